@@ -3,12 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -21,6 +23,10 @@ import (
 	"github.com/ammar1510/converse/internal/api"
 	"github.com/ammar1510/converse/internal/auth"
 	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
+	"github.com/ammar1510/converse/internal/mail"
+	"github.com/ammar1510/converse/internal/models"
+	"github.com/ammar1510/converse/internal/throttle"
 	internalWs "github.com/ammar1510/converse/internal/websocket"
 )
 
@@ -46,67 +52,64 @@ func main() {
 		log.Println("Warning: .env file not found, using environment variables")
 	}
 
+	// "migrate" manages the database schema instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
 	// Set Gin mode based on environment
 	env := os.Getenv("ENV")
 	if env == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	// Initialize JWT key from environment variable
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is required")
-	}
-	auth.InitJWTKey([]byte(jwtSecret))
-
-	// Determine database type from environment (default to PostgreSQL)
-	dbTypeStr := os.Getenv("DB_TYPE")
-	if dbTypeStr == "" {
-		dbTypeStr = "postgres" // Default to PostgreSQL
+	// Initialize JWT keys from environment variables
+	if err := loadJWTKeys(); err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
 	}
 
-	dbType := database.DatabaseType(dbTypeStr)
-
-	// Get connection string
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		// Fallback to individual connection parameters if DATABASE_URL not set
-		dbHost := os.Getenv("DB_HOST")
-		dbPort := os.Getenv("DB_PORT")
-		dbName := os.Getenv("DB_NAME")
-		dbUser := os.Getenv("DB_USER")
-		dbPass := os.Getenv("DB_PASSWORD")
-
-		if dbHost == "" || dbName == "" || dbUser == "" {
-			log.Fatal("Database connection details missing. Set DATABASE_URL or individual DB_* variables")
-		}
-
-		// Build connection string based on database type
-		switch dbType {
-		case database.PostgreSQL:
-			dbURL = fmt.Sprintf(
-				"postgres://%s:%s@%s:%s/%s?sslmode=disable",
-				dbUser, dbPass, dbHost, dbPort, dbName,
-			)
-		case database.MySQL:
-			dbURL = fmt.Sprintf(
-				"mysql://%s:%s@tcp(%s:%s)/%s",
-				dbUser, dbPass, dbHost, dbPort, dbName,
-			)
-		}
+	if err := configurePasswordHashing(); err != nil {
+		log.Fatalf("Invalid password hashing configuration: %v", err)
 	}
 
 	// Create database connection using factory
-	db, err := database.NewDatabase(dbType, dbURL)
+	db, dbType, err := openDatabase()
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
 	log.Printf("Connected to %s database successfully", dbType)
 
+	// Bring the schema up to date before serving when asked to. An embedded
+	// SQLite database has no separate deploy step, so it is always migrated.
+	if os.Getenv("MIGRATE_ON_STARTUP") == "true" || dbType == database.SQLite {
+		applied, err := database.MigrateUp(context.Background(), db)
+		switch {
+		case err == database.ErrMigrationsNotSupported:
+			log.Printf("Skipping migrations: %s database has no schema", dbType)
+		case err != nil:
+			log.Fatalf("Failed to migrate database: %v", err)
+		default:
+			log.Printf("Applied %d migration(s)", len(applied))
+		}
+	}
+
+	if err := promoteAdmins(db); err != nil {
+		log.Fatalf("Failed to promote admins: %v", err)
+	}
+
 	// Initialize router with default middleware (logger and recovery)
 	router := gin.Default()
 
+	// Only take the client address from X-Forwarded-For when the request
+	// came through one of TRUSTED_PROXIES; login throttling relies on it
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Configure CORS using environment variable
 	allowedOriginsStr := os.Getenv("ALLOWED_ORIGINS")
 	allowedOrigins := strings.Split(allowedOriginsStr, ",")
@@ -120,41 +123,114 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// The handlers publish what happens on the bus; the WebSocket manager
+	// delivers it to connected clients
+	bus := events.NewBus()
+
 	// Create API handlers
-	authHandler := api.NewAuthHandler(db)
-	messageHandler := api.NewMessageHandler(db)
+	authHandler := api.NewAuthHandler(db, bus)
+	authHandler.Mailer, err = openMailer()
+	if err != nil {
+		log.Fatalf("Failed to configure mail: %v", err)
+	}
+	if appURL := os.Getenv("APP_URL"); appURL != "" {
+		authHandler.AppURL = appURL
+	}
+	// Failed logins are counted in the database so every server sees them;
+	// LOGIN_THROTTLE_STORE=memory keeps them per process instead
+	if os.Getenv("LOGIN_THROTTLE_STORE") == "memory" {
+		authHandler.Limiter = throttle.NewLimiter(throttle.NewMemoryStore())
+	}
+	messageHandler := api.NewMessageHandler(db, bus)
+	adminHandler := api.NewAdminHandler(db, bus)
 
 	// Initialize WebSocket manager
-	wsManager := internalWs.NewManager()
-	go wsManager.Run()
+	backplane, err := openBackplane(db)
+	if err != nil {
+		log.Fatalf("Failed to start WebSocket backplane: %v", err)
+	}
+	defer backplane.Close()
+	wsManager := internalWs.NewManagerWithBackplane(db, backplane, bus)
+	// EVENT_RETENTION (such as 72h) is how long events are kept for
+	// WebSocket clients that reconnect
+	if raw := os.Getenv("EVENT_RETENTION"); raw != "" {
+		retention, err := time.ParseDuration(raw)
+		if err != nil || retention <= 0 {
+			log.Fatalf("EVENT_RETENTION must be a positive duration, such as 72h")
+		}
+		wsManager.EventRetention = retention
+	}
 
-	// Set the WebSocket manager in the messages package
-	api.WSManager = wsManager
+	authHandler.Connections = wsManager
+	adminHandler.Connections = wsManager
+	go wsManager.Run()
 
 	// Set up API routes
 	// Public routes (no authentication required)
 	router.POST("/api/auth/register", authHandler.Register)
 	router.POST("/api/auth/login", authHandler.Login)
+	router.POST("/api/auth/login/2fa", authHandler.VerifyTwoFactor)
+	router.POST("/api/auth/refresh", authHandler.Refresh)
+	router.POST("/api/auth/logout", authHandler.Logout)
+	router.POST("/api/auth/verify-email", authHandler.VerifyEmail)
+	router.POST("/api/auth/password/forgot", authHandler.ForgotPassword)
+	router.POST("/api/auth/password/reset", authHandler.ResetPassword)
 
 	// Protected routes (authentication required)
 	authorized := router.Group("/api")
-	authorized.Use(api.AuthMiddleware())
+	authorized.Use(api.AuthMiddleware(db))
 	{
 		authorized.GET("/auth/me", authHandler.GetMe)
+		authorized.PATCH("/auth/me", authHandler.UpdateMe)
+		authorized.POST("/auth/me/password", authHandler.ChangePassword)
+		authorized.POST("/auth/me/email", authHandler.ChangeEmail)
+		authorized.GET("/me/export", authHandler.ExportData)
+		authorized.DELETE("/me", authHandler.DeleteAccount)
+		authorized.POST("/auth/verify-email/resend", authHandler.ResendVerification)
+		authorized.GET("/auth/2fa", authHandler.GetTwoFactor)
+		authorized.POST("/auth/2fa/enroll", authHandler.EnrollTwoFactor)
+		authorized.POST("/auth/2fa/confirm", authHandler.ConfirmTwoFactor)
+		authorized.POST("/auth/2fa/disable", authHandler.DisableTwoFactor)
 		authorized.GET("/users", authHandler.GetAllUsers)
+		authorized.GET("/sessions", authHandler.GetSessions)
+		authorized.DELETE("/sessions/:id", authHandler.RevokeSession)
+		authorized.GET("/presence", authHandler.GetPresence)
 
 		// Message routes
 		authorized.POST("/messages", messageHandler.SendMessage)
 		authorized.GET("/messages", messageHandler.GetMessages)
+		authorized.GET("/messages/search", messageHandler.SearchMessages)
 		authorized.GET("/messages/conversation/:userID", messageHandler.GetConversation)
 		authorized.PUT("/messages/:messageID/read", messageHandler.MarkMessageAsRead)
+		authorized.GET("/conversations", messageHandler.GetConversations)
+
+		// Group routes
+		authorized.POST("/groups", messageHandler.CreateGroup)
+		authorized.GET("/groups", messageHandler.GetGroups)
+		authorized.GET("/groups/:groupID", messageHandler.GetGroup)
+		authorized.PATCH("/groups/:groupID", messageHandler.RenameGroup)
+		authorized.POST("/groups/:groupID/leave", messageHandler.LeaveGroup)
+		authorized.GET("/groups/:groupID/messages", messageHandler.GetGroupMessages)
 
 		// More protected routes can be added here
 	}
 
+	// Admin routes (admin role required)
+	admin := router.Group("/api/admin")
+	admin.Use(api.AuthMiddleware(db), api.RequireRole(models.RoleAdmin))
+	{
+		admin.GET("/users", adminHandler.ListUsers)
+		admin.GET("/users/:userID", adminHandler.GetUser)
+		admin.PUT("/users/:userID/role", adminHandler.SetRole)
+		admin.POST("/users/:userID/suspend", adminHandler.Suspend)
+		admin.POST("/users/:userID/unsuspend", adminHandler.Unsuspend)
+		admin.POST("/users/:userID/logout", adminHandler.Logout)
+		admin.GET("/stats", adminHandler.Stats)
+	}
+
 	// WebSocket route with TokenAuthMiddleware for accepting tokens in URL parameters
 	wsRoute := router.Group("/api")
-	wsRoute.Use(api.TokenAuthMiddleware())
+	wsRoute.Use(api.TokenAuthMiddleware(db))
 	{
 		wsRoute.GET("/ws", func(c *gin.Context) {
 			remoteAddr := c.Request.RemoteAddr
@@ -165,6 +241,9 @@ func main() {
 		})
 	}
 
+	// Public keys for other services to verify our tokens
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+
 	// Add health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
@@ -296,6 +375,17 @@ func main() {
 		}
 	}()
 
+	// SIGHUP reloads the JWT keys, for rotation without a restart
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := loadJWTKeys(); err != nil {
+				log.Printf("Failed to reload JWT keys, keeping the current ones: %v", err)
+			}
+		}
+	}()
+
 	// Wait for interrupt signal to gracefully shut down the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -311,3 +401,242 @@ func main() {
 
 	log.Println("Server exited properly")
 }
+
+// openDatabase connects to the database configured by DB_TYPE and either
+// DATABASE_URL, DB_PATH (SQLite) or the individual DB_* variables
+func openDatabase() (database.DBInterface, database.DatabaseType, error) {
+	// Determine database type from environment (default to PostgreSQL)
+	dbTypeStr := os.Getenv("DB_TYPE")
+	if dbTypeStr == "" {
+		dbTypeStr = "postgres" // Default to PostgreSQL
+	}
+
+	dbType := database.DatabaseType(dbTypeStr)
+
+	// Get connection string
+	dbURL := os.Getenv("DATABASE_URL")
+	switch {
+	case dbURL != "" || dbType == database.Memory:
+		// Use DATABASE_URL as given; the in-memory database needs nothing
+	case dbType == database.SQLite:
+		// SQLite only needs a file path
+		dbURL = os.Getenv("DB_PATH")
+		if dbURL == "" {
+			dbURL = "converse.db"
+		}
+	default:
+		// Fallback to individual connection parameters if DATABASE_URL not set
+		dbHost := os.Getenv("DB_HOST")
+		dbPort := os.Getenv("DB_PORT")
+		dbName := os.Getenv("DB_NAME")
+		dbUser := os.Getenv("DB_USER")
+		dbPass := os.Getenv("DB_PASSWORD")
+
+		if dbHost == "" || dbName == "" || dbUser == "" {
+			return nil, dbType, errors.New("database connection details missing. Set DATABASE_URL or individual DB_* variables")
+		}
+
+		// Build connection string based on database type
+		switch dbType {
+		case database.PostgreSQL:
+			dbURL = fmt.Sprintf(
+				"postgres://%s:%s@%s:%s/%s?sslmode=disable",
+				dbUser, dbPass, dbHost, dbPort, dbName,
+			)
+		case database.MySQL:
+			dbURL = fmt.Sprintf(
+				"mysql://%s:%s@tcp(%s:%s)/%s",
+				dbUser, dbPass, dbHost, dbPort, dbName,
+			)
+		}
+	}
+
+	// Create database connection using factory
+	db, err := database.NewDatabase(dbType, dbURL)
+	return db, dbType, err
+}
+
+// openBackplane returns what WebSocket frames travel between instances on.
+// BACKPLANE=postgres shares them through the Postgres database, so several
+// instances can run behind a load balancer; the default, local, keeps them
+// in this process.
+func openBackplane(db database.DBInterface) (internalWs.Backplane, error) {
+	switch backplane := os.Getenv("BACKPLANE"); backplane {
+	case "", "local":
+		return internalWs.NewLocalBackplane(), nil
+	case "postgres":
+		pg, ok := db.(*database.PostgresDB)
+		if !ok {
+			return nil, errors.New("BACKPLANE=postgres needs a PostgreSQL database")
+		}
+		return internalWs.NewPostgresBackplane(pg)
+	default:
+		return nil, fmt.Errorf("unknown BACKPLANE %q, use local or postgres", backplane)
+	}
+}
+
+// loadJWTKeys configures token signing. JWT_SIGNING_KEY is a PEM file with
+// the RSA or Ed25519 private key new tokens are signed with, and
+// JWT_VERIFICATION_KEYS a comma separated list of PEM files whose tokens are
+// accepted too; listed files that don't exist are skipped so rotation can be
+// done by moving files around. Without a signing key, tokens are signed with
+// the JWT_SECRET HMAC secret, which otherwise only verifies tokens issued
+// before switching to keys.
+func loadJWTKeys() error {
+	secret := os.Getenv("JWT_SECRET")
+
+	signingPath := os.Getenv("JWT_SIGNING_KEY")
+	if signingPath == "" {
+		if secret == "" {
+			return errors.New("JWT_SIGNING_KEY or JWT_SECRET environment variable is required")
+		}
+		auth.InitJWTKey([]byte(secret))
+		log.Println("Signing tokens with JWT_SECRET (HS256)")
+		return nil
+	}
+
+	signing, err := auth.LoadKeyFile(signingPath)
+	if err != nil {
+		return err
+	}
+
+	var verify []*auth.Key
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFICATION_KEYS"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		key, err := auth.LoadKeyFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("Skipping missing JWT verification key %s", path)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		verify = append(verify, key)
+	}
+
+	if secret != "" {
+		verify = append(verify, auth.NewHMACKey([]byte(secret)))
+	}
+
+	if err := auth.InitKeys(signing, verify...); err != nil {
+		return err
+	}
+
+	log.Printf("Signing tokens with key %s (%s), accepting %d other key(s)", signing.ID, signing.Method.Alg(), len(verify))
+	return nil
+}
+
+// configurePasswordHashing sets the argon2id parameters new password hashes
+// are made with from ARGON2_MEMORY (KiB), ARGON2_TIME and ARGON2_THREADS.
+// Stored hashes with other parameters, and bcrypt hashes, are upgraded as
+// users log in.
+func configurePasswordHashing() error {
+	params := auth.DefaultArgon2idParams
+
+	settings := []struct {
+		name  string
+		value *uint32
+	}{
+		{"ARGON2_MEMORY", &params.Memory},
+		{"ARGON2_TIME", &params.Time},
+	}
+	for _, setting := range settings {
+		if raw := os.Getenv(setting.name); raw != "" {
+			n, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil || n == 0 {
+				return fmt.Errorf("%s must be a positive integer", setting.name)
+			}
+			*setting.value = uint32(n)
+		}
+	}
+
+	if raw := os.Getenv("ARGON2_THREADS"); raw != "" {
+		n, err := strconv.ParseUint(raw, 10, 8)
+		if err != nil || n == 0 {
+			return errors.New("ARGON2_THREADS must be between 1 and 255")
+		}
+		params.Threads = uint8(n)
+	}
+
+	auth.InitPasswordHasher(auth.NewPasswordHasher(auth.Argon2idScheme{Params: params}, auth.BcryptScheme{Cost: 12}))
+	log.Printf("Hashing passwords with argon2id (m=%d KiB, t=%d, p=%d)", params.Memory, params.Time, params.Threads)
+	return nil
+}
+
+// promoteAdmins gives the accounts listed in ADMIN_EMAILS (comma separated)
+// the admin role, so a deployment has someone to manage the others. Admins
+// can promote more users from the admin API.
+func promoteAdmins(db database.DBInterface) error {
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+
+		user, err := db.GetUserByEmail(email)
+		if err == database.ErrUserNotFound {
+			log.Printf("Warning: admin %s has not registered yet", email)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if user.Role == models.RoleAdmin {
+			continue
+		}
+
+		if err := db.SetUserRole(user.ID, models.RoleAdmin); err != nil {
+			return err
+		}
+		log.Printf("Gave %s the admin role", email)
+	}
+	return nil
+}
+
+// trustedProxies returns the addresses or CIDR ranges listed in
+// TRUSTED_PROXIES (comma separated). It is nil when none are set, so no proxy
+// is trusted and X-Forwarded-For is ignored.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// openMailer creates the mail sender configured by MAIL_DRIVER: "smtp" uses
+// the SMTP_* variables, "file" appends to MAIL_FILE and anything else logs
+// emails instead of sending them
+func openMailer() (mail.Sender, error) {
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		sender := &mail.SMTPSender{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+		if sender.Host == "" || sender.From == "" {
+			return nil, errors.New("SMTP_HOST and MAIL_FROM are required for MAIL_DRIVER=smtp")
+		}
+		if sender.Port == "" {
+			sender.Port = "587"
+		}
+		return sender, nil
+	case "file":
+		path := os.Getenv("MAIL_FILE")
+		if path == "" {
+			path = "mail.log"
+		}
+		return mail.NewFileSender(path)
+	default:
+		return mail.LogSender{}, nil
+	}
+}
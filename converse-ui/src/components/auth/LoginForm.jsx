@@ -11,8 +11,10 @@ const LoginForm = () => {
   const [password, setPassword] = useState('');
   const [formError, setFormError] = useState('');
   const [isSubmitting, setIsSubmitting] = useState(false);
+  const [challengeToken, setChallengeToken] = useState('');
+  const [code, setCode] = useState('');
   
-  const { login, error } = useAuth();
+  const { login, completeTwoFactorLogin, error } = useAuth();
   const navigate = useNavigate();
 
   /**
@@ -31,7 +33,11 @@ const LoginForm = () => {
     setIsSubmitting(true);
     
     try {
-      await login(email, password);
+      const result = await login(email, password);
+      if (result.twoFactorRequired) {
+        setChallengeToken(result.challengeToken);
+        return;
+      }
       // Redirect to chat page on successful login
       navigate('/chat');
     } catch (err) {
@@ -41,6 +47,71 @@ const LoginForm = () => {
     }
   };
 
+  /**
+   * Handle two-factor code submission
+   */
+  const handleCodeSubmit = async (e) => {
+    e.preventDefault();
+
+    setFormError('');
+    setIsSubmitting(true);
+
+    try {
+      await completeTwoFactorLogin(challengeToken, code.trim());
+      navigate('/chat');
+    } catch (err) {
+      setFormError(err.error || 'Verification failed. Please try again.');
+    } finally {
+      setIsSubmitting(false);
+    }
+  };
+
+  if (challengeToken) {
+    return (
+      <div className="auth-form-container">
+        <h2>Two-Factor Authentication</h2>
+
+        {(formError || error) && (
+          <div className="auth-error">
+            {formError || error}
+          </div>
+        )}
+
+        <form className="auth-form" onSubmit={handleCodeSubmit}>
+          <div className="form-group">
+            <label htmlFor="code">Authentication Code</label>
+            <input
+              type="text"
+              id="code"
+              placeholder="Code from your app or a recovery code"
+              autoComplete="one-time-code"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              disabled={isSubmitting}
+              required
+            />
+          </div>
+
+          <button
+            type="submit"
+            className="auth-button"
+            disabled={isSubmitting}
+          >
+            {isSubmitting ? 'VERIFYING...' : 'VERIFY'}
+          </button>
+        </form>
+
+        <div className="auth-links">
+          <p>
+            <a href="#" onClick={(e) => { e.preventDefault(); setChallengeToken(''); setCode(''); }}>
+              Back to Login
+            </a>
+          </p>
+        </div>
+      </div>
+    );
+  }
+
   return (
     <div className="auth-form-container">
       <h2>Welcome Back</h2>
@@ -88,6 +159,9 @@ const LoginForm = () => {
       </form>
       
       <div className="auth-links">
+        <p>
+          <Link to="/forgot-password">Forgot your password?</Link>
+        </p>
         <p>
           Don't have an account? <Link to="/register">Register Here</Link>
         </p>
@@ -5,6 +5,7 @@ export const API_URL = import.meta.env.VITE_API_URL || 'http://localhost:8080/ap
 
 // Auth token settings
 export const AUTH_TOKEN_KEY = 'converse_auth_token';
+export const REFRESH_TOKEN_KEY = 'converse_refresh_token';
 export const USER_DATA_KEY = 'converse_user_data';
 
 // WebSocket settings
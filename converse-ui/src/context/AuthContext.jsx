@@ -1,5 +1,5 @@
 import { createContext, useState, useEffect, useContext } from 'react';
-import { isTokenValid, getUserData, clearAuthData } from '../utils/tokenStorage';
+import { isTokenValid, getRefreshToken, getUserData, clearAuthData } from '../utils/tokenStorage';
 import * as authService from '../services/authService';
 import websocketService from '../services/websocketService';
 import messageService from '../services/messageService';
@@ -20,7 +20,8 @@ export const AuthProvider = ({ children }) => {
   useEffect(() => {
     const initAuth = async () => {
       try {
-        if (isTokenValid()) {
+        // An expired access token is renewed on the first request
+        if (isTokenValid() || getRefreshToken()) {
           // Get user from local storage
           const userData = getUserData();
           if (userData) {
@@ -69,13 +70,18 @@ export const AuthProvider = ({ children }) => {
       websocketService.reset();
       
       // Now perform the login
-      const { user } = await authService.login({ email, password });
+      const result = await authService.login({ email, password });
+
+      // The caller asks for a code and finishes with completeTwoFactorLogin
+      if (result.twoFactorRequired) {
+        return result;
+      }
       
       // Update state after successful login
-      setUser(user);
+      setUser(result.user);
       setIsAuthenticated(true);
       
-      return user;
+      return result;
     } catch (err) {
       setError(err.error || 'Login failed. Please check your credentials.');
       throw err;
@@ -84,6 +90,28 @@ export const AuthProvider = ({ children }) => {
     }
   };
 
+  /**
+   * Finish a login that needs a two-factor code
+   */
+  const completeTwoFactorLogin = async (challengeToken, code) => {
+    setLoading(true);
+    setError(null);
+
+    try {
+      const { user } = await authService.verifyTwoFactor(challengeToken, code);
+
+      setUser(user);
+      setIsAuthenticated(true);
+
+      return user;
+    } catch (err) {
+      setError(err.error || 'Verification failed. Please try again.');
+      throw err;
+    } finally {
+      setLoading(false);
+    }
+  };
+
   /**
    * Register a new user
    */
@@ -136,6 +164,7 @@ export const AuthProvider = ({ children }) => {
     loading,
     error,
     login,
+    completeTwoFactorLogin,
     register,
     logout
   };
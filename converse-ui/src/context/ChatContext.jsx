@@ -118,22 +118,10 @@ export const ChatProvider = ({ children }) => {
       setLoading(true);
       setError(null);
       
-      const messagesData = await messageService.getMessages();
-      const processedConversations = messageService.processConversations(messagesData, user.id);
+      // Messages themselves are loaded per conversation when it is opened
+      const conversationsData = await messageService.getConversations();
       
-      setConversations(processedConversations);
-      
-      // Organize messages by conversation
-      const messagesByConversation = {};
-      processedConversations.forEach(convo => {
-        // Sort messages by timestamp (oldest first)
-        const sortedMessages = [...convo.messages].sort(
-          (a, b) => new Date(a.created_at) - new Date(b.created_at)
-        );
-        messagesByConversation[convo.id] = sortedMessages;
-      });
-      
-      setMessages(messagesByConversation);
+      setConversations(conversationsData);
     } catch (err) {
       console.error('Error fetching conversations:', err);
       setError('Failed to load conversations');
@@ -277,14 +265,27 @@ export const ChatProvider = ({ children }) => {
     
     const handleMessage = (data) => {
       console.log('Received message in chat context:', data);
+      if (data.type !== 'message') return;
+      
+      // WebSocket frames carry the stored message ID as message_id; the same
+      // message may arrive more than once when echoed to our other devices
+      const message = {
+        id: data.message_id,
+        sender_id: data.sender_id,
+        receiver_id: data.receiver_id,
+        content: data.content,
+        created_at: data.timestamp,
+        is_read: false
+      };
+      
       // Add new message to state
       setMessages(prev => {
-        const conversationId = data.sender_id === user?.id ? data.receiver_id : data.sender_id;
+        const conversationId = message.sender_id === user?.id ? message.receiver_id : message.sender_id;
         const conversationMessages = [...(prev[conversationId] || [])];
         
         // Check if message already exists to avoid duplicates
-        if (!conversationMessages.some(msg => msg.id === data.id)) {
-          conversationMessages.push(data);
+        if (!conversationMessages.some(msg => msg.id === message.id)) {
+          conversationMessages.push(message);
           // Sort messages by timestamp (oldest first)
           conversationMessages.sort((a, b) => new Date(a.created_at) - new Date(b.created_at));
         }
@@ -296,7 +297,7 @@ export const ChatProvider = ({ children }) => {
       });
       
       // Update conversations list
-      updateConversationWithMessage(data);
+      updateConversationWithMessage(message);
     };
     
     const handleTyping = (data) => {
@@ -359,12 +360,10 @@ export const ChatProvider = ({ children }) => {
     try {
       setError(null);
       
-      // Send via REST API for persistence
+      // Send via REST API; the server stores the message and notifies
+      // the receiver over WebSocket
       const newMessage = await messageService.sendMessage(receiverId, content);
       
-      // Also try to send via WebSocket for real-time
-      websocketService.sendMessage(receiverId, content);
-      
       // Update local state
       setMessages(prev => {
         const conversationMessages = [...(prev[receiverId] || []), newMessage];
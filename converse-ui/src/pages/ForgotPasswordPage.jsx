@@ -0,0 +1,84 @@
+import { useState } from 'react';
+import { Link } from 'react-router-dom';
+import { requestPasswordReset } from '../services/authService';
+
+/**
+ * ForgotPasswordPage component
+ * Asks for a password reset link by email
+ */
+const ForgotPasswordPage = () => {
+  const [email, setEmail] = useState('');
+  const [formError, setFormError] = useState('');
+  const [isSubmitting, setIsSubmitting] = useState(false);
+  const [sent, setSent] = useState(false);
+
+  /**
+   * Handle form submission
+   */
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+
+    setFormError('');
+    setIsSubmitting(true);
+
+    try {
+      await requestPasswordReset(email);
+      setSent(true);
+    } catch (err) {
+      setFormError(err.error || 'Failed to request a password reset.');
+    } finally {
+      setIsSubmitting(false);
+    }
+  };
+
+  return (
+    <div className="auth-page">
+      <div className="auth-container">
+        <div className="auth-form-container">
+          <h2>Forgot Password</h2>
+
+          {sent ? (
+            <div className="auth-success">
+              If an account exists for that email, a reset link is on its way.
+            </div>
+          ) : (
+            <>
+              {formError && <div className="auth-error">{formError}</div>}
+
+              <form className="auth-form" onSubmit={handleSubmit}>
+                <div className="form-group">
+                  <label htmlFor="email">Email</label>
+                  <input
+                    type="email"
+                    id="email"
+                    placeholder="Enter your email"
+                    value={email}
+                    onChange={(e) => setEmail(e.target.value)}
+                    disabled={isSubmitting}
+                    required
+                  />
+                </div>
+
+                <button
+                  type="submit"
+                  className="auth-button"
+                  disabled={isSubmitting}
+                >
+                  {isSubmitting ? 'SENDING...' : 'SEND RESET LINK'}
+                </button>
+              </form>
+            </>
+          )}
+
+          <div className="auth-links">
+            <p>
+              <Link to="/login">Back to Login</Link>
+            </p>
+          </div>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default ForgotPasswordPage;
@@ -0,0 +1,115 @@
+import { useState } from 'react';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+import { resetPassword } from '../services/authService';
+
+/**
+ * ResetPasswordPage component
+ * Sets a new password from the link in a reset email
+ */
+const ResetPasswordPage = () => {
+  const [searchParams] = useSearchParams();
+  const [password, setPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [formError, setFormError] = useState('');
+  const [isSubmitting, setIsSubmitting] = useState(false);
+  const [success, setSuccess] = useState(false);
+
+  const navigate = useNavigate();
+
+  /**
+   * Handle form submission
+   */
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+
+    if (password.length < 6) {
+      setFormError('Password must be at least 6 characters');
+      return;
+    }
+    if (password !== confirmPassword) {
+      setFormError('Passwords do not match');
+      return;
+    }
+
+    setFormError('');
+    setIsSubmitting(true);
+
+    try {
+      await resetPassword(searchParams.get('token') || '', password);
+      setSuccess(true);
+
+      // Redirect to login page after a short delay
+      setTimeout(() => {
+        navigate('/login');
+      }, 2000);
+    } catch (err) {
+      setFormError(err.error || 'Password reset failed.');
+    } finally {
+      setIsSubmitting(false);
+    }
+  };
+
+  return (
+    <div className="auth-page">
+      <div className="auth-container">
+        <div className="auth-form-container">
+          <h2>Choose a New Password</h2>
+
+          {success ? (
+            <div className="auth-success">
+              Your password has been reset. Redirecting to login...
+            </div>
+          ) : (
+            <>
+              {formError && <div className="auth-error">{formError}</div>}
+
+              <form className="auth-form" onSubmit={handleSubmit}>
+                <div className="form-group">
+                  <label htmlFor="password">New Password</label>
+                  <input
+                    type="password"
+                    id="password"
+                    placeholder="Enter a new password"
+                    value={password}
+                    onChange={(e) => setPassword(e.target.value)}
+                    disabled={isSubmitting}
+                    required
+                  />
+                </div>
+
+                <div className="form-group">
+                  <label htmlFor="confirmPassword">Confirm Password</label>
+                  <input
+                    type="password"
+                    id="confirmPassword"
+                    placeholder="Confirm your new password"
+                    value={confirmPassword}
+                    onChange={(e) => setConfirmPassword(e.target.value)}
+                    disabled={isSubmitting}
+                    required
+                  />
+                </div>
+
+                <button
+                  type="submit"
+                  className="auth-button"
+                  disabled={isSubmitting}
+                >
+                  {isSubmitting ? 'RESETTING...' : 'RESET PASSWORD'}
+                </button>
+              </form>
+            </>
+          )}
+
+          <div className="auth-links">
+            <p>
+              <Link to="/login">Back to Login</Link>
+            </p>
+          </div>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default ResetPasswordPage;
@@ -0,0 +1,53 @@
+import { useEffect, useRef, useState } from 'react';
+import { Link, useSearchParams } from 'react-router-dom';
+import { verifyEmail } from '../services/authService';
+
+/**
+ * VerifyEmailPage component
+ * Confirms the email address from the link in a verification email
+ */
+const VerifyEmailPage = () => {
+  const [searchParams] = useSearchParams();
+  const [status, setStatus] = useState('verifying');
+  const [error, setError] = useState('');
+  const submitted = useRef(false);
+
+  useEffect(() => {
+    // Tokens are single use; don't submit twice in strict mode
+    if (submitted.current) {
+      return;
+    }
+    submitted.current = true;
+
+    verifyEmail(searchParams.get('token') || '')
+      .then(() => setStatus('verified'))
+      .catch((err) => {
+        setError(err.error || 'Email verification failed.');
+        setStatus('failed');
+      });
+  }, [searchParams]);
+
+  return (
+    <div className="auth-page">
+      <div className="auth-container">
+        <div className="auth-form-container">
+          <h2>Email Verification</h2>
+
+          {status === 'verifying' && <p>Verifying your email...</p>}
+          {status === 'verified' && (
+            <div className="auth-success">Your email has been verified.</div>
+          )}
+          {status === 'failed' && <div className="auth-error">{error}</div>}
+
+          <div className="auth-links">
+            <p>
+              <Link to="/login">Back to Login</Link>
+            </p>
+          </div>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default VerifyEmailPage;
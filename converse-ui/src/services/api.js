@@ -1,6 +1,12 @@
 import axios from 'axios';
 import { API_URL } from '../config';
-import { getToken, clearAuthData } from '../utils/tokenStorage';
+import {
+  getToken,
+  saveToken,
+  getRefreshToken,
+  saveRefreshToken,
+  clearAuthData,
+} from '../utils/tokenStorage';
 
 // Create axios instance with default config
 const api = axios.create({
@@ -10,6 +16,31 @@ const api = axios.create({
   },
 });
 
+// The refresh in flight, shared by every request that fails while it runs
+let refreshPromise = null;
+
+/**
+ * Exchange the stored refresh token for a new access token and refresh token.
+ * Uses plain axios so a failed refresh doesn't go through the interceptors.
+ * @returns {Promise<string>} Promise with the new access token
+ */
+export const refreshAccessToken = () => {
+  if (!refreshPromise) {
+    const refreshToken = getRefreshToken();
+    refreshPromise = (refreshToken
+      ? axios.post(`${API_URL}/auth/refresh`, { refresh_token: refreshToken }).then((response) => {
+          saveToken(response.data.token);
+          saveRefreshToken(response.data.refresh_token);
+          return response.data.token;
+        })
+      : Promise.reject(new Error('No refresh token'))
+    ).finally(() => {
+      refreshPromise = null;
+    });
+  }
+  return refreshPromise;
+};
+
 // Add request interceptor to include auth token in requests
 api.interceptors.request.use(
   (config) => {
@@ -29,9 +60,22 @@ api.interceptors.response.use(
   (response) => {
     return response;
   },
-  (error) => {
+  async (error) => {
     // Handle 401 Unauthorized errors (expired token, etc.)
     if (error.response && error.response.status === 401) {
+      // Renew an expired access token once and retry the request
+      const original = error.config;
+      if (original && !original._retried && getRefreshToken()) {
+        original._retried = true;
+        try {
+          const token = await refreshAccessToken();
+          original.headers.Authorization = `Bearer ${token}`;
+          return api(original);
+        } catch (refreshError) {
+          // The session is gone; log out below
+        }
+      }
+
       clearAuthData();
       // Redirect to login if needed
       if (window.location.pathname !== '/login') {
@@ -1,5 +1,11 @@
 import api from './api';
-import { saveToken, saveUserData, clearAuthData } from '../utils/tokenStorage';
+import {
+  saveToken,
+  saveRefreshToken,
+  getRefreshToken,
+  saveUserData,
+  clearAuthData,
+} from '../utils/tokenStorage';
 
 /**
  * Register a new user
@@ -30,13 +36,13 @@ export const register = async (userData) => {
 export const login = async (credentials) => {
   try {
     const response = await api.post('/auth/login', credentials);
-    const { token, user } = response.data;
-    
-    // Save token and user data to local storage
-    saveToken(token);
-    saveUserData(user);
-    
-    return { token, user };
+
+    // Accounts with two-factor authentication need a code before tokens are issued
+    if (response.data.two_factor_required) {
+      return { twoFactorRequired: true, challengeToken: response.data.challenge_token };
+    }
+
+    return saveLogin(response.data);
   } catch (error) {
     throw error.response?.data || {
       error: 'Login failed. Please check your credentials.'
@@ -45,12 +51,95 @@ export const login = async (credentials) => {
 };
 
 /**
- * Logout the current user
+ * Complete a two-factor login with a code from the authenticator app or a recovery code
+ * @param {string} challengeToken - Challenge token from the password step
+ * @param {string} code - Authenticator or recovery code
+ * @returns {Promise} Promise with login response including token and user data
+ */
+export const verifyTwoFactor = async (challengeToken, code) => {
+  try {
+    const response = await api.post('/auth/login/2fa', { challenge_token: challengeToken, code });
+    return saveLogin(response.data);
+  } catch (error) {
+    throw error.response?.data || {
+      error: 'Verification failed. Please try again.'
+    };
+  }
+};
+
+/**
+ * Save the tokens and user data from a login response
+ */
+const saveLogin = ({ token, refresh_token: refreshToken, user }) => {
+  // Save tokens and user data to local storage
+  saveToken(token);
+  saveRefreshToken(refreshToken);
+  saveUserData(user);
+
+  return { token, user };
+};
+
+/**
+ * Logout the current user, revoking the session's refresh token
  */
 export const logout = () => {
+  const refreshToken = getRefreshToken();
+  if (refreshToken) {
+    // Local data is cleared whether or not the server is reachable
+    api.post('/auth/logout', { refresh_token: refreshToken }).catch(() => {});
+  }
   clearAuthData();
 };
 
+/**
+ * Confirm an email address with the token from a verification email
+ * @param {string} token - Token from the verification link
+ * @returns {Promise} Promise with the server response
+ */
+export const verifyEmail = async (token) => {
+  try {
+    const response = await api.post('/auth/verify-email', { token });
+    return response.data;
+  } catch (error) {
+    throw error.response?.data || {
+      error: 'Email verification failed.'
+    };
+  }
+};
+
+/**
+ * Ask for a password reset link
+ * @param {string} email - Email of the account
+ * @returns {Promise} Promise with the server response
+ */
+export const requestPasswordReset = async (email) => {
+  try {
+    const response = await api.post('/auth/password/forgot', { email });
+    return response.data;
+  } catch (error) {
+    throw error.response?.data || {
+      error: 'Failed to request a password reset.'
+    };
+  }
+};
+
+/**
+ * Set a new password with the token from a reset email
+ * @param {string} token - Token from the reset link
+ * @param {string} password - New password
+ * @returns {Promise} Promise with the server response
+ */
+export const resetPassword = async (token, password) => {
+  try {
+    const response = await api.post('/auth/password/reset', { token, password });
+    return response.data;
+  } catch (error) {
+    throw error.response?.data || {
+      error: 'Password reset failed.'
+    };
+  }
+};
+
 /**
  * Get the current user profile
  * @returns {Promise} Promise with user profile data
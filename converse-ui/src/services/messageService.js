@@ -76,14 +76,31 @@ export const messageService = {
       return cachedMessages;
     }
     
-    const response = await api.get('/messages');
+    const response = await api.get('/messages', { params: { limit: 100 } });
     
     // Cache the response
-    messagesCache.set('all_messages', response.data);
+    messagesCache.set('all_messages', response.data.messages);
     
-    return response.data;
+    return response.data.messages;
   },
   
+  /**
+   * Get the current user's conversations, most recent first
+   * @returns {Promise} Promise with conversations in the shape used by the sidebar
+   */
+  getConversations: async () => {
+    const response = await api.get('/conversations', { params: { limit: 100 } });
+    
+    return response.data.conversations.map(convo => ({
+      id: convo.user.id,
+      user: convo.user,
+      messages: [],
+      lastMessage: convo.last_message,
+      lastMessageTime: convo.last_message_at,
+      unreadCount: convo.unread_count
+    }));
+  },
+
   /**
    * Get conversation between current user and another user
    * @param {string} otherUserId - UUID of the other user
@@ -104,12 +121,13 @@ export const messageService = {
       return cachedConversation;
     }
     
+    // The latest page of the conversation
     const response = await api.get(`/messages/conversation/${otherUserId}`);
     
     // Cache the response
-    messagesCache.set(cacheKey, response.data);
+    messagesCache.set(cacheKey, response.data.messages);
     
-    return response.data;
+    return response.data.messages;
   },
   
   /**
@@ -153,53 +171,6 @@ export const messageService = {
   invalidateCache: () => {
     usersCache.invalidate();
     messagesCache.invalidate();
-  },
-  
-  /**
-   * Process raw messages into conversations
-   * @param {Array} messages - Raw messages from API
-   * @param {string} currentUserId - UUID of current user
-   * @returns {Array} Processed conversations
-   */
-  processConversations: (messages, currentUserId) => {
-    // Group messages by the other user (sender or receiver)
-    const conversationsMap = {};
-    
-    // Add null check to prevent "Cannot read properties of null" error
-    if (!messages || !Array.isArray(messages)) {
-      console.warn('No messages to process or messages is not an array');
-      return [];
-    }
-    
-    messages.forEach(message => {
-      // Determine the other user in the conversation
-      const otherUserId = message.sender_id === currentUserId 
-        ? message.receiver_id 
-        : message.sender_id;
-      
-      if (!conversationsMap[otherUserId]) {
-        conversationsMap[otherUserId] = {
-          id: otherUserId,
-          messages: [],
-          lastMessage: null,
-          lastMessageTime: null
-        };
-      }
-      
-      // Add message to conversation
-      conversationsMap[otherUserId].messages.push(message);
-      
-      // Update last message if this is newer
-      if (!conversationsMap[otherUserId].lastMessageTime || 
-          new Date(message.created_at) > new Date(conversationsMap[otherUserId].lastMessageTime)) {
-        conversationsMap[otherUserId].lastMessage = message;
-        conversationsMap[otherUserId].lastMessageTime = message.created_at;
-      }
-    });
-    
-    // Convert map to array and sort by last message time
-    return Object.values(conversationsMap)
-      .sort((a, b) => new Date(b.lastMessageTime) - new Date(a.lastMessageTime));
   }
 };
 
@@ -1,5 +1,6 @@
 import { WS_URL } from '../config';
-import { getToken } from '../utils/tokenStorage';
+import { getToken, isTokenValid } from '../utils/tokenStorage';
+import { refreshAccessToken } from './api';
 
 // Connection states for state machine
 const CONNECTION_STATES = {
@@ -227,9 +228,21 @@ class WebSocketService {
     }
     
     // Set up new timeout for reconnection
-    this.reconnectTimeout = setTimeout(() => {
-      console.log('Reconnecting with token:', tokenToUse ? tokenToUse.substring(0, 10) + '...' : 'none');
-      this.connect(tokenToUse, true);
+    this.reconnectTimeout = setTimeout(async () => {
+      let reconnectToken = tokenToUse;
+
+      // Access tokens are short-lived; renew an expired one before reconnecting
+      if (!isTokenValid()) {
+        try {
+          reconnectToken = await refreshAccessToken();
+        } catch (error) {
+          console.log('Session expired, not reconnecting');
+          return;
+        }
+      }
+
+      console.log('Reconnecting with token:', reconnectToken.substring(0, 10) + '...');
+      this.connect(reconnectToken, true);
     }, delay + jitter);
     
     this.triggerEvent(EVENT_TYPES.RECONNECTING, { 
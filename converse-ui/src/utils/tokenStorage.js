@@ -1,4 +1,4 @@
-import { AUTH_TOKEN_KEY, USER_DATA_KEY } from '../config';
+import { AUTH_TOKEN_KEY, REFRESH_TOKEN_KEY, USER_DATA_KEY } from '../config';
 import { jwtDecode } from 'jwt-decode';
 
 /**
@@ -24,6 +24,29 @@ export const removeToken = () => {
   localStorage.removeItem(AUTH_TOKEN_KEY);
 };
 
+/**
+ * Save refresh token to local storage
+ * @param {string} token - Refresh token
+ */
+export const saveRefreshToken = (token) => {
+  localStorage.setItem(REFRESH_TOKEN_KEY, token);
+};
+
+/**
+ * Get refresh token from local storage
+ * @returns {string|null} Refresh token or null if not found
+ */
+export const getRefreshToken = () => {
+  return localStorage.getItem(REFRESH_TOKEN_KEY);
+};
+
+/**
+ * Remove refresh token from local storage
+ */
+export const removeRefreshToken = () => {
+  localStorage.removeItem(REFRESH_TOKEN_KEY);
+};
+
 /**
  * Check if token exists and is valid (not expired)
  * @returns {boolean} True if token is valid
@@ -69,9 +92,10 @@ export const removeUserData = () => {
 };
 
 /**
- * Clear all authentication data (both token and user data)
+ * Clear all authentication data (tokens and user data)
  */
 export const clearAuthData = () => {
   removeToken();
+  removeRefreshToken();
   removeUserData();
 }; 
\ No newline at end of file
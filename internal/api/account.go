@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// ExportData returns everything stored about the authenticated user as a
+// JSON download: their profile, sessions, groups and every message they sent
+// or received
+func (h *AuthHandler) ExportData(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// The userID from context is now a UUID object
+	userUUID := userID.(uuid.UUID)
+
+	user, err := h.DB.GetUserByID(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	export := models.DataExport{
+		ExportedAt: time.Now().UTC(),
+		User:       user,
+		Sessions:   []*models.Session{},
+		Groups:     []*models.Group{},
+		Messages:   []*models.Message{},
+	}
+
+	totp, err := h.DB.GetTOTP(userUUID)
+	if err != nil && err != database.ErrTOTPNotFound {
+		h.log.Error("Failed to load TOTP for user %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+	export.TwoFactorEnabled = err == nil && totp.Enabled()
+
+	sessions, err := h.DB.GetSessionsByUser(userUUID)
+	if err != nil {
+		h.log.Error("Failed to load sessions for user %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+	if sessions != nil {
+		export.Sessions = sessions
+	}
+
+	groups, err := h.DB.GetGroupsByUser(userUUID)
+	if err != nil {
+		h.log.Error("Failed to load groups for user %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+	if groups != nil {
+		export.Groups = groups
+	}
+
+	messages, err := h.DB.GetUserMessages(userUUID)
+	if err != nil {
+		h.log.Error("Failed to load messages for user %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+	if messages != nil {
+		export.Messages = messages
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="converse-export-`+export.ExportedAt.Format("2006-01-02")+`.json"`)
+	c.JSON(http.StatusOK, export)
+}
+
+// DeleteAccount deletes the authenticated user's account after they confirm
+// their password. The account becomes an anonymous tombstone: the messages
+// it exchanged stay in other users' conversations, but its name, email,
+// credentials, sessions and group memberships are gone. Its WebSocket
+// connections are closed.
+func (h *AuthHandler) DeleteAccount(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input models.AccountDeletionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.DB.GetUserByID(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if !h.confirmPassword(c, user, input.Password) {
+		return
+	}
+
+	if err := h.DB.DeleteUser(user.ID); err != nil {
+		h.log.Error("Failed to delete user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	if err := h.Limiter.Succeed(user.Email); err != nil {
+		h.log.Warn("Failed to clear login attempts of user %s: %v", user.ID, err)
+	}
+	h.Events.Publish(events.UserDeleted{UserID: user.ID})
+
+	h.log.Info("Deleted account of user %s", user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
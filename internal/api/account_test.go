@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/auth"
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// TestExportData tests that the export holds the user's profile and the
+// messages they sent and received
+func TestExportData(t *testing.T) {
+	router, handler := setupTestRouter(t)
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	user, err := handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
+	require.NoError(t, err)
+	other, err := handler.DB.CreateUser("otheruser", "other@example.com", hashedPassword)
+	require.NoError(t, err)
+	third, err := handler.DB.CreateUser("thirduser", "third@example.com", hashedPassword)
+	require.NoError(t, err)
+
+	_, err = handler.DB.CreateMessage(user.ID, other.ID, "Hello")
+	require.NoError(t, err)
+	_, err = handler.DB.CreateMessage(other.ID, user.ID, "Hi there")
+	require.NoError(t, err)
+	_, err = handler.DB.CreateMessage(other.ID, third.ID, "Not about you")
+	require.NoError(t, err)
+
+	accessToken, _ := loginForTokens(t, router, "test@example.com", "password123", "laptop")
+
+	req := httptest.NewRequest("GET", "/me/export", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Regexp(t, `^attachment; filename="converse-export-\d{4}-\d{2}-\d{2}\.json"$`, w.Header().Get("Content-Disposition"))
+
+	var export struct {
+		User struct {
+			Email string `json:"email"`
+		} `json:"user"`
+		Sessions []json.RawMessage `json:"sessions"`
+		Groups   []json.RawMessage `json:"groups"`
+		Messages []models.Message  `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	assert.Equal(t, "test@example.com", export.User.Email)
+	assert.NotContains(t, w.Body.String(), "password_hash")
+	assert.Len(t, export.Sessions, 1)
+	assert.NotNil(t, export.Groups)
+	require.Len(t, export.Messages, 2)
+	assert.Equal(t, "Hello", export.Messages[0].Content)
+	assert.Equal(t, "Hi there", export.Messages[1].Content)
+}
+
+// TestDeleteAccount tests that deleting an account needs the password, ends
+// its sessions and keeps the other side of its conversations
+func TestDeleteAccount(t *testing.T) {
+	router, handler := setupTestRouter(t)
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	user, err := handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
+	require.NoError(t, err)
+	other, err := handler.DB.CreateUser("otheruser", "other@example.com", hashedPassword)
+	require.NoError(t, err)
+
+	_, err = handler.DB.CreateMessage(user.ID, other.ID, "Hello")
+	require.NoError(t, err)
+
+	accessToken, refreshToken := loginForTokens(t, router, "test@example.com", "password123", "laptop")
+
+	w := sendJSON(router, "DELETE", "/me", models.AccountDeletionRequest{Password: "wrongpassword"}, accessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = sendJSON(router, "DELETE", "/me", nil, accessToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendJSON(router, "DELETE", "/me", models.AccountDeletionRequest{Password: "password123"}, accessToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	stored, err := handler.DB.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Deleted())
+	assert.NotEqual(t, "test@example.com", stored.Email)
+
+	// The account can't be used again
+	w = postJSON(router, "/login", models.UserLogin{Email: "test@example.com", Password: "password123"}, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = postRefreshToken(router, "/refresh", refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = sendJSON(router, "DELETE", "/me", models.AccountDeletionRequest{Password: "password123"}, accessToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The other user keeps the conversation but can't write to the account
+	messages, err := handler.DB.GetConversation(other.ID, user.ID, database.PageOptions{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Hello", messages[0].Content)
+
+	_, err = handler.DB.CreateMessage(other.ID, user.ID, "Still there?")
+	assert.Equal(t, database.ErrUserNotFound, err)
+
+	// The email can be registered again
+	_, err = handler.DB.CreateUser("newuser", "test@example.com", hashedPassword)
+	assert.NoError(t, err)
+}
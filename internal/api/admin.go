@@ -0,0 +1,269 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
+	"github.com/ammar1510/converse/internal/logger"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// statsWindow is how far back the recent counts of the statistics reach
+const statsWindow = 24 * time.Hour
+
+// AdminHandler handles the admin routes. They must be behind
+// RequireRole(models.RoleAdmin).
+type AdminHandler struct {
+	DB database.DBInterface
+	// Events is where users logged out by an admin are published
+	Events *events.Bus
+	// Connections counts the WebSocket connections in the statistics; nil
+	// means nobody is connected
+	Connections Connections
+	log         *logger.Logger
+}
+
+// NewAdminHandler creates a new admin handler that publishes the users it
+// logs out on bus
+func NewAdminHandler(db database.DBInterface, bus *events.Bus) *AdminHandler {
+	return &AdminHandler{
+		DB:     db,
+		Events: bus,
+		log:    logger.New("api-admin"),
+	}
+}
+
+// ListUsers returns a page of accounts, newest first. q searches usernames,
+// emails and display names; role and suspended=true narrow the listing.
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	page, err := parsePageOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := database.UserFilter{
+		Search: strings.TrimSpace(c.Query("q")),
+		Role:   models.Role(c.Query("role")),
+	}
+	if filter.Role != "" && !filter.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+	if suspended := c.Query("suspended"); suspended != "" {
+		filter.Suspended, err = strconv.ParseBool(suspended)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "suspended must be true or false"})
+			return
+		}
+	}
+
+	users, err := h.DB.ListUsers(filter, pageQuery(page))
+	if err != nil {
+		h.log.Error("Failed to list users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newUserPage(users, page))
+}
+
+// GetUser returns one account
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newAdminUserResponse(user))
+}
+
+// SetRole changes a user's role. Admins can't demote themselves, so there is
+// always one left.
+func (h *AdminHandler) SetRole(c *gin.Context) {
+	var input models.RoleRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	adminID := c.MustGet("userID").(uuid.UUID)
+	if user.ID == adminID && input.Role != models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't remove your own admin role"})
+		return
+	}
+
+	if err := h.DB.SetUserRole(user.ID, input.Role); err != nil {
+		h.log.Error("Failed to set role of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change role"})
+		return
+	}
+
+	h.log.Info("Admin %s changed the role of user %s from %s to %s", adminID, user.ID, user.Role, input.Role)
+	user.Role = input.Role
+	c.JSON(http.StatusOK, newAdminUserResponse(user))
+}
+
+// Suspend suspends an account: it is logged out everywhere and can't log in
+// until it is unsuspended
+func (h *AdminHandler) Suspend(c *gin.Context) {
+	h.setSuspended(c, true)
+}
+
+// Unsuspend lets a suspended account log in again
+func (h *AdminHandler) Unsuspend(c *gin.Context) {
+	h.setSuspended(c, false)
+}
+
+func (h *AdminHandler) setSuspended(c *gin.Context, suspended bool) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	adminID := c.MustGet("userID").(uuid.UUID)
+	if user.ID == adminID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't suspend yourself"})
+		return
+	}
+
+	if err := h.DB.SetUserSuspended(user.ID, suspended); err != nil {
+		h.log.Error("Failed to change suspension of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change suspension"})
+		return
+	}
+
+	if suspended {
+		h.log.Info("Admin %s suspended user %s", adminID, user.ID)
+		if !h.logoutUser(c, user.ID) {
+			return
+		}
+	} else {
+		h.log.Info("Admin %s unsuspended user %s", adminID, user.ID)
+	}
+
+	user, err := h.DB.GetUserByID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newAdminUserResponse(user))
+}
+
+// Logout revokes every session of a user and closes their WebSocket
+// connections, so their tokens stop working right away
+func (h *AdminHandler) Logout(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	if !h.logoutUser(c, user.ID) {
+		return
+	}
+
+	h.log.Info("Admin %s logged out user %s", c.MustGet("userID"), user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "User logged out"})
+}
+
+// Stats returns counts of users, messages, groups, sessions and WebSocket
+// connections
+func (h *AdminHandler) Stats(c *gin.Context) {
+	stats, err := h.DB.GetStats(time.Now().Add(-statsWindow))
+	if err != nil {
+		h.log.Error("Failed to load statistics: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve statistics"})
+		return
+	}
+
+	if h.Connections != nil {
+		stats.ConnectedUsers, stats.Connections = h.Connections.ConnectionCounts()
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// targetUser loads the account named by the userID parameter. It responds
+// and reports false if there is none; deleted accounts count as none.
+func (h *AdminHandler) targetUser(c *gin.Context) (*models.User, bool) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	user, err := h.DB.GetUserByID(userID)
+	if err == nil && user.Deleted() {
+		err = database.ErrUserNotFound
+	}
+	if err == database.ErrUserNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// logoutUser revokes all of a user's sessions and closes their WebSocket
+// connections. It responds and reports false on failure.
+func (h *AdminHandler) logoutUser(c *gin.Context, userID uuid.UUID) bool {
+	if err := h.DB.RevokeUserSessions(userID); err != nil {
+		h.log.Error("Failed to revoke sessions of user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log user out"})
+		return false
+	}
+
+	h.Events.Publish(events.SessionsRevoked{UserID: userID})
+	return true
+}
+
+// newAdminUserResponse returns the admin view of user
+func newAdminUserResponse(user *models.User) *models.AdminUserResponse {
+	return &models.AdminUserResponse{
+		UserResponse: newUserResponse(user),
+		LastSeen:     user.LastSeen,
+		SuspendedAt:  user.SuspendedAt,
+	}
+}
+
+// newUserPage trims the extra row fetched by pageQuery and builds the
+// response envelope from users, which are newest first
+func newUserPage(users []*models.User, page database.PageOptions) models.UserPage {
+	users, hasMore := trimPage(users, page, true)
+
+	result := models.UserPage{
+		Users:   make([]*models.AdminUserResponse, 0, len(users)),
+		HasMore: hasMore,
+	}
+	for _, user := range users {
+		result.Users = append(result.Users, newAdminUserResponse(user))
+	}
+
+	if len(users) > 0 {
+		result.Before = database.CursorForUser(users[len(users)-1]).String()
+		result.After = database.CursorForUser(users[0]).String()
+	}
+
+	return result
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/auth"
+	"github.com/ammar1510/converse/internal/events"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// setupAdminRouter adds the admin routes to the test router. It creates an
+// admin and returns their access token.
+func setupAdminRouter(t *testing.T) (*gin.Engine, *AuthHandler, *models.User, string) {
+	router, handler := setupTestRouter(t)
+
+	adminHandler := NewAdminHandler(handler.DB, events.NewBus())
+	admin := router.Group("/admin", AuthMiddleware(handler.DB), RequireRole(models.RoleAdmin))
+	admin.GET("/users", adminHandler.ListUsers)
+	admin.GET("/users/:userID", adminHandler.GetUser)
+	admin.PUT("/users/:userID/role", adminHandler.SetRole)
+	admin.POST("/users/:userID/suspend", adminHandler.Suspend)
+	admin.POST("/users/:userID/unsuspend", adminHandler.Unsuspend)
+	admin.POST("/users/:userID/logout", adminHandler.Logout)
+	admin.GET("/stats", adminHandler.Stats)
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	user, err := handler.DB.CreateUser("admin", "admin@example.com", hashedPassword)
+	require.NoError(t, err)
+	require.NoError(t, handler.DB.SetUserRole(user.ID, models.RoleAdmin))
+	user.Role = models.RoleAdmin
+
+	token, _ := loginForTokens(t, router, "admin@example.com", "password123", "laptop")
+	return router, handler, user, token
+}
+
+// createTestUser creates a user with the password "password123"
+func createTestUser(t *testing.T, handler *AuthHandler, username string) *models.User {
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	user, err := handler.DB.CreateUser(username, username+"@example.com", hashedPassword)
+	require.NoError(t, err)
+	return user
+}
+
+// TestAdminUsers tests listing, searching and looking up users and changing
+// their role
+func TestAdminUsers(t *testing.T) {
+	router, handler, admin, adminToken := setupAdminRouter(t)
+	bob := createTestUser(t, handler, "bob")
+	createTestUser(t, handler, "carol")
+
+	// The role is in the token and the login response
+	claims, err := auth.ValidateToken(adminToken)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, auth.GetRoleFromToken(claims))
+
+	bobToken, _ := loginForTokens(t, router, "bob@example.com", "password123", "laptop")
+	w := sendJSON(router, "GET", "/admin/users", nil, bobToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = sendJSON(router, "GET", "/admin/stats", nil, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	list := func(query string) models.UserPage {
+		w := sendJSON(router, "GET", "/admin/users"+query, nil, adminToken)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var page models.UserPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		return page
+	}
+
+	page := list("")
+	require.Len(t, page.Users, 3)
+	assert.Equal(t, "carol", page.Users[0].Username)
+	assert.Equal(t, "admin", page.Users[2].Username)
+	assert.Equal(t, models.RoleAdmin, page.Users[2].Role)
+
+	page = list("?q=BOB")
+	require.Len(t, page.Users, 1)
+	assert.Equal(t, bob.ID, page.Users[0].ID)
+	assert.Equal(t, models.RoleUser, page.Users[0].Role)
+
+	page = list("?role=admin")
+	require.Len(t, page.Users, 1)
+	assert.Equal(t, admin.ID, page.Users[0].ID)
+
+	page = list("?limit=2")
+	assert.Len(t, page.Users, 2)
+	assert.True(t, page.HasMore)
+	page = list("?limit=2&before=" + page.Before)
+	require.Len(t, page.Users, 1)
+	assert.False(t, page.HasMore)
+	assert.Equal(t, admin.ID, page.Users[0].ID)
+
+	for _, bad := range []string{"?role=root", "?suspended=maybe", "?limit=0", "?before=nope"} {
+		w = sendJSON(router, "GET", "/admin/users"+bad, nil, adminToken)
+		assert.Equal(t, http.StatusBadRequest, w.Code, bad)
+	}
+
+	w = sendJSON(router, "GET", "/admin/users/"+bob.ID.String(), nil, adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"last_seen"`)
+	w = sendJSON(router, "GET", "/admin/users/"+uuid.New().String(), nil, adminToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = sendJSON(router, "GET", "/admin/users/not-a-uuid", nil, adminToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Roles
+	w = sendJSON(router, "PUT", "/admin/users/"+bob.ID.String()+"/role", models.RoleRequest{Role: "root"}, adminToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = sendJSON(router, "PUT", "/admin/users/"+admin.ID.String()+"/role", models.RoleRequest{Role: models.RoleUser}, adminToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendJSON(router, "PUT", "/admin/users/"+bob.ID.String()+"/role", models.RoleRequest{Role: models.RoleAdmin}, adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response models.AdminUserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.RoleAdmin, response.Role)
+
+	// The new role applies to the tokens Bob already has, both ways
+	w = sendJSON(router, "GET", "/admin/users", nil, bobToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendJSON(router, "PUT", "/admin/users/"+bob.ID.String()+"/role", models.RoleRequest{Role: models.RoleUser}, adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = sendJSON(router, "GET", "/admin/users", nil, bobToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// TestAdminSuspend tests that suspended users are logged out and can't log
+// in until they are unsuspended
+func TestAdminSuspend(t *testing.T) {
+	router, handler, admin, adminToken := setupAdminRouter(t)
+	bob := createTestUser(t, handler, "bob")
+
+	bobToken, bobRefresh := loginForTokens(t, router, "bob@example.com", "password123", "laptop")
+
+	w := postJSON(router, "/admin/users/"+admin.ID.String()+"/suspend", nil, adminToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/admin/users/"+bob.ID.String()+"/suspend", nil, adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response models.AdminUserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotNil(t, response.SuspendedAt)
+
+	w = postRefreshToken(router, "/refresh", bobRefresh)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = sendJSON(router, "GET", "/me", nil, bobToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = postJSON(router, "/login", models.UserLogin{Email: "bob@example.com", Password: "password123"}, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// A wrong password doesn't reveal the suspension
+	w = postJSON(router, "/login", models.UserLogin{Email: "bob@example.com", Password: "wrongpassword"}, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = sendJSON(router, "GET", "/admin/users?suspended=true", nil, adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page models.UserPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Users, 1)
+	assert.Equal(t, bob.ID, page.Users[0].ID)
+
+	w = postJSON(router, "/admin/users/"+bob.ID.String()+"/unsuspend", nil, adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	loginForTokens(t, router, "bob@example.com", "password123", "laptop")
+}
+
+// TestAdminLogout tests ending every session of a user
+func TestAdminLogout(t *testing.T) {
+	router, handler, _, adminToken := setupAdminRouter(t)
+	bob := createTestUser(t, handler, "bob")
+
+	laptopToken, laptopRefresh := loginForTokens(t, router, "bob@example.com", "password123", "laptop")
+	_, phoneRefresh := loginForTokens(t, router, "bob@example.com", "password123", "phone")
+
+	w := postJSON(router, "/admin/users/"+bob.ID.String()+"/logout", nil, adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = sendJSON(router, "GET", "/me", nil, laptopToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	for _, refresh := range []string{laptopRefresh, phoneRefresh} {
+		w = postRefreshToken(router, "/refresh", refresh)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Logging in again works
+	loginForTokens(t, router, "bob@example.com", "password123", "laptop")
+
+	w = postJSON(router, "/admin/users/"+uuid.New().String()+"/logout", nil, adminToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestAdminStats tests the system statistics
+func TestAdminStats(t *testing.T) {
+	router, handler, admin, adminToken := setupAdminRouter(t)
+	bob := createTestUser(t, handler, "bob")
+	carol := createTestUser(t, handler, "carol")
+
+	_, err := handler.DB.CreateMessage(bob.ID, carol.ID, "Hello")
+	require.NoError(t, err)
+	_, err = handler.DB.CreateGroup(admin.ID, "team", []uuid.UUID{bob.ID, carol.ID})
+	require.NoError(t, err)
+	require.NoError(t, handler.DB.DeleteUser(carol.ID))
+
+	w := sendJSON(router, "GET", "/admin/stats", nil, adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var stats models.SystemStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 2, stats.Users)
+	assert.Equal(t, 1, stats.Admins)
+	assert.Equal(t, 1, stats.DeletedUsers)
+	assert.Equal(t, 1, stats.Messages)
+	assert.Equal(t, 1, stats.RecentMessages)
+	assert.Equal(t, 1, stats.Groups)
+	assert.Equal(t, 1, stats.ActiveSessions)
+}
@@ -1,28 +1,59 @@
 package api
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
 	"github.com/ammar1510/converse/internal/auth"
 	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
 	"github.com/ammar1510/converse/internal/logger"
+	"github.com/ammar1510/converse/internal/mail"
 	"github.com/ammar1510/converse/internal/models"
+	"github.com/ammar1510/converse/internal/throttle"
 )
 
 // AuthHandler handles authentication routes
 type AuthHandler struct {
-	DB  database.DBInterface
-	log *logger.Logger
+	DB     database.DBInterface
+	Mailer mail.Sender
+	AppURL string // base URL of the web app, for links in emails
+	// Limiter throttles failed logins per account and per IP address
+	Limiter *throttle.Limiter
+	// Events is where revoked sessions and changes to accounts are published
+	Events *events.Bus
+	// Connections reports who is connected over WebSocket; nil means nobody
+	Connections Connections
+	log         *logger.Logger
 }
 
-// NewAuthHandler creates a new auth handler
-func NewAuthHandler(db database.DBInterface) *AuthHandler {
+// Connections reports on the users connected over WebSocket.
+// websocket.Manager implements it.
+type Connections interface {
+	// ConnectionCounts returns the number of connected users and of their
+	// open connections
+	ConnectionCounts() (users, connections int)
+	// Presence returns the current status of a user
+	Presence(userID uuid.UUID) models.PresenceStatus
+}
+
+// NewAuthHandler creates a new auth handler that publishes revoked sessions
+// and changes to accounts on bus. Emails are logged until Mailer is set to a
+// real sender, and failed logins are counted in the database.
+func NewAuthHandler(db database.DBInterface, bus *events.Bus) *AuthHandler {
 	return &AuthHandler{
-		DB:  db,
-		log: logger.New("api-auth"),
+		DB:      db,
+		Mailer:  mail.LogSender{},
+		AppURL:  "http://localhost:5173",
+		Limiter: throttle.NewLimiter(db),
+		Events:  bus,
+		log:     logger.New("api-auth"),
 	}
 }
 
@@ -54,15 +85,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// Registration succeeds even if the email can't be sent; the user can ask
+	// for another one
+	if err := h.sendEmailToken(user, models.TokenPurposeVerifyEmail); err != nil {
+		h.log.Error("Failed to send verification email to user %s: %v", user.ID, err)
+	}
+
 	// Return user data (without password)
-	c.JSON(http.StatusCreated, models.UserResponse{
-		ID:          user.ID,
-		Username:    user.Username,
-		Email:       user.Email,
-		DisplayName: user.DisplayName,
-		AvatarURL:   user.AvatarURL,
-		CreatedAt:   user.CreatedAt,
-	})
+	c.JSON(http.StatusCreated, newUserResponse(user))
 }
 
 // Login handles user login
@@ -74,10 +104,18 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// Refuse attempts while the account or address is backing off, without
+	// checking the password
+	release, throttled := h.throttled(c, input.Email)
+	if throttled {
+		return
+	}
+	defer release()
+
 	// Get user by email
 	user, err := h.DB.GetUserByEmail(input.Email)
 	if err == database.ErrUserNotFound {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		h.loginFailed(c, input.Email)
 		return
 	}
 
@@ -87,39 +125,313 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Check password
-	if !auth.CheckPasswordHash(input.Password, user.PasswordHash) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	ok, needsRehash := auth.VerifyPassword(input.Password, user.PasswordHash)
+	if !ok {
+		h.loginFailed(c, input.Email)
+		return
+	}
+
+	if err := h.Limiter.Succeed(input.Email); err != nil {
+		h.log.Warn("Failed to clear login attempts of user %s: %v", user.ID, err)
+	}
+
+	// The plaintext is only available now, so this is when hashes made with
+	// an old scheme or weaker parameters get upgraded
+	if needsRehash {
+		h.rehashPassword(user, input.Password)
+	}
+
+	if h.rejectSuspended(c, user) {
+		return
+	}
+
+	// With 2FA enabled the password only earns a challenge
+	totp, err := h.DB.GetTOTP(user.ID)
+	if err != nil && err != database.ErrTOTPNotFound {
+		h.log.Error("Failed to load TOTP for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+	if err == nil && totp.Enabled() {
+		h.issueTwoFactorChallenge(c, user, strings.TrimSpace(input.DeviceLabel))
 		return
 	}
 
+	h.startSession(c, user, strings.TrimSpace(input.DeviceLabel))
+}
+
+// throttled responds with 429 and reports true while password attempts for
+// the account or from the client's address have to wait. Otherwise the
+// attempt goes ahead and the caller must call release once its outcome is
+// recorded; other attempts on the same keys wait until then.
+func (h *AuthHandler) throttled(c *gin.Context, email string) (release func(), throttled bool) {
+	wait, release, err := h.Limiter.Begin(email, c.ClientIP())
+	if err != nil {
+		h.log.Error("Failed to check login attempts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return release, true
+	}
+	if wait <= 0 {
+		return release, false
+	}
+	release()
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts, try again later",
+		"retry_after": retryAfter,
+	})
+	return func() {}, true
+}
+
+// loginFailed counts a failed login and rejects it. Unknown emails count
+// too, so they can't be told apart from wrong passwords.
+func (h *AuthHandler) loginFailed(c *gin.Context, email string) {
+	if err := h.Limiter.Fail(email, c.ClientIP()); err != nil {
+		h.log.Error("Failed to record failed login: %v", err)
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+}
+
+// rejectSuspended responds with 403 and reports true if an admin suspended
+// the user's account
+func (h *AuthHandler) rejectSuspended(c *gin.Context, user *models.User) bool {
+	if !user.Suspended() {
+		return false
+	}
+
+	h.log.Info("Refused login of suspended user %s", user.ID)
+	c.JSON(http.StatusForbidden, gin.H{"error": "Account suspended"})
+	return true
+}
+
+// rehashPassword replaces the user's stored hash with one from the current
+// scheme. Failures are logged; the old hash keeps working.
+func (h *AuthHandler) rehashPassword(user *models.User, password string) {
+	hash, err := auth.HashPassword(password)
+	if err == nil {
+		err = h.DB.UpdatePassword(user.ID, hash)
+	}
+	if err != nil {
+		h.log.Warn("Failed to rehash password of user %s: %v", user.ID, err)
+		return
+	}
+
+	user.PasswordHash = hash
+	h.log.Info("Rehashed password of user %s", user.ID)
+}
+
+// startSession completes a login: it creates a session and responds with
+// its tokens
+func (h *AuthHandler) startSession(c *gin.Context, user *models.User, deviceLabel string) {
 	// Update last seen
 	if err := h.DB.UpdateLastSeen(user.ID); err != nil {
 		// Log this error, don't return it
 		h.log.Warn("Failed to update last_seen: %v", err)
 	}
 
+	// Each login is a new session, which is also the refresh token family
+	now := time.Now().UTC()
+	session := &models.Session{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		DeviceLabel: deviceLabel,
+		IPAddress:   c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+		CreatedAt:   now,
+		LastUsedAt:  now,
+	}
+	if err := h.DB.CreateSession(session); err != nil {
+		h.log.Error("Failed to create session for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	h.issueTokens(c, user, session.ID)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Refresh tokens are single use: presenting one that was already
+// exchanged means it was stolen or replayed, so the whole family is revoked
+// and the user has to log in again.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var input models.RefreshRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stored, err := h.DB.GetRefreshToken(auth.HashOpaqueToken(input.RefreshToken))
+	if err == database.ErrRefreshTokenNotFound {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to load refresh token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	if stored.UsedAt != nil {
+		h.revokeReusedFamily(c, stored)
+		return
+	}
+
+	user, err := h.DB.GetUserByID(stored.UserID)
+	if err == database.ErrUserNotFound {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if h.rejectSuspended(c, user) {
+		return
+	}
+
+	h.rotateTokens(c, user, stored)
+}
+
+// Logout ends the session of the presented refresh token, revoking its
+// refresh tokens. It succeeds for unknown tokens so clients can always clear
+// their state.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var input models.RefreshRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stored, err := h.DB.GetRefreshToken(auth.HashOpaqueToken(input.RefreshToken))
+	if err == nil {
+		err = h.endSession(stored.UserID, stored.FamilyID)
+	}
+	if err != nil && err != database.ErrRefreshTokenNotFound {
+		h.log.Error("Failed to revoke refresh token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// issueTokens responds with a new access token and a new refresh token in
+// the given family
+func (h *AuthHandler) issueTokens(c *gin.Context, user *models.User, familyID uuid.UUID) {
+	refresh, next, err := newRefreshToken(user.ID, familyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	if err := h.DB.CreateRefreshToken(next); err != nil {
+		h.log.Error("Failed to store refresh token for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	h.respondWithTokens(c, user, refresh, next)
+}
+
+// rotateTokens marks used as exchanged and responds with its replacement
+func (h *AuthHandler) rotateTokens(c *gin.Context, user *models.User, used *models.RefreshToken) {
+	refresh, next, err := newRefreshToken(user.ID, used.FamilyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	// A concurrent refresh with the same token got there first
+	err = h.DB.RotateRefreshToken(used.ID, next)
+	if err == database.ErrRefreshTokenUsed {
+		h.revokeReusedFamily(c, used)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to rotate refresh token for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	if err := h.DB.TouchSession(used.FamilyID, c.ClientIP()); err != nil {
+		// Log this error, don't return it
+		h.log.Warn("Failed to update session %s: %v", used.FamilyID, err)
+	}
+
+	h.respondWithTokens(c, user, refresh, next)
+}
+
+// revokeReusedFamily handles a refresh token presented a second time by
+// ending its session
+func (h *AuthHandler) revokeReusedFamily(c *gin.Context, token *models.RefreshToken) {
+	h.log.Warn("Refresh token reuse detected for user %s, revoking session %s", token.UserID, token.FamilyID)
+
+	if err := h.endSession(token.UserID, token.FamilyID); err != nil {
+		h.log.Error("Failed to revoke session %s: %v", token.FamilyID, err)
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+}
+
+// endSession revokes a session of a user and its refresh tokens, and
+// publishes the revocation so its WebSocket connections are closed
+func (h *AuthHandler) endSession(userID, sessionID uuid.UUID) error {
+	if err := h.DB.RevokeSession(sessionID); err != nil {
+		return err
+	}
+
+	h.Events.Publish(events.SessionRevoked{UserID: userID, SessionID: sessionID})
+	return nil
+}
+
+// respondWithTokens writes the login response: an access token, the refresh
+// token and the user
+func (h *AuthHandler) respondWithTokens(c *gin.Context, user *models.User, refresh string, stored *models.RefreshToken) {
 	// Generate JWT token
-	token, expiry, err := auth.GenerateToken(user)
+	token, expiry, err := auth.GenerateSessionToken(user, stored.FamilyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	// Return user data with token
+	// Return user data with tokens
 	c.JSON(http.StatusOK, gin.H{
-		"token":  token,
-		"expiry": expiry,
-		"user": models.UserResponse{
-			ID:          user.ID,
-			Username:    user.Username,
-			Email:       user.Email,
-			DisplayName: user.DisplayName,
-			AvatarURL:   user.AvatarURL,
-			CreatedAt:   user.CreatedAt,
-		},
+		"token":          token,
+		"expiry":         expiry,
+		"refresh_token":  refresh,
+		"refresh_expiry": stored.ExpiresAt,
+		"user":           newUserResponse(user),
 	})
 }
 
+// newRefreshToken generates a refresh token and the record to store for it
+func newRefreshToken(userID, familyID uuid.UUID) (string, *models.RefreshToken, error) {
+	refresh, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now().UTC()
+	return refresh, &models.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(auth.RefreshTokenTTL),
+	}, nil
+}
+
 // GetMe gets the current user profile
 func (h *AuthHandler) GetMe(c *gin.Context) {
 	// The user should be added to context by auth middleware
@@ -140,14 +452,7 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 	}
 
 	// Return user data
-	c.JSON(http.StatusOK, models.UserResponse{
-		ID:          user.ID,
-		Username:    user.Username,
-		Email:       user.Email,
-		DisplayName: user.DisplayName,
-		AvatarURL:   user.AvatarURL,
-		CreatedAt:   user.CreatedAt,
-	})
+	c.JSON(http.StatusOK, newUserResponse(user))
 }
 
 // GetAllUsers retrieves all users except the current user
@@ -172,15 +477,33 @@ func (h *AuthHandler) GetAllUsers(c *gin.Context) {
 	// Convert to user response objects (without sensitive data)
 	var userResponses []*models.UserResponse
 	for _, user := range users {
-		userResponses = append(userResponses, &models.UserResponse{
-			ID:          user.ID,
-			Username:    user.Username,
-			Email:       user.Email,
-			DisplayName: user.DisplayName,
-			AvatarURL:   user.AvatarURL,
-			CreatedAt:   user.CreatedAt,
-		})
+		userResponse := newUserResponse(user)
+		userResponses = append(userResponses, &userResponse)
 	}
 
 	c.JSON(http.StatusOK, userResponses)
 }
+
+// JWKS publishes the public keys tokens are signed with, so other services
+// can verify them without holding a secret
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	// Keys are published well before they start signing, so a short cache
+	// is enough
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, auth.PublicKeys())
+}
+
+// newUserResponse returns the public view of user
+func newUserResponse(user *models.User) models.UserResponse {
+	return models.UserResponse{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		DisplayName:   user.DisplayName,
+		AvatarURL:     user.AvatarURL,
+		EmailVerified: user.EmailVerified,
+		CreatedAt:     user.CreatedAt,
+		Role:          user.Role,
+		Deleted:       user.Deleted(),
+	}
+}
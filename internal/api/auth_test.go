@@ -2,42 +2,39 @@ package api
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ammar1510/converse/internal/auth"
 	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
 	"github.com/ammar1510/converse/internal/models"
+	"github.com/ammar1510/converse/internal/throttle"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // setupTestRouter creates a test router with the auth handler
 func setupTestRouter(t *testing.T) (*gin.Engine, *AuthHandler) {
-	// Create test database connection
-	connStr := "postgres://ammar3.shaikh@localhost:5432/converse_test?sslmode=disable"
-	db, err := database.NewDatabase(database.PostgreSQL, connStr)
+	// Each test gets a fresh in-memory database
+	db, err := database.NewDatabase(database.Memory, "")
 	if err != nil {
-		t.Fatalf("Failed to connect to test database: %v", err)
-	}
-
-	// Clean up test data
-	_, err = db.Exec("DELETE FROM messages")
-	if err != nil {
-		t.Fatalf("Failed to clean up test data (messages): %v", err)
-	}
-
-	_, err = db.Exec("DELETE FROM users")
-	if err != nil {
-		t.Fatalf("Failed to clean up test data (users): %v", err)
+		t.Fatalf("Failed to create test database: %v", err)
 	}
 
 	// Create auth handler
-	handler := NewAuthHandler(db)
+	handler := NewAuthHandler(db, events.NewBus())
 
 	// Setup router
 	gin.SetMode(gin.TestMode)
@@ -46,7 +43,26 @@ func setupTestRouter(t *testing.T) (*gin.Engine, *AuthHandler) {
 	// Setup routes
 	router.POST("/register", handler.Register)
 	router.POST("/login", handler.Login)
-	router.GET("/me", AuthMiddleware(), handler.GetMe)
+	router.POST("/login/2fa", handler.VerifyTwoFactor)
+	router.POST("/refresh", handler.Refresh)
+	router.POST("/logout", handler.Logout)
+	router.GET("/jwks.json", handler.JWKS)
+	router.POST("/verify-email", handler.VerifyEmail)
+	router.POST("/verify-email/resend", AuthMiddleware(handler.DB), handler.ResendVerification)
+	router.POST("/password/forgot", handler.ForgotPassword)
+	router.POST("/password/reset", handler.ResetPassword)
+	router.GET("/me", AuthMiddleware(handler.DB), handler.GetMe)
+	router.PATCH("/me", AuthMiddleware(handler.DB), handler.UpdateMe)
+	router.POST("/me/password", AuthMiddleware(handler.DB), handler.ChangePassword)
+	router.POST("/me/email", AuthMiddleware(handler.DB), handler.ChangeEmail)
+	router.GET("/me/export", AuthMiddleware(handler.DB), handler.ExportData)
+	router.DELETE("/me", AuthMiddleware(handler.DB), handler.DeleteAccount)
+	router.GET("/2fa", AuthMiddleware(handler.DB), handler.GetTwoFactor)
+	router.POST("/2fa/enroll", AuthMiddleware(handler.DB), handler.EnrollTwoFactor)
+	router.POST("/2fa/confirm", AuthMiddleware(handler.DB), handler.ConfirmTwoFactor)
+	router.POST("/2fa/disable", AuthMiddleware(handler.DB), handler.DisableTwoFactor)
+	router.GET("/sessions", AuthMiddleware(handler.DB), handler.GetSessions)
+	router.DELETE("/sessions/:id", AuthMiddleware(handler.DB), handler.RevokeSession)
 
 	return router, handler
 }
@@ -129,18 +145,13 @@ func TestRegister(t *testing.T) {
 
 // TestLogin tests user login endpoint
 func TestLogin(t *testing.T) {
-	router, _ := setupTestRouter(t)
+	router, handler := setupTestRouter(t)
 
 	// Create a test user
 	hashedPassword, err := auth.HashPassword("password123")
 	assert.NoError(t, err)
 
-	connStr := "postgres://ammar3.shaikh@localhost:5432/converse_test?sslmode=disable"
-	db, err := database.NewDatabase(database.PostgreSQL, connStr)
-	assert.NoError(t, err)
-	defer db.Close()
-
-	_, err = db.CreateUser("testuser", "test@example.com", hashedPassword)
+	_, err = handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
 	assert.NoError(t, err)
 
 	tests := []struct {
@@ -209,9 +220,10 @@ func TestLogin(t *testing.T) {
 			if !tt.wantError {
 				// Parse response
 				var response struct {
-					Token  string              `json:"token"`
-					Expiry string              `json:"expiry"`
-					User   models.UserResponse `json:"user"`
+					Token        string              `json:"token"`
+					Expiry       string              `json:"expiry"`
+					RefreshToken string              `json:"refresh_token"`
+					User         models.UserResponse `json:"user"`
 				}
 				err = json.Unmarshal(w.Body.Bytes(), &response)
 				assert.NoError(t, err)
@@ -219,6 +231,7 @@ func TestLogin(t *testing.T) {
 				// Verify response
 				assert.NotEmpty(t, response.Token)
 				assert.NotEmpty(t, response.Expiry)
+				assert.NotEmpty(t, response.RefreshToken)
 				assert.Equal(t, tt.input.Email, response.User.Email)
 
 				// Verify token
@@ -231,20 +244,286 @@ func TestLogin(t *testing.T) {
 	}
 }
 
+// TestLoginRehashesPassword tests that logging in upgrades a bcrypt hash to
+// the current argon2id scheme without expiring password reset links
+func TestLoginRehashesPassword(t *testing.T) {
+	router, handler := setupTestRouter(t)
+	mailer := &recordingMailer{}
+	handler.Mailer = mailer
+
+	bcryptHash, err := auth.BcryptScheme{Cost: 4}.Hash("password123")
+	require.NoError(t, err)
+	_, err = handler.DB.CreateUser("testuser", "test@example.com", bcryptHash)
+	require.NoError(t, err)
+
+	// A failed login leaves the hash alone
+	w := postJSON(router, "/login", models.UserLogin{Email: "test@example.com", Password: "wrongpassword"}, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	user, err := handler.DB.GetUserByEmail("test@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, bcryptHash, user.PasswordHash)
+
+	w = postJSON(router, "/password/forgot", models.EmailRequest{Email: "test@example.com"}, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, mailer.sent(), 1)
+	resetToken := linkToken(t, mailer.sent()[0])
+
+	loginForTokens(t, router, "test@example.com", "password123", "laptop")
+
+	user, err = handler.DB.GetUserByEmail("test@example.com")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.PasswordHash, "$argon2id$"))
+
+	// The new hash is current, so it's kept
+	upgraded := user.PasswordHash
+	loginForTokens(t, router, "test@example.com", "password123", "laptop")
+	user, err = handler.DB.GetUserByEmail("test@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, upgraded, user.PasswordHash)
+
+	// The password didn't change, so the reset link still works
+	w = postJSON(router, "/password/reset", models.PasswordResetRequest{Token: resetToken, Password: "newpassword"}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// TestLoginThrottling tests that repeated failed logins are refused with 429
+// until the backoff has passed
+func TestLoginThrottling(t *testing.T) {
+	router, handler := setupTestRouter(t)
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	_, err = handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
+	require.NoError(t, err)
+
+	for range throttle.DefaultAccountPolicy.FreeAttempts {
+		w := postJSON(router, "/login", models.UserLogin{Email: "test@example.com", Password: "wrongpassword"}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Even the right password is refused while backing off
+	w := postJSON(router, "/login", models.UserLogin{Email: "test@example.com", Password: "password123"}, "")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	var response struct {
+		RetryAfter int `json:"retry_after"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.RetryAfter)
+
+	// Unknown accounts are throttled the same way
+	for range throttle.DefaultAccountPolicy.FreeAttempts {
+		w := postJSON(router, "/login", models.UserLogin{Email: "nobody@example.com", Password: "password123"}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	w = postJSON(router, "/login", models.UserLogin{Email: "nobody@example.com", Password: "password123"}, "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	time.Sleep(time.Second)
+	loginForTokens(t, router, "test@example.com", "password123", "laptop")
+
+	// A successful login starts the account over
+	w = postJSON(router, "/login", models.UserLogin{Email: "test@example.com", Password: "wrongpassword"}, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	loginForTokens(t, router, "test@example.com", "password123", "laptop")
+}
+
+// loginForTokens logs in as the given user from a device and returns the
+// access and refresh tokens
+func loginForTokens(t *testing.T, router *gin.Engine, email, password, device string) (string, string) {
+	body, err := json.Marshal(models.UserLogin{Email: email, Password: password, DeviceLabel: device})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", device+"-agent")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Token, response.RefreshToken
+}
+
+// postRefreshToken posts a refresh token to path and returns the response
+func postRefreshToken(router *gin.Engine, path, refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.RefreshRequest{RefreshToken: refreshToken})
+	req := httptest.NewRequest("POST", path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestRefresh tests refresh token rotation and reuse detection
+func TestRefresh(t *testing.T) {
+	router, handler := setupTestRouter(t)
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	_, err = handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
+	require.NoError(t, err)
+
+	_, first := loginForTokens(t, router, "test@example.com", "password123", "laptop")
+	_, other := loginForTokens(t, router, "test@example.com", "password123", "phone")
+
+	// Each refresh returns a new access token and a new refresh token
+	w := postRefreshToken(router, "/refresh", first)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Token        string              `json:"token"`
+		RefreshToken string              `json:"refresh_token"`
+		User         models.UserResponse `json:"user"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.Token)
+	assert.NotEqual(t, first, response.RefreshToken)
+	assert.Equal(t, "testuser", response.User.Username)
+
+	_, err = auth.ValidateToken(response.Token)
+	assert.NoError(t, err)
+
+	second := response.RefreshToken
+
+	// Reusing the first token revokes the whole family, including its replacement
+	w = postRefreshToken(router, "/refresh", first)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postRefreshToken(router, "/refresh", second)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Other logins are unaffected
+	w = postRefreshToken(router, "/refresh", other)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = postRefreshToken(router, "/refresh", "not-a-token")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postRefreshToken(router, "/refresh", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestLogout tests that logging out revokes the refresh token
+func TestLogout(t *testing.T) {
+	router, handler := setupTestRouter(t)
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	user, err := handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
+	require.NoError(t, err)
+
+	var revoked []events.SessionRevoked
+	events.Subscribe(handler.Events, func(e events.SessionRevoked) {
+		revoked = append(revoked, e)
+	})
+
+	_, refreshToken := loginForTokens(t, router, "test@example.com", "password123", "laptop")
+
+	w := postRefreshToken(router, "/logout", refreshToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, revoked, 1)
+	assert.Equal(t, user.ID, revoked[0].UserID)
+	assert.NotEqual(t, uuid.Nil, revoked[0].SessionID)
+
+	w = postRefreshToken(router, "/refresh", refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Logging out again or with an unknown token still succeeds
+	w = postRefreshToken(router, "/logout", refreshToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postRefreshToken(router, "/logout", "not-a-token")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// TestSessions tests listing and revoking sessions
+func TestSessions(t *testing.T) {
+	router, handler := setupTestRouter(t)
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	_, err = handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
+	require.NoError(t, err)
+	_, err = handler.DB.CreateUser("other", "other@example.com", hashedPassword)
+	require.NoError(t, err)
+
+	laptopToken, _ := loginForTokens(t, router, "test@example.com", "password123", "laptop")
+	phoneToken, phoneRefresh := loginForTokens(t, router, "test@example.com", "password123", "phone")
+	otherToken, _ := loginForTokens(t, router, "other@example.com", "password123", "tablet")
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	listSessions := func(token string) []models.Session {
+		w := request("GET", "/sessions", token)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Sessions []models.Session `json:"sessions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Sessions
+	}
+
+	sessions := listSessions(laptopToken)
+	require.Len(t, sessions, 2)
+
+	byDevice := make(map[string]models.Session)
+	for _, session := range sessions {
+		byDevice[session.DeviceLabel] = session
+	}
+	assert.True(t, byDevice["laptop"].Current)
+	assert.Equal(t, "laptop-agent", byDevice["laptop"].UserAgent)
+	assert.False(t, byDevice["phone"].Current)
+	assert.Equal(t, "phone-agent", byDevice["phone"].UserAgent)
+
+	phoneSession := byDevice["phone"].ID.String()
+
+	// Other users' sessions can't be revoked
+	w := request("DELETE", "/sessions/"+phoneSession, otherToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = request("DELETE", "/sessions/"+phoneSession, laptopToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The revoked session's tokens no longer work, even the unexpired access
+	// token
+	w = postRefreshToken(router, "/refresh", phoneRefresh)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = request("GET", "/me", phoneToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	sessions = listSessions(laptopToken)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "laptop", sessions[0].DeviceLabel)
+
+	w = request("DELETE", "/sessions/"+phoneSession, laptopToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = request("DELETE", "/sessions/"+uuid.New().String(), laptopToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = request("DELETE", "/sessions/not-a-uuid", laptopToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 // TestGetMe tests the get current user profile endpoint
 func TestGetMe(t *testing.T) {
-	router, _ := setupTestRouter(t)
+	router, handler := setupTestRouter(t)
 
 	// Create a test user and token
 	hashedPassword, err := auth.HashPassword("password123")
 	assert.NoError(t, err)
 
-	connStr := "postgres://ammar3.shaikh@localhost:5432/converse_test?sslmode=disable"
-	db, err := database.NewDatabase(database.PostgreSQL, connStr)
-	assert.NoError(t, err)
-	defer db.Close()
-
-	user, err := db.CreateUser("testuser", "test@example.com", hashedPassword)
+	user, err := handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
 	assert.NoError(t, err)
 
 	token, _, err := auth.GenerateToken(user)
@@ -339,7 +618,7 @@ func TestGetAllUsers(t *testing.T) {
 	mockDB.On("GetAllUsers", currentUser.ID).Return(otherUsers, nil)
 
 	// Create a new auth handler with the mock DB
-	handler := NewAuthHandler(mockDB)
+	handler := NewAuthHandler(mockDB, events.NewBus())
 
 	// Set up the router
 	gin.SetMode(gin.TestMode)
@@ -378,6 +657,46 @@ func TestGetAllUsers(t *testing.T) {
 	mockDB.AssertExpectations(t)
 }
 
+// TestJWKS tests that tokens can be verified with nothing but the published keys
+func TestJWKS(t *testing.T) {
+	router, handler := setupTestRouter(t)
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := auth.NewKey(private)
+	require.NoError(t, err)
+	require.NoError(t, auth.InitKeys(key))
+	t.Cleanup(func() { auth.InitJWTKey([]byte(os.Getenv("JWT_SECRET"))) })
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	user, err := handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
+	require.NoError(t, err)
+
+	accessToken, _ := loginForTokens(t, router, "test@example.com", "password123", "laptop")
+
+	req := httptest.NewRequest("GET", "/jwks.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Cache-Control"), "max-age")
+
+	var jwks auth.JWKS
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, key.ID, jwks.Keys[0].KeyID)
+
+	// Verify the way another service would
+	claims := &auth.JWTClaims{}
+	_, err = jwt.ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		assert.Equal(t, jwks.Keys[0].KeyID, token.Header["kid"])
+		x, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0].X)
+		return ed25519.PublicKey(x), err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, user.ID.String(), claims.UserID)
+}
+
 // GetAllUsers mocks retrieving all users except the specified user
 func (m *MockDB) GetAllUsers(excludeUserID uuid.UUID) ([]*models.User, error) {
 	args := m.Called(excludeUserID)
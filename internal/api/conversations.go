@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// GetConversations returns a page of the authenticated user's conversations,
+// most recent first, with the latest message and unread count of each
+func (h *MessageHandler) GetConversations(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// The userID from context is now a UUID object
+	userUUID := userID.(uuid.UUID)
+
+	page, err := parsePageOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conversations, err := h.DB.GetConversations(userUUID, pageQuery(page))
+	if err != nil {
+		h.log.Error("Failed to load conversations for user %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newConversationPage(conversations, page))
+}
+
+// newConversationPage trims the extra row fetched by pageQuery and builds the
+// response envelope from conversations, which are most recent first
+func newConversationPage(conversations []*models.ConversationSummary, page database.PageOptions) models.ConversationPage {
+	conversations, hasMore := trimPage(conversations, page, true)
+
+	result := models.ConversationPage{
+		Conversations: make([]*models.ConversationResponse, 0, len(conversations)),
+		HasMore:       hasMore,
+	}
+
+	for _, conversation := range conversations {
+		response := &models.ConversationResponse{
+			Group:         conversation.Group,
+			LastMessage:   conversation.LastMessage,
+			LastMessageAt: conversation.LastMessage.CreatedAt,
+			UnreadCount:   conversation.UnreadCount,
+		}
+		if conversation.User != nil {
+			response.User = userResponse(conversation.User)
+		}
+		result.Conversations = append(result.Conversations, response)
+	}
+
+	if len(conversations) > 0 {
+		result.Before = database.CursorFor(conversations[len(conversations)-1].LastMessage).String()
+		result.After = database.CursorFor(conversations[0].LastMessage).String()
+	}
+
+	return result
+}
+
+// userResponse converts a user to its client representation
+func userResponse(user *models.User) models.UserResponse {
+	return models.UserResponse{
+		ID:          user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		CreatedAt:   user.CreatedAt,
+		Deleted:     user.Deleted(),
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+func TestGetConversations(t *testing.T) {
+	router, mockDB, currentUserID := setupMessageTest(t)
+
+	// Two conversations, most recent first, plus the extra row
+	now := time.Now().UTC()
+	var summaries []*models.ConversationSummary
+	for i, name := range []string{"bob", "carol", "dave"} {
+		partner := &models.User{ID: uuid.New(), Username: name, Email: name + "@example.com", PasswordHash: "secret"}
+		summaries = append(summaries, &models.ConversationSummary{
+			User: partner,
+			LastMessage: &models.Message{
+				ID:         uuid.New(),
+				SenderID:   partner.ID,
+				ReceiverID: currentUserID,
+				Content:    "hi from " + name,
+				CreatedAt:  now.Add(-time.Duration(i) * time.Minute),
+			},
+			UnreadCount: i + 1,
+		})
+	}
+
+	// Groups are listed by their name and have no user
+	groupID := uuid.New()
+	withGroup := []*models.ConversationSummary{
+		{
+			Group: &models.Group{ID: groupID, Name: "team", MemberIDs: []uuid.UUID{currentUserID}},
+			LastMessage: &models.Message{
+				ID:             uuid.New(),
+				SenderID:       currentUserID,
+				ConversationID: &groupID,
+				Content:        "hi team",
+				CreatedAt:      now.Add(time.Minute),
+			},
+		},
+		summaries[0],
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		setupMock  func()
+		wantStatus int
+		wantNames  []string
+		wantMore   bool
+	}{
+		{
+			name:  "first page",
+			query: "?limit=2",
+			setupMock: func() {
+				mockDB.On("GetConversations", currentUserID, database.PageOptions{Limit: 3}).
+					Return(summaries, nil).Once()
+			},
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"bob", "carol"},
+			wantMore:   true,
+		},
+		{
+			name:  "groups",
+			query: "?limit=5",
+			setupMock: func() {
+				mockDB.On("GetConversations", currentUserID, database.PageOptions{Limit: 6}).
+					Return(withGroup, nil).Once()
+			},
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"team", "bob"},
+		},
+		{
+			name:  "no conversations",
+			query: "",
+			setupMock: func() {
+				mockDB.On("GetConversations", currentUserID, database.PageOptions{Limit: defaultPageLimit + 1}).
+					Return(nil, nil).Once()
+			},
+			wantStatus: http.StatusOK,
+			wantNames:  []string{},
+		},
+		{
+			name:  "database error",
+			query: "?limit=10",
+			setupMock: func() {
+				mockDB.On("GetConversations", currentUserID, database.PageOptions{Limit: 11}).
+					Return(nil, errors.New("connection lost")).Once()
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "invalid limit",
+			query:      "?limit=0",
+			setupMock:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setupMock()
+
+			req, _ := http.NewRequest("GET", "/api/conversations"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantNames != nil {
+				var response models.ConversationPage
+				json.Unmarshal(w.Body.Bytes(), &response)
+
+				names := []string{}
+				for _, conversation := range response.Conversations {
+					if conversation.Group != nil {
+						assert.Zero(t, conversation.User)
+						names = append(names, conversation.Group.Name)
+					} else {
+						names = append(names, conversation.User.Username)
+					}
+				}
+				assert.Equal(t, tt.wantNames, names)
+				assert.Equal(t, tt.wantMore, response.HasMore)
+
+				if len(tt.wantNames) > 0 && tt.wantNames[0] == "bob" {
+					first := response.Conversations[0]
+					assert.Equal(t, summaries[0].LastMessage.ID, first.LastMessage.ID)
+					assert.True(t, summaries[0].LastMessage.CreatedAt.Equal(first.LastMessageAt))
+					assert.Equal(t, 1, first.UnreadCount)
+					assert.Equal(t, database.CursorFor(summaries[1].LastMessage).String(), response.Before)
+					assert.NotContains(t, w.Body.String(), "secret")
+				}
+			}
+
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// CreateGroup creates a group conversation with the authenticated user as a member
+func (h *MessageHandler) CreateGroup(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// The userID from context is now a UUID object
+	userUUID := userID.(uuid.UUID)
+
+	var req models.GroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Group name is required"})
+		return
+	}
+
+	group, err := h.DB.CreateGroup(userUUID, name, req.MemberIDs)
+	if err == database.ErrUserNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown member"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to create group for user %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// GetGroups returns the authenticated user's groups, most recently active first
+func (h *MessageHandler) GetGroups(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// The userID from context is now a UUID object
+	userUUID := userID.(uuid.UUID)
+
+	groups, err := h.DB.GetGroupsByUser(userUUID)
+	if err != nil {
+		h.log.Error("Failed to load groups for user %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve groups"})
+		return
+	}
+
+	if groups == nil {
+		groups = []*models.Group{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"groups": groups})
+}
+
+// GetGroup returns a group the authenticated user is a member of
+func (h *MessageHandler) GetGroup(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	group, ok := h.memberGroup(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// RenameGroup renames a group the authenticated user is a member of
+func (h *MessageHandler) RenameGroup(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req models.GroupRenameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Group name is required"})
+		return
+	}
+
+	group, ok := h.memberGroup(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	if err := h.DB.RenameGroup(group.ID, name); err != nil {
+		h.log.Error("Failed to rename group %s: %v", group.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename group"})
+		return
+	}
+
+	groupID := group.ID
+	group, err := h.DB.GetGroupByID(groupID)
+	if err != nil {
+		h.log.Error("Failed to reload group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// LeaveGroup removes the authenticated user from a group. The group and its
+// history remain for the other members.
+func (h *MessageHandler) LeaveGroup(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// The userID from context is now a UUID object
+	userUUID := userID.(uuid.UUID)
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	err = h.DB.LeaveGroup(groupID, userUUID)
+	if err == database.ErrGroupNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	if err == database.ErrNotGroupMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to remove user %s from group %s: %v", userUUID, groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Left group"})
+}
+
+// GetGroupMessages returns a page of a group's messages, oldest first. Without
+// cursors it returns the latest page.
+func (h *MessageHandler) GetGroupMessages(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	page, err := parsePageOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, ok := h.memberGroup(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	messages, err := h.DB.GetGroupMessages(group.ID, pageQuery(page))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newMessagePage(messages, page, false))
+}
+
+// sendGroupMessage stores a message addressed to a group and publishes it
+// for the group's members, including the sender's other devices
+func (h *MessageHandler) sendGroupMessage(c *gin.Context, senderID uuid.UUID, req models.MessageRequest) {
+	message, created, err := h.DB.CreateGroupMessageOnce(senderID, req.ConversationID, req.Content, req.ClientMsgID)
+	if err == database.ErrGroupNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	if err == database.ErrNotGroupMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !created {
+		c.JSON(http.StatusOK, message)
+		return
+	}
+
+	h.Events.Publish(events.MessageCreated{Message: message})
+
+	c.JSON(http.StatusCreated, message)
+}
+
+// memberGroup loads the group named by the groupID parameter and checks that
+// userID is a member. It writes the error response and reports false otherwise.
+func (h *MessageHandler) memberGroup(c *gin.Context, userID uuid.UUID) (*models.Group, bool) {
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return nil, false
+	}
+
+	group, err := h.DB.GetGroupByID(groupID)
+	if err == database.ErrGroupNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return nil, false
+	}
+	if err != nil {
+		h.log.Error("Failed to load group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve group"})
+		return nil, false
+	}
+
+	if !slices.Contains(group.MemberIDs, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+		return nil, false
+	}
+
+	return group, true
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+func TestCreateGroup(t *testing.T) {
+	router, mockDB, currentUserID := setupMessageTest(t)
+
+	bobID := uuid.New()
+	group := &models.Group{
+		ID:        uuid.New(),
+		Name:      "Weekend",
+		CreatedBy: currentUserID,
+		MemberIDs: []uuid.UUID{currentUserID, bobID},
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		setupMock  func()
+		wantStatus int
+	}{
+		{
+			name: "created",
+			body: `{"name": "  Weekend ", "member_ids": ["` + bobID.String() + `"]}`,
+			setupMock: func() {
+				mockDB.On("CreateGroup", currentUserID, "Weekend", []uuid.UUID{bobID}).Return(group, nil).Once()
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "unknown member",
+			body: `{"name": "Ghosts", "member_ids": ["` + bobID.String() + `"]}`,
+			setupMock: func() {
+				mockDB.On("CreateGroup", currentUserID, "Ghosts", []uuid.UUID{bobID}).Return(nil, database.ErrUserNotFound).Once()
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "blank name",
+			body:       `{"name": "   ", "member_ids": ["` + bobID.String() + `"]}`,
+			setupMock:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "no members",
+			body:       `{"name": "Alone", "member_ids": []}`,
+			setupMock:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setupMock()
+
+			req, _ := http.NewRequest("POST", "/api/groups", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusCreated {
+				var response models.Group
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, group.ID, response.ID)
+				assert.Equal(t, group.MemberIDs, response.MemberIDs)
+			}
+		})
+	}
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestGroupMembership(t *testing.T) {
+	router, mockDB, currentUserID := setupMessageTest(t)
+
+	member := &models.Group{ID: uuid.New(), Name: "Weekend", MemberIDs: []uuid.UUID{uuid.New(), currentUserID}}
+	other := &models.Group{ID: uuid.New(), Name: "Private", MemberIDs: []uuid.UUID{uuid.New()}}
+	missing := uuid.New()
+
+	mockDB.On("GetGroupByID", member.ID).Return(member, nil)
+	mockDB.On("GetGroupByID", other.ID).Return(other, nil)
+	mockDB.On("GetGroupByID", missing).Return(nil, database.ErrGroupNotFound)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		setupMock  func()
+		wantStatus int
+	}{
+		{name: "get group", method: "GET", path: "/api/groups/" + member.ID.String(), wantStatus: http.StatusOK},
+		{name: "get other's group", method: "GET", path: "/api/groups/" + other.ID.String(), wantStatus: http.StatusForbidden},
+		{name: "get missing group", method: "GET", path: "/api/groups/" + missing.String(), wantStatus: http.StatusNotFound},
+		{name: "invalid ID", method: "GET", path: "/api/groups/not-a-uuid", wantStatus: http.StatusBadRequest},
+		{
+			name: "rename", method: "PATCH", path: "/api/groups/" + member.ID.String(), body: `{"name": "Saturday"}`,
+			setupMock: func() {
+				mockDB.On("RenameGroup", member.ID, "Saturday").Return(nil).Once()
+			},
+			wantStatus: http.StatusOK,
+		},
+		{name: "rename other's group", method: "PATCH", path: "/api/groups/" + other.ID.String(), body: `{"name": "Mine"}`, wantStatus: http.StatusForbidden},
+		{
+			name: "leave", method: "POST", path: "/api/groups/" + member.ID.String() + "/leave",
+			setupMock: func() {
+				mockDB.On("LeaveGroup", member.ID, currentUserID).Return(nil).Once()
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "leave other's group", method: "POST", path: "/api/groups/" + other.ID.String() + "/leave",
+			setupMock: func() {
+				mockDB.On("LeaveGroup", other.ID, currentUserID).Return(database.ErrNotGroupMember).Once()
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{name: "messages of other's group", method: "GET", path: "/api/groups/" + other.ID.String() + "/messages", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setupMock != nil {
+				tt.setupMock()
+			}
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+		})
+	}
+
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "GetGroupMessages", mock.Anything, mock.Anything)
+}
+
+func TestGroupMessages(t *testing.T) {
+	router, mockDB, currentUserID := setupMessageTest(t)
+
+	group := &models.Group{ID: uuid.New(), Name: "Weekend", MemberIDs: []uuid.UUID{currentUserID, uuid.New()}}
+	mockDB.On("GetGroupByID", group.ID).Return(group, nil)
+
+	// Oldest first, plus the extra row
+	now := time.Now().UTC()
+	var messages []*models.Message
+	for i := 3; i > 0; i-- {
+		messages = append(messages, &models.Message{
+			ID:             uuid.New(),
+			SenderID:       currentUserID,
+			ConversationID: &group.ID,
+			Content:        "hi",
+			CreatedAt:      now.Add(-time.Duration(i) * time.Minute),
+		})
+	}
+
+	t.Run("page", func(t *testing.T) {
+		mockDB.On("GetGroupMessages", group.ID, database.PageOptions{Limit: 3}).Return(messages, nil).Once()
+
+		req, _ := http.NewRequest("GET", "/api/groups/"+group.ID.String()+"/messages?limit=2", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.MessagePage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Messages, 2)
+		assert.Equal(t, messages[1].ID, response.Messages[0].ID)
+		assert.Equal(t, group.ID, *response.Messages[0].ConversationID)
+		assert.True(t, response.HasMore)
+	})
+
+	t.Run("send", func(t *testing.T) {
+		message := &models.Message{ID: uuid.New(), SenderID: currentUserID, ConversationID: &group.ID, Content: "hello group", CreatedAt: now}
+		mockDB.On("CreateGroupMessageOnce", currentUserID, group.ID, "hello group", "").Return(message, true, nil).Once()
+
+		body := `{"conversation_id": "` + group.ID.String() + `", "content": "hello group"}`
+		req, _ := http.NewRequest("POST", "/api/messages", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, group.ID.String(), response["conversation_id"])
+		assert.NotContains(t, response, "receiver_id")
+	})
+
+	t.Run("send as non-member", func(t *testing.T) {
+		mockDB.On("CreateGroupMessageOnce", currentUserID, group.ID, "let me in", "").Return(nil, false, database.ErrNotGroupMember).Once()
+
+		body := `{"conversation_id": "` + group.ID.String() + `", "content": "let me in"}`
+		req, _ := http.NewRequest("POST", "/api/messages", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("both receiver and conversation", func(t *testing.T) {
+		body := `{"receiver_id": "` + uuid.New().String() + `", "conversation_id": "` + group.ID.String() + `", "content": "hi"}`
+		req, _ := http.NewRequest("POST", "/api/messages", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	mockDB.AssertExpectations(t)
+}
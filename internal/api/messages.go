@@ -1,33 +1,42 @@
 package api
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
 	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
 	"github.com/ammar1510/converse/internal/logger"
 	"github.com/ammar1510/converse/internal/models"
-	"github.com/ammar1510/converse/internal/websocket"
 )
 
-// Global WebSocket manager instance
-var WSManager *websocket.Manager
+// Page sizes for message listings
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
 var log = logger.New("api-messages")
 
 // MessageHandler handles message-related routes
 type MessageHandler struct {
-	DB  database.DBInterface
-	log *logger.Logger
+	DB database.DBInterface
+	// Events is where new messages and read messages are published
+	Events *events.Bus
+	log    *logger.Logger
 }
 
-// NewMessageHandler creates a new message handler
-func NewMessageHandler(db database.DBInterface) *MessageHandler {
+// NewMessageHandler creates a new message handler that publishes new and
+// read messages on bus
+func NewMessageHandler(db database.DBInterface, bus *events.Bus) *MessageHandler {
 	return &MessageHandler{
-		DB:  db,
-		log: logger.New("api-messages"),
+		DB:     db,
+		Events: bus,
+		log:    logger.New("api-messages"),
 	}
 }
 
@@ -48,39 +57,41 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 	// The userID from context is now a UUID object
 	senderID := userID.(uuid.UUID)
 
+	// A message goes either to a user or to a group
+	if (req.ReceiverID == uuid.Nil) == (req.ConversationID == uuid.Nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of receiver_id and conversation_id is required"})
+		return
+	}
+
+	if req.ConversationID != uuid.Nil {
+		h.sendGroupMessage(c, senderID, req)
+		return
+	}
+
 	// Create the message
-	message, err := h.DB.CreateMessage(senderID, req.ReceiverID, req.Content)
+	message, created, err := h.DB.CreateMessageOnce(senderID, req.ReceiverID, req.Content, req.ClientMsgID)
+	if err == database.ErrUserNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Receiver not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Notify the receiver via WebSocket if they're connected
-	if WSManager != nil {
-		// Create WebSocket message
-		wsMessage := websocket.WebSocketMessage{
-			Type:       "message",
-			SenderID:   senderID,
-			ReceiverID: req.ReceiverID,
-			Content:    req.Content,
-			Timestamp:  message.CreatedAt,
-		}
-
-		// Convert to JSON
-		messageJSON, err := json.Marshal(wsMessage)
-		if err == nil {
-			// Send to receiver
-			WSManager.SendToUser(req.ReceiverID, messageJSON)
-			h.log.Debug("Sent WebSocket notification to user %s", req.ReceiverID)
-		} else {
-			h.log.Error("Failed to marshal WebSocket message: %v", err)
-		}
+	// A retry of a message already stored was delivered the first time
+	if !created {
+		c.JSON(http.StatusOK, message)
+		return
 	}
 
+	// The receiver and the sender's devices hear about it from the subscribers
+	h.Events.Publish(events.MessageCreated{Message: message})
+
 	c.JSON(http.StatusCreated, message)
 }
 
-// GetMessages returns all messages for the authenticated user
+// GetMessages returns a page of the authenticated user's messages, newest first
 func (h *MessageHandler) GetMessages(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -91,16 +102,23 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 	// The userID from context is now a UUID object
 	userUUID := userID.(uuid.UUID)
 
-	messages, err := h.DB.GetMessagesByUser(userUUID)
+	page, err := parsePageOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	messages, err := h.DB.GetMessagesByUser(userUUID, pageQuery(page))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	c.JSON(http.StatusOK, newMessagePage(messages, page, true))
 }
 
-// GetConversation returns all messages between the authenticated user and another user
+// GetConversation returns a page of the messages between the authenticated user
+// and another user, oldest first. Without cursors it returns the latest page.
 func (h *MessageHandler) GetConversation(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -118,13 +136,19 @@ func (h *MessageHandler) GetConversation(c *gin.Context) {
 		return
 	}
 
-	messages, err := h.DB.GetConversation(userUUID, otherUserID)
+	page, err := parsePageOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	messages, err := h.DB.GetConversation(userUUID, otherUserID, pageQuery(page))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	c.JSON(http.StatusOK, newMessagePage(messages, page, false))
 }
 
 // MarkMessageAsRead marks a message as read
@@ -153,6 +177,13 @@ func (h *MessageHandler) MarkMessageAsRead(c *gin.Context) {
 		return
 	}
 
+	// Group messages have a single read flag and no receiver, so there is
+	// no telling which member read them
+	if message.ConversationID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Group messages can't be marked as read"})
+		return
+	}
+
 	// Check if the authenticated user is the intended recipient
 	if message.ReceiverID != userUUID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to mark this message as read"})
@@ -166,23 +197,90 @@ func (h *MessageHandler) MarkMessageAsRead(c *gin.Context) {
 		return
 	}
 
-	// Notify the sender via WebSocket that their message was read
-	if WSManager != nil {
-		// Create WebSocket message
-		wsMessage := websocket.WebSocketMessage{
-			Type:       "read_receipt",
-			SenderID:   userUUID,
-			ReceiverID: message.SenderID,
-			Timestamp:  message.CreatedAt,
-		}
+	h.Events.Publish(events.MessageRead{Message: message, ReaderID: userUUID})
 
-		// Convert to JSON
-		messageJSON, err := json.Marshal(wsMessage)
-		if err == nil {
-			// Send to original sender
-			WSManager.SendToUser(message.SenderID, messageJSON)
+	c.JSON(http.StatusOK, gin.H{"message": "Message marked as read"})
+}
+
+// parsePageOptions reads the before, after and limit query parameters
+func parsePageOptions(c *gin.Context) (database.PageOptions, error) {
+	page := database.PageOptions{Limit: defaultPageLimit}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return page, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
 		}
+		page.Limit = limit
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Message marked as read"})
+	var err error
+	if page.Before, err = parseCursorParam(c, "before"); err != nil {
+		return page, err
+	}
+	if page.After, err = parseCursorParam(c, "after"); err != nil {
+		return page, err
+	}
+
+	return page, nil
+}
+
+// parseCursorParam decodes an optional cursor query parameter
+func parseCursorParam(c *gin.Context, param string) (*database.Cursor, error) {
+	token := c.Query(param)
+	if token == "" {
+		return nil, nil
+	}
+
+	cursor, err := database.ParseCursor(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s cursor", param)
+	}
+	return cursor, nil
+}
+
+// pageQuery asks for one extra row so newMessagePage can tell whether more
+// messages follow
+func pageQuery(page database.PageOptions) database.PageOptions {
+	page.Limit++
+	return page
+}
+
+// trimPage drops the extra row fetched by pageQuery, if present, and reports
+// whether there was one. items are newest first when newestFirst is set and
+// oldest first otherwise.
+func trimPage[T any](items []T, page database.PageOptions, newestFirst bool) ([]T, bool) {
+	if len(items) <= page.Limit {
+		return items, false
+	}
+
+	// The extra row is the one farthest along the direction being paged:
+	// the newest when paging forward with "after", the oldest otherwise
+	dropNewest := page.After != nil
+	if dropNewest == newestFirst {
+		return items[1:], true
+	}
+	return items[:page.Limit], true
+}
+
+// newMessagePage trims the extra row fetched by pageQuery and builds the
+// response envelope. messages are newest first when newestFirst is set and
+// oldest first otherwise.
+func newMessagePage(messages []*models.Message, page database.PageOptions, newestFirst bool) models.MessagePage {
+	result := models.MessagePage{}
+	result.Messages, result.HasMore = trimPage(messages, page, newestFirst)
+
+	if len(result.Messages) == 0 {
+		result.Messages = []*models.Message{}
+		return result
+	}
+
+	oldest, newest := result.Messages[0], result.Messages[len(result.Messages)-1]
+	if newestFirst {
+		oldest, newest = newest, oldest
+	}
+	result.Before = database.CursorFor(oldest).String()
+	result.After = database.CursorFor(newest).String()
+
+	return result
 }
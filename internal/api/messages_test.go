@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,8 +14,10 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
 	"github.com/ammar1510/converse/internal/models"
 )
 
@@ -34,24 +37,417 @@ func (m *MockDB) CreateMessage(senderID, receiverID uuid.UUID, content string) (
 	return args.Get(0).(*models.Message), args.Error(1)
 }
 
-// GetMessagesByUser mocks retrieving all messages for a user
-func (m *MockDB) GetMessagesByUser(userID uuid.UUID) ([]*models.Message, error) {
+// CreateMessageOnce mocks the deduplicated creation of a message
+func (m *MockDB) CreateMessageOnce(senderID, receiverID uuid.UUID, content, clientMsgID string) (*models.Message, bool, error) {
+	args := m.Called(senderID, receiverID, content, clientMsgID)
+	if args.Get(0) == nil {
+		return nil, false, args.Error(2)
+	}
+	return args.Get(0).(*models.Message), args.Bool(1), args.Error(2)
+}
+
+// GetMessagesByUser mocks retrieving a page of messages for a user
+func (m *MockDB) GetMessagesByUser(userID uuid.UUID, page database.PageOptions) ([]*models.Message, error) {
+	args := m.Called(userID, page)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Message), args.Error(1)
+}
+
+// GetConversation mocks retrieving a page of messages between two users
+func (m *MockDB) GetConversation(userID1, userID2 uuid.UUID, page database.PageOptions) ([]*models.Message, error) {
+	args := m.Called(userID1, userID2, page)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Message), args.Error(1)
+}
+
+// SearchMessages mocks searching a user's messages
+func (m *MockDB) SearchMessages(userID uuid.UUID, query string, page database.PageOptions) ([]*models.SearchResult, error) {
+	args := m.Called(userID, query, page)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.SearchResult), args.Error(1)
+}
+
+// GetConversations mocks retrieving a page of a user's conversations
+func (m *MockDB) GetConversations(userID uuid.UUID, page database.PageOptions) ([]*models.ConversationSummary, error) {
+	args := m.Called(userID, page)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.ConversationSummary), args.Error(1)
+}
+
+// GetConversationPartners mocks listing the users a user talks to
+func (m *MockDB) GetConversationPartners(userID uuid.UUID) ([]uuid.UUID, error) {
 	args := m.Called(userID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
+// CreateGroup mocks creating a group
+func (m *MockDB) CreateGroup(creatorID uuid.UUID, name string, memberIDs []uuid.UUID) (*models.Group, error) {
+	args := m.Called(creatorID, name, memberIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Group), args.Error(1)
+}
+
+// GetGroupByID mocks retrieving a group by ID
+func (m *MockDB) GetGroupByID(groupID uuid.UUID) (*models.Group, error) {
+	args := m.Called(groupID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Group), args.Error(1)
+}
+
+// GetGroupsByUser mocks retrieving a user's groups
+func (m *MockDB) GetGroupsByUser(userID uuid.UUID) ([]*models.Group, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Group), args.Error(1)
+}
+
+// RenameGroup mocks renaming a group
+func (m *MockDB) RenameGroup(groupID uuid.UUID, name string) error {
+	args := m.Called(groupID, name)
+	return args.Error(0)
+}
+
+// LeaveGroup mocks removing a member from a group
+func (m *MockDB) LeaveGroup(groupID, userID uuid.UUID) error {
+	args := m.Called(groupID, userID)
+	return args.Error(0)
+}
+
+// CreateGroupMessage mocks sending a message to a group
+func (m *MockDB) CreateGroupMessage(senderID, groupID uuid.UUID, content string) (*models.Message, error) {
+	args := m.Called(senderID, groupID, content)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Message), args.Error(1)
+}
+
+// CreateGroupMessageOnce mocks the deduplicated sending of a group message
+func (m *MockDB) CreateGroupMessageOnce(senderID, groupID uuid.UUID, content, clientMsgID string) (*models.Message, bool, error) {
+	args := m.Called(senderID, groupID, content, clientMsgID)
+	if args.Get(0) == nil {
+		return nil, false, args.Error(2)
+	}
+	return args.Get(0).(*models.Message), args.Bool(1), args.Error(2)
+}
+
+// GetGroupMessages mocks retrieving a page of a group's messages
+func (m *MockDB) GetGroupMessages(groupID uuid.UUID, page database.PageOptions) ([]*models.Message, error) {
+	args := m.Called(groupID, page)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
 	return args.Get(0).([]*models.Message), args.Error(1)
 }
 
-// GetConversation mocks retrieving messages between two users
-func (m *MockDB) GetConversation(userID1, userID2 uuid.UUID) ([]*models.Message, error) {
-	args := m.Called(userID1, userID2)
+// CreateRefreshToken mocks storing a refresh token
+func (m *MockDB) CreateRefreshToken(token *models.RefreshToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+// GetRefreshToken mocks looking up a refresh token by hash
+func (m *MockDB) GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	args := m.Called(tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.RefreshToken), args.Error(1)
+}
+
+// RotateRefreshToken mocks exchanging a refresh token for its replacement
+func (m *MockDB) RotateRefreshToken(usedID uuid.UUID, next *models.RefreshToken) error {
+	args := m.Called(usedID, next)
+	return args.Error(0)
+}
+
+// RevokeRefreshTokenFamily mocks revoking a refresh token family
+func (m *MockDB) RevokeRefreshTokenFamily(familyID uuid.UUID) error {
+	args := m.Called(familyID)
+	return args.Error(0)
+}
+
+// CreateSession mocks storing a session
+func (m *MockDB) CreateSession(session *models.Session) error {
+	args := m.Called(session)
+	return args.Error(0)
+}
+
+// GetSession mocks retrieving a session by ID
+func (m *MockDB) GetSession(sessionID uuid.UUID) (*models.Session, error) {
+	args := m.Called(sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Session), args.Error(1)
+}
+
+// GetSessionsByUser mocks retrieving a user's active sessions
+func (m *MockDB) GetSessionsByUser(userID uuid.UUID) ([]*models.Session, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Session), args.Error(1)
+}
+
+// TouchSession mocks recording a session's use
+func (m *MockDB) TouchSession(sessionID uuid.UUID, ipAddress string) error {
+	args := m.Called(sessionID, ipAddress)
+	return args.Error(0)
+}
+
+// RevokeSession mocks revoking a session
+func (m *MockDB) RevokeSession(sessionID uuid.UUID) error {
+	args := m.Called(sessionID)
+	return args.Error(0)
+}
+
+// RevokeUserSessions mocks revoking all of a user's sessions
+func (m *MockDB) RevokeUserSessions(userID uuid.UUID) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+// RevokeOtherSessions mocks ending all but one of a user's sessions
+func (m *MockDB) RevokeOtherSessions(userID, keepSessionID uuid.UUID) error {
+	args := m.Called(userID, keepSessionID)
+	return args.Error(0)
+}
+
+// CreateEmailToken mocks storing an email token
+func (m *MockDB) CreateEmailToken(token *models.EmailToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+// UseEmailToken mocks redeeming an email token
+func (m *MockDB) UseEmailToken(tokenHash, purpose string) (*models.EmailToken, error) {
+	args := m.Called(tokenHash, purpose)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.EmailToken), args.Error(1)
+}
+
+// ExpireResetTokens mocks expiring a user's password reset tokens
+func (m *MockDB) ExpireResetTokens(userID uuid.UUID) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+// UpdatePassword mocks changing a user's password hash
+func (m *MockDB) UpdatePassword(userID uuid.UUID, passwordHash string) error {
+	args := m.Called(userID, passwordHash)
+	return args.Error(0)
+}
+
+// MarkEmailVerified mocks marking a user's email verified
+func (m *MockDB) MarkEmailVerified(userID uuid.UUID, email string) error {
+	args := m.Called(userID, email)
+	return args.Error(0)
+}
+
+// DeleteUser mocks deleting an account
+func (m *MockDB) DeleteUser(userID uuid.UUID) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+// UpdateProfile mocks setting a user's display name and avatar
+func (m *MockDB) UpdateProfile(userID uuid.UUID, displayName, avatarURL string) error {
+	args := m.Called(userID, displayName, avatarURL)
+	return args.Error(0)
+}
+
+// UpdateEmail mocks changing a user's email
+func (m *MockDB) UpdateEmail(userID uuid.UUID, email string) error {
+	args := m.Called(userID, email)
+	return args.Error(0)
+}
+
+// SaveTOTPSecret mocks storing a pending TOTP secret
+func (m *MockDB) SaveTOTPSecret(userID uuid.UUID, secret string) error {
+	args := m.Called(userID, secret)
+	return args.Error(0)
+}
+
+// GetTOTP mocks retrieving a user's TOTP secret
+func (m *MockDB) GetTOTP(userID uuid.UUID) (*models.TOTP, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TOTP), args.Error(1)
+}
+
+// EnableTOTP mocks enabling a pending TOTP secret
+func (m *MockDB) EnableTOTP(userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	args := m.Called(userID, step, recoveryCodeHashes)
+	return args.Error(0)
+}
+
+// UseTOTPStep mocks recording an accepted TOTP code
+func (m *MockDB) UseTOTPStep(userID uuid.UUID, step int64) error {
+	args := m.Called(userID, step)
+	return args.Error(0)
+}
+
+// UseRecoveryCode mocks using up a recovery code
+func (m *MockDB) UseRecoveryCode(userID uuid.UUID, codeHash string) error {
+	args := m.Called(userID, codeHash)
+	return args.Error(0)
+}
+
+// DisableTOTP mocks turning 2FA off
+func (m *MockDB) DisableTOTP(userID uuid.UUID) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+// CreateTwoFactorChallenge mocks storing a login challenge
+func (m *MockDB) CreateTwoFactorChallenge(challenge *models.TwoFactorChallenge) error {
+	args := m.Called(challenge)
+	return args.Error(0)
+}
+
+// GetTwoFactorChallenge mocks looking up a login challenge by hash
+func (m *MockDB) GetTwoFactorChallenge(tokenHash string) (*models.TwoFactorChallenge, error) {
+	args := m.Called(tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TwoFactorChallenge), args.Error(1)
+}
+
+// AttemptTwoFactorChallenge mocks counting an attempt at a login challenge
+func (m *MockDB) AttemptTwoFactorChallenge(challengeID uuid.UUID, maxAttempts int) error {
+	args := m.Called(challengeID, maxAttempts)
+	return args.Error(0)
+}
+
+// UseTwoFactorChallenge mocks using up a login challenge
+func (m *MockDB) UseTwoFactorChallenge(challengeID uuid.UUID) error {
+	args := m.Called(challengeID)
+	return args.Error(0)
+}
+
+// GetUserMessages mocks loading everything a user sent or received
+func (m *MockDB) GetUserMessages(userID uuid.UUID) ([]*models.Message, error) {
+	args := m.Called(userID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]*models.Message), args.Error(1)
 }
 
+// RecordLoginFailure mocks counting a failed login
+func (m *MockDB) RecordLoginFailure(key string, at, since time.Time) (*models.LoginAttempts, error) {
+	args := m.Called(key, at, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.LoginAttempts), args.Error(1)
+}
+
+// GetLoginAttempts mocks looking up failed logins
+func (m *MockDB) GetLoginAttempts(key string) (*models.LoginAttempts, error) {
+	args := m.Called(key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.LoginAttempts), args.Error(1)
+}
+
+// ClearLoginAttempts mocks forgetting failed logins
+func (m *MockDB) ClearLoginAttempts(key string) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+// PruneLoginAttempts mocks forgetting stale failed logins
+func (m *MockDB) PruneLoginAttempts(before time.Time) error {
+	args := m.Called(before)
+	return args.Error(0)
+}
+
+// ListUsers mocks the admin user listing
+func (m *MockDB) ListUsers(filter database.UserFilter, page database.PageOptions) ([]*models.User, error) {
+	args := m.Called(filter, page)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.User), args.Error(1)
+}
+
+// SetUserRole mocks changing a user's role
+func (m *MockDB) SetUserRole(userID uuid.UUID, role models.Role) error {
+	args := m.Called(userID, role)
+	return args.Error(0)
+}
+
+// SetUserSuspended mocks suspending or unsuspending an account
+func (m *MockDB) SetUserSuspended(userID uuid.UUID, suspended bool) error {
+	args := m.Called(userID, suspended)
+	return args.Error(0)
+}
+
+// GetStats mocks counting what the server holds
+func (m *MockDB) GetStats(since time.Time) (*models.SystemStats, error) {
+	args := m.Called(since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.SystemStats), args.Error(1)
+}
+
+// AppendEvent mocks storing an event for a user
+func (m *MockDB) AppendEvent(userID uuid.UUID, payload []byte) (*models.Event, error) {
+	args := m.Called(userID, payload)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Event), args.Error(1)
+}
+
+// GetEventsSince mocks reading a user's events after a seq
+func (m *MockDB) GetEventsSince(userID uuid.UUID, afterSeq int64, limit int) ([]*models.Event, error) {
+	args := m.Called(userID, afterSeq, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Event), args.Error(1)
+}
+
+// GetLastEventSeq mocks reading the seq of a user's latest event
+func (m *MockDB) GetLastEventSeq(userID uuid.UUID) (int64, error) {
+	args := m.Called(userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// PruneEvents mocks deleting old events
+func (m *MockDB) PruneEvents(before time.Time) error {
+	args := m.Called(before)
+	return args.Error(0)
+}
+
 // GetUserByID mocks retrieving a user by ID
 func (m *MockDB) GetUserByID(id uuid.UUID) (*models.User, error) {
 	args := m.Called(id)
@@ -151,7 +547,7 @@ func setupMessageTest(t *testing.T) (*gin.Engine, *MockDB, uuid.UUID) {
 	mockDB := new(MockDB)
 
 	// Create message handler with mock DB using the constructor
-	handler := NewMessageHandler(mockDB)
+	handler := NewMessageHandler(mockDB, events.NewBus())
 
 	// Set up routes with authentication middleware mock
 	group := router.Group("/api")
@@ -164,8 +560,16 @@ func setupMessageTest(t *testing.T) (*gin.Engine, *MockDB, uuid.UUID) {
 	// Register message routes
 	group.POST("/messages", handler.SendMessage)
 	group.GET("/messages", handler.GetMessages)
+	group.GET("/messages/search", handler.SearchMessages)
 	group.GET("/messages/conversation/:userID", handler.GetConversation)
 	group.PUT("/messages/:messageID/read", handler.MarkMessageAsRead)
+	group.GET("/conversations", handler.GetConversations)
+	group.POST("/groups", handler.CreateGroup)
+	group.GET("/groups", handler.GetGroups)
+	group.GET("/groups/:groupID", handler.GetGroup)
+	group.PATCH("/groups/:groupID", handler.RenameGroup)
+	group.POST("/groups/:groupID/leave", handler.LeaveGroup)
+	group.GET("/groups/:groupID/messages", handler.GetGroupMessages)
 
 	return router, mockDB, userID
 }
@@ -191,7 +595,7 @@ func TestCreateMessage(t *testing.T) {
 		}
 
 		// Setup mock expectations
-		mockDB.On("CreateMessage", senderID, receiverID, messageContent).Return(expectedMessage, nil).Once()
+		mockDB.On("CreateMessageOnce", senderID, receiverID, messageContent, "").Return(expectedMessage, true, nil).Once()
 
 		// Create request JSON
 		reqBody := map[string]interface{}{
@@ -227,6 +631,50 @@ func TestCreateMessage(t *testing.T) {
 		mockDB.AssertExpectations(t)
 	})
 
+	// Test case: a resent message returns the stored one
+	t.Run("Resent message", func(t *testing.T) {
+		receiverID := uuid.New()
+		storedMessage := &models.Message{
+			ID:         uuid.New(),
+			SenderID:   senderID,
+			ReceiverID: receiverID,
+			Content:    "Hello again",
+			CreatedAt:  time.Now(),
+		}
+		mockDB.On("CreateMessageOnce", senderID, receiverID, "Hello again", "c-1").Return(storedMessage, false, nil).Once()
+
+		jsonData, _ := json.Marshal(map[string]interface{}{
+			"receiver_id":   receiverID.String(),
+			"content":       "Hello again",
+			"client_msg_id": "c-1",
+		})
+		req, _ := http.NewRequest("POST", "/api/messages", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, storedMessage.ID.String(), response["id"])
+		mockDB.AssertExpectations(t)
+	})
+
+	// Test case: client message ID too long
+	t.Run("Client message ID too long", func(t *testing.T) {
+		jsonData, _ := json.Marshal(map[string]interface{}{
+			"receiver_id":   uuid.New().String(),
+			"content":       "Hello!",
+			"client_msg_id": strings.Repeat("x", 65),
+		})
+		req, _ := http.NewRequest("POST", "/api/messages", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
 	// Test case: missing receiver ID
 	t.Run("Missing receiver ID", func(t *testing.T) {
 		// Setup
@@ -288,7 +736,7 @@ func TestGetMessages(t *testing.T) {
 		}
 
 		// Setup mock expectations
-		mockDB.On("GetMessagesByUser", currentUserID).Return(messages, nil).Once()
+		mockDB.On("GetMessagesByUser", currentUserID, database.PageOptions{Limit: defaultPageLimit + 1}).Return(messages, nil).Once()
 
 		// Create request
 		req, _ := http.NewRequest("GET", "/api/messages", nil)
@@ -309,11 +757,12 @@ func TestGetMessages(t *testing.T) {
 		assert.Equal(t, http.StatusOK, w.Code)
 
 		// Parse response
-		var response []map[string]interface{}
+		var response models.MessagePage
 		json.Unmarshal(w.Body.Bytes(), &response)
 
 		// Assert response length
-		assert.Len(t, response, 2)
+		assert.Len(t, response.Messages, 2)
+		assert.False(t, response.HasMore)
 
 		// Verify mock expectations were met
 		mockDB.AssertExpectations(t)
@@ -349,7 +798,7 @@ func TestGetConversation(t *testing.T) {
 		}
 
 		// Setup mock expectations
-		mockDB.On("GetConversation", currentUserID, otherUserID).Return(messages, nil).Once()
+		mockDB.On("GetConversation", currentUserID, otherUserID, database.PageOptions{Limit: defaultPageLimit + 1}).Return(messages, nil).Once()
 
 		// Create request - fix URL to match the registered route
 		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/messages/conversation/%s", otherUserID), nil)
@@ -370,11 +819,12 @@ func TestGetConversation(t *testing.T) {
 		assert.Equal(t, http.StatusOK, w.Code)
 
 		// Parse response
-		var response []map[string]interface{}
+		var response models.MessagePage
 		json.Unmarshal(w.Body.Bytes(), &response)
 
 		// Assert response length
-		assert.Len(t, response, 2)
+		assert.Len(t, response.Messages, 2)
+		assert.False(t, response.HasMore)
 
 		// Verify mock expectations were met
 		mockDB.AssertExpectations(t)
@@ -383,6 +833,84 @@ func TestGetConversation(t *testing.T) {
 	// Additional test cases...
 }
 
+func TestGetConversationPagination(t *testing.T) {
+	router, mockDB, currentUserID := setupMessageTest(t)
+	otherUserID := uuid.New()
+
+	// Three messages, oldest first; the oldest is the extra row
+	now := time.Now().UTC()
+	messages := []*models.Message{
+		{ID: uuid.New(), SenderID: otherUserID, ReceiverID: currentUserID, Content: "one", CreatedAt: now.Add(-3 * time.Minute)},
+		{ID: uuid.New(), SenderID: currentUserID, ReceiverID: otherUserID, Content: "two", CreatedAt: now.Add(-2 * time.Minute)},
+		{ID: uuid.New(), SenderID: otherUserID, ReceiverID: currentUserID, Content: "three", CreatedAt: now.Add(-time.Minute)},
+	}
+	before := database.Cursor{CreatedAt: now, ID: uuid.New()}
+
+	tests := []struct {
+		name       string
+		query      string
+		setupMock  func()
+		wantStatus int
+		wantPage   *models.MessagePage
+	}{
+		{
+			name:  "page before a cursor",
+			query: "?limit=2&before=" + before.String(),
+			setupMock: func() {
+				mockDB.On("GetConversation", currentUserID, otherUserID, database.PageOptions{
+					Before: &before,
+					Limit:  3,
+				}).Return(messages, nil).Once()
+			},
+			wantStatus: http.StatusOK,
+			wantPage: &models.MessagePage{
+				Messages: messages[1:],
+				HasMore:  true,
+				Before:   database.CursorFor(messages[1]).String(),
+				After:    database.CursorFor(messages[2]).String(),
+			},
+		},
+		{
+			name:       "limit too large",
+			query:      "?limit=1000",
+			setupMock:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid cursor",
+			query:      "?after=not-a-cursor",
+			setupMock:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setupMock()
+
+			req, _ := http.NewRequest("GET", fmt.Sprintf("/api/messages/conversation/%s%s", otherUserID, tt.query), nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantPage != nil {
+				var response models.MessagePage
+				json.Unmarshal(w.Body.Bytes(), &response)
+
+				assert.Equal(t, tt.wantPage.HasMore, response.HasMore)
+				assert.Equal(t, tt.wantPage.Before, response.Before)
+				assert.Equal(t, tt.wantPage.After, response.After)
+				assert.Len(t, response.Messages, len(tt.wantPage.Messages))
+				for i, msg := range tt.wantPage.Messages {
+					assert.Equal(t, msg.ID, response.Messages[i].ID)
+				}
+			}
+
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
 func TestMarkMessageAsRead(t *testing.T) {
 	router, mockDB, userID := setupMessageTest(t) // Use userID for authentication
 
@@ -436,6 +964,37 @@ func TestMarkMessageAsRead(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
+	// Test case: group message
+	t.Run("Group message", func(t *testing.T) {
+		// Setup
+		messageID := uuid.New()
+		groupID := uuid.New()
+
+		// Group messages have no receiver to check
+		mockMessage := &models.Message{
+			ID:             messageID,
+			SenderID:       uuid.New(),
+			ConversationID: &groupID,
+			Content:        "Group message",
+			CreatedAt:      time.Now(),
+		}
+		mockDB.On("GetMessageByID", messageID).Return(mockMessage, nil).Once()
+
+		// Create request
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/messages/%s/read", messageID), nil)
+
+		// Create response recorder
+		w := httptest.NewRecorder()
+
+		// Serve the request
+		router.ServeHTTP(w, req)
+
+		// Assertions
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Group messages can't be marked as read")
+		mockDB.AssertNotCalled(t, "MarkMessageAsRead", messageID)
+	})
+
 	// Test case: message not found
 	t.Run("Message not found", func(t *testing.T) {
 		// Setup
@@ -461,21 +1020,21 @@ func TestMarkMessageAsRead(t *testing.T) {
 	})
 }
 
-// TestSendMessageWithoutWebSocket tests the SendMessage handler with WebSocket manager set to nil
-func TestSendMessageWithoutWebSocket(t *testing.T) {
+// TestSendMessagePublishes tests that SendMessage publishes the stored message
+// on the handler's bus
+func TestSendMessagePublishes(t *testing.T) {
 	// Setup
 	gin.SetMode(gin.TestMode)
 
 	// Create mock DB
 	mockDB := new(MockDB)
 
-	// Save original WebSocket manager and set to nil for this test
-	originalWSManager := WSManager
-	WSManager = nil
-	defer func() { WSManager = originalWSManager }()
-
-	// Create message handler
-	handler := NewMessageHandler(mockDB)
+	// Create message handler and record what it publishes
+	handler := NewMessageHandler(mockDB, events.NewBus())
+	var published []events.MessageCreated
+	events.Subscribe(handler.Events, func(e events.MessageCreated) {
+		published = append(published, e)
+	})
 
 	// Create test router
 	router := gin.New()
@@ -505,7 +1064,7 @@ func TestSendMessageWithoutWebSocket(t *testing.T) {
 	}
 
 	// Setup mock expectations
-	mockDB.On("CreateMessage", mock.Anything, receiverID, "Test message").Return(expectedMessage, nil)
+	mockDB.On("CreateMessageOnce", mock.Anything, receiverID, "Test message", "").Return(expectedMessage, true, nil)
 
 	// Create request
 	body, _ := json.Marshal(message)
@@ -518,26 +1077,39 @@ func TestSendMessageWithoutWebSocket(t *testing.T) {
 
 	// Assert response
 	assert.Equal(t, http.StatusCreated, w.Code)
+	require.Len(t, published, 1)
+	assert.Equal(t, expectedMessage, published[0].Message)
+	assert.Equal(t, uuid.Nil, published[0].ConnID)
+
+	// A retry of the same message isn't published again
+	mockDB.ExpectedCalls = nil
+	mockDB.On("CreateMessageOnce", mock.Anything, receiverID, "Test message", "").Return(expectedMessage, false, nil)
+	req, _ = http.NewRequest("POST", "/messages", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, published, 1)
 
 	// Verify mock expectations
 	mockDB.AssertExpectations(t)
 }
 
-// TestMarkMessageAsReadWithoutWebSocket tests the MarkMessageAsRead handler with WebSocket manager set to nil
-func TestMarkMessageAsReadWithoutWebSocket(t *testing.T) {
+// TestMarkMessageAsReadPublishes tests that MarkMessageAsRead publishes the
+// read message on the handler's bus
+func TestMarkMessageAsReadPublishes(t *testing.T) {
 	// Setup
 	gin.SetMode(gin.TestMode)
 
 	// Create mock DB
 	mockDB := new(MockDB)
 
-	// Save original WebSocket manager and set to nil for this test
-	originalWSManager := WSManager
-	WSManager = nil
-	defer func() { WSManager = originalWSManager }()
-
-	// Create message handler
-	handler := NewMessageHandler(mockDB)
+	// Create message handler and record what it publishes
+	handler := NewMessageHandler(mockDB, events.NewBus())
+	var published []events.MessageRead
+	events.Subscribe(handler.Events, func(e events.MessageRead) {
+		published = append(published, e)
+	})
 
 	// Create test router
 	router := gin.New()
@@ -576,6 +1148,9 @@ func TestMarkMessageAsReadWithoutWebSocket(t *testing.T) {
 
 	// Assert response
 	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, published, 1)
+	assert.Equal(t, message, published[0].Message)
+	assert.Equal(t, userID, published[0].ReaderID)
 
 	// Verify mock expectations
 	mockDB.AssertExpectations(t)
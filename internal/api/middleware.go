@@ -2,19 +2,24 @@ package api
 
 import (
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
 	"github.com/ammar1510/converse/internal/auth"
+	"github.com/ammar1510/converse/internal/database"
 	"github.com/ammar1510/converse/internal/logger"
+	"github.com/ammar1510/converse/internal/models"
 )
 
 var mwLog = logger.New("api-middleware")
 
-// AuthMiddleware validates JWT tokens and sets user info in context
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware validates JWT tokens and sets user info in context. Tokens
+// of a revoked session or of a suspended or deleted account are refused even
+// before they expire.
+func AuthMiddleware(db database.DBInterface) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 
@@ -29,36 +34,17 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Extract token
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		// Validate token
-		claims, err := auth.ValidateToken(tokenString)
-		if err != nil {
-			mwLog.Debug("Invalid token from %s: %v", c.ClientIP(), err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
-
-		// Parse user ID string into UUID
-		userUUID, err := uuid.Parse(claims.UserID)
-		if err != nil {
-			mwLog.Error("Invalid user ID format in token: %s", claims.UserID)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID format in token"})
-			c.Abort()
+		if !authenticate(c, db, tokenString) {
 			return
 		}
 
-		// Set user ID (as UUID) and username in context
-		c.Set("userID", userUUID)
-		c.Set("username", claims.Username)
-		mwLog.Debug("User %s (%s) authenticated", claims.Username, userUUID)
-
 		c.Next()
 	}
 }
 
 // TokenAuthMiddleware validates JWT tokens from either header or URL parameter
 // This is especially useful for WebSocket connections where setting headers can be problematic
-func TokenAuthMiddleware() gin.HandlerFunc {
+func TokenAuthMiddleware(db database.DBInterface) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var tokenString string
 
@@ -79,29 +65,112 @@ func TokenAuthMiddleware() gin.HandlerFunc {
 			mwLog.Debug("Token found in URL parameter from %s", c.ClientIP())
 		}
 
-		// Validate token
-		claims, err := auth.ValidateToken(tokenString)
-		if err != nil {
-			mwLog.Debug("Invalid token from %s: %v", c.ClientIP(), err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+		if !authenticate(c, db, tokenString) {
 			return
 		}
 
-		// Parse user ID string into UUID
-		userUUID, err := uuid.Parse(claims.UserID)
-		if err != nil {
-			mwLog.Error("Invalid user ID format in token: %s", claims.UserID)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID format in token"})
+		c.Next()
+	}
+}
+
+// authenticate validates a token and checks that its session, if it has
+// one, is still live and that its account is neither suspended nor deleted.
+// It then sets the user ID (as UUID), username, current role and session in
+// the context. It responds, aborts and reports false otherwise.
+func authenticate(c *gin.Context, db database.DBInterface, tokenString string) bool {
+	// Validate token
+	claims, err := auth.ValidateToken(tokenString)
+	if err != nil {
+		mwLog.Debug("Invalid token from %s: %v", c.ClientIP(), err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return false
+	}
+
+	// Parse user ID string into UUID
+	userUUID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		mwLog.Error("Invalid user ID format in token: %s", claims.UserID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID format in token"})
+		c.Abort()
+		return false
+	}
+
+	sessionID, err := auth.GetSessionIDFromToken(claims)
+	if err != nil {
+		mwLog.Error("Invalid session ID format in token: %s", claims.SessionID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session ID format in token"})
+		c.Abort()
+		return false
+	}
+
+	if sessionID != uuid.Nil {
+		session, err := db.GetSession(sessionID)
+		if err != nil && err != database.ErrSessionNotFound {
+			mwLog.Error("Failed to load session %s: %v", sessionID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session"})
+			c.Abort()
+			return false
+		}
+		if err != nil || session.RevokedAt != nil || session.UserID != userUUID {
+			mwLog.Debug("Refused token of revoked session %s from %s", sessionID, c.ClientIP())
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
+			c.Abort()
+			return false
+		}
+	}
+
+	user, err := db.GetUserByID(userUUID)
+	if err != nil && err != database.ErrUserNotFound {
+		mwLog.Error("Failed to load user %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify user"})
+		c.Abort()
+		return false
+	}
+	if err != nil || user.Deleted() {
+		mwLog.Debug("Refused token of missing or deleted user %s from %s", userUUID, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return false
+	}
+	if user.Suspended() {
+		mwLog.Debug("Refused token of suspended user %s from %s", userUUID, c.ClientIP())
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account suspended"})
+		c.Abort()
+		return false
+	}
+
+	// The role is taken from the account, so a change applies at once
+	role := user.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+
+	c.Set("userID", userUUID)
+	c.Set("username", user.Username)
+	c.Set("role", role)
+	if sessionID != uuid.Nil {
+		c.Set("sessionID", sessionID)
+	}
+	mwLog.Debug("User %s (%s) authenticated", user.Username, userUUID)
+	return true
+}
+
+// RequireRole only lets users with one of the given roles through. It must
+// run after AuthMiddleware, which reads the role from the account, so a
+// changed role takes effect on the next request.
+func RequireRole(roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("role")
+		role, _ := value.(models.Role)
+		if !slices.Contains(roles, role) {
+			userID, _ := c.Get("userID")
+			mwLog.Warn("User %v with role %q denied access to %s %s", userID, role, c.Request.Method, c.Request.URL.Path)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
 			c.Abort()
 			return
 		}
 
-		// Set user ID (as UUID) and username in context
-		c.Set("userID", userUUID)
-		c.Set("username", claims.Username)
-		mwLog.Debug("User %s (%s) authenticated via TokenAuthMiddleware", claims.Username, userUUID)
-
 		c.Next()
 	}
 }
@@ -2,25 +2,28 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/ammar1510/converse/internal/auth"
+	"github.com/ammar1510/converse/internal/database"
 	"github.com/ammar1510/converse/internal/models"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // setupAuthTestRouter creates a test router with the auth middleware
-func setupAuthTestRouter(t *testing.T) *gin.Engine {
+func setupAuthTestRouter(t *testing.T, db database.DBInterface) *gin.Engine {
 	// Setup router
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 
 	// Add auth middleware
-	router.Use(AuthMiddleware())
+	router.Use(AuthMiddleware(db))
 
 	// Add test endpoint
 	router.GET("/test", func(c *gin.Context) {
@@ -36,13 +39,13 @@ func setupAuthTestRouter(t *testing.T) *gin.Engine {
 }
 
 // setupTokenAuthTestRouter creates a test router with the token auth middleware
-func setupTokenAuthTestRouter(t *testing.T) *gin.Engine {
+func setupTokenAuthTestRouter(t *testing.T, db database.DBInterface) *gin.Engine {
 	// Setup router
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 
 	// Add token auth middleware
-	router.Use(TokenAuthMiddleware())
+	router.Use(TokenAuthMiddleware(db))
 
 	// Add test endpoint
 	router.GET("/test", func(c *gin.Context) {
@@ -59,18 +62,31 @@ func setupTokenAuthTestRouter(t *testing.T) *gin.Engine {
 
 // TestAuthMiddleware tests the authentication middleware
 func TestAuthMiddleware(t *testing.T) {
-	router := setupAuthTestRouter(t)
+	db := database.NewMemoryDB()
+	router := setupAuthTestRouter(t, db)
 
 	// Create a test user and token
-	testUser := &models.User{
-		ID:       uuid.New(),
-		Username: "testuser",
-		Email:    "test@example.com",
-	}
+	testUser, err := db.CreateUser("testuser", "test@example.com", "hash")
+	require.NoError(t, err)
 
 	token, _, err := auth.GenerateToken(testUser)
 	assert.NoError(t, err)
 
+	suspendedUser, err := db.CreateUser("suspended", "suspended@example.com", "hash")
+	require.NoError(t, err)
+	require.NoError(t, db.SetUserSuspended(suspendedUser.ID, true))
+	suspendedToken, _, err := auth.GenerateToken(suspendedUser)
+	require.NoError(t, err)
+
+	deletedUser, err := db.CreateUser("deleted", "deleted@example.com", "hash")
+	require.NoError(t, err)
+	deletedToken, _, err := auth.GenerateToken(deletedUser)
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteUser(deletedUser.ID))
+
+	unknownToken, _, err := auth.GenerateToken(&models.User{ID: uuid.New(), Username: "ghost"})
+	require.NoError(t, err)
+
 	tests := []struct {
 		name       string
 		token      string
@@ -101,6 +117,24 @@ func TestAuthMiddleware(t *testing.T) {
 			wantStatus: http.StatusUnauthorized,
 			wantError:  true,
 		},
+		{
+			name:       "suspended account",
+			token:      suspendedToken,
+			wantStatus: http.StatusForbidden,
+			wantError:  true,
+		},
+		{
+			name:       "deleted account",
+			token:      deletedToken,
+			wantStatus: http.StatusUnauthorized,
+			wantError:  true,
+		},
+		{
+			name:       "unknown account",
+			token:      unknownToken,
+			wantStatus: http.StatusUnauthorized,
+			wantError:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -146,14 +180,12 @@ func TestAuthMiddleware(t *testing.T) {
 // TestTokenAuthMiddleware tests the token authentication middleware
 // which accepts tokens from both Authorization header and URL parameters
 func TestTokenAuthMiddleware(t *testing.T) {
-	router := setupTokenAuthTestRouter(t)
+	db := database.NewMemoryDB()
+	router := setupTokenAuthTestRouter(t, db)
 
 	// Create a test user and token
-	testUser := &models.User{
-		ID:       uuid.New(),
-		Username: "testuser",
-		Email:    "test@example.com",
-	}
+	testUser, err := db.CreateUser("testuser", "test@example.com", "hash")
+	require.NoError(t, err)
 
 	token, _, err := auth.GenerateToken(testUser)
 	assert.NoError(t, err)
@@ -260,3 +292,45 @@ func TestTokenAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+// TestRequireRole tests that only users with an allowed role get through,
+// whatever role their token was issued with
+func TestRequireRole(t *testing.T) {
+	db := database.NewMemoryDB()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/admin", AuthMiddleware(db), RequireRole(models.RoleAdmin), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	tests := []struct {
+		name       string
+		role       models.Role // the account's role
+		tokenRole  models.Role // the role the token was issued with
+		wantStatus int
+	}{
+		{name: "admin", role: models.RoleAdmin, tokenRole: models.RoleAdmin, wantStatus: http.StatusOK},
+		{name: "user", role: models.RoleUser, tokenRole: models.RoleUser, wantStatus: http.StatusForbidden},
+		{name: "demoted admin", role: models.RoleUser, tokenRole: models.RoleAdmin, wantStatus: http.StatusForbidden},
+		{name: "promoted user", role: models.RoleAdmin, tokenRole: "", wantStatus: http.StatusOK},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := db.CreateUser(fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@example.com", i), "hash")
+			require.NoError(t, err)
+			require.NoError(t, db.SetUserRole(user.ID, tt.role))
+
+			user.Role = tt.tokenRole
+			token, _, err := auth.GenerateToken(user)
+			assert.NoError(t, err)
+
+			req := httptest.NewRequest("GET", "/admin", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// maxPresenceIDs bounds how many users one presence request can ask about
+const maxPresenceIDs = 100
+
+// GetPresence returns the status and last seen time of the users in the
+// comma-separated ids parameter. Only the authenticated user and their
+// conversation partners are reported; anyone else, and unknown and deleted
+// users, are left out.
+func (h *AuthHandler) GetPresence(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userUUID := userID.(uuid.UUID)
+
+	raw := strings.TrimSpace(c.Query("ids"))
+	if raw == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids is required"})
+		return
+	}
+
+	var ids []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for _, part := range strings.Split(raw, ",") {
+		id, err := uuid.Parse(strings.TrimSpace(part))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxPresenceIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many user IDs"})
+		return
+	}
+
+	partners, err := h.DB.GetConversationPartners(userUUID)
+	if err != nil {
+		h.log.Error("Failed to load conversation partners of %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve presence"})
+		return
+	}
+	visible := map[uuid.UUID]bool{userUUID: true}
+	for _, partner := range partners {
+		visible[partner] = true
+	}
+
+	presences := make([]models.Presence, 0, len(ids))
+	for _, id := range ids {
+		if !visible[id] {
+			continue
+		}
+		user, err := h.DB.GetUserByID(id)
+		if err == database.ErrUserNotFound || (err == nil && user.Deleted()) {
+			continue
+		}
+		if err != nil {
+			h.log.Error("Failed to load user %s for presence: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve presence"})
+			return
+		}
+
+		status := models.PresenceOffline
+		if h.Connections != nil {
+			status = h.Connections.Presence(id)
+		}
+		presences = append(presences, models.Presence{
+			UserID:   id,
+			Status:   status,
+			LastSeen: user.LastSeen,
+		})
+	}
+
+	c.JSON(http.StatusOK, presences)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	gorilla "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/models"
+	"github.com/ammar1510/converse/internal/websocket"
+)
+
+// TestGetPresence tests looking up the status of several users
+func TestGetPresence(t *testing.T) {
+	router, handler := setupTestRouter(t)
+	router.GET("/presence", AuthMiddleware(handler.DB), handler.GetPresence)
+
+	wsManager := websocket.NewManager(handler.DB, handler.Events)
+	go wsManager.Run()
+	handler.Connections = wsManager
+	router.GET("/ws", TokenAuthMiddleware(handler.DB), wsManager.HandleWebSocket)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	alice := createTestUser(t, handler, "alice")
+	bob := createTestUser(t, handler, "bob")
+	carol := createTestUser(t, handler, "carol")
+	dave := createTestUser(t, handler, "dave")
+	erin := createTestUser(t, handler, "erin")
+
+	// Alice talks to bob and dave directly and shares a group with carol,
+	// but has never talked to erin
+	for _, receiver := range []uuid.UUID{bob.ID, dave.ID} {
+		_, err := handler.DB.CreateMessage(alice.ID, receiver, "hi")
+		require.NoError(t, err)
+	}
+	_, err := handler.DB.CreateGroup(alice.ID, "friends", []uuid.UUID{carol.ID})
+	require.NoError(t, err)
+	require.NoError(t, handler.DB.DeleteUser(dave.ID))
+
+	aliceToken, _ := loginForTokens(t, router, "alice@example.com", "password123", "laptop")
+	bobToken, _ := loginForTokens(t, router, "bob@example.com", "password123", "laptop")
+
+	bobWS, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?token="+bobToken, nil)
+	require.NoError(t, err)
+	defer bobWS.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	ids := []string{bob.ID.String(), carol.ID.String(), dave.ID.String(), erin.ID.String(), uuid.NewString(), bob.ID.String()}
+	w := sendJSON(router, "GET", "/presence?ids="+strings.Join(ids, ","), nil, aliceToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var presences []models.Presence
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &presences))
+	require.Len(t, presences, 2)
+	assert.Equal(t, bob.ID, presences[0].UserID)
+	assert.Equal(t, models.PresenceOnline, presences[0].Status)
+	assert.Equal(t, carol.ID, presences[1].UserID)
+	assert.Equal(t, models.PresenceOffline, presences[1].Status)
+	assert.False(t, presences[1].LastSeen.IsZero())
+
+	// Users can look themselves up
+	w = sendJSON(router, "GET", "/presence?ids="+alice.ID.String(), nil, aliceToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &presences))
+	require.Len(t, presences, 1)
+	assert.Equal(t, alice.ID, presences[0].UserID)
+
+	tooMany := make([]string, maxPresenceIDs+1)
+	for i := range tooMany {
+		tooMany[i] = uuid.NewString()
+	}
+	for _, bad := range []string{"", "?ids=", "?ids=nope", "?ids=" + alice.ID.String() + ",", "?ids=" + strings.Join(tooMany, ",")} {
+		w = sendJSON(router, "GET", "/presence"+bad, nil, aliceToken)
+		assert.Equal(t, http.StatusBadRequest, w.Code, bad)
+	}
+
+	w = sendJSON(router, "GET", "/presence?ids="+bob.ID.String(), nil, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/auth"
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
+	"github.com/ammar1510/converse/internal/mail"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// UpdateMe changes the authenticated user's display name or avatar
+func (h *AuthHandler) UpdateMe(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input models.ProfileUpdate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.DB.GetUserByID(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if input.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*input.DisplayName)
+	}
+	if input.AvatarURL != nil {
+		avatarURL := strings.TrimSpace(*input.AvatarURL)
+		if avatarURL != "" && !isWebURL(avatarURL) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar URL must be an http or https URL"})
+			return
+		}
+		user.AvatarURL = avatarURL
+	}
+
+	if err := h.DB.UpdateProfile(user.ID, user.DisplayName, user.AvatarURL); err != nil {
+		h.log.Error("Failed to update profile of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	h.Events.Publish(events.UserUpdated{User: user})
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// ChangePassword sets a new password for the authenticated user. Their other
+// sessions are ended; the one making the request stays logged in.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input models.PasswordChangeRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.DB.GetUserByID(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if !h.confirmPassword(c, user, input.CurrentPassword) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(input.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process password"})
+		return
+	}
+
+	if err := h.DB.UpdatePassword(user.ID, hashedPassword); err != nil {
+		h.log.Error("Failed to update password of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// Reset links sent before the change mustn't set the password again
+	if err := h.DB.ExpireResetTokens(user.ID); err != nil {
+		h.log.Error("Failed to expire password reset links of user %s: %v", user.ID, err)
+	}
+
+	// Tokens without a session revoke them all
+	currentSession := uuid.Nil
+	if sessionID, ok := c.Get("sessionID"); ok {
+		currentSession = sessionID.(uuid.UUID)
+	}
+
+	if err := h.DB.RevokeOtherSessions(user.ID, currentSession); err != nil {
+		h.log.Error("Failed to revoke other sessions of user %s: %v", user.ID, err)
+	}
+	h.Events.Publish(events.SessionsRevoked{UserID: user.ID, ExceptSessionID: currentSession})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+// ChangeEmail moves the authenticated user to a new email address. The new
+// address is unverified until the user opens the link sent to it, and the
+// old address is told about the change.
+func (h *AuthHandler) ChangeEmail(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input models.EmailChangeRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.DB.GetUserByID(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if !h.confirmPassword(c, user, input.Password) {
+		return
+	}
+
+	if input.Email == user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That is already your email"})
+		return
+	}
+
+	err = h.DB.UpdateEmail(user.ID, input.Email)
+	if err == database.ErrEmailInUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to update email of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+
+	previous := user.Email
+	user.Email = input.Email
+	user.EmailVerified = false
+
+	// The change stands even if the emails can't be sent; the user can ask
+	// for another verification email
+	if err := h.sendEmailToken(user, models.TokenPurposeVerifyEmail); err != nil {
+		h.log.Error("Failed to send verification email to user %s: %v", user.ID, err)
+	}
+	if err := h.Mailer.Send(mail.EmailChangedEmail(previous, user.Username, user.Email)); err != nil {
+		h.log.Error("Failed to notify previous email of user %s: %v", user.ID, err)
+	}
+
+	h.Events.Publish(events.UserUpdated{User: user})
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// confirmPassword checks a password the authenticated user entered again to
+// make a sensitive change. Wrong passwords count as failed logins. It
+// responds and reports false if the change can't go ahead.
+func (h *AuthHandler) confirmPassword(c *gin.Context, user *models.User, password string) bool {
+	release, throttled := h.throttled(c, user.Email)
+	if throttled {
+		return false
+	}
+	defer release()
+
+	if !auth.CheckPasswordHash(password, user.PasswordHash) {
+		if err := h.Limiter.Fail(user.Email, c.ClientIP()); err != nil {
+			h.log.Error("Failed to record failed login: %v", err)
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Incorrect password"})
+		return false
+	}
+
+	return true
+}
+
+// isWebURL reports whether raw is an absolute http or https URL
+func isWebURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/auth"
+	"github.com/ammar1510/converse/internal/events"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// TestUpdateMe tests changing the display name and avatar
+func TestUpdateMe(t *testing.T) {
+	router, handler := setupTestRouter(t)
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	user, err := handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
+	require.NoError(t, err)
+
+	accessToken, _ := loginForTokens(t, router, "test@example.com", "password123", "laptop")
+
+	displayName := "  Test User "
+	avatarURL := "https://example.com/avatar.png"
+	w := sendJSON(router, "PATCH", "/me", models.ProfileUpdate{DisplayName: &displayName, AvatarURL: &avatarURL}, accessToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Test User", response.DisplayName)
+	assert.Equal(t, avatarURL, response.AvatarURL)
+
+	// Omitted fields are kept, empty ones cleared
+	empty := ""
+	w = sendJSON(router, "PATCH", "/me", models.ProfileUpdate{AvatarURL: &empty}, accessToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	stored, err := handler.DB.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Test User", stored.DisplayName)
+	assert.Empty(t, stored.AvatarURL)
+
+	for _, bad := range []string{"javascript:alert(1)", "/relative.png", "not a url"} {
+		w = sendJSON(router, "PATCH", "/me", models.ProfileUpdate{AvatarURL: &bad}, accessToken)
+		assert.Equal(t, http.StatusBadRequest, w.Code, bad)
+	}
+
+	long := string(make([]byte, 51))
+	w = sendJSON(router, "PATCH", "/me", models.ProfileUpdate{DisplayName: &long}, accessToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendJSON(router, "PATCH", "/me", models.ProfileUpdate{DisplayName: &displayName}, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// TestChangePassword tests that changing the password needs the current one
+// and ends the user's other sessions and outstanding reset links
+func TestChangePassword(t *testing.T) {
+	router, handler := setupTestRouter(t)
+	mailer := &recordingMailer{}
+	handler.Mailer = mailer
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	user, err := handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
+	require.NoError(t, err)
+
+	var revoked []events.SessionsRevoked
+	events.Subscribe(handler.Events, func(e events.SessionsRevoked) {
+		revoked = append(revoked, e)
+	})
+
+	laptopToken, laptopRefresh := loginForTokens(t, router, "test@example.com", "password123", "laptop")
+	_, phoneRefresh := loginForTokens(t, router, "test@example.com", "password123", "phone")
+
+	w := postJSON(router, "/password/forgot", models.EmailRequest{Email: "test@example.com"}, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, mailer.sent(), 1)
+	resetToken := linkToken(t, mailer.sent()[0])
+
+	w = postJSON(router, "/me/password", models.PasswordChangeRequest{CurrentPassword: "wrongpassword", NewPassword: "newpassword"}, laptopToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = postJSON(router, "/me/password", models.PasswordChangeRequest{CurrentPassword: "password123", NewPassword: "new"}, laptopToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	assert.Empty(t, revoked)
+
+	w = postJSON(router, "/me/password", models.PasswordChangeRequest{CurrentPassword: "password123", NewPassword: "newpassword"}, laptopToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, revoked, 1)
+	assert.Equal(t, user.ID, revoked[0].UserID)
+	assert.NotEqual(t, uuid.Nil, revoked[0].ExceptSessionID)
+
+	// The phone is logged out, the laptop isn't
+	w = postRefreshToken(router, "/refresh", phoneRefresh)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = postRefreshToken(router, "/refresh", laptopRefresh)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = postJSON(router, "/login", models.UserLogin{Email: "test@example.com", Password: "password123"}, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	loginForTokens(t, router, "test@example.com", "newpassword", "phone")
+
+	// The reset link sent before the change no longer works
+	w = postJSON(router, "/password/reset", models.PasswordResetRequest{Token: resetToken, Password: "resetpassword"}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestChangeEmail tests moving to a new address, which has to be verified
+// again
+func TestChangeEmail(t *testing.T) {
+	router, handler := setupTestRouter(t)
+	mailer := &recordingMailer{}
+	handler.Mailer = mailer
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	user, err := handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
+	require.NoError(t, err)
+	require.NoError(t, handler.DB.MarkEmailVerified(user.ID, "test@example.com"))
+	_, err = handler.DB.CreateUser("other", "other@example.com", hashedPassword)
+	require.NoError(t, err)
+
+	accessToken, _ := loginForTokens(t, router, "test@example.com", "password123", "laptop")
+
+	// A reset link sent before the change
+	w := postJSON(router, "/password/forgot", models.EmailRequest{Email: "test@example.com"}, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, mailer.sent(), 1)
+	resetToken := linkToken(t, mailer.sent()[0])
+
+	w = postJSON(router, "/me/email", models.EmailChangeRequest{Email: "new@example.com", Password: "wrongpassword"}, accessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = postJSON(router, "/me/email", models.EmailChangeRequest{Email: "other@example.com", Password: "password123"}, accessToken)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = postJSON(router, "/me/email", models.EmailChangeRequest{Email: "test@example.com", Password: "password123"}, accessToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/me/email", models.EmailChangeRequest{Email: "new@example.com", Password: "password123"}, accessToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "new@example.com", response.Email)
+	assert.False(t, response.EmailVerified)
+
+	// The new address gets a verification link, the old one a notice
+	sent := mailer.sent()
+	require.Len(t, sent, 3)
+	assert.Equal(t, "new@example.com", sent[1].To)
+	assert.Equal(t, "test@example.com", sent[2].To)
+	assert.Contains(t, sent[2].Body, "new@example.com")
+
+	w = postJSON(router, "/verify-email", models.TokenRequest{Token: linkToken(t, sent[1])}, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	stored, err := handler.DB.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", stored.Email)
+	assert.True(t, stored.EmailVerified)
+
+	// Links sent to the old address stop working
+	w = postJSON(router, "/password/reset", models.PasswordResetRequest{Token: resetToken, Password: "hijacked"}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/login", models.UserLogin{Email: "test@example.com", Password: "password123"}, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	loginForTokens(t, router, "new@example.com", "password123", "laptop")
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// maxSearchQueryLength bounds the q parameter of message search
+const maxSearchQueryLength = 200
+
+// SearchMessages returns a page of the authenticated user's messages matching
+// the q query parameter, newest first, with highlighted snippets
+func (h *MessageHandler) SearchMessages(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// The userID from context is now a UUID object
+	userUUID := userID.(uuid.UUID)
+
+	query := strings.TrimSpace(c.Query("q"))
+	if len(database.SearchTerms(query)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
+		return
+	}
+	if len(query) > maxSearchQueryLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is too long"})
+		return
+	}
+
+	page, err := parsePageOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := h.DB.SearchMessages(userUUID, query, pageQuery(page))
+	if err != nil {
+		h.log.Error("Failed to search messages for user %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newSearchPage(results, page))
+}
+
+// newSearchPage trims the extra row fetched by pageQuery and builds the
+// response envelope from results, which are newest first
+func newSearchPage(results []*models.SearchResult, page database.PageOptions) models.SearchPage {
+	results, hasMore := trimPage(results, page, true)
+
+	response := models.SearchPage{
+		Results: make([]*models.SearchResultResponse, 0, len(results)),
+		HasMore: hasMore,
+	}
+
+	for _, result := range results {
+		resultResponse := &models.SearchResultResponse{
+			Message: result.Message,
+			Group:   result.Group,
+			Snippet: result.Snippet,
+		}
+		if result.Partner != nil {
+			resultResponse.Partner = userResponse(result.Partner)
+		}
+		response.Results = append(response.Results, resultResponse)
+	}
+
+	if len(results) > 0 {
+		response.Before = database.CursorFor(results[len(results)-1].Message).String()
+		response.After = database.CursorFor(results[0].Message).String()
+	}
+
+	return response
+}
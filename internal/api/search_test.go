@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+func TestSearchMessages(t *testing.T) {
+	router, mockDB, currentUserID := setupMessageTest(t)
+
+	partner := &models.User{ID: uuid.New(), Username: "bob", Email: "bob@example.com", PasswordHash: "secret"}
+	now := time.Now().UTC()
+	var results []*models.SearchResult
+	for i := 0; i < 3; i++ {
+		results = append(results, &models.SearchResult{
+			Message: &models.Message{
+				ID:         uuid.New(),
+				SenderID:   partner.ID,
+				ReceiverID: currentUserID,
+				Content:    "pizza tonight?",
+				CreatedAt:  now.Add(-time.Duration(i) * time.Minute),
+			},
+			Partner: partner,
+			Snippet: "<mark>pizza</mark> tonight?",
+		})
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		setupMock  func()
+		wantStatus int
+		wantCount  int
+		wantMore   bool
+	}{
+		{
+			name:  "first page",
+			query: "?q=pizza&limit=2",
+			setupMock: func() {
+				mockDB.On("SearchMessages", currentUserID, "pizza", database.PageOptions{Limit: 3}).
+					Return(results, nil).Once()
+			},
+			wantStatus: http.StatusOK,
+			wantCount:  2,
+			wantMore:   true,
+		},
+		{
+			name:  "no matches",
+			query: "?q=" + url.QueryEscape("  lasagna  "),
+			setupMock: func() {
+				mockDB.On("SearchMessages", currentUserID, "lasagna", database.PageOptions{Limit: defaultPageLimit + 1}).
+					Return(nil, nil).Once()
+			},
+			wantStatus: http.StatusOK,
+			wantCount:  0,
+		},
+		{
+			name:  "database error",
+			query: "?q=pizza",
+			setupMock: func() {
+				mockDB.On("SearchMessages", currentUserID, "pizza", database.PageOptions{Limit: defaultPageLimit + 1}).
+					Return(nil, errors.New("connection lost")).Once()
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "missing query",
+			query:      "",
+			setupMock:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "query without words",
+			query:      "?q=" + url.QueryEscape("?!*"),
+			setupMock:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "query too long",
+			query:      "?q=" + strings.Repeat("a", maxSearchQueryLength+1),
+			setupMock:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setupMock()
+
+			req, _ := http.NewRequest("GET", "/api/messages/search"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				var response models.SearchPage
+				json.Unmarshal(w.Body.Bytes(), &response)
+
+				assert.Len(t, response.Results, tt.wantCount)
+				assert.Equal(t, tt.wantMore, response.HasMore)
+
+				if tt.wantCount > 0 {
+					assert.Equal(t, results[0].Message.ID, response.Results[0].Message.ID)
+					assert.Equal(t, partner.ID, response.Results[0].Partner.ID)
+					assert.Equal(t, "<mark>pizza</mark> tonight?", response.Results[0].Snippet)
+					assert.Equal(t, database.CursorFor(results[1].Message).String(), response.Before)
+					assert.NotContains(t, w.Body.String(), "secret")
+				}
+			}
+
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
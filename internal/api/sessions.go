@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// GetSessions returns the authenticated user's active sessions, most recently
+// used first. The session making the request is marked as current.
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// The userID from context is now a UUID object
+	userUUID := userID.(uuid.UUID)
+
+	sessions, err := h.DB.GetSessionsByUser(userUUID)
+	if err != nil {
+		h.log.Error("Failed to load sessions for user %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	if sessions == nil {
+		sessions = []*models.Session{}
+	}
+
+	// Set by the auth middleware for tokens issued at login
+	if currentID, ok := c.Get("sessionID"); ok {
+		for _, session := range sessions {
+			session.Current = session.ID == currentID.(uuid.UUID)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession logs out one of the authenticated user's sessions. Its
+// refresh tokens stop working and its WebSocket connections are closed.
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// The userID from context is now a UUID object
+	userUUID := userID.(uuid.UUID)
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	// Other users' sessions are reported as missing so they can't be probed
+	session, err := h.DB.GetSession(sessionID)
+	if err == database.ErrSessionNotFound || (err == nil && (session.UserID != userUUID || session.RevokedAt != nil)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to load session %s: %v", sessionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve session"})
+		return
+	}
+
+	if err := h.endSession(userUUID, session.ID); err != nil {
+		h.log.Error("Failed to revoke session %s: %v", session.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
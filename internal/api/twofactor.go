@@ -0,0 +1,360 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/auth"
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+const (
+	// totpIssuer names the account in authenticator apps
+	totpIssuer = "Converse"
+	// recoveryCodeCount is how many recovery codes a user gets on enrollment
+	recoveryCodeCount = 10
+	// maxTwoFactorAttempts is how many codes can be tried against one login
+	// challenge before the user has to enter their password again
+	maxTwoFactorAttempts = 5
+)
+
+// GetTwoFactor reports whether the authenticated user has 2FA enabled
+func (h *AuthHandler) GetTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	totp, err := h.DB.GetTOTP(userID.(uuid.UUID))
+	if err != nil && err != database.ErrTOTPNotFound {
+		h.log.Error("Failed to load TOTP for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve two-factor status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"enabled": err == nil && totp.Enabled()})
+}
+
+// EnrollTwoFactor starts 2FA enrollment by generating a secret for the
+// authenticated user's authenticator app. 2FA isn't enabled until a code
+// from the app is confirmed.
+func (h *AuthHandler) EnrollTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	user, err := h.DB.GetUserByID(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	err = h.DB.SaveTOTPSecret(user.ID, secret)
+	if err == database.ErrTOTPAlreadyEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to save TOTP secret for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": auth.TOTPProvisioningURI(secret, totpIssuer, user.Email),
+	})
+}
+
+// ConfirmTwoFactor enables 2FA once the user proves their authenticator app
+// works by sending a code from it. The response holds the recovery codes,
+// which are only ever shown this once.
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// The userID from context is now a UUID object
+	userUUID := userID.(uuid.UUID)
+
+	var input models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	totp, err := h.DB.GetTOTP(userUUID)
+	if err == database.ErrTOTPNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor enrollment has not been started"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to load TOTP for user %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	if totp.Enabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, input.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	// A concurrent confirmation got there first
+	err = h.DB.EnableTOTP(userUUID, step, hashes)
+	if err == database.ErrTOTPNotFound {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to enable TOTP for user %s: %v", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns 2FA off. It takes the password and a current code so
+// a stolen access token isn't enough.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input models.TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.DB.GetUserByID(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	totp, err := h.DB.GetTOTP(user.ID)
+	if err == database.ErrTOTPNotFound || (err == nil && !totp.Enabled()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to load TOTP for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	if !auth.CheckPasswordHash(input.Password, user.PasswordHash) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid password or code"})
+		return
+	}
+
+	ok, err := h.checkSecondFactor(totp, input.Code)
+	if err != nil {
+		h.log.Error("Failed to check second factor for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid password or code"})
+		return
+	}
+
+	if err := h.DB.DisableTOTP(user.ID); err != nil {
+		h.log.Error("Failed to disable TOTP for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// VerifyTwoFactor completes a login started with a password by exchanging the
+// challenge token and a code for real tokens. Each challenge allows a few
+// attempts, after which the user has to log in again.
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var input models.TwoFactorLoginRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	challenge, err := h.DB.GetTwoFactorChallenge(auth.HashOpaqueToken(input.ChallengeToken))
+	if err == database.ErrChallengeNotFound {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to load login challenge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	if challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		return
+	}
+
+	// Counted before checking the code so guesses are bounded
+	err = h.DB.AttemptTwoFactorChallenge(challenge.ID, maxTwoFactorAttempts)
+	if err == database.ErrChallengeUsed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to record attempt at login challenge %s: %v", challenge.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	// 2FA was disabled since the password was checked; start over
+	totp, err := h.DB.GetTOTP(challenge.UserID)
+	if err == database.ErrTOTPNotFound || (err == nil && !totp.Enabled()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to load TOTP for user %s: %v", challenge.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	ok, err := h.checkSecondFactor(totp, input.Code)
+	if err != nil {
+		h.log.Error("Failed to check second factor for user %s: %v", challenge.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	err = h.DB.UseTwoFactorChallenge(challenge.ID)
+	if err == database.ErrChallengeUsed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to use login challenge %s: %v", challenge.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	user, err := h.DB.GetUserByID(challenge.UserID)
+	if err == database.ErrUserNotFound {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if h.rejectSuspended(c, user) {
+		return
+	}
+
+	h.startSession(c, user, challenge.DeviceLabel)
+}
+
+// issueTwoFactorChallenge responds to a correct password for a user with 2FA
+// enabled with a challenge token instead of real tokens
+func (h *AuthHandler) issueTwoFactorChallenge(c *gin.Context, user *models.User, deviceLabel string) {
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	now := time.Now().UTC()
+	challenge := &models.TwoFactorChallenge{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		TokenHash:   hash,
+		DeviceLabel: deviceLabel,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(auth.TwoFactorChallengeTTL),
+	}
+	if err := h.DB.CreateTwoFactorChallenge(challenge); err != nil {
+		h.log.Error("Failed to store login challenge for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"two_factor_required": true,
+		"challenge_token":     token,
+		"challenge_expiry":    challenge.ExpiresAt,
+	})
+}
+
+// checkSecondFactor reports whether code is a current authenticator code or
+// an unused recovery code, and uses it up. Authenticator codes are six
+// digits; anything else is taken as a recovery code.
+func (h *AuthHandler) checkSecondFactor(totp *models.TOTP, code string) (bool, error) {
+	code = strings.ReplaceAll(code, " ", "")
+
+	if !isTOTPCode(code) {
+		err := h.DB.UseRecoveryCode(totp.UserID, auth.HashRecoveryCode(code))
+		if err == database.ErrRecoveryCodeInvalid {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// Each code works once, so one seen over a shoulder can't be reused
+	err := h.DB.UseTOTPStep(totp.UserID, step)
+	if err == database.ErrTOTPCodeUsed {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// isTOTPCode reports whether code looks like an authenticator code
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/auth"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// totpCodeAt returns the authenticator code offset steps from now
+func totpCodeAt(t *testing.T, secret string, offset int64) string {
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now())+offset)
+	require.NoError(t, err)
+	return code
+}
+
+// startTwoFactorLogin logs in with a password and returns the challenge token
+func startTwoFactorLogin(t *testing.T, router *gin.Engine) string {
+	w := postJSON(router, "/login", models.UserLogin{Email: "test@example.com", Password: "password123", DeviceLabel: "phone"}, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, true, response["two_factor_required"])
+	assert.NotContains(t, response, "token")
+	assert.NotContains(t, response, "refresh_token")
+
+	challenge, _ := response["challenge_token"].(string)
+	require.NotEmpty(t, challenge)
+	return challenge
+}
+
+// TestTwoFactor tests enrolling in 2FA, logging in with a code or a recovery
+// code, and disabling it
+func TestTwoFactor(t *testing.T) {
+	router, handler := setupTestRouter(t)
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	_, err = handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
+	require.NoError(t, err)
+
+	accessToken, _ := loginForTokens(t, router, "test@example.com", "password123", "laptop")
+
+	status := func() bool {
+		req := httptest.NewRequest("GET", "/2fa", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Enabled bool `json:"enabled"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Enabled
+	}
+	assert.False(t, status())
+
+	// Confirming needs an enrollment first
+	w := postJSON(router, "/2fa/confirm", models.TOTPCodeRequest{Code: "123456"}, accessToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/2fa/enroll", nil, accessToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var enrollment struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+	assert.NotEmpty(t, enrollment.Secret)
+	assert.Contains(t, enrollment.ProvisioningURI, "otpauth://totp/Converse:test@example.com?")
+	assert.Contains(t, enrollment.ProvisioningURI, "secret="+enrollment.Secret)
+
+	// Until confirmed, logins don't ask for a code
+	assert.False(t, status())
+	loginForTokens(t, router, "test@example.com", "password123", "laptop")
+
+	w = postJSON(router, "/2fa/confirm", models.TOTPCodeRequest{Code: totpCodeAt(t, enrollment.Secret, -5)}, accessToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/2fa/confirm", models.TOTPCodeRequest{Code: totpCodeAt(t, enrollment.Secret, 0)}, accessToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &confirmed))
+	require.Len(t, confirmed.RecoveryCodes, recoveryCodeCount)
+	assert.True(t, status())
+
+	w = postJSON(router, "/2fa/enroll", nil, accessToken)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	t.Run("authenticator code", func(t *testing.T) {
+		challenge := startTwoFactorLogin(t, router)
+
+		w := postJSON(router, "/login/2fa", models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: totpCodeAt(t, enrollment.Secret, -5)}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// Codes from before the last accepted one are rejected, so a code
+		// can't be replayed
+		w = postJSON(router, "/login/2fa", models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: totpCodeAt(t, enrollment.Secret, -1)}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = postJSON(router, "/login/2fa", models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: totpCodeAt(t, enrollment.Secret, 1)}, "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Token        string              `json:"token"`
+			RefreshToken string              `json:"refresh_token"`
+			User         models.UserResponse `json:"user"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "testuser", response.User.Username)
+		assert.NotEmpty(t, response.RefreshToken)
+
+		claims, err := auth.ValidateToken(response.Token)
+		require.NoError(t, err)
+		assert.NotEmpty(t, claims.SessionID)
+
+		// The session keeps the device label from the password step
+		sessions, err := handler.DB.GetSessionsByUser(response.User.ID)
+		require.NoError(t, err)
+		require.NotEmpty(t, sessions)
+		assert.Equal(t, "phone", sessions[0].DeviceLabel)
+
+		// Challenges work once
+		w = postJSON(router, "/login/2fa", models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: confirmed.RecoveryCodes[0]}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("recovery code", func(t *testing.T) {
+		challenge := startTwoFactorLogin(t, router)
+
+		w := postJSON(router, "/login/2fa", models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: confirmed.RecoveryCodes[1]}, "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// Recovery codes work once too
+		challenge = startTwoFactorLogin(t, router)
+		w = postJSON(router, "/login/2fa", models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: confirmed.RecoveryCodes[1]}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("too many attempts", func(t *testing.T) {
+		challenge := startTwoFactorLogin(t, router)
+
+		for range maxTwoFactorAttempts {
+			w := postJSON(router, "/login/2fa", models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: "wrong-code"}, "")
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+
+		w := postJSON(router, "/login/2fa", models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: confirmed.RecoveryCodes[2]}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// The recovery code wasn't spent on the locked challenge
+		challenge = startTwoFactorLogin(t, router)
+		w = postJSON(router, "/login/2fa", models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: confirmed.RecoveryCodes[2]}, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("unknown challenge", func(t *testing.T) {
+		w := postJSON(router, "/login/2fa", models.TwoFactorLoginRequest{ChallengeToken: "nope", Code: "123456"}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		w := postJSON(router, "/2fa/disable", models.TwoFactorDisableRequest{Password: "wrong", Code: confirmed.RecoveryCodes[3]}, accessToken)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = postJSON(router, "/2fa/disable", models.TwoFactorDisableRequest{Password: "password123", Code: "wrong-code"}, accessToken)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = postJSON(router, "/2fa/disable", models.TwoFactorDisableRequest{Password: "password123", Code: confirmed.RecoveryCodes[3]}, accessToken)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.False(t, status())
+
+		w = postJSON(router, "/2fa/disable", models.TwoFactorDisableRequest{Password: "password123", Code: confirmed.RecoveryCodes[4]}, accessToken)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		// Passwords are enough again
+		loginForTokens(t, router, "test@example.com", "password123", "laptop")
+	})
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/auth"
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
+	"github.com/ammar1510/converse/internal/mail"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// VerifyEmail confirms the user's email address with the token from a
+// verification email
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var input models.TokenRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.DB.UseEmailToken(auth.HashOpaqueToken(input.Token), models.TokenPurposeVerifyEmail)
+	if err == database.ErrEmailTokenInvalid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to use verification token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	// The user changed their email since the link was sent
+	err = h.DB.MarkEmailVerified(token.UserID, token.Email)
+	if err == database.ErrUserNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to mark email of user %s verified: %v", token.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerification sends the authenticated user a new verification email
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	user, err := h.DB.GetUserByID(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if user.EmailVerified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already verified"})
+		return
+	}
+
+	if err := h.sendEmailToken(user, models.TokenPurposeVerifyEmail); err != nil {
+		h.log.Error("Failed to send verification email to user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not an account exists for the address, so it can't be used to
+// discover accounts.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var input models.EmailRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.DB.GetUserByEmail(input.Email)
+	if err != nil && err != database.ErrUserNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if err == nil {
+		if err := h.sendEmailToken(user, models.TokenPurposeResetPassword); err != nil {
+			h.log.Error("Failed to send password reset email to user %s: %v", user.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for that email, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password with the token from a reset email. All
+// of the user's sessions are ended, so a stolen session doesn't outlive the
+// reset.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var input models.PasswordResetRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Hash password
+	hashedPassword, err := auth.HashPassword(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process password"})
+		return
+	}
+
+	token, err := h.DB.UseEmailToken(auth.HashOpaqueToken(input.Token), models.TokenPurposeResetPassword)
+	if err == database.ErrEmailTokenInvalid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to use password reset token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// Links sent to an address the user has since moved away from no longer work
+	user, err := h.DB.GetUserByID(token.UserID)
+	if err == database.ErrUserNotFound || (err == nil && user.Email != token.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if err := h.DB.UpdatePassword(token.UserID, hashedPassword); err != nil {
+		h.log.Error("Failed to update password of user %s: %v", token.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := h.DB.ExpireResetTokens(token.UserID); err != nil {
+		h.log.Error("Failed to expire password reset links of user %s: %v", token.UserID, err)
+	}
+	if err := h.DB.RevokeUserSessions(token.UserID); err != nil {
+		h.log.Error("Failed to revoke sessions of user %s: %v", token.UserID, err)
+	}
+	h.Events.Publish(events.SessionsRevoked{UserID: token.UserID})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset"})
+}
+
+// sendEmailToken stores a new single-use token for user and mails it in a
+// link to the web app
+func (h *AuthHandler) sendEmailToken(user *models.User, purpose string) error {
+	raw, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	ttl, path, build := auth.EmailVerificationTTL, "/verify-email", mail.VerificationEmail
+	if purpose == models.TokenPurposeResetPassword {
+		ttl, path, build = auth.PasswordResetTTL, "/reset-password", mail.PasswordResetEmail
+	}
+
+	now := time.Now().UTC()
+	err = h.DB.CreateEmailToken(&models.EmailToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := strings.TrimSuffix(h.AppURL, "/") + path + "?token=" + url.QueryEscape(raw)
+	return h.Mailer.Send(build(user.Email, user.Username, link))
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/auth"
+	"github.com/ammar1510/converse/internal/mail"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// recordingMailer keeps sent emails for inspection
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *recordingMailer) Send(msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// sent returns a snapshot of the sent emails
+func (m *recordingMailer) sent() []mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mail.Message(nil), m.messages...)
+}
+
+var linkTokenPattern = regexp.MustCompile(`\?token=([A-Za-z0-9_-]+)`)
+
+// linkToken extracts the token from the link in an email
+func linkToken(t *testing.T, msg mail.Message) string {
+	match := linkTokenPattern.FindStringSubmatch(msg.Body)
+	require.NotNil(t, match, "no link in %q", msg.Body)
+	return match[1]
+}
+
+// postJSON posts body to path and returns the response
+func postJSON(router *gin.Engine, path string, body interface{}, token string) *httptest.ResponseRecorder {
+	return sendJSON(router, "POST", path, body, token)
+}
+
+// sendJSON sends body to path with the given method and returns the response
+func sendJSON(router *gin.Engine, method, path string, body interface{}, token string) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestVerifyEmail tests that registering sends a verification link that
+// works once
+func TestVerifyEmail(t *testing.T) {
+	router, handler := setupTestRouter(t)
+	mailer := &recordingMailer{}
+	handler.Mailer = mailer
+
+	w := postJSON(router, "/register", models.UserRegistration{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: "password123",
+	}, "")
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var registered models.UserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &registered))
+	assert.False(t, registered.EmailVerified)
+
+	sent := mailer.sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "test@example.com", sent[0].To)
+	assert.Contains(t, sent[0].Body, "http://localhost:5173/verify-email?token=")
+	first := linkToken(t, sent[0])
+
+	// A resent link replaces the first one
+	accessToken, _ := loginForTokens(t, router, "test@example.com", "password123", "laptop")
+	w = postJSON(router, "/verify-email/resend", nil, accessToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	sent = mailer.sent()
+	require.Len(t, sent, 2)
+	second := linkToken(t, sent[1])
+
+	w = postJSON(router, "/verify-email", models.TokenRequest{Token: second}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	user, err := handler.DB.GetUserByEmail("test@example.com")
+	require.NoError(t, err)
+	assert.True(t, user.EmailVerified)
+
+	// Links work once
+	w = postJSON(router, "/verify-email", models.TokenRequest{Token: second}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = postJSON(router, "/verify-email", models.TokenRequest{Token: first}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = postJSON(router, "/verify-email", models.TokenRequest{Token: "not-a-token"}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/verify-email/resend", nil, accessToken)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+// TestPasswordReset tests the forgot/reset password flow
+func TestPasswordReset(t *testing.T) {
+	router, handler := setupTestRouter(t)
+	mailer := &recordingMailer{}
+	handler.Mailer = mailer
+
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	_, err = handler.DB.CreateUser("testuser", "test@example.com", hashedPassword)
+	require.NoError(t, err)
+
+	_, refreshToken := loginForTokens(t, router, "test@example.com", "password123", "laptop")
+
+	// Unknown addresses get the same answer but no email
+	w := postJSON(router, "/password/forgot", models.EmailRequest{Email: "nobody@example.com"}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, mailer.sent())
+
+	w = postJSON(router, "/password/forgot", models.EmailRequest{Email: "test@example.com"}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	sent := mailer.sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "test@example.com", sent[0].To)
+	assert.Contains(t, sent[0].Body, "http://localhost:5173/reset-password?token=")
+	token := linkToken(t, sent[0])
+
+	w = postJSON(router, "/password/reset", models.PasswordResetRequest{Token: token, Password: "abc"}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/password/reset", models.PasswordResetRequest{Token: token, Password: "newpassword"}, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Existing sessions are ended
+	w = postRefreshToken(router, "/refresh", refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postJSON(router, "/login", models.UserLogin{Email: "test@example.com", Password: "password123"}, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = postJSON(router, "/login", models.UserLogin{Email: "test@example.com", Password: "newpassword"}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Links work once
+	w = postJSON(router, "/password/reset", models.PasswordResetRequest{Token: token, Password: "another"}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -9,12 +9,14 @@ import (
 	"time"
 
 	"github.com/ammar1510/converse/internal/auth"
+	"github.com/ammar1510/converse/internal/events"
 	"github.com/ammar1510/converse/internal/models"
 	"github.com/ammar1510/converse/internal/websocket"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	gorilla "github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -23,20 +25,18 @@ func setupWsTokenAuthRouter(t *testing.T) (*gin.Engine, *websocket.Manager) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 
-	// Create WebSocket manager
-	wsManager := websocket.NewManager()
+	// Create WebSocket manager. Connecting and disconnecting update presence,
+	// and the middleware checks the account of each token.
+	mockDB := new(MockDB)
+	mockDB.On("GetUserByID", mock.Anything).Return(&models.User{Username: "testuser", Role: models.RoleUser}, nil).Maybe()
+	mockDB.On("GetConversationPartners", mock.Anything).Return([]uuid.UUID{}, nil).Maybe()
+	mockDB.On("UpdateLastSeen", mock.Anything).Return(nil).Maybe()
+	wsManager := websocket.NewManager(mockDB, events.NewBus())
 	go wsManager.Run()
 
-	// Save the global WebSocket manager
-	originalWSManager := WSManager
-	WSManager = wsManager
-	t.Cleanup(func() {
-		WSManager = originalWSManager
-	})
-
 	// Create a group with TokenAuthMiddleware
 	wsRoute := router.Group("/api")
-	wsRoute.Use(TokenAuthMiddleware())
+	wsRoute.Use(TokenAuthMiddleware(mockDB))
 	wsRoute.GET("/ws", func(c *gin.Context) {
 		wsManager.HandleWebSocket(c)
 	})
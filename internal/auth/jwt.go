@@ -15,28 +15,51 @@ import (
 
 var (
 	ErrInvalidToken = errors.New("invalid token")
-	// This variable will be initialized either from environment
-	// variables or explicitly via InitJWTKey function
-	jwtKey = []byte(os.Getenv("JWT_SECRET"))
-	log    = logger.New("auth")
+	// keys starts out with an HMAC key from the environment and is replaced
+	// by InitJWTKey or InitKeys
+	keys, _ = NewKeySet(NewHMACKey([]byte(os.Getenv("JWT_SECRET"))))
+	log     = logger.New("auth")
 )
 
 // InitJWTKey initializes the JWT key with the provided secret
 // This allows for explicit initialization after environment variables are loaded
 // or for setting a custom key during testing
 func InitJWTKey(key []byte) {
-	jwtKey = key
+	keys.Set(NewHMACKey(key))
 }
 
+// InitKeys signs new tokens with signing and accepts tokens signed by any of
+// the keys. It can be called again at any time to rotate keys.
+func InitKeys(signing *Key, verify ...*Key) error {
+	return keys.Set(signing, verify...)
+}
+
+// PublicKeys returns the key set other services verify our tokens with
+func PublicKeys() JWKS {
+	return keys.JWKS()
+}
+
+// AccessTokenTTL is the lifetime of access tokens. Clients renew them with a
+// refresh token; the tokens of a revoked session stop working before then.
+const AccessTokenTTL = 15 * time.Minute
+
 // JWTClaims represents the claims in the JWT
 type JWTClaims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid,omitempty"`
+	Role      string `json:"role,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a new JWT token for a user
+// GenerateToken creates a new JWT token for a user that isn't tied to a session
 func GenerateToken(user *models.User) (string, time.Time, error) {
+	return GenerateSessionToken(user, uuid.Nil)
+}
+
+// GenerateSessionToken creates a new JWT token for a user, carrying the
+// session it was issued for in the sid claim
+func GenerateSessionToken(user *models.User, sessionID uuid.UUID) (string, time.Time, error) {
 	// Check for nil user
 	if user == nil {
 		return "", time.Time{}, errors.New("user cannot be nil")
@@ -47,19 +70,27 @@ func GenerateToken(user *models.User) (string, time.Time, error) {
 		return "", time.Time{}, errors.New("user ID cannot be empty")
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
+	expirationTime := time.Now().Add(AccessTokenTTL)
 
 	claims := &JWTClaims{
 		UserID:   user.ID.String(),
 		Username: user.Username,
+		Role:     string(user.Role),
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	key := keys.SigningKey()
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	tokenString, err := token.SignedString(key.signer)
 
 	return tokenString, expirationTime, err
 }
@@ -78,12 +109,19 @@ func ValidateToken(tokenString string) (*JWTClaims, error) {
 	claims := &JWTClaims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// Check signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Lookup(kid)
+		if !ok {
+			log.Error("Unknown signing key: %q", kid)
+			return nil, fmt.Errorf("unknown signing key: %q", kid)
+		}
+
+		// Check signing method: a key only verifies its own algorithm
+		if token.Method.Alg() != key.Method.Alg() {
 			log.Error("Unexpected signing method: %v", token.Header["alg"])
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return jwtKey, nil
+		return key.verifier, nil
 	})
 
 	if err != nil {
@@ -107,3 +145,24 @@ func GetUserIDFromToken(claims *JWTClaims) (uuid.UUID, error) {
 	}
 	return uuid.Parse(claims.UserID)
 }
+
+// GetSessionIDFromToken extracts the session from claims. It returns
+// uuid.Nil for tokens that aren't tied to a session.
+func GetSessionIDFromToken(claims *JWTClaims) (uuid.UUID, error) {
+	if claims == nil {
+		return uuid.Nil, errors.New("claims cannot be nil")
+	}
+	if claims.SessionID == "" {
+		return uuid.Nil, nil
+	}
+	return uuid.Parse(claims.SessionID)
+}
+
+// GetRoleFromToken extracts the role from claims. Tokens issued before roles
+// existed belong to ordinary users.
+func GetRoleFromToken(claims *JWTClaims) models.Role {
+	if claims == nil || claims.Role == "" {
+		return models.RoleUser
+	}
+	return models.Role(claims.Role)
+}
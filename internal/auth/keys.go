@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrUnsupportedKey = errors.New("unsupported key type: use an RSA (2048 bits or more) or Ed25519 key")
+	ErrNoSigningKey   = errors.New("no signing key configured")
+)
+
+// Key is a key tokens are signed or verified with. Asymmetric keys are
+// identified by their RFC 7638 thumbprint, which goes in the kid header of
+// the tokens they sign. Keys loaded from a public key can only verify.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// signer is the private key, or the secret for HMAC; nil for keys that
+	// only verify
+	signer interface{}
+	// verifier is the public key, or the secret for HMAC
+	verifier interface{}
+}
+
+// NewHMACKey returns an HS256 key for a shared secret. HMAC tokens carry no
+// kid and the key is never published.
+func NewHMACKey(secret []byte) *Key {
+	return &Key{Method: jwt.SigningMethodHS256, signer: secret, verifier: secret}
+}
+
+// NewKey returns the key for a parsed RSA or Ed25519 private or public key
+func NewKey(key crypto.PublicKey) (*Key, error) {
+	var k Key
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		k = Key{Method: jwt.SigningMethodRS256, signer: key, verifier: &key.PublicKey}
+	case *rsa.PublicKey:
+		k = Key{Method: jwt.SigningMethodRS256, verifier: key}
+	case ed25519.PrivateKey:
+		k = Key{Method: jwt.SigningMethodEdDSA, signer: key, verifier: key.Public()}
+	case ed25519.PublicKey:
+		k = Key{Method: jwt.SigningMethodEdDSA, verifier: key}
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	if public, ok := k.verifier.(*rsa.PublicKey); ok && public.N.BitLen() < 2048 {
+		return nil, ErrUnsupportedKey
+	}
+
+	jwk := k.JWK()
+	k.ID = jwk.thumbprint()
+	return &k, nil
+}
+
+// ParseKeyPEM parses a PEM encoded PKCS #8 or PKCS #1 private key, or a PKIX
+// public key
+func ParseKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKey(key)
+}
+
+// LoadKeyFile reads a PEM encoded key from path
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParseKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// CanSign reports whether the key holds a private key or secret
+func (k *Key) CanSign() bool {
+	return k.signer != nil
+}
+
+// JWK returns the public JSON Web Key for an asymmetric key
+func (k *Key) JWK() JWK {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+
+	switch public := k.verifier.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+
+	return jwk
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// thumbprint returns the RFC 7638 thumbprint: a hash of the required
+// members, in lexical order
+func (j JWK) thumbprint() string {
+	var members []byte
+	if j.KeyType == "RSA" {
+		members, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.KeyType, j.N})
+	} else {
+		members, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Curve, j.KeyType, j.X})
+	}
+
+	sum := sha256.Sum256(members)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS is the JSON Web Key Set published for other services to verify our
+// tokens
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet holds the key new tokens are signed with and every key tokens are
+// accepted from. Rotating a key means publishing the new one for
+// verification first, then signing with it while the old one keeps
+// verifying until its last tokens expire.
+type KeySet struct {
+	mu      sync.RWMutex
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet creates a key set that signs with signing and also accepts
+// tokens signed by verify
+func NewKeySet(signing *Key, verify ...*Key) (*KeySet, error) {
+	s := &KeySet{}
+	if err := s.Set(signing, verify...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Set replaces the keys
+func (s *KeySet) Set(signing *Key, verify ...*Key) error {
+	if signing == nil || !signing.CanSign() {
+		return ErrNoSigningKey
+	}
+
+	keys := map[string]*Key{signing.ID: signing}
+	for _, key := range verify {
+		if existing, ok := keys[key.ID]; ok && existing.CanSign() {
+			// The same key loaded twice; keep the one that can sign
+			continue
+		}
+		keys[key.ID] = key
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signing = signing
+	s.keys = keys
+	return nil
+}
+
+// SigningKey returns the key new tokens are signed with
+func (s *KeySet) SigningKey() *Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.signing
+}
+
+// Lookup returns the key for a kid. HMAC tokens have no kid.
+func (s *KeySet) Lookup(kid string) (*Key, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// JWKS returns the public keys, sorted by kid. Shared secrets are never
+// included.
+func (s *KeySet) JWKS() JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range s.keys {
+		if key.Method != jwt.SigningMethodHS256 {
+			jwks.Keys = append(jwks.Keys, key.JWK())
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+	return jwks
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// generateKeys returns a new RSA and a new Ed25519 signing key
+func generateKeys(t *testing.T) (*Key, *Key) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaKey, err := NewKey(rsaPrivate)
+	require.NoError(t, err)
+
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edKey, err := NewKey(edPrivate)
+	require.NoError(t, err)
+
+	return rsaKey, edKey
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// The example from RFC 7638 section 3.1
+	jwk := JWK{
+		KeyType: "RSA",
+		N:       "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:       "AQAB",
+	}
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jwk.thumbprint())
+}
+
+func TestAsymmetricTokens(t *testing.T) {
+	t.Cleanup(func() { InitJWTKey([]byte("test-secret-key-for-jwt-tests")) })
+
+	rsaKey, edKey := generateKeys(t)
+	user := &models.User{ID: uuid.New(), Username: "testuser"}
+
+	for _, key := range []*Key{rsaKey, edKey} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			require.NoError(t, InitKeys(key))
+
+			token, _, err := GenerateToken(user)
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &JWTClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, key.Method.Alg(), parsed.Header["alg"])
+			assert.Equal(t, key.ID, parsed.Header["kid"])
+
+			claims, err := ValidateToken(token)
+			require.NoError(t, err)
+			assert.Equal(t, user.ID.String(), claims.UserID)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	t.Cleanup(func() { InitJWTKey([]byte("test-secret-key-for-jwt-tests")) })
+
+	oldKey, newKey := generateKeys(t)
+	user := &models.User{ID: uuid.New(), Username: "testuser"}
+
+	// Tokens signed with a shared secret keep working while moving to keys
+	InitJWTKey([]byte("legacy-secret"))
+	legacy, _, err := GenerateToken(user)
+	require.NoError(t, err)
+
+	require.NoError(t, InitKeys(oldKey, NewHMACKey([]byte("legacy-secret"))))
+	oldToken, _, err := GenerateToken(user)
+	require.NoError(t, err)
+	_, err = ValidateToken(legacy)
+	assert.NoError(t, err)
+
+	// Publish the new key before signing with it
+	require.NoError(t, InitKeys(oldKey, newKey))
+	assert.Len(t, PublicKeys().Keys, 2)
+	_, err = ValidateToken(legacy)
+	assert.Error(t, err)
+
+	// Switch: old tokens still verify, new ones use the new key
+	require.NoError(t, InitKeys(newKey, oldKey))
+	_, err = ValidateToken(oldToken)
+	assert.NoError(t, err)
+
+	newToken, _, err := GenerateToken(user)
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &JWTClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, newKey.ID, parsed.Header["kid"])
+
+	// Retire the old key
+	require.NoError(t, InitKeys(newKey))
+	_, err = ValidateToken(oldToken)
+	assert.Error(t, err)
+	_, err = ValidateToken(newToken)
+	assert.NoError(t, err)
+}
+
+func TestValidateTokenRejectsKeyMismatch(t *testing.T) {
+	t.Cleanup(func() { InitJWTKey([]byte("test-secret-key-for-jwt-tests")) })
+
+	rsaKey, edKey := generateKeys(t)
+	require.NoError(t, InitKeys(rsaKey))
+
+	claims := &JWTClaims{UserID: uuid.New().String(), Username: "mallory"}
+
+	// HMAC signed with the public key, claiming the RSA key's kid
+	public, err := x509.MarshalPKIXPublicKey(rsaKey.verifier)
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = rsaKey.ID
+	token, err := forged.SignedString(public)
+	require.NoError(t, err)
+	_, err = ValidateToken(token)
+	assert.Error(t, err)
+
+	// A key that isn't in the set
+	unknown := jwt.NewWithClaims(edKey.Method, claims)
+	unknown.Header["kid"] = edKey.ID
+	token, err = unknown.SignedString(edKey.signer)
+	require.NoError(t, err)
+	_, err = ValidateToken(token)
+	assert.Error(t, err)
+
+	// Without a kid there is no HMAC key to fall back on
+	noKid := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token, err = noKid.SignedString([]byte("test-secret-key-for-jwt-tests"))
+	require.NoError(t, err)
+	_, err = ValidateToken(token)
+	assert.Error(t, err)
+}
+
+func TestParseKeyPEM(t *testing.T) {
+	rsaKey, edKey := generateKeys(t)
+
+	for _, key := range []*Key{rsaKey, edKey} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			private, err := x509.MarshalPKCS8PrivateKey(key.signer)
+			require.NoError(t, err)
+			parsed, err := ParseKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private}))
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, parsed.ID)
+			assert.True(t, parsed.CanSign())
+
+			public, err := x509.MarshalPKIXPublicKey(key.verifier)
+			require.NoError(t, err)
+			parsed, err = ParseKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, parsed.ID)
+			assert.False(t, parsed.CanSign())
+
+			// A public key can't be the signing key
+			_, err = NewKeySet(parsed)
+			assert.Equal(t, ErrNoSigningKey, err)
+		})
+	}
+
+	pkcs1 := x509.MarshalPKCS1PrivateKey(rsaKey.signer.(*rsa.PrivateKey))
+	parsed, err := ParseKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: pkcs1}))
+	require.NoError(t, err)
+	assert.Equal(t, rsaKey.ID, parsed.ID)
+
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = NewKey(weak)
+	assert.Equal(t, ErrUnsupportedKey, err)
+
+	_, err = ParseKeyPEM([]byte("not a key"))
+	assert.Error(t, err)
+}
+
+func TestPublicKeys(t *testing.T) {
+	rsaKey, edKey := generateKeys(t)
+
+	set, err := NewKeySet(rsaKey, edKey, NewHMACKey([]byte("secret")))
+	require.NoError(t, err)
+
+	jwks := set.JWKS()
+	require.Len(t, jwks.Keys, 2)
+
+	for _, jwk := range jwks.Keys {
+		assert.Equal(t, "sig", jwk.Use)
+
+		switch jwk.KeyID {
+		case rsaKey.ID:
+			assert.Equal(t, "RSA", jwk.KeyType)
+			assert.Equal(t, "RS256", jwk.Algorithm)
+			assert.Equal(t, "AQAB", jwk.E)
+		case edKey.ID:
+			assert.Equal(t, "OKP", jwk.KeyType)
+			assert.Equal(t, "EdDSA", jwk.Algorithm)
+			assert.Equal(t, "Ed25519", jwk.Curve)
+
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			require.NoError(t, err)
+			assert.Equal(t, []byte(edKey.verifier.(ed25519.PublicKey)), x)
+		default:
+			t.Errorf("unexpected key %q", jwk.KeyID)
+		}
+	}
+}
@@ -1,17 +1,209 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword creates a bcrypt hash of the password
+// PasswordScheme is one way of hashing passwords. Hashes are self-describing
+// strings, so a scheme recognizes its own and can read the parameters they
+// were made with.
+type PasswordScheme interface {
+	Hash(password string) (string, error)
+	// Recognizes reports whether hash was made by this scheme
+	Recognizes(hash string) bool
+	// Verify reports whether password matches a hash made by this scheme
+	Verify(password, hash string) bool
+	// Outdated reports whether hash was made with other parameters than the
+	// scheme's current ones
+	Outdated(hash string) bool
+}
+
+// PasswordHasher hashes new passwords with its current scheme and verifies
+// hashes made by any of its schemes, so stored hashes can be upgraded as
+// users log in
+type PasswordHasher struct {
+	current PasswordScheme
+	legacy  []PasswordScheme
+}
+
+// NewPasswordHasher creates a hasher that hashes with current and still
+// verifies hashes made by the legacy schemes
+func NewPasswordHasher(current PasswordScheme, legacy ...PasswordScheme) *PasswordHasher {
+	return &PasswordHasher{current: current, legacy: legacy}
+}
+
+// Hash hashes a password with the current scheme
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+// Verify checks a password against a hash from any scheme. needsRehash
+// reports whether a matching hash should be replaced by a new Hash because
+// its scheme or parameters are outdated.
+func (h *PasswordHasher) Verify(password, hash string) (ok, needsRehash bool) {
+	if h.current.Recognizes(hash) {
+		ok = h.current.Verify(password, hash)
+		return ok, ok && h.current.Outdated(hash)
+	}
+
+	for _, scheme := range h.legacy {
+		if scheme.Recognizes(hash) {
+			ok = scheme.Verify(password, hash)
+			return ok, ok
+		}
+	}
+
+	return false, false
+}
+
+// passwords hashes with argon2id and accepts the bcrypt hashes stored before it
+var passwords = NewPasswordHasher(Argon2idScheme{Params: DefaultArgon2idParams}, BcryptScheme{Cost: 12})
+
+// InitPasswordHasher replaces the hasher used by HashPassword and
+// VerifyPassword
+func InitPasswordHasher(hasher *PasswordHasher) {
+	passwords = hasher
+}
+
+// HashPassword hashes a password with the current scheme
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 12) // Cost of 12
-	return string(bytes), err
+	return passwords.Hash(password)
 }
 
-// CheckPasswordHash compares a bcrypt hashed password with its possible plaintext equivalent
+// CheckPasswordHash compares a hashed password with its possible plaintext equivalent
 func CheckPasswordHash(password, hash string) bool {
+	ok, _ := passwords.Verify(password, hash)
+	return ok
+}
+
+// VerifyPassword compares a hashed password with its possible plaintext
+// equivalent and reports whether a matching hash should be rehashed
+func VerifyPassword(password, hash string) (ok, needsRehash bool) {
+	return passwords.Verify(password, hash)
+}
+
+// Argon2idParams are the cost parameters of argon2id hashes
+type Argon2idParams struct {
+	Memory     uint32 // in KiB
+	Time       uint32 // passes over the memory
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// DefaultArgon2idParams follow the OWASP recommendation of 19 MiB and two
+// passes
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:     19 * 1024,
+	Time:       2,
+	Threads:    1,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+// Argon2idScheme hashes passwords with argon2id. Hashes use the PHC string
+// format: $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+type Argon2idScheme struct {
+	Params Argon2idParams
+}
+
+func (s Argon2idScheme) Hash(password string) (string, error) {
+	salt := make([]byte, s.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	p := s.Params
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (s Argon2idScheme) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (s Argon2idScheme) Verify(password, hash string) bool {
+	version, p, salt, key, err := parseArgon2id(hash)
+	if err != nil || version != argon2.Version {
+		return false
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
+
+func (s Argon2idScheme) Outdated(hash string) bool {
+	version, p, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return version != argon2.Version ||
+		p.Memory != s.Params.Memory ||
+		p.Time != s.Params.Time ||
+		p.Threads != s.Params.Threads ||
+		uint32(len(salt)) != s.Params.SaltLength ||
+		uint32(len(key)) != s.Params.KeyLength
+}
+
+// parseArgon2id splits an argon2id PHC string into its parts
+func parseArgon2id(hash string) (version int, params Argon2idParams, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return 0, params, nil, nil, fmt.Errorf("malformed argon2id hash")
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return 0, params, nil, nil, err
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return 0, params, nil, nil, err
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return 0, params, nil, nil, err
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return 0, params, nil, nil, err
+	}
+
+	return version, params, salt, key, nil
+}
+
+// BcryptScheme hashes passwords with bcrypt
+type BcryptScheme struct {
+	Cost int
+}
+
+func (s BcryptScheme) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), s.Cost)
+	return string(bytes), err
+}
+
+func (s BcryptScheme) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (s BcryptScheme) Verify(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
-} 
\ No newline at end of file
+}
+
+func (s BcryptScheme) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != s.Cost
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -110,4 +111,81 @@ func TestCheckPasswordHash(t *testing.T) {
 			}
 		})
 	}
-} 
\ No newline at end of file
+} 
+func TestArgon2idScheme(t *testing.T) {
+	scheme := Argon2idScheme{Params: Argon2idParams{Memory: 1024, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32}}
+
+	hash, err := scheme.Hash("password123")
+	if err != nil {
+		t.Fatalf("Hash returned an error: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected hash format: %s", hash)
+	}
+
+	if !scheme.Recognizes(hash) || !scheme.Verify("password123", hash) {
+		t.Fatal("Verify returned false for a valid password/hash pair")
+	}
+	if scheme.Verify("password124", hash) {
+		t.Fatal("Verify returned true for an invalid password/hash pair")
+	}
+	if scheme.Outdated(hash) {
+		t.Fatal("a hash with the current parameters is outdated")
+	}
+
+	// Hashes keep the parameters they were made with
+	stronger := Argon2idScheme{Params: Argon2idParams{Memory: 2048, Time: 2, Threads: 1, SaltLength: 16, KeyLength: 32}}
+	if !stronger.Verify("password123", hash) {
+		t.Fatal("Verify failed for a hash made with other parameters")
+	}
+	if !stronger.Outdated(hash) {
+		t.Fatal("a hash with weaker parameters isn't outdated")
+	}
+
+	for _, malformed := range []string{"$argon2id$v=19$m=1024$salt$key", "$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5", "$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+		if scheme.Verify("password123", malformed) {
+			t.Fatalf("Verify accepted malformed hash %q", malformed)
+		}
+	}
+}
+
+func TestPasswordHasherRehash(t *testing.T) {
+	current := Argon2idScheme{Params: Argon2idParams{Memory: 1024, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32}}
+	hasher := NewPasswordHasher(current, BcryptScheme{Cost: 4})
+
+	bcryptHash, err := BcryptScheme{Cost: 4}.Hash("password123")
+	if err != nil {
+		t.Fatalf("Hash returned an error: %v", err)
+	}
+	oldArgonHash, err := Argon2idScheme{Params: Argon2idParams{Memory: 512, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32}}.Hash("password123")
+	if err != nil {
+		t.Fatalf("Hash returned an error: %v", err)
+	}
+	currentHash, err := hasher.Hash("password123")
+	if err != nil {
+		t.Fatalf("Hash returned an error: %v", err)
+	}
+
+	testCases := []struct {
+		name        string
+		password    string
+		hash        string
+		ok          bool
+		needsRehash bool
+	}{
+		{name: "legacy scheme", password: "password123", hash: bcryptHash, ok: true, needsRehash: true},
+		{name: "outdated parameters", password: "password123", hash: oldArgonHash, ok: true, needsRehash: true},
+		{name: "current", password: "password123", hash: currentHash, ok: true, needsRehash: false},
+		{name: "wrong password", password: "wrong", hash: bcryptHash, ok: false, needsRehash: false},
+		{name: "unknown scheme", password: "password123", hash: "$md5$abc", ok: false, needsRehash: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, needsRehash := hasher.Verify(tc.password, tc.hash)
+			if ok != tc.ok || needsRehash != tc.needsRehash {
+				t.Fatalf("Verify = (%v, %v), want (%v, %v)", ok, needsRehash, tc.ok, tc.needsRehash)
+			}
+		})
+	}
+}
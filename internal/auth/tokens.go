@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// Lifetimes of the opaque tokens handed to users
+const (
+	// RefreshTokenTTL is how long a refresh token can be exchanged for new tokens
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// EmailVerificationTTL is how long an email verification link works
+	EmailVerificationTTL = 24 * time.Hour
+	// PasswordResetTTL is how long a password reset link works
+	PasswordResetTTL = time.Hour
+	// TwoFactorChallengeTTL is how long a password login has to be completed
+	// with a second factor
+	TwoFactorChallengeTTL = 5 * time.Minute
+)
+
+// GenerateOpaqueToken creates a random token, such as a refresh token or the
+// token in an email link, and returns it along with the hash to store. Only
+// the hash is persisted, so a leaked database doesn't expose usable tokens.
+func GenerateOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken returns the stored form of an opaque token
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// UserFilter narrows the admin user listing. Zero fields match every user.
+type UserFilter struct {
+	// Search matches part of the username, email or display name, ignoring case
+	Search    string
+	Role      models.Role
+	Suspended bool // only suspended accounts
+}
+
+// matches reports whether user passes the filter
+func (f UserFilter) matches(user *models.User) bool {
+	if f.Role != "" && user.Role != f.Role {
+		return false
+	}
+	if f.Suspended && !user.Suspended() {
+		return false
+	}
+	if f.Search == "" {
+		return true
+	}
+
+	search := strings.ToLower(f.Search)
+	for _, field := range []string{user.Username, user.Email, user.DisplayName} {
+		if strings.Contains(strings.ToLower(field), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// likeEscaper escapes the LIKE wildcards with !, which needs no quoting in
+// any backend's string literals
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func (s sqlStore) ListUsers(filter UserFilter, page PageOptions) ([]*models.User, error) {
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return s.bind(len(args))
+	}
+
+	query := "SELECT " + userColumns + " FROM users WHERE deleted_at IS NULL"
+	if filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(filter.Search)) + "%"
+		query += fmt.Sprintf(` AND (LOWER(username) LIKE %s ESCAPE '!'
+			OR LOWER(email) LIKE %s ESCAPE '!'
+			OR LOWER(COALESCE(display_name, '')) LIKE %s ESCAPE '!')`,
+			arg(pattern), arg(pattern), arg(pattern))
+	}
+	if filter.Role != "" {
+		query += " AND role = " + arg(string(filter.Role))
+	}
+	if filter.Suspended {
+		query += " AND suspended_at IS NOT NULL"
+	}
+
+	query, args = keysetQuery(query, args, page, s.bind)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user rows: %w", err)
+	}
+
+	if page.ascending() {
+		slices.Reverse(users)
+	}
+	return users, nil
+}
+
+func (s sqlStore) SetUserRole(userID uuid.UUID, role models.Role) error {
+	changed, err := s.updateUser("UPDATE users SET role = ? WHERE id = ? AND deleted_at IS NULL", string(role), userID)
+	if err != nil || changed {
+		return err
+	}
+
+	_, err = s.getActiveUser(userID)
+	return err
+}
+
+func (s sqlStore) SetUserSuspended(userID uuid.UUID, suspended bool) error {
+	var changed bool
+	var err error
+	if suspended {
+		changed, err = s.updateUser(
+			"UPDATE users SET suspended_at = COALESCE(suspended_at, ?) WHERE id = ? AND deleted_at IS NULL",
+			time.Now().UTC().Truncate(time.Microsecond), userID,
+		)
+	} else {
+		changed, err = s.updateUser("UPDATE users SET suspended_at = NULL WHERE id = ? AND deleted_at IS NULL", userID)
+	}
+	if err != nil || changed {
+		return err
+	}
+
+	_, err = s.getActiveUser(userID)
+	return err
+}
+
+func (s sqlStore) GetStats(since time.Time) (*models.SystemStats, error) {
+	since = since.UTC()
+
+	var stats models.SystemStats
+	err := s.db.QueryRow(s.rebind(`
+		SELECT
+			(SELECT COUNT(*) FROM users WHERE deleted_at IS NULL),
+			(SELECT COUNT(*) FROM users WHERE deleted_at IS NULL AND role = ?),
+			(SELECT COUNT(*) FROM users WHERE deleted_at IS NULL AND suspended_at IS NOT NULL),
+			(SELECT COUNT(*) FROM users WHERE deleted_at IS NOT NULL),
+			(SELECT COUNT(*) FROM users WHERE deleted_at IS NULL AND last_seen >= ?),
+			(SELECT COUNT(*) FROM users WHERE deleted_at IS NULL AND created_at >= ?),
+			(SELECT COUNT(*) FROM messages),
+			(SELECT COUNT(*) FROM messages WHERE created_at >= ?),
+			(SELECT COUNT(*) FROM conversations),
+			(SELECT COUNT(*) FROM sessions WHERE revoked_at IS NULL)`),
+		string(models.RoleAdmin), since, since, since,
+	).Scan(
+		&stats.Users, &stats.Admins, &stats.SuspendedUsers, &stats.DeletedUsers,
+		&stats.RecentUsers, &stats.NewUsers, &stats.Messages, &stats.RecentMessages,
+		&stats.Groups, &stats.ActiveSessions,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// TestAdmin tests the admin methods on every backend
+func TestAdmin(t *testing.T) {
+	forEachBackend(t, testAdmin)
+}
+
+// testAdmin checks listing and searching users, roles, suspension and the
+// statistics
+func testAdmin(t *testing.T, db DBInterface) {
+	start := time.Now().UTC().Add(-time.Minute)
+
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleUser, alice.Role)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	carol, err := db.CreateUser("carol_c", "carol@example.org", "hash")
+	require.NoError(t, err)
+	require.NoError(t, db.UpdateProfile(carol.ID, "Carol Percent", ""))
+	dave, err := db.CreateUser("dave", "dave@example.com", "hash")
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteUser(dave.ID))
+
+	list := func(filter UserFilter, page PageOptions) []string {
+		users, err := db.ListUsers(filter, page)
+		require.NoError(t, err)
+		var names []string
+		for _, user := range users {
+			names = append(names, user.Username)
+		}
+		return names
+	}
+
+	// Newest first, without deleted accounts
+	assert.Equal(t, []string{"carol_c", "bob", "alice"}, list(UserFilter{}, PageOptions{}))
+
+	assert.Equal(t, []string{"bob"}, list(UserFilter{Search: "BOB"}, PageOptions{}))
+	assert.Equal(t, []string{"carol_c"}, list(UserFilter{Search: "example.org"}, PageOptions{}))
+	assert.Equal(t, []string{"carol_c"}, list(UserFilter{Search: "percent"}, PageOptions{}))
+	// LIKE wildcards are matched literally
+	assert.Equal(t, []string{"carol_c"}, list(UserFilter{Search: "_"}, PageOptions{}))
+	assert.Empty(t, list(UserFilter{Search: "%"}, PageOptions{}))
+	assert.Empty(t, list(UserFilter{Search: "dave"}, PageOptions{}))
+
+	// Paging
+	users, err := db.ListUsers(UserFilter{}, PageOptions{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, []string{"alice"}, list(UserFilter{}, PageOptions{Before: CursorForUser(users[1])}))
+	assert.Equal(t, []string{"carol_c"}, list(UserFilter{}, PageOptions{After: CursorForUser(users[1])}))
+
+	// Roles
+	require.NoError(t, db.SetUserRole(bob.ID, models.RoleAdmin))
+	require.NoError(t, db.SetUserRole(bob.ID, models.RoleAdmin))
+	stored, err := db.GetUserByID(bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, stored.Role)
+	assert.Equal(t, []string{"bob"}, list(UserFilter{Role: models.RoleAdmin}, PageOptions{}))
+	assert.Equal(t, ErrUserNotFound, db.SetUserRole(uuid.New(), models.RoleAdmin))
+	assert.Equal(t, ErrUserNotFound, db.SetUserRole(dave.ID, models.RoleAdmin))
+
+	// Suspension
+	require.NoError(t, db.SetUserSuspended(alice.ID, true))
+	stored, err = db.GetUserByID(alice.ID)
+	require.NoError(t, err)
+	require.True(t, stored.Suspended())
+	suspendedAt := *stored.SuspendedAt
+
+	require.NoError(t, db.SetUserSuspended(alice.ID, true))
+	stored, err = db.GetUserByID(alice.ID)
+	require.NoError(t, err)
+	assert.True(t, suspendedAt.Equal(*stored.SuspendedAt))
+	assert.Equal(t, []string{"alice"}, list(UserFilter{Suspended: true}, PageOptions{}))
+
+	require.NoError(t, db.SetUserSuspended(alice.ID, false))
+	require.NoError(t, db.SetUserSuspended(alice.ID, false))
+	stored, err = db.GetUserByID(alice.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.Suspended())
+	assert.Empty(t, list(UserFilter{Suspended: true}, PageOptions{}))
+	assert.Equal(t, ErrUserNotFound, db.SetUserSuspended(uuid.New(), true))
+	assert.Equal(t, ErrUserNotFound, db.SetUserSuspended(dave.ID, true))
+
+	// Statistics
+	require.NoError(t, db.SetUserSuspended(carol.ID, true))
+	_, err = db.CreateMessage(alice.ID, bob.ID, "hi")
+	require.NoError(t, err)
+	group, err := db.CreateGroup(alice.ID, "friends", []uuid.UUID{bob.ID})
+	require.NoError(t, err)
+	_, err = db.CreateGroupMessage(bob.ID, group.ID, "hi all")
+	require.NoError(t, err)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, userID := range []uuid.UUID{alice.ID, bob.ID} {
+		require.NoError(t, db.CreateSession(&models.Session{ID: uuid.New(), UserID: userID, CreatedAt: now, LastUsedAt: now}))
+	}
+	revoked := &models.Session{ID: uuid.New(), UserID: bob.ID, CreatedAt: now, LastUsedAt: now}
+	require.NoError(t, db.CreateSession(revoked))
+	require.NoError(t, db.RevokeSession(revoked.ID))
+
+	stats, err := db.GetStats(start)
+	require.NoError(t, err)
+	assert.Equal(t, models.SystemStats{
+		Users:          3,
+		Admins:         1,
+		SuspendedUsers: 1,
+		DeletedUsers:   1,
+		RecentUsers:    3,
+		NewUsers:       3,
+		Messages:       2,
+		RecentMessages: 2,
+		Groups:         1,
+		ActiveSessions: 2,
+	}, *stats)
+
+	stats, err = db.GetStats(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, stats.RecentUsers)
+	assert.Zero(t, stats.NewUsers)
+	assert.Zero(t, stats.RecentMessages)
+	assert.Equal(t, 3, stats.Users)
+}
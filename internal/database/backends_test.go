@@ -0,0 +1,58 @@
+package database
+
+import (
+	"testing"
+)
+
+// testBackend is a database the shared tests run against
+type testBackend struct {
+	name string
+	// open returns a fresh, migrated database, skipping the test when the
+	// backend isn't available
+	open func(t *testing.T) DBInterface
+}
+
+// testBackends lists every backend. MySQL runs when a server is reachable
+// at MYSQL_TEST_DSN (or the default local one), PostgreSQL when
+// POSTGRES_TEST_DSN is set.
+var testBackends = []testBackend{
+	{name: "Memory", open: func(t *testing.T) DBInterface { return NewMemoryDB() }},
+	{name: "SQLite", open: func(t *testing.T) DBInterface { return setupSQLiteDB(t) }},
+	{name: "MySQL", open: func(t *testing.T) DBInterface { return setupMySQLTestDB(t) }},
+	{name: "Postgres", open: func(t *testing.T) DBInterface { return setupPostgresTestDB(t) }},
+}
+
+// forEachBackend runs test as a subtest on a fresh database of every backend
+func forEachBackend(t *testing.T, test func(t *testing.T, db DBInterface)) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			test(t, backend.open(t))
+		})
+	}
+}
+
+// testTables lists the tables of the schema, children before the tables
+// they reference, so deleting in this order empties a shared test database
+var testTables = []string{
+	"user_events",
+	"messages",
+	"conversation_members",
+	"conversations",
+	"refresh_tokens",
+	"sessions",
+	"email_tokens",
+	"user_totp",
+	"recovery_codes",
+	"two_factor_challenges",
+	"login_attempts",
+	"users",
+}
+
+// clearTestTables deletes the rows earlier runs left in a server database
+func clearTestTables(t *testing.T, db DBInterface) {
+	for _, table := range testTables {
+		if _, err := db.Exec("DELETE FROM " + table); err != nil {
+			t.Fatalf("Failed to clean up %s: %v", table, err)
+		}
+	}
+}
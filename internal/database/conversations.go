@@ -0,0 +1,176 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// conversationsQuery builds the conversation list query shared by the SQL
+// backends. Each of the user's messages is tagged with the other participant,
+// or with its group; window functions then pick the latest message per
+// conversation and count the unread ones, and the outer query pages through
+// the latest messages by (created_at, id) like a message listing.
+func conversationsQuery(userID uuid.UUID, page PageOptions, bind func(n int) string) (string, []interface{}) {
+	var args []interface{}
+	user := func() string {
+		args = append(args, userID)
+		return bind(len(args))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at, unread_count,
+		       partner_id, username, email, display_name, avatar_url, user_created_at, last_seen, deleted_at
+		FROM (
+			SELECT ranked.*, COALESCE(u.username, '') AS username, COALESCE(u.email, '') AS email,
+			       COALESCE(u.display_name, '') AS display_name, COALESCE(u.avatar_url, '') AS avatar_url,
+			       u.created_at AS user_created_at, u.last_seen, u.deleted_at
+			FROM (
+				SELECT tagged.*,
+				       ROW_NUMBER() OVER (PARTITION BY thread_id ORDER BY created_at DESC, id DESC) AS rn,
+				       SUM(CASE WHEN receiver_id = %s AND NOT is_read THEN 1 ELSE 0 END)
+				           OVER (PARTITION BY thread_id) AS unread_count
+				FROM (
+					SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at,
+					       CASE WHEN sender_id = %s THEN receiver_id ELSE sender_id END AS partner_id,
+					       CASE WHEN sender_id = %s THEN receiver_id ELSE sender_id END AS thread_id
+					FROM messages
+					WHERE (sender_id = %s OR receiver_id = %s) AND conversation_id IS NULL
+					UNION ALL
+					SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at,
+					       NULL, conversation_id
+					FROM messages
+					WHERE conversation_id IN (SELECT conversation_id FROM conversation_members WHERE user_id = %s)
+				) tagged
+			) ranked
+			LEFT JOIN users u ON u.id = ranked.partner_id
+		) conversations
+		WHERE rn = 1`,
+		user(), user(), user(), user(), user(), user(),
+	)
+
+	return keysetQuery(query, args, page, bind)
+}
+
+// scanConversations reads the rows of conversationsQuery, most recent first.
+// Group conversations only carry the group's ID; attachGroups loads them.
+func scanConversations(rows *sql.Rows, page PageOptions) ([]*models.ConversationSummary, error) {
+	defer rows.Close()
+
+	var conversations []*models.ConversationSummary
+	for rows.Next() {
+		var msg models.Message
+		var user models.User
+		var receiverID, conversationID, partnerID uuid.NullUUID
+		var updatedAt, userCreatedAt, lastSeen, deletedAt sql.NullTime
+		var unread int
+
+		err := rows.Scan(
+			&msg.ID, &msg.SenderID, &receiverID, &conversationID, &msg.Content, &msg.CreatedAt, &msg.IsRead, &updatedAt, &unread,
+			&partnerID, &user.Username, &user.Email, &user.DisplayName, &user.AvatarURL, &userCreatedAt, &lastSeen, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		msg.ReceiverID = receiverID.UUID
+		if updatedAt.Valid {
+			msg.UpdatedAt = &updatedAt.Time
+		}
+
+		conversation := &models.ConversationSummary{LastMessage: &msg, UnreadCount: unread}
+		if conversationID.Valid {
+			msg.ConversationID = &conversationID.UUID
+			conversation.Group = &models.Group{ID: conversationID.UUID}
+		} else {
+			user.ID = partnerID.UUID
+			user.CreatedAt = userCreatedAt.Time
+			user.LastSeen = lastSeen.Time
+			if deletedAt.Valid {
+				user.DeletedAt = &deletedAt.Time
+			}
+			conversation.User = &user
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if page.ascending() {
+		slices.Reverse(conversations)
+	}
+
+	return conversations, nil
+}
+
+// attachGroups replaces the group of each group conversation with the full
+// group, loaded with getGroup
+func attachGroups(conversations []*models.ConversationSummary, getGroup func(uuid.UUID) (*models.Group, error)) error {
+	for _, conversation := range conversations {
+		if conversation.Group == nil {
+			continue
+		}
+
+		group, err := getGroup(conversation.Group.ID)
+		if err != nil {
+			return err
+		}
+		conversation.Group = group
+	}
+
+	return nil
+}
+
+func (s sqlStore) GetConversationPartners(userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := s.db.Query(s.rebind(`
+		SELECT id FROM users
+		WHERE deleted_at IS NULL AND id <> ? AND id IN (
+			SELECT receiver_id FROM messages WHERE sender_id = ? AND conversation_id IS NULL
+			UNION
+			SELECT sender_id FROM messages WHERE receiver_id = ? AND conversation_id IS NULL
+			UNION
+			SELECT others.user_id
+			FROM conversation_members mine
+			JOIN conversation_members others ON others.conversation_id = mine.conversation_id
+			WHERE mine.user_id = ?
+		)`),
+		userID, userID, userID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partners []uuid.UUID
+	for rows.Next() {
+		var partnerID uuid.UUID
+		if err := rows.Scan(&partnerID); err != nil {
+			return nil, err
+		}
+		partners = append(partners, partnerID)
+	}
+
+	return partners, rows.Err()
+}
+
+// partnerOf returns the participant of msg other than userID
+func partnerOf(msg *models.Message, userID uuid.UUID) uuid.UUID {
+	if msg.SenderID == userID {
+		return msg.ReceiverID
+	}
+	return msg.SenderID
+}
+
+// threadOf returns what a user's conversation containing msg is keyed by:
+// its group, or the participant other than userID
+func threadOf(msg *models.Message, userID uuid.UUID) uuid.UUID {
+	if msg.ConversationID != nil {
+		return *msg.ConversationID
+	}
+	return partnerOf(msg, userID)
+}
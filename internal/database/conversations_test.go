@@ -0,0 +1,158 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// TestConversations tests the conversation list on every backend
+func TestConversations(t *testing.T) {
+	forEachBackend(t, testConversations)
+}
+
+// testConversations checks partners, latest messages, unread counts and paging
+func testConversations(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	carol, err := db.CreateUser("carol", "carol@example.com", "hash")
+	require.NoError(t, err)
+	dave, err := db.CreateUser("dave", "dave@example.com", "hash")
+	require.NoError(t, err)
+
+	send := func(from, to *models.User, content string) *models.Message {
+		msg, err := db.CreateMessage(from.ID, to.ID, content)
+		require.NoError(t, err)
+		return msg
+	}
+
+	send(bob, alice, "bob 1")
+	read := send(bob, alice, "bob 2")
+	send(alice, carol, "carol 1")
+	send(carol, alice, "carol 2")
+	carolLast := send(alice, carol, "carol 3")
+	bobLast := send(bob, alice, "bob 3")
+	send(carol, dave, "not alice's")
+	require.NoError(t, db.MarkMessageAsRead(read.ID))
+
+	partners := func(conversations []*models.ConversationSummary) []uuid.UUID {
+		var ids []uuid.UUID
+		for _, conversation := range conversations {
+			ids = append(ids, conversation.User.ID)
+		}
+		return ids
+	}
+
+	conversations, err := db.GetConversations(alice.ID, PageOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []uuid.UUID{bob.ID, carol.ID}, partners(conversations))
+
+	assert.Equal(t, "bob", conversations[0].User.Username)
+	assert.Equal(t, bobLast.ID, conversations[0].LastMessage.ID)
+	assert.Equal(t, "bob 3", conversations[0].LastMessage.Content)
+	assert.Equal(t, 2, conversations[0].UnreadCount)
+
+	// Alice sent the latest message to Carol; only Carol's one is unread
+	assert.Equal(t, carolLast.ID, conversations[1].LastMessage.ID)
+	assert.Equal(t, 1, conversations[1].UnreadCount)
+
+	// Paging by the last message
+	conversations, err = db.GetConversations(alice.ID, PageOptions{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{bob.ID}, partners(conversations))
+
+	conversations, err = db.GetConversations(alice.ID, PageOptions{Before: CursorFor(bobLast), Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{carol.ID}, partners(conversations))
+
+	conversations, err = db.GetConversations(alice.ID, PageOptions{After: CursorFor(carolLast)})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{bob.ID}, partners(conversations))
+
+	// Dave only talked to Carol
+	conversations, err = db.GetConversations(dave.ID, PageOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []uuid.UUID{carol.ID}, partners(conversations))
+	assert.Equal(t, 1, conversations[0].UnreadCount)
+
+	conversations, err = db.GetConversations(uuid.New(), PageOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, conversations)
+
+	// Groups are listed with the members' conversations, without unread counts
+	group, err := db.CreateGroup(dave.ID, "team", []uuid.UUID{alice.ID})
+	require.NoError(t, err)
+	_, err = db.CreateGroupMessage(alice.ID, group.ID, "team 1")
+	require.NoError(t, err)
+	groupLast, err := db.CreateGroupMessage(dave.ID, group.ID, "team 2")
+	require.NoError(t, err)
+
+	conversations, err = db.GetConversations(alice.ID, PageOptions{})
+	require.NoError(t, err)
+	require.Len(t, conversations, 3)
+	assert.Nil(t, conversations[0].User)
+	require.NotNil(t, conversations[0].Group)
+	assert.Equal(t, group.ID, conversations[0].Group.ID)
+	assert.Equal(t, "team", conversations[0].Group.Name)
+	assert.ElementsMatch(t, []uuid.UUID{dave.ID, alice.ID}, conversations[0].Group.MemberIDs)
+	assert.Equal(t, groupLast.ID, conversations[0].LastMessage.ID)
+	require.NotNil(t, conversations[0].LastMessage.ConversationID)
+	assert.Equal(t, group.ID, *conversations[0].LastMessage.ConversationID)
+	assert.Zero(t, conversations[0].UnreadCount)
+	assert.Equal(t, []uuid.UUID{bob.ID, carol.ID}, partners(conversations[1:]))
+
+	conversations, err = db.GetConversations(alice.ID, PageOptions{Before: CursorFor(groupLast), Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{bob.ID}, partners(conversations))
+
+	// Bob isn't a member
+	conversations, err = db.GetConversations(bob.ID, PageOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{alice.ID}, partners(conversations))
+}
+
+// TestConversationPartners tests finding partners on every backend
+func TestConversationPartners(t *testing.T) {
+	forEachBackend(t, testConversationPartners)
+}
+
+// testConversationPartners checks that direct messages in either direction
+// and shared groups make users partners
+func testConversationPartners(t *testing.T, db DBInterface) {
+	users := make(map[string]*models.User)
+	for _, name := range []string{"alice", "bob", "carol", "dave", "erin", "frank"} {
+		user, err := db.CreateUser(name, name+"@example.com", "hash")
+		require.NoError(t, err)
+		users[name] = user
+	}
+	alice := users["alice"]
+
+	partners := func(user *models.User) []uuid.UUID {
+		ids, err := db.GetConversationPartners(user.ID)
+		require.NoError(t, err)
+		return ids
+	}
+	assert.Empty(t, partners(alice))
+
+	_, err := db.CreateMessage(alice.ID, users["bob"].ID, "hi bob")
+	require.NoError(t, err)
+	_, err = db.CreateMessage(users["carol"].ID, alice.ID, "hi alice")
+	require.NoError(t, err)
+	_, err = db.CreateMessage(alice.ID, alice.ID, "note to self")
+	require.NoError(t, err)
+	_, err = db.CreateGroup(users["dave"].ID, "team", []uuid.UUID{alice.ID, users["erin"].ID})
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteUser(users["erin"].ID))
+
+	// Frank has nothing to do with alice
+	assert.ElementsMatch(t, []uuid.UUID{users["bob"].ID, users["carol"].ID, users["dave"].ID}, partners(alice))
+	assert.ElementsMatch(t, []uuid.UUID{alice.ID}, partners(users["bob"]))
+	assert.ElementsMatch(t, []uuid.UUID{alice.ID}, partners(users["dave"]))
+	assert.Empty(t, partners(users["frank"]))
+}
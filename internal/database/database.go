@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ammar1510/converse/internal/models"
 	"github.com/google/uuid"
@@ -14,13 +15,161 @@ type DBInterface interface {
 	GetUserByID(id uuid.UUID) (*models.User, error)
 	UpdateLastSeen(userID uuid.UUID) error
 	GetAllUsers(excludeUserID uuid.UUID) ([]*models.User, error)
+	UpdatePassword(userID uuid.UUID, passwordHash string) error
+	// MarkEmailVerified marks the user's email verified if it is still email
+	MarkEmailVerified(userID uuid.UUID, email string) error
+	// UpdateProfile sets the user's display name and avatar URL; empty
+	// strings clear them
+	UpdateProfile(userID uuid.UUID, displayName, avatarURL string) error
+	// UpdateEmail changes the user's email and marks it unverified. It fails
+	// with ErrEmailInUse if another user has the address.
+	UpdateEmail(userID uuid.UUID, email string) error
+	// DeleteUser turns the account into an anonymous tombstone: its username
+	// and email are replaced, it can no longer log in, and its sessions,
+	// tokens, two-factor secrets and group memberships are removed. Messages
+	// keep referring to it.
+	DeleteUser(userID uuid.UUID) error
 
 	// Message methods
 	CreateMessage(senderID, receiverID uuid.UUID, content string) (*models.Message, error)
-	GetMessagesByUser(userID uuid.UUID) ([]*models.Message, error)
+	// CreateMessageOnce is CreateMessage for a message the client named with
+	// clientMsgID. If the sender already sent a message with that ID, it
+	// returns that message and false instead of storing another. An empty
+	// clientMsgID always stores.
+	CreateMessageOnce(senderID, receiverID uuid.UUID, content, clientMsgID string) (*models.Message, bool, error)
+	// GetMessagesByUser returns a page of the user's direct messages, newest first
+	GetMessagesByUser(userID uuid.UUID, page PageOptions) ([]*models.Message, error)
 	GetMessageByID(messageID uuid.UUID) (*models.Message, error)
-	GetConversation(userID1, userID2 uuid.UUID) ([]*models.Message, error)
+	// GetConversation returns a page of the messages between two users, oldest first
+	GetConversation(userID1, userID2 uuid.UUID, page PageOptions) ([]*models.Message, error)
 	MarkMessageAsRead(messageID uuid.UUID) error
+	// GetUserMessages returns every direct message the user sent or received
+	// and every message of their groups, oldest first
+	GetUserMessages(userID uuid.UUID) ([]*models.Message, error)
+	// SearchMessages returns a page of the user's direct messages and the
+	// messages of the groups they are a member of matching all SearchTerms of
+	// query, newest first
+	SearchMessages(userID uuid.UUID, query string, page PageOptions) ([]*models.SearchResult, error)
+
+	// Conversation methods
+	// GetConversations returns a page of the user's conversations, most recent first
+	GetConversations(userID uuid.UUID, page PageOptions) ([]*models.ConversationSummary, error)
+	// GetConversationPartners returns the users the user has exchanged direct
+	// messages with or shares a group with. Deleted accounts are left out.
+	GetConversationPartners(userID uuid.UUID) ([]uuid.UUID, error)
+
+	// Group methods
+	// CreateGroup creates a group with the creator and memberIDs as members
+	CreateGroup(creatorID uuid.UUID, name string, memberIDs []uuid.UUID) (*models.Group, error)
+	GetGroupByID(groupID uuid.UUID) (*models.Group, error)
+	// GetGroupsByUser returns the groups the user is a member of, most recently active first
+	GetGroupsByUser(userID uuid.UUID) ([]*models.Group, error)
+	RenameGroup(groupID uuid.UUID, name string) error
+	LeaveGroup(groupID, userID uuid.UUID) error
+	// CreateGroupMessage sends a message to a group the sender is a member of
+	CreateGroupMessage(senderID, groupID uuid.UUID, content string) (*models.Message, error)
+	// CreateGroupMessageOnce is CreateGroupMessage with the deduplication of
+	// CreateMessageOnce
+	CreateGroupMessageOnce(senderID, groupID uuid.UUID, content, clientMsgID string) (*models.Message, bool, error)
+	// GetGroupMessages returns a page of a group's messages, oldest first
+	GetGroupMessages(groupID uuid.UUID, page PageOptions) ([]*models.Message, error)
+
+	// Refresh token methods
+	CreateRefreshToken(token *models.RefreshToken) error
+	// GetRefreshToken looks a token up by its hash, including used and revoked ones
+	GetRefreshToken(tokenHash string) (*models.RefreshToken, error)
+	// RotateRefreshToken marks a token used and stores its replacement. It
+	// fails with ErrRefreshTokenUsed if the token was already used or revoked.
+	RotateRefreshToken(usedID uuid.UUID, next *models.RefreshToken) error
+	RevokeRefreshTokenFamily(familyID uuid.UUID) error
+
+	// Email token methods
+	CreateEmailToken(token *models.EmailToken) error
+	// UseEmailToken marks an unexpired token with the given hash and purpose
+	// as used, along with the user's other tokens for that purpose. It fails
+	// with ErrEmailTokenInvalid if there is no such token.
+	UseEmailToken(tokenHash, purpose string) (*models.EmailToken, error)
+	// ExpireResetTokens marks the user's unused password reset tokens as
+	// used, for when their password changes
+	ExpireResetTokens(userID uuid.UUID) error
+
+	// Two-factor methods
+	// SaveTOTPSecret stores a pending secret, replacing any earlier pending
+	// one. It fails with ErrTOTPAlreadyEnabled once 2FA is enabled.
+	SaveTOTPSecret(userID uuid.UUID, secret string) error
+	// GetTOTP returns a user's pending or enabled secret
+	GetTOTP(userID uuid.UUID) (*models.TOTP, error)
+	// EnableTOTP enables a pending secret, recording the confirmed step, and
+	// replaces the user's recovery codes
+	EnableTOTP(userID uuid.UUID, step int64, recoveryCodeHashes []string) error
+	// UseTOTPStep records an accepted code's step. It fails with
+	// ErrTOTPCodeUsed unless step is later than the last one accepted.
+	UseTOTPStep(userID uuid.UUID, step int64) error
+	// UseRecoveryCode marks an unused recovery code used
+	UseRecoveryCode(userID uuid.UUID, codeHash string) error
+	// DisableTOTP removes a user's secret and recovery codes
+	DisableTOTP(userID uuid.UUID) error
+	CreateTwoFactorChallenge(challenge *models.TwoFactorChallenge) error
+	// GetTwoFactorChallenge looks a challenge up by its hash, including used ones
+	GetTwoFactorChallenge(tokenHash string) (*models.TwoFactorChallenge, error)
+	// AttemptTwoFactorChallenge counts an attempt at a challenge. It fails with
+	// ErrChallengeUsed if the challenge was used or has no attempts left.
+	AttemptTwoFactorChallenge(challengeID uuid.UUID, maxAttempts int) error
+	// UseTwoFactorChallenge marks a challenge used, failing with
+	// ErrChallengeUsed if it already was
+	UseTwoFactorChallenge(challengeID uuid.UUID) error
+
+	// Session methods
+	CreateSession(session *models.Session) error
+	// GetSession returns a session, including a revoked one
+	GetSession(sessionID uuid.UUID) (*models.Session, error)
+	// GetSessionsByUser returns a user's unrevoked sessions, most recently used first
+	GetSessionsByUser(userID uuid.UUID) ([]*models.Session, error)
+	// TouchSession records that a session was just used from ipAddress
+	TouchSession(sessionID uuid.UUID, ipAddress string) error
+	// RevokeSession ends a session and revokes its refresh tokens
+	RevokeSession(sessionID uuid.UUID) error
+	// RevokeUserSessions ends all of a user's sessions and revokes their refresh tokens
+	RevokeUserSessions(userID uuid.UUID) error
+	// RevokeOtherSessions ends all of a user's sessions but keepSessionID and
+	// revokes their refresh tokens
+	RevokeOtherSessions(userID, keepSessionID uuid.UUID) error
+
+	// Login attempt methods
+	// RecordLoginFailure counts a failed login for key at the given time,
+	// starting the count over if the last failure was before since
+	RecordLoginFailure(key string, at, since time.Time) (*models.LoginAttempts, error)
+	// GetLoginAttempts returns a key's failures; a zero count if it has none
+	GetLoginAttempts(key string) (*models.LoginAttempts, error)
+	ClearLoginAttempts(key string) error
+	// PruneLoginAttempts forgets keys whose last failure was before the given time
+	PruneLoginAttempts(before time.Time) error
+
+	// Admin methods
+	// ListUsers returns a page of the accounts matching filter, newest first.
+	// Deleted accounts are left out.
+	ListUsers(filter UserFilter, page PageOptions) ([]*models.User, error)
+	SetUserRole(userID uuid.UUID, role models.Role) error
+	// SetUserSuspended suspends or unsuspends an account. Suspending a
+	// suspended account keeps the time it was first suspended.
+	SetUserSuspended(userID uuid.UUID, suspended bool) error
+	// GetStats counts users, messages, groups and sessions. Recent counts
+	// cover what happened since the given time.
+	GetStats(since time.Time) (*models.SystemStats, error)
+
+	// Event methods
+	// AppendEvent stores a frame for delivery to a user under their next
+	// sequence number
+	AppendEvent(userID uuid.UUID, payload []byte) (*models.Event, error)
+	// GetEventsSince returns up to limit of a user's events numbered after
+	// afterSeq, oldest first
+	GetEventsSince(userID uuid.UUID, afterSeq int64, limit int) ([]*models.Event, error)
+	// GetLastEventSeq returns the number of a user's latest event, or 0 if
+	// they have none
+	GetLastEventSeq(userID uuid.UUID) (int64, error)
+	// PruneEvents deletes events stored before the given time. Sequence
+	// numbers keep counting up from where they were.
+	PruneEvents(before time.Time) error
 
 	// Common methods
 	Exec(query string, args ...interface{}) (ExecResult, error)
@@ -37,6 +186,8 @@ type DatabaseType string
 const (
 	PostgreSQL DatabaseType = "postgres"
 	MySQL      DatabaseType = "mysql"
+	SQLite     DatabaseType = "sqlite"
+	Memory     DatabaseType = "memory"
 )
 
 func NewDatabase(dbType DatabaseType, connStr string) (DBInterface, error) {
@@ -44,7 +195,13 @@ func NewDatabase(dbType DatabaseType, connStr string) (DBInterface, error) {
 	case PostgreSQL:
 		return NewPostgresDB(connStr)
 	case MySQL:
-		return nil, fmt.Errorf("MySQL implementation not available yet")
+		return NewMySQLDB(connStr)
+	case SQLite:
+		// connStr is the path of the database file
+		return NewSQLiteDB(connStr)
+	case Memory:
+		// connStr is ignored; data lives only as long as the process
+		return NewMemoryDB(), nil
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", dbType)
 	}
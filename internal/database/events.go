@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+func (s sqlStore) AppendEvent(userID uuid.UUID, payload []byte) (*models.Event, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Bumping the counter locks the user's row, so concurrent appends for the
+	// same user get consecutive numbers
+	result, err := tx.Exec(
+		s.rebind("UPDATE users SET event_seq = event_seq + 1 WHERE id = ? AND deleted_at IS NULL"),
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	event := &models.Event{
+		UserID:    userID,
+		Payload:   payload,
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	err = tx.QueryRow(s.rebind("SELECT event_seq FROM users WHERE id = ?"), userID).Scan(&event.Seq)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		s.rebind("INSERT INTO user_events (user_id, seq, payload, created_at) VALUES (?, ?, ?, ?)"),
+		userID, event.Seq, string(payload), event.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, tx.Commit()
+}
+
+func (s sqlStore) GetEventsSince(userID uuid.UUID, afterSeq int64, limit int) ([]*models.Event, error) {
+	rows, err := s.db.Query(
+		s.rebind(fmt.Sprintf("SELECT seq, payload, created_at FROM user_events WHERE user_id = ? AND seq > ? ORDER BY seq LIMIT %d", limit)),
+		userID, afterSeq,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.Event
+	for rows.Next() {
+		event := models.Event{UserID: userID}
+		var payload string
+		if err := rows.Scan(&event.Seq, &payload, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Payload = []byte(payload)
+		events = append(events, &event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (s sqlStore) GetLastEventSeq(userID uuid.UUID) (int64, error) {
+	var seq int64
+	err := s.db.QueryRow(s.rebind("SELECT event_seq FROM users WHERE id = ?"), userID).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, ErrUserNotFound
+	}
+	return seq, err
+}
+
+func (s sqlStore) PruneEvents(before time.Time) error {
+	_, err := s.db.Exec(s.rebind("DELETE FROM user_events WHERE created_at < ?"), before.UTC())
+	return err
+}
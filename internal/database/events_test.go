@@ -0,0 +1,87 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvents tests the event methods on every backend
+func TestEvents(t *testing.T) {
+	forEachBackend(t, testEvents)
+}
+
+// testEvents checks numbering, reading, pruning and deleting events
+func testEvents(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+
+	seq, err := db.GetLastEventSeq(alice.ID)
+	require.NoError(t, err)
+	assert.Zero(t, seq)
+
+	// Each user's events are numbered separately
+	for i := 1; i <= 3; i++ {
+		event, err := db.AppendEvent(alice.ID, []byte(fmt.Sprintf(`{"n":%d}`, i)))
+		require.NoError(t, err)
+		assert.Equal(t, int64(i), event.Seq)
+	}
+	event, err := db.AppendEvent(bob.ID, []byte(`{"n":1}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), event.Seq)
+
+	seq, err = db.GetLastEventSeq(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), seq)
+
+	events, err := db.GetEventsSince(alice.ID, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, int64(2), events[0].Seq)
+	assert.Equal(t, alice.ID, events[0].UserID)
+	assert.JSONEq(t, `{"n":2}`, string(events[0].Payload))
+	assert.Equal(t, int64(3), events[1].Seq)
+
+	events, err = db.GetEventsSince(alice.ID, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, int64(1), events[0].Seq)
+
+	events, err = db.GetEventsSince(alice.ID, 3, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	_, err = db.AppendEvent(uuid.New(), []byte(`{}`))
+	assert.Equal(t, ErrUserNotFound, err)
+	_, err = db.GetLastEventSeq(uuid.New())
+	assert.Equal(t, ErrUserNotFound, err)
+
+	// Pruning keeps the numbering going
+	require.NoError(t, db.PruneEvents(time.Now().Add(-time.Hour)))
+	events, err = db.GetEventsSince(alice.ID, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, events, 3)
+
+	require.NoError(t, db.PruneEvents(time.Now().Add(time.Hour)))
+	events, err = db.GetEventsSince(alice.ID, 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	event, err = db.AppendEvent(alice.ID, []byte(`{"n":4}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), event.Seq)
+
+	// Deleted accounts lose their events and get no new ones
+	require.NoError(t, db.DeleteUser(alice.ID))
+	events, err = db.GetEventsSince(alice.ID, 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	_, err = db.AppendEvent(alice.ID, []byte(`{}`))
+	assert.Equal(t, ErrUserNotFound, err)
+}
@@ -0,0 +1,302 @@
+package database
+
+import (
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+func (s sqlStore) CreateGroup(creatorID uuid.UUID, name string, memberIDs []uuid.UUID) (*models.Group, error) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	group := &models.Group{
+		ID:        uuid.New(),
+		Name:      name,
+		CreatedBy: creatorID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		MemberIDs: groupMembers(creatorID, memberIDs),
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Checked up front: each backend reports foreign key violations differently
+	for _, memberID := range group.MemberIDs {
+		var count int
+		err := tx.QueryRow(s.rebind("SELECT COUNT(*) FROM users WHERE id = ? AND deleted_at IS NULL"), memberID).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrUserNotFound
+		}
+	}
+
+	_, err = tx.Exec(
+		s.rebind("INSERT INTO conversations (id, name, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?)"),
+		group.ID, group.Name, group.CreatedBy, group.CreatedAt, group.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, memberID := range group.MemberIDs {
+		_, err = tx.Exec(
+			s.rebind("INSERT INTO conversation_members (conversation_id, user_id, joined_at) VALUES (?, ?, ?)"),
+			group.ID, memberID, now,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+func (s sqlStore) GetGroupByID(groupID uuid.UUID) (*models.Group, error) {
+	var group models.Group
+	err := s.db.QueryRow(
+		s.rebind("SELECT id, name, created_by, created_at, updated_at FROM conversations WHERE id = ?"),
+		groupID,
+	).Scan(&group.ID, &group.Name, &group.CreatedBy, &group.CreatedAt, &group.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.groupMemberIDs("conversation_id = ?", groupID)
+	if err != nil {
+		return nil, err
+	}
+	group.MemberIDs = members[groupID]
+
+	return &group, nil
+}
+
+func (s sqlStore) GetGroupsByUser(userID uuid.UUID) ([]*models.Group, error) {
+	rows, err := s.db.Query(s.rebind(`
+		SELECT c.id, c.name, c.created_by, c.created_at, c.updated_at
+		FROM conversations c
+		JOIN conversation_members m ON m.conversation_id = c.id
+		WHERE m.user_id = ?
+		ORDER BY c.updated_at DESC, c.id DESC`),
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*models.Group
+	for rows.Next() {
+		var group models.Group
+		err := rows.Scan(&group.ID, &group.Name, &group.CreatedBy, &group.CreatedAt, &group.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, &group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	members, err := s.groupMemberIDs(
+		"conversation_id IN (SELECT conversation_id FROM conversation_members WHERE user_id = ?)", userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		group.MemberIDs = members[group.ID]
+	}
+
+	return groups, nil
+}
+
+// groupMemberIDs returns the members of the groups matching the given WHERE
+// clause on conversation_members, by group
+func (s sqlStore) groupMemberIDs(where string, arg interface{}) (map[uuid.UUID][]uuid.UUID, error) {
+	rows, err := s.db.Query(s.rebind(`
+		SELECT conversation_id, user_id
+		FROM conversation_members
+		WHERE `+where+`
+		ORDER BY joined_at, user_id`),
+		arg,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make(map[uuid.UUID][]uuid.UUID)
+	for rows.Next() {
+		var groupID, userID uuid.UUID
+		if err := rows.Scan(&groupID, &userID); err != nil {
+			return nil, err
+		}
+		members[groupID] = append(members[groupID], userID)
+	}
+
+	return members, rows.Err()
+}
+
+func (s sqlStore) RenameGroup(groupID uuid.UUID, name string) error {
+	result, err := s.db.Exec(
+		s.rebind("UPDATE conversations SET name = ?, updated_at = ? WHERE id = ?"),
+		name, time.Now().UTC().Truncate(time.Microsecond), groupID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrGroupNotFound
+	}
+
+	return nil
+}
+
+func (s sqlStore) LeaveGroup(groupID, userID uuid.UUID) error {
+	result, err := s.db.Exec(
+		s.rebind("DELETE FROM conversation_members WHERE conversation_id = ? AND user_id = ?"),
+		groupID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return s.checkMember(s.db, groupID, userID)
+	}
+
+	return nil
+}
+
+// checkMember returns ErrGroupNotFound or ErrNotGroupMember unless userID is
+// a member of the group
+func (s sqlStore) checkMember(q queryer, groupID, userID uuid.UUID) error {
+	var groups, members int
+	err := q.QueryRow(s.rebind(`
+		SELECT (SELECT COUNT(*) FROM conversations WHERE id = ?),
+		       (SELECT COUNT(*) FROM conversation_members WHERE conversation_id = ? AND user_id = ?)`),
+		groupID, groupID, userID,
+	).Scan(&groups, &members)
+	if err != nil {
+		return err
+	}
+
+	if groups == 0 {
+		return ErrGroupNotFound
+	}
+	if members == 0 {
+		return ErrNotGroupMember
+	}
+
+	return nil
+}
+
+func (s sqlStore) CreateGroupMessage(senderID, groupID uuid.UUID, content string) (*models.Message, error) {
+	message, _, err := s.CreateGroupMessageOnce(senderID, groupID, content, "")
+	return message, err
+}
+
+func (s sqlStore) CreateGroupMessageOnce(senderID, groupID uuid.UUID, content, clientMsgID string) (*models.Message, bool, error) {
+	if existing, err := s.clientMessage(senderID, clientMsgID); existing != nil || err != nil {
+		return existing, false, err
+	}
+
+	message := &models.Message{
+		ID:             uuid.New(),
+		SenderID:       senderID,
+		ConversationID: &groupID,
+		Content:        content,
+		CreatedAt:      time.Now().UTC().Truncate(time.Microsecond),
+		IsRead:         false,
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	if err := s.checkMember(tx, groupID, senderID); err != nil {
+		return nil, false, err
+	}
+
+	_, err = tx.Exec(
+		s.rebind("INSERT INTO messages (id, sender_id, conversation_id, content, created_at, is_read, client_msg_id) VALUES (?, ?, ?, ?, ?, ?, ?)"),
+		message.ID, message.SenderID, groupID, message.Content, message.CreatedAt, message.IsRead, nullIfEmpty(clientMsgID),
+	)
+	if err != nil {
+		// Free the connection for the lookup; SQLite has only one
+		tx.Rollback()
+		return s.insertFailed(senderID, clientMsgID, err)
+	}
+
+	// Groups are listed most recently active first
+	_, err = tx.Exec(s.rebind("UPDATE conversations SET updated_at = ? WHERE id = ?"), message.CreatedAt, groupID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	return message, true, nil
+}
+
+func (s sqlStore) GetGroupMessages(groupID uuid.UUID, page PageOptions) ([]*models.Message, error) {
+	query, args := keysetQuery(s.rebind(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at
+		FROM messages
+		WHERE conversation_id = ?`),
+		[]interface{}{groupID}, page, s.bind,
+	)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := scanMessages(rows)
+	if err == nil && !page.ascending() {
+		slices.Reverse(messages)
+	}
+	return messages, err
+}
+
+// groupMembers returns the creator followed by memberIDs, without duplicates
+func groupMembers(creatorID uuid.UUID, memberIDs []uuid.UUID) []uuid.UUID {
+	members := []uuid.UUID{creatorID}
+	for _, id := range memberIDs {
+		if !slices.Contains(members, id) {
+			members = append(members, id)
+		}
+	}
+	return members
+}
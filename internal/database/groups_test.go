@@ -0,0 +1,144 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// TestGroups tests group conversations on every backend
+func TestGroups(t *testing.T) {
+	forEachBackend(t, testGroups)
+}
+
+// testGroups checks membership, renaming, leaving, group messages and that
+// group messages stay out of direct message listings
+func testGroups(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	carol, err := db.CreateUser("carol", "carol@example.com", "hash")
+	require.NoError(t, err)
+	dave, err := db.CreateUser("dave", "dave@example.com", "hash")
+	require.NoError(t, err)
+
+	// The creator is always a member and duplicates are ignored
+	group, err := db.CreateGroup(alice.ID, "Weekend", []uuid.UUID{bob.ID, carol.ID, bob.ID})
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, group.CreatedBy)
+	assert.ElementsMatch(t, []uuid.UUID{alice.ID, bob.ID, carol.ID}, group.MemberIDs)
+
+	_, err = db.CreateGroup(alice.ID, "Ghosts", []uuid.UUID{uuid.New()})
+	assert.Equal(t, ErrUserNotFound, err)
+
+	other, err := db.CreateGroup(dave.ID, "Dave's", []uuid.UUID{alice.ID})
+	require.NoError(t, err)
+
+	loaded, err := db.GetGroupByID(group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Weekend", loaded.Name)
+	assert.ElementsMatch(t, group.MemberIDs, loaded.MemberIDs)
+
+	_, err = db.GetGroupByID(uuid.New())
+	assert.Equal(t, ErrGroupNotFound, err)
+
+	// Messages
+	var sent []*models.Message
+	for _, content := range []string{"hi all", "hey", "plans?"} {
+		msg, err := db.CreateGroupMessage(alice.ID, group.ID, content)
+		require.NoError(t, err)
+		require.NotNil(t, msg.ConversationID)
+		assert.Equal(t, group.ID, *msg.ConversationID)
+		assert.Equal(t, uuid.Nil, msg.ReceiverID)
+		sent = append(sent, msg)
+	}
+
+	_, err = db.CreateGroupMessage(dave.ID, group.ID, "let me in")
+	assert.Equal(t, ErrNotGroupMember, err)
+	_, err = db.CreateGroupMessage(alice.ID, uuid.New(), "anyone?")
+	assert.Equal(t, ErrGroupNotFound, err)
+
+	ids := func(messages []*models.Message) []uuid.UUID {
+		var result []uuid.UUID
+		for _, msg := range messages {
+			result = append(result, msg.ID)
+		}
+		return result
+	}
+
+	messages, err := db.GetGroupMessages(group.ID, PageOptions{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, ids(sent[1:]), ids(messages))
+
+	messages, err = db.GetGroupMessages(group.ID, PageOptions{Before: CursorFor(sent[1])})
+	require.NoError(t, err)
+	assert.Equal(t, ids(sent[:1]), ids(messages))
+
+	stored, err := db.GetMessageByID(sent[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.ConversationID)
+	assert.Equal(t, group.ID, *stored.ConversationID)
+
+	// The group with the latest message comes first
+	groups, err := db.GetGroupsByUser(alice.ID)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, group.ID, groups[0].ID)
+	assert.Equal(t, other.ID, groups[1].ID)
+	assert.ElementsMatch(t, []uuid.UUID{dave.ID, alice.ID}, groups[1].MemberIDs)
+
+	// Group messages aren't direct messages, but the group is one of the
+	// members' conversations and its messages are searched
+	direct, err := db.GetMessagesByUser(alice.ID, PageOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, direct)
+
+	conversations, err := db.GetConversations(alice.ID, PageOptions{})
+	require.NoError(t, err)
+	require.Len(t, conversations, 1)
+	require.NotNil(t, conversations[0].Group)
+	assert.Equal(t, group.ID, conversations[0].Group.ID)
+	assert.Equal(t, sent[2].ID, conversations[0].LastMessage.ID)
+
+	results, err := db.SearchMessages(alice.ID, "plans", PageOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, sent[2].ID, results[0].Message.ID)
+
+	results, err = db.SearchMessages(dave.ID, "plans", PageOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// Renaming
+	require.NoError(t, db.RenameGroup(group.ID, "Saturday"))
+	loaded, err = db.GetGroupByID(group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Saturday", loaded.Name)
+	assert.Equal(t, ErrGroupNotFound, db.RenameGroup(uuid.New(), "Nope"))
+
+	// Leaving
+	require.NoError(t, db.LeaveGroup(group.ID, bob.ID))
+	assert.Equal(t, ErrNotGroupMember, db.LeaveGroup(group.ID, bob.ID))
+	assert.Equal(t, ErrGroupNotFound, db.LeaveGroup(uuid.New(), bob.ID))
+
+	loaded, err = db.GetGroupByID(group.ID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uuid.UUID{alice.ID, carol.ID}, loaded.MemberIDs)
+
+	groups, err = db.GetGroupsByUser(bob.ID)
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+
+	_, err = db.CreateGroupMessage(bob.ID, group.ID, "wait")
+	assert.Equal(t, ErrNotGroupMember, err)
+
+	// History survives leaving
+	messages, err = db.GetGroupMessages(group.ID, PageOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ids(sent), ids(messages))
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// upsertLoginFailureSQL counts a failure of a key in one statement, so the
+// first failures of a new key can't race to insert it. It is the Postgres
+// and SQLite form; MySQL has its own.
+const upsertLoginFailureSQL = `
+	INSERT INTO login_attempts (throttle_key, failures, last_failure_at) VALUES (?, 1, ?)
+	ON CONFLICT (throttle_key) DO UPDATE
+	SET failures = CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END,
+		last_failure_at = excluded.last_failure_at`
+
+// recordLoginFailure counts a failure with upsert, which takes the key, the
+// failure's time and the start of the window, and returns the new count
+func (s sqlStore) recordLoginFailure(upsert, key string, at, since time.Time) (*models.LoginAttempts, error) {
+	at = at.UTC().Truncate(time.Microsecond)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(s.rebind(upsert), key, at, since.UTC()); err != nil {
+		return nil, err
+	}
+
+	attempts, err := s.getLoginAttempts(tx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts, tx.Commit()
+}
+
+func (s sqlStore) GetLoginAttempts(key string) (*models.LoginAttempts, error) {
+	return s.getLoginAttempts(s.db, key)
+}
+
+// getLoginAttempts loads a key's attempts, or a zero count if it has none
+func (s sqlStore) getLoginAttempts(q queryer, key string) (*models.LoginAttempts, error) {
+	attempts := models.LoginAttempts{Key: key}
+
+	err := q.QueryRow(
+		s.rebind("SELECT failures, last_failure_at FROM login_attempts WHERE throttle_key = ?"),
+		key,
+	).Scan(&attempts.Failures, &attempts.LastFailureAt)
+
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return &attempts, nil
+}
+
+func (s sqlStore) ClearLoginAttempts(key string) error {
+	_, err := s.db.Exec(s.rebind("DELETE FROM login_attempts WHERE throttle_key = ?"), key)
+	return err
+}
+
+func (s sqlStore) PruneLoginAttempts(before time.Time) error {
+	_, err := s.db.Exec(s.rebind("DELETE FROM login_attempts WHERE last_failure_at < ?"), before.UTC())
+	return err
+}
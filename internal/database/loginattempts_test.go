@@ -0,0 +1,85 @@
+package database
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoginAttempts tests login attempt storage on every backend
+func TestLoginAttempts(t *testing.T) {
+	forEachBackend(t, testLoginAttempts)
+}
+
+// testLoginAttempts checks counting, the window after which counts start
+// over, clearing and pruning
+func testLoginAttempts(t *testing.T, db DBInterface) {
+	start := time.Now().UTC().Truncate(time.Second)
+	window := time.Hour
+
+	attempts, err := db.GetLoginAttempts("account:alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "account:alice@example.com", attempts.Key)
+	assert.Zero(t, attempts.Failures)
+
+	for i := 1; i <= 3; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		attempts, err = db.RecordLoginFailure("account:alice@example.com", at, at.Add(-window))
+		require.NoError(t, err)
+		assert.Equal(t, i, attempts.Failures)
+		assert.True(t, at.Equal(attempts.LastFailureAt))
+	}
+
+	attempts, err = db.GetLoginAttempts("account:alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts.Failures)
+	assert.True(t, start.Add(3*time.Minute).Equal(attempts.LastFailureAt))
+
+	// Keys are counted separately
+	attempts, err = db.RecordLoginFailure("ip:192.0.2.1", start, start.Add(-window))
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempts.Failures)
+
+	// After a quiet window the count starts over
+	later := start.Add(2 * window)
+	attempts, err = db.RecordLoginFailure("account:alice@example.com", later, later.Add(-window))
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempts.Failures)
+
+	require.NoError(t, db.ClearLoginAttempts("account:alice@example.com"))
+	attempts, err = db.GetLoginAttempts("account:alice@example.com")
+	require.NoError(t, err)
+	assert.Zero(t, attempts.Failures)
+
+	// Pruning only forgets keys whose last failure is old enough
+	_, err = db.RecordLoginFailure("account:bob@example.com", later, later.Add(-window))
+	require.NoError(t, err)
+	require.NoError(t, db.PruneLoginAttempts(start.Add(window)))
+
+	attempts, err = db.GetLoginAttempts("ip:192.0.2.1")
+	require.NoError(t, err)
+	assert.Zero(t, attempts.Failures)
+
+	attempts, err = db.GetLoginAttempts("account:bob@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempts.Failures)
+
+	// Concurrent first failures of a new key are all counted
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := db.RecordLoginFailure("account:carol@example.com", later, later.Add(-window))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	attempts, err = db.GetLoginAttempts("account:carol@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 10, attempts.Failures)
+}
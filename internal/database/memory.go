@@ -0,0 +1,1289 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// ErrExecNotSupported is returned when raw SQL is run against the in-memory database
+var ErrExecNotSupported = errors.New("raw SQL is not supported by the in-memory database")
+
+// MemoryDB is a concurrency-safe, non-persistent implementation of DBInterface.
+// It is meant for demos and tests and mirrors the behavior of PostgresDB.
+type MemoryDB struct {
+	mu          sync.RWMutex
+	users       map[uuid.UUID]*models.User
+	usernames   map[string]uuid.UUID
+	emails      map[string]uuid.UUID
+	messages    map[uuid.UUID]*models.Message
+	messageSeq  []uuid.UUID // message IDs in insertion order
+	groups      map[uuid.UUID]*models.Group
+	tokens      map[string]*models.RefreshToken // refresh tokens by hash
+	sessions    map[uuid.UUID]*models.Session
+	emailTokens map[string]*models.EmailToken // email tokens by hash
+	totps       map[uuid.UUID]*models.TOTP
+	recovery    map[uuid.UUID]map[string]bool         // recovery code hashes by user, true once used
+	challenges  map[string]*models.TwoFactorChallenge // two-factor challenges by hash
+	attempts    map[string]models.LoginAttempts       // failed logins by throttling key
+	clientIDs   map[clientMessageKey]uuid.UUID        // message IDs by sender and client message ID
+	eventSeqs   map[uuid.UUID]int64                   // latest event number by user
+	events      map[uuid.UUID][]*models.Event         // retained events by user, oldest first
+}
+
+// clientMessageKey identifies a message by its sender and the ID the client
+// gave it
+type clientMessageKey struct {
+	senderID    uuid.UUID
+	clientMsgID string
+}
+
+// NewMemoryDB creates an empty in-memory database
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		users:       make(map[uuid.UUID]*models.User),
+		usernames:   make(map[string]uuid.UUID),
+		emails:      make(map[string]uuid.UUID),
+		messages:    make(map[uuid.UUID]*models.Message),
+		groups:      make(map[uuid.UUID]*models.Group),
+		tokens:      make(map[string]*models.RefreshToken),
+		sessions:    make(map[uuid.UUID]*models.Session),
+		emailTokens: make(map[string]*models.EmailToken),
+		totps:       make(map[uuid.UUID]*models.TOTP),
+		recovery:    make(map[uuid.UUID]map[string]bool),
+		challenges:  make(map[string]*models.TwoFactorChallenge),
+		attempts:    make(map[string]models.LoginAttempts),
+		clientIDs:   make(map[clientMessageKey]uuid.UUID),
+		eventSeqs:   make(map[uuid.UUID]int64),
+		events:      make(map[uuid.UUID][]*models.Event),
+	}
+}
+
+func (db *MemoryDB) CreateUser(username, email, passwordHash string) (*models.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.usernames[username]; ok {
+		return nil, ErrUserAlreadyExists
+	}
+	if _, ok := db.emails[email]; ok {
+		return nil, ErrUserAlreadyExists
+	}
+
+	now := time.Now()
+	user := &models.User{
+		ID:           uuid.New(),
+		Username:     username,
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         models.RoleUser,
+		CreatedAt:    now,
+		LastSeen:     now,
+	}
+
+	db.users[user.ID] = user
+	db.usernames[username] = user.ID
+	db.emails[email] = user.ID
+
+	return copyUser(user), nil
+}
+
+func (db *MemoryDB) GetUserByEmail(email string) (*models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	id, ok := db.emails[email]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return copyUser(db.users[id]), nil
+}
+
+func (db *MemoryDB) GetUserByID(id uuid.UUID) (*models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	user, ok := db.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return copyUser(user), nil
+}
+
+func (db *MemoryDB) UpdateLastSeen(userID uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, ok := db.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	user.LastSeen = time.Now()
+	return nil
+}
+
+func (db *MemoryDB) UpdatePassword(userID uuid.UUID, passwordHash string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, ok := db.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	user.PasswordHash = passwordHash
+	return nil
+}
+
+func (db *MemoryDB) MarkEmailVerified(userID uuid.UUID, email string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, ok := db.users[userID]
+	if !ok || user.Email != email {
+		return ErrUserNotFound
+	}
+
+	user.EmailVerified = true
+	return nil
+}
+
+func (db *MemoryDB) UpdateProfile(userID uuid.UUID, displayName, avatarURL string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, ok := db.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	user.DisplayName = displayName
+	user.AvatarURL = avatarURL
+	return nil
+}
+
+func (db *MemoryDB) UpdateEmail(userID uuid.UUID, email string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, ok := db.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if id, ok := db.emails[email]; ok && id != userID {
+		return ErrEmailInUse
+	}
+
+	delete(db.emails, user.Email)
+	db.emails[email] = userID
+	user.Email = email
+	user.EmailVerified = false
+	return nil
+}
+
+func (db *MemoryDB) DeleteUser(userID uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, ok := db.users[userID]
+	if !ok || user.Deleted() {
+		return ErrUserNotFound
+	}
+
+	delete(db.usernames, user.Username)
+	delete(db.emails, user.Email)
+
+	now := time.Now()
+	user.Username, user.Email = DeletedUserIdentity(userID)
+	user.PasswordHash = ""
+	user.DisplayName = ""
+	user.AvatarURL = ""
+	user.EmailVerified = false
+	user.DeletedAt = &now
+	db.usernames[user.Username] = userID
+	db.emails[user.Email] = userID
+
+	for id, session := range db.sessions {
+		if session.UserID == userID {
+			delete(db.sessions, id)
+		}
+	}
+	for hash, token := range db.tokens {
+		if token.UserID == userID {
+			delete(db.tokens, hash)
+		}
+	}
+	for hash, token := range db.emailTokens {
+		if token.UserID == userID {
+			delete(db.emailTokens, hash)
+		}
+	}
+	for hash, challenge := range db.challenges {
+		if challenge.UserID == userID {
+			delete(db.challenges, hash)
+		}
+	}
+	delete(db.totps, userID)
+	delete(db.recovery, userID)
+	delete(db.events, userID)
+
+	for _, group := range db.groups {
+		group.MemberIDs = slices.DeleteFunc(group.MemberIDs, func(id uuid.UUID) bool {
+			return id == userID
+		})
+	}
+
+	return nil
+}
+
+// activeLocked reports whether a user exists and isn't deleted. The caller
+// must hold db.mu.
+func (db *MemoryDB) activeLocked(userID uuid.UUID) bool {
+	user, ok := db.users[userID]
+	return ok && !user.Deleted()
+}
+
+func (db *MemoryDB) GetAllUsers(excludeUserID uuid.UUID) ([]*models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var users []*models.User
+	for id, user := range db.users {
+		if id == excludeUserID || user.Deleted() {
+			continue
+		}
+		users = append(users, copyUser(user))
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	return users, nil
+}
+
+func (db *MemoryDB) CreateMessage(senderID, receiverID uuid.UUID, content string) (*models.Message, error) {
+	message, _, err := db.CreateMessageOnce(senderID, receiverID, content, "")
+	return message, err
+}
+
+func (db *MemoryDB) CreateMessageOnce(senderID, receiverID uuid.UUID, content, clientMsgID string) (*models.Message, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if existing := db.clientMessageLocked(senderID, clientMsgID); existing != nil {
+		return existing, false, nil
+	}
+	if !db.activeLocked(senderID) || !db.activeLocked(receiverID) {
+		return nil, false, ErrUserNotFound
+	}
+
+	message := &models.Message{
+		ID:         uuid.New(),
+		SenderID:   senderID,
+		ReceiverID: receiverID,
+		Content:    content,
+		CreatedAt:  time.Now().UTC(),
+		IsRead:     false,
+	}
+
+	db.addMessageLocked(message, clientMsgID)
+	return copyMessage(message), true, nil
+}
+
+// clientMessageLocked returns a copy of the message a sender named with
+// clientMsgID, or nil. The caller must hold db.mu.
+func (db *MemoryDB) clientMessageLocked(senderID uuid.UUID, clientMsgID string) *models.Message {
+	if clientMsgID == "" {
+		return nil
+	}
+	id, ok := db.clientIDs[clientMessageKey{senderID, clientMsgID}]
+	if !ok {
+		return nil
+	}
+	return copyMessage(db.messages[id])
+}
+
+// addMessageLocked stores a new message. The caller must hold db.mu.
+func (db *MemoryDB) addMessageLocked(message *models.Message, clientMsgID string) {
+	db.messages[message.ID] = message
+	db.messageSeq = append(db.messageSeq, message.ID)
+	if clientMsgID != "" {
+		db.clientIDs[clientMessageKey{message.SenderID, clientMsgID}] = message.ID
+	}
+}
+
+func (db *MemoryDB) GetMessagesByUser(userID uuid.UUID, page PageOptions) ([]*models.Message, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	messages := pageMessages(db.filterMessages(func(msg *models.Message) bool {
+		return msg.ConversationID == nil && (msg.SenderID == userID || msg.ReceiverID == userID)
+	}), page)
+
+	// Newest first, matching PostgresDB
+	slices.Reverse(messages)
+
+	return messages, nil
+}
+
+func (db *MemoryDB) GetUserMessages(userID uuid.UUID) ([]*models.Message, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.filterMessages(func(msg *models.Message) bool {
+		if msg.ConversationID == nil || msg.SenderID == userID {
+			return msg.SenderID == userID || msg.ReceiverID == userID
+		}
+		group, ok := db.groups[*msg.ConversationID]
+		return ok && slices.Contains(group.MemberIDs, userID)
+	}), nil
+}
+
+func (db *MemoryDB) GetMessageByID(messageID uuid.UUID) (*models.Message, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	message, ok := db.messages[messageID]
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+
+	return copyMessage(message), nil
+}
+
+func (db *MemoryDB) GetConversation(userID1, userID2 uuid.UUID, page PageOptions) ([]*models.Message, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Oldest first, matching PostgresDB
+	messages := pageMessages(db.filterMessages(func(msg *models.Message) bool {
+		return (msg.SenderID == userID1 && msg.ReceiverID == userID2) ||
+			(msg.SenderID == userID2 && msg.ReceiverID == userID1)
+	}), page)
+
+	return messages, nil
+}
+
+func (db *MemoryDB) MarkMessageAsRead(messageID uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	message, ok := db.messages[messageID]
+	if !ok {
+		return ErrMessageNotFound
+	}
+
+	now := time.Now().UTC()
+	message.IsRead = true
+	message.UpdatedAt = &now
+
+	return nil
+}
+
+func (db *MemoryDB) SearchMessages(userID uuid.UUID, query string, page PageOptions) ([]*models.SearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Case-insensitive substring matching; every term must appear
+	messages := pageMessages(db.filterMessages(func(msg *models.Message) bool {
+		if !db.visibleLocked(msg, userID) {
+			return false
+		}
+		content := strings.ToLower(msg.Content)
+		for _, term := range terms {
+			if !strings.Contains(content, term) {
+				return false
+			}
+		}
+		return true
+	}), page)
+
+	// Newest first, matching the SQL backends
+	slices.Reverse(messages)
+
+	results := make([]*models.SearchResult, 0, len(messages))
+	for _, msg := range messages {
+		result := &models.SearchResult{
+			Message: msg,
+			Snippet: highlightSnippet(msg.Content, terms),
+		}
+		if msg.ConversationID != nil {
+			result.Group = copyGroup(db.groups[*msg.ConversationID])
+		} else {
+			result.Partner = copyUser(db.users[partnerOf(msg, userID)])
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// visibleLocked reports whether a message is in one of the user's
+// conversations: sent to or by them, or to one of their groups. The caller
+// must hold db.mu.
+func (db *MemoryDB) visibleLocked(msg *models.Message, userID uuid.UUID) bool {
+	if msg.ConversationID != nil {
+		group, ok := db.groups[*msg.ConversationID]
+		return ok && slices.Contains(group.MemberIDs, userID)
+	}
+	return msg.SenderID == userID || msg.ReceiverID == userID
+}
+
+func (db *MemoryDB) GetConversationPartners(userID uuid.UUID) ([]uuid.UUID, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	seen := make(map[uuid.UUID]bool)
+	for _, msg := range db.messages {
+		if msg.ConversationID == nil && (msg.SenderID == userID || msg.ReceiverID == userID) {
+			seen[partnerOf(msg, userID)] = true
+		}
+	}
+	for _, group := range db.groups {
+		if slices.Contains(group.MemberIDs, userID) {
+			for _, memberID := range group.MemberIDs {
+				seen[memberID] = true
+			}
+		}
+	}
+
+	var partners []uuid.UUID
+	for partnerID := range seen {
+		if partnerID != userID && db.activeLocked(partnerID) {
+			partners = append(partners, partnerID)
+		}
+	}
+	return partners, nil
+}
+
+func (db *MemoryDB) GetConversations(userID uuid.UUID, page PageOptions) ([]*models.ConversationSummary, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Conversations are keyed by the partner or the group
+	latest := make(map[uuid.UUID]*models.Message)
+	unread := make(map[uuid.UUID]int)
+	for _, msg := range db.filterMessages(func(msg *models.Message) bool {
+		return db.visibleLocked(msg, userID)
+	}) {
+		threadID := threadOf(msg, userID)
+
+		// filterMessages is oldest first, so the last one seen wins
+		latest[threadID] = msg
+		if msg.ReceiverID == userID && !msg.IsRead {
+			unread[threadID]++
+		}
+	}
+
+	lastMessages := make([]*models.Message, 0, len(latest))
+	for _, msg := range latest {
+		lastMessages = append(lastMessages, msg)
+	}
+	sort.Slice(lastMessages, func(i, j int) bool {
+		return CursorFor(lastMessages[j]).before(lastMessages[i])
+	})
+
+	var conversations []*models.ConversationSummary
+	for _, msg := range pageMessages(lastMessages, page) {
+		conversation := &models.ConversationSummary{
+			LastMessage: msg,
+			UnreadCount: unread[threadOf(msg, userID)],
+		}
+		if msg.ConversationID != nil {
+			conversation.Group = copyGroup(db.groups[*msg.ConversationID])
+		} else {
+			conversation.User = copyUser(db.users[partnerOf(msg, userID)])
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	// Most recent first, matching the SQL backends
+	slices.Reverse(conversations)
+
+	return conversations, nil
+}
+
+func (db *MemoryDB) CreateGroup(creatorID uuid.UUID, name string, memberIDs []uuid.UUID) (*models.Group, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	members := groupMembers(creatorID, memberIDs)
+	for _, memberID := range members {
+		if !db.activeLocked(memberID) {
+			return nil, ErrUserNotFound
+		}
+	}
+
+	now := time.Now().UTC()
+	group := &models.Group{
+		ID:        uuid.New(),
+		Name:      name,
+		CreatedBy: creatorID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		MemberIDs: members,
+	}
+	db.groups[group.ID] = group
+
+	return copyGroup(group), nil
+}
+
+func (db *MemoryDB) GetGroupByID(groupID uuid.UUID) (*models.Group, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	group, ok := db.groups[groupID]
+	if !ok {
+		return nil, ErrGroupNotFound
+	}
+
+	return copyGroup(group), nil
+}
+
+func (db *MemoryDB) GetGroupsByUser(userID uuid.UUID) ([]*models.Group, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var groups []*models.Group
+	for _, group := range db.groups {
+		if slices.Contains(group.MemberIDs, userID) {
+			groups = append(groups, copyGroup(group))
+		}
+	}
+
+	// Most recently active first, matching the SQL backends
+	sort.Slice(groups, func(i, j int) bool {
+		if !groups[i].UpdatedAt.Equal(groups[j].UpdatedAt) {
+			return groups[i].UpdatedAt.After(groups[j].UpdatedAt)
+		}
+		return bytes.Compare(groups[i].ID[:], groups[j].ID[:]) > 0
+	})
+
+	return groups, nil
+}
+
+func (db *MemoryDB) RenameGroup(groupID uuid.UUID, name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	group, ok := db.groups[groupID]
+	if !ok {
+		return ErrGroupNotFound
+	}
+
+	group.Name = name
+	group.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (db *MemoryDB) LeaveGroup(groupID, userID uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	group, ok := db.groups[groupID]
+	if !ok {
+		return ErrGroupNotFound
+	}
+
+	i := slices.Index(group.MemberIDs, userID)
+	if i < 0 {
+		return ErrNotGroupMember
+	}
+
+	group.MemberIDs = slices.Delete(group.MemberIDs, i, i+1)
+	return nil
+}
+
+func (db *MemoryDB) CreateGroupMessage(senderID, groupID uuid.UUID, content string) (*models.Message, error) {
+	message, _, err := db.CreateGroupMessageOnce(senderID, groupID, content, "")
+	return message, err
+}
+
+func (db *MemoryDB) CreateGroupMessageOnce(senderID, groupID uuid.UUID, content, clientMsgID string) (*models.Message, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if existing := db.clientMessageLocked(senderID, clientMsgID); existing != nil {
+		return existing, false, nil
+	}
+
+	group, ok := db.groups[groupID]
+	if !ok {
+		return nil, false, ErrGroupNotFound
+	}
+	if !slices.Contains(group.MemberIDs, senderID) {
+		return nil, false, ErrNotGroupMember
+	}
+
+	message := &models.Message{
+		ID:             uuid.New(),
+		SenderID:       senderID,
+		ConversationID: &groupID,
+		Content:        content,
+		CreatedAt:      time.Now().UTC(),
+		IsRead:         false,
+	}
+
+	db.addMessageLocked(message, clientMsgID)
+	group.UpdatedAt = message.CreatedAt
+
+	return copyMessage(message), true, nil
+}
+
+func (db *MemoryDB) GetGroupMessages(groupID uuid.UUID, page PageOptions) ([]*models.Message, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Oldest first, matching the SQL backends
+	messages := pageMessages(db.filterMessages(func(msg *models.Message) bool {
+		return msg.ConversationID != nil && *msg.ConversationID == groupID
+	}), page)
+
+	return messages, nil
+}
+
+func (db *MemoryDB) CreateRefreshToken(token *models.RefreshToken) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.tokens[token.TokenHash] = copyRefreshToken(token)
+	return nil
+}
+
+func (db *MemoryDB) GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	token, ok := db.tokens[tokenHash]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	return copyRefreshToken(token), nil
+}
+
+func (db *MemoryDB) RotateRefreshToken(usedID uuid.UUID, next *models.RefreshToken) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, token := range db.tokens {
+		if token.ID != usedID {
+			continue
+		}
+		if token.UsedAt != nil || token.RevokedAt != nil {
+			return ErrRefreshTokenUsed
+		}
+
+		now := time.Now()
+		token.UsedAt = &now
+		db.tokens[next.TokenHash] = copyRefreshToken(next)
+		return nil
+	}
+
+	return ErrRefreshTokenUsed
+}
+
+func (db *MemoryDB) RevokeRefreshTokenFamily(familyID uuid.UUID) error {
+	db.revokeRefreshTokens(func(token *models.RefreshToken) bool {
+		return token.FamilyID == familyID
+	})
+	return nil
+}
+
+// revokeRefreshTokens revokes the unrevoked tokens matching match
+func (db *MemoryDB) revokeRefreshTokens(match func(*models.RefreshToken) bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.revokeRefreshTokensLocked(time.Now(), match)
+}
+
+// revokeRefreshTokensLocked is revokeRefreshTokens for callers holding db.mu
+func (db *MemoryDB) revokeRefreshTokensLocked(now time.Time, match func(*models.RefreshToken) bool) {
+	for _, token := range db.tokens {
+		if token.RevokedAt == nil && match(token) {
+			revokedAt := now
+			token.RevokedAt = &revokedAt
+		}
+	}
+}
+
+func (db *MemoryDB) RevokeUserSessions(userID uuid.UUID) error {
+	return db.RevokeOtherSessions(userID, uuid.Nil)
+}
+
+func (db *MemoryDB) RevokeOtherSessions(userID, keepSessionID uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	for _, session := range db.sessions {
+		if session.UserID == userID && session.ID != keepSessionID && session.RevokedAt == nil {
+			revokedAt := now
+			session.RevokedAt = &revokedAt
+		}
+	}
+
+	db.revokeRefreshTokensLocked(now, func(token *models.RefreshToken) bool {
+		return token.UserID == userID && token.FamilyID != keepSessionID
+	})
+	return nil
+}
+
+func (db *MemoryDB) CreateEmailToken(token *models.EmailToken) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := *token
+	db.emailTokens[token.TokenHash] = &t
+	return nil
+}
+
+func (db *MemoryDB) UseEmailToken(tokenHash, purpose string) (*models.EmailToken, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	token, ok := db.emailTokens[tokenHash]
+	if !ok || token.Purpose != purpose || token.UsedAt != nil || now.After(token.ExpiresAt) {
+		return nil, ErrEmailTokenInvalid
+	}
+
+	for _, other := range db.emailTokens {
+		if other.UserID == token.UserID && other.Purpose == purpose && other.UsedAt == nil {
+			usedAt := now
+			other.UsedAt = &usedAt
+		}
+	}
+
+	t := *token
+	usedAt := now
+	t.UsedAt = &usedAt
+	return &t, nil
+}
+
+func (db *MemoryDB) ExpireResetTokens(userID uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range db.emailTokens {
+		if token.UserID == userID && token.Purpose == models.TokenPurposeResetPassword && token.UsedAt == nil {
+			usedAt := now
+			token.UsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+func (db *MemoryDB) SaveTOTPSecret(userID uuid.UUID, secret string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if totp, ok := db.totps[userID]; ok && totp.Enabled() {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	db.totps[userID] = &models.TOTP{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+
+func (db *MemoryDB) GetTOTP(userID uuid.UUID) (*models.TOTP, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	totp, ok := db.totps[userID]
+	if !ok {
+		return nil, ErrTOTPNotFound
+	}
+
+	t := *totp
+	if totp.EnabledAt != nil {
+		enabledAt := *totp.EnabledAt
+		t.EnabledAt = &enabledAt
+	}
+	return &t, nil
+}
+
+func (db *MemoryDB) EnableTOTP(userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	totp, ok := db.totps[userID]
+	if !ok || totp.Enabled() {
+		return ErrTOTPNotFound
+	}
+
+	now := time.Now()
+	totp.EnabledAt = &now
+	totp.LastStep = step
+
+	codes := make(map[string]bool)
+	for _, hash := range recoveryCodeHashes {
+		codes[hash] = false
+	}
+	db.recovery[userID] = codes
+	return nil
+}
+
+func (db *MemoryDB) UseTOTPStep(userID uuid.UUID, step int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	totp, ok := db.totps[userID]
+	if !ok || !totp.Enabled() || step <= totp.LastStep {
+		return ErrTOTPCodeUsed
+	}
+
+	totp.LastStep = step
+	return nil
+}
+
+func (db *MemoryDB) UseRecoveryCode(userID uuid.UUID, codeHash string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	used, ok := db.recovery[userID][codeHash]
+	if !ok || used {
+		return ErrRecoveryCodeInvalid
+	}
+
+	db.recovery[userID][codeHash] = true
+	return nil
+}
+
+func (db *MemoryDB) DisableTOTP(userID uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.totps, userID)
+	delete(db.recovery, userID)
+	return nil
+}
+
+func (db *MemoryDB) CreateTwoFactorChallenge(challenge *models.TwoFactorChallenge) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c := *challenge
+	db.challenges[challenge.TokenHash] = &c
+	return nil
+}
+
+func (db *MemoryDB) GetTwoFactorChallenge(tokenHash string) (*models.TwoFactorChallenge, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	challenge, ok := db.challenges[tokenHash]
+	if !ok {
+		return nil, ErrChallengeNotFound
+	}
+
+	c := *challenge
+	if challenge.UsedAt != nil {
+		usedAt := *challenge.UsedAt
+		c.UsedAt = &usedAt
+	}
+	return &c, nil
+}
+
+func (db *MemoryDB) AttemptTwoFactorChallenge(challengeID uuid.UUID, maxAttempts int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, challenge := range db.challenges {
+		if challenge.ID == challengeID && challenge.UsedAt == nil && challenge.Attempts < maxAttempts {
+			challenge.Attempts++
+			return nil
+		}
+	}
+
+	return ErrChallengeUsed
+}
+
+func (db *MemoryDB) UseTwoFactorChallenge(challengeID uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, challenge := range db.challenges {
+		if challenge.ID == challengeID && challenge.UsedAt == nil {
+			now := time.Now()
+			challenge.UsedAt = &now
+			return nil
+		}
+	}
+
+	return ErrChallengeUsed
+}
+
+func (db *MemoryDB) CreateSession(session *models.Session) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.sessions[session.ID] = copySession(session)
+	return nil
+}
+
+func (db *MemoryDB) GetSession(sessionID uuid.UUID) (*models.Session, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	session, ok := db.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	return copySession(session), nil
+}
+
+func (db *MemoryDB) GetSessionsByUser(userID uuid.UUID) ([]*models.Session, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var sessions []*models.Session
+	for _, session := range db.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			sessions = append(sessions, copySession(session))
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+		}
+		return bytes.Compare(sessions[i].ID[:], sessions[j].ID[:]) > 0
+	})
+
+	return sessions, nil
+}
+
+func (db *MemoryDB) TouchSession(sessionID uuid.UUID, ipAddress string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if session, ok := db.sessions[sessionID]; ok {
+		session.LastUsedAt = time.Now()
+		session.IPAddress = ipAddress
+	}
+	return nil
+}
+
+func (db *MemoryDB) RevokeSession(sessionID uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	if session, ok := db.sessions[sessionID]; ok && session.RevokedAt == nil {
+		session.RevokedAt = &now
+	}
+
+	db.revokeRefreshTokensLocked(now, func(token *models.RefreshToken) bool {
+		return token.FamilyID == sessionID
+	})
+	return nil
+}
+
+func (db *MemoryDB) RecordLoginFailure(key string, at, since time.Time) (*models.LoginAttempts, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	attempts, ok := db.attempts[key]
+	if !ok || attempts.LastFailureAt.Before(since) {
+		attempts = models.LoginAttempts{Key: key}
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = at
+
+	db.attempts[key] = attempts
+	return &attempts, nil
+}
+
+func (db *MemoryDB) GetLoginAttempts(key string) (*models.LoginAttempts, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	attempts, ok := db.attempts[key]
+	if !ok {
+		attempts = models.LoginAttempts{Key: key}
+	}
+	return &attempts, nil
+}
+
+func (db *MemoryDB) ClearLoginAttempts(key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.attempts, key)
+	return nil
+}
+
+func (db *MemoryDB) PruneLoginAttempts(before time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for key, attempts := range db.attempts {
+		if attempts.LastFailureAt.Before(before) {
+			delete(db.attempts, key)
+		}
+	}
+	return nil
+}
+
+func (db *MemoryDB) ListUsers(filter UserFilter, page PageOptions) ([]*models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var users []*models.User
+	for _, user := range db.users {
+		if !user.Deleted() && filter.matches(user) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return CursorForUser(users[i]).precedes(CursorForUser(users[j]))
+	})
+
+	window := pageItems(users, CursorForUser, page)
+	result := make([]*models.User, 0, len(window))
+	for _, user := range window {
+		result = append(result, copyUser(user))
+	}
+
+	// Newest first, matching the SQL backends
+	slices.Reverse(result)
+
+	return result, nil
+}
+
+func (db *MemoryDB) SetUserRole(userID uuid.UUID, role models.Role) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.activeLocked(userID) {
+		return ErrUserNotFound
+	}
+
+	db.users[userID].Role = role
+	return nil
+}
+
+func (db *MemoryDB) SetUserSuspended(userID uuid.UUID, suspended bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.activeLocked(userID) {
+		return ErrUserNotFound
+	}
+
+	user := db.users[userID]
+	if !suspended {
+		user.SuspendedAt = nil
+	} else if user.SuspendedAt == nil {
+		now := time.Now().UTC()
+		user.SuspendedAt = &now
+	}
+	return nil
+}
+
+func (db *MemoryDB) GetStats(since time.Time) (*models.SystemStats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var stats models.SystemStats
+	for _, user := range db.users {
+		if user.Deleted() {
+			stats.DeletedUsers++
+			continue
+		}
+
+		stats.Users++
+		if user.Role == models.RoleAdmin {
+			stats.Admins++
+		}
+		if user.Suspended() {
+			stats.SuspendedUsers++
+		}
+		if !user.LastSeen.Before(since) {
+			stats.RecentUsers++
+		}
+		if !user.CreatedAt.Before(since) {
+			stats.NewUsers++
+		}
+	}
+
+	stats.Messages = len(db.messages)
+	for _, msg := range db.messages {
+		if !msg.CreatedAt.Before(since) {
+			stats.RecentMessages++
+		}
+	}
+
+	stats.Groups = len(db.groups)
+	for _, session := range db.sessions {
+		if session.RevokedAt == nil {
+			stats.ActiveSessions++
+		}
+	}
+
+	return &stats, nil
+}
+
+// Exec always fails: there is no SQL engine behind MemoryDB
+func (db *MemoryDB) AppendEvent(userID uuid.UUID, payload []byte) (*models.Event, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.activeLocked(userID) {
+		return nil, ErrUserNotFound
+	}
+
+	db.eventSeqs[userID]++
+	event := &models.Event{
+		UserID:    userID,
+		Seq:       db.eventSeqs[userID],
+		Payload:   bytes.Clone(payload),
+		CreatedAt: time.Now(),
+	}
+	db.events[userID] = append(db.events[userID], event)
+
+	stored := *event
+	return &stored, nil
+}
+
+func (db *MemoryDB) GetEventsSince(userID uuid.UUID, afterSeq int64, limit int) ([]*models.Event, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var events []*models.Event
+	for _, event := range db.events[userID] {
+		if len(events) == limit {
+			break
+		}
+		if event.Seq > afterSeq {
+			stored := *event
+			events = append(events, &stored)
+		}
+	}
+	return events, nil
+}
+
+func (db *MemoryDB) GetLastEventSeq(userID uuid.UUID) (int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, ok := db.users[userID]; !ok {
+		return 0, ErrUserNotFound
+	}
+	return db.eventSeqs[userID], nil
+}
+
+func (db *MemoryDB) PruneEvents(before time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for userID, events := range db.events {
+		events = slices.DeleteFunc(events, func(event *models.Event) bool {
+			return event.CreatedAt.Before(before)
+		})
+		if len(events) == 0 {
+			delete(db.events, userID)
+		} else {
+			db.events[userID] = events
+		}
+	}
+	return nil
+}
+
+func (db *MemoryDB) Exec(query string, args ...interface{}) (ExecResult, error) {
+	return nil, ErrExecNotSupported
+}
+
+func (db *MemoryDB) Close() error {
+	return nil
+}
+
+// filterMessages returns copies of the messages matching keep, oldest first
+// by (created_at, id) like the SQL backends. The caller must hold db.mu.
+func (db *MemoryDB) filterMessages(keep func(*models.Message) bool) []*models.Message {
+	var messages []*models.Message
+	for _, id := range db.messageSeq {
+		msg := db.messages[id]
+		if keep(msg) {
+			messages = append(messages, copyMessage(msg))
+		}
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return CursorFor(messages[j]).before(messages[i])
+	})
+
+	return messages
+}
+
+// copyUser returns a copy so callers can't mutate stored state
+func copyUser(user *models.User) *models.User {
+	u := *user
+	return &u
+}
+
+// copyMessage returns a copy so callers can't mutate stored state
+func copyMessage(message *models.Message) *models.Message {
+	m := *message
+	if message.ConversationID != nil {
+		conversationID := *message.ConversationID
+		m.ConversationID = &conversationID
+	}
+	if message.UpdatedAt != nil {
+		updatedAt := *message.UpdatedAt
+		m.UpdatedAt = &updatedAt
+	}
+	return &m
+}
+
+// copyGroup returns a copy so callers can't mutate stored state
+func copyGroup(group *models.Group) *models.Group {
+	g := *group
+	g.MemberIDs = slices.Clone(group.MemberIDs)
+	return &g
+}
+
+// copyRefreshToken returns a copy so callers can't mutate stored state
+func copyRefreshToken(token *models.RefreshToken) *models.RefreshToken {
+	t := *token
+	if token.UsedAt != nil {
+		usedAt := *token.UsedAt
+		t.UsedAt = &usedAt
+	}
+	if token.RevokedAt != nil {
+		revokedAt := *token.RevokedAt
+		t.RevokedAt = &revokedAt
+	}
+	return &t
+}
+
+// copySession returns a copy so callers can't mutate stored state
+func copySession(session *models.Session) *models.Session {
+	c := *session
+	if session.RevokedAt != nil {
+		revokedAt := *session.RevokedAt
+		c.RevokedAt = &revokedAt
+	}
+	return &c
+}
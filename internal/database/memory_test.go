@@ -0,0 +1,57 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewDatabaseMemory tests that the factory builds an in-memory database
+func TestNewDatabaseMemory(t *testing.T) {
+	db, err := NewDatabase(Memory, "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.IsType(t, &MemoryDB{}, db)
+}
+
+// TestMemoryConcurrentAccess tests that concurrent writers don't race
+func TestMemoryConcurrentAccess(t *testing.T) {
+	db := NewMemoryDB()
+
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			_, err := db.CreateMessage(alice.ID, bob.ID, fmt.Sprintf("message %d", i))
+			assert.NoError(t, err)
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, err := db.GetConversation(alice.ID, bob.ID, PageOptions{})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	conversation, err := db.GetConversation(alice.ID, bob.ID, PageOptions{})
+	require.NoError(t, err)
+	assert.Len(t, conversation, 50)
+}
+
+// TestMemoryExec tests that raw SQL is rejected
+func TestMemoryExec(t *testing.T) {
+	db := NewMemoryDB()
+
+	_, err := db.Exec("DELETE FROM users")
+	assert.Equal(t, ErrExecNotSupported, err)
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// scanMessages reads rows selecting the standard message columns:
+// id, sender_id, receiver_id, conversation_id, content, created_at, is_read,
+// updated_at
+func scanMessages(rows *sql.Rows) ([]*models.Message, error) {
+	defer rows.Close()
+
+	var messages []*models.Message
+	for rows.Next() {
+		var msg models.Message
+		var receiverID, conversationID uuid.NullUUID
+		var updatedAt sql.NullTime
+
+		err := rows.Scan(&msg.ID, &msg.SenderID, &receiverID, &conversationID, &msg.Content, &msg.CreatedAt, &msg.IsRead, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		// Group messages have no receiver
+		msg.ReceiverID = receiverID.UUID
+		if conversationID.Valid {
+			msg.ConversationID = &conversationID.UUID
+		}
+		if updatedAt.Valid {
+			msg.UpdatedAt = &updatedAt.Time
+		}
+
+		messages = append(messages, &msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// clientMessage returns the message a sender named with clientMsgID, or nil
+// if there is none or clientMsgID is empty
+func (s sqlStore) clientMessage(senderID uuid.UUID, clientMsgID string) (*models.Message, error) {
+	if clientMsgID == "" {
+		return nil, nil
+	}
+
+	rows, err := s.db.Query(s.rebind(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at
+		FROM messages
+		WHERE sender_id = ? AND client_msg_id = ?`),
+		senderID, clientMsgID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := scanMessages(rows)
+	if err != nil || len(messages) == 0 {
+		return nil, err
+	}
+	return messages[0], nil
+}
+
+// insertFailed handles the error of inserting a message named with
+// clientMsgID. If a concurrent send of the same message got in first, the
+// insert broke the unique index and that message is returned instead.
+func (s sqlStore) insertFailed(senderID uuid.UUID, clientMsgID string, err error) (*models.Message, bool, error) {
+	if existing, _ := s.clientMessage(senderID, clientMsgID); existing != nil {
+		return existing, false, nil
+	}
+	return nil, false, err
+}
+
+func (s sqlStore) GetUserMessages(userID uuid.UUID) ([]*models.Message, error) {
+	rows, err := s.db.Query(s.rebind(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at
+		FROM messages
+		WHERE sender_id = ? OR receiver_id = ?
+		   OR conversation_id IN (SELECT conversation_id FROM conversation_members WHERE user_id = ?)
+		ORDER BY created_at, id`),
+		userID, userID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClientMessageIDs tests deduplicating sends on every backend
+func TestClientMessageIDs(t *testing.T) {
+	forEachBackend(t, testClientMessageIDs)
+}
+
+// testClientMessageIDs checks that a message sent twice with the same client
+// message ID is stored once
+func testClientMessageIDs(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+
+	first, created, err := db.CreateMessageOnce(alice.ID, bob.ID, "hello", "c-1")
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	retry, created, err := db.CreateMessageOnce(alice.ID, bob.ID, "hello", "c-1")
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, first.ID, retry.ID)
+	assert.True(t, first.CreatedAt.Equal(retry.CreatedAt))
+
+	// IDs are per sender, and messages without one are never deduplicated
+	other, created, err := db.CreateMessageOnce(bob.ID, alice.ID, "hi", "c-1")
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.NotEqual(t, first.ID, other.ID)
+
+	for i := 0; i < 2; i++ {
+		_, created, err = db.CreateMessageOnce(alice.ID, bob.ID, "again", "")
+		require.NoError(t, err)
+		assert.True(t, created)
+	}
+
+	// A failed send doesn't claim the ID
+	_, _, err = db.CreateMessageOnce(alice.ID, uuid.New(), "lost", "c-2")
+	assert.Equal(t, ErrUserNotFound, err)
+	_, created, err = db.CreateMessageOnce(alice.ID, bob.ID, "found", "c-2")
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	// Group messages share the sender's IDs
+	group, err := db.CreateGroup(alice.ID, "friends", []uuid.UUID{bob.ID})
+	require.NoError(t, err)
+	groupMessage, created, err := db.CreateGroupMessageOnce(alice.ID, group.ID, "hi all", "g-1")
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	retry, created, err = db.CreateGroupMessageOnce(alice.ID, group.ID, "hi all", "g-1")
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, groupMessage.ID, retry.ID)
+	require.NotNil(t, retry.ConversationID)
+	assert.Equal(t, group.ID, *retry.ConversationID)
+
+	retry, created, err = db.CreateGroupMessageOnce(alice.ID, group.ID, "hello", "c-1")
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, first.ID, retry.ID)
+
+	// Concurrent retries store one message between them
+	var wg sync.WaitGroup
+	results := make(chan bool, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, created, err := db.CreateMessageOnce(alice.ID, bob.ID, "racing", "c-3")
+			assert.NoError(t, err)
+			results <- created
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	stored := 0
+	for created := range results {
+		if created {
+			stored++
+		}
+	}
+	assert.Equal(t, 1, stored)
+
+	messages, err := db.GetUserMessages(alice.ID)
+	require.NoError(t, err)
+	assert.Len(t, messages, 7)
+}
+
+// TestMessages tests message storage, ordering and read flags
+func TestMessages(t *testing.T) {
+	forEachBackend(t, testMessages)
+}
+
+// testMessages checks storing, listing and marking messages as read
+func testMessages(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	carol, err := db.CreateUser("carol", "carol@example.com", "hash")
+	require.NoError(t, err)
+
+	_, err = db.CreateMessage(alice.ID, uuid.New(), "to nobody")
+	assert.Equal(t, ErrUserNotFound, err)
+
+	first, err := db.CreateMessage(alice.ID, bob.ID, "first")
+	require.NoError(t, err)
+	second, err := db.CreateMessage(bob.ID, alice.ID, "second")
+	require.NoError(t, err)
+	_, err = db.CreateMessage(carol.ID, alice.ID, "elsewhere")
+	require.NoError(t, err)
+
+	// Conversations are oldest first and only include the two participants
+	conversation, err := db.GetConversation(bob.ID, alice.ID, PageOptions{})
+	require.NoError(t, err)
+	require.Len(t, conversation, 2)
+	assert.Equal(t, first.ID, conversation[0].ID)
+	assert.Equal(t, second.ID, conversation[1].ID)
+
+	// A user's messages are newest first
+	messages, err := db.GetMessagesByUser(alice.ID, PageOptions{})
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.Equal(t, "elsewhere", messages[0].Content)
+	assert.Equal(t, first.ID, messages[2].ID)
+
+	// Read flags
+	assert.False(t, first.IsRead)
+	require.NoError(t, db.MarkMessageAsRead(first.ID))
+	read, err := db.GetMessageByID(first.ID)
+	require.NoError(t, err)
+	assert.True(t, read.IsRead)
+	assert.NotNil(t, read.UpdatedAt)
+
+	assert.Equal(t, ErrMessageNotFound, db.MarkMessageAsRead(uuid.New()))
+	_, err = db.GetMessageByID(uuid.New())
+	assert.Equal(t, ErrMessageNotFound, err)
+}
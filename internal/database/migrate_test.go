@@ -0,0 +1,225 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrationsEmbedded tests that every dialect ships the same versions
+func TestMigrationsEmbedded(t *testing.T) {
+	var versions [][]int64
+	for _, dbType := range []DatabaseType{PostgreSQL, MySQL, SQLite} {
+		migrator, err := NewMigrator(nil, dbType)
+		require.NoError(t, err, dbType)
+
+		var dialectVersions []int64
+		for _, migration := range migrator.Migrations() {
+			assert.NotEmpty(t, migration.Up, "%s %d", dbType, migration.Version)
+			assert.NotEmpty(t, migration.Down, "%s %d", dbType, migration.Version)
+			dialectVersions = append(dialectVersions, migration.Version)
+		}
+		require.NotEmpty(t, dialectVersions, dbType)
+		versions = append(versions, dialectVersions)
+	}
+
+	assert.Equal(t, versions[0], versions[1])
+	assert.Equal(t, versions[0], versions[2])
+
+	_, err := NewMigrator(nil, Memory)
+	assert.Equal(t, ErrMigrationsNotSupported, err)
+}
+
+// TestLoadMigrations tests file name parsing and pairing
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int64
+		wantErr  bool
+	}{
+		{
+			name: "sorted by version",
+			files: fstest.MapFS{
+				"m/0010_later.up.sql":   {Data: []byte("SELECT 10;")},
+				"m/0010_later.down.sql": {Data: []byte("SELECT -10;")},
+				"m/0002_first.up.sql":   {Data: []byte("SELECT 2;")},
+				"m/0002_first.down.sql": {Data: []byte("SELECT -2;")},
+				"m/README.md":           {Data: []byte("ignored")},
+			},
+			versions: []int64{2, 10},
+		},
+		{
+			name: "missing down file",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad file name",
+			files: fstest.MapFS{
+				"m/init.up.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate version",
+			files: fstest.MapFS{
+				"m/0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+				"m/0001_a.down.sql": {Data: []byte("SELECT 1;")},
+				"m/0001_b.up.sql":   {Data: []byte("SELECT 1;")},
+				"m/0001_b.down.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files, "m")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			var versions []int64
+			for _, migration := range migrations {
+				versions = append(versions, migration.Version)
+			}
+			assert.Equal(t, tt.versions, versions)
+		})
+	}
+}
+
+// TestSplitStatements tests splitting migration scripts into statements
+func TestSplitStatements(t *testing.T) {
+	script := `-- a comment; with a semicolon
+CREATE TABLE a (
+    id INT
+);
+
+CREATE FUNCTION f() RETURNS trigger AS $$
+BEGIN
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+DROP TABLE b`
+
+	statements := splitStatements(script)
+	require.Len(t, statements, 3)
+	assert.Equal(t, "CREATE TABLE a (\n    id INT\n)", statements[0])
+	assert.Contains(t, statements[1], "RETURN NEW;\nEND;")
+	assert.Equal(t, "DROP TABLE b", statements[2])
+}
+
+// TestMigratorUpDown tests applying, reporting and rolling back migrations
+// on every backend with a schema
+func TestMigratorUpDown(t *testing.T) {
+	forEachBackend(t, testMigratorUpDown)
+}
+
+// testMigratorUpDown rolls every migration back and applies them again
+func testMigratorUpDown(t *testing.T, db DBInterface) {
+	ctx := context.Background()
+	migratable, ok := db.(Migratable)
+	if !ok {
+		t.Skip("backend has no schema")
+	}
+
+	migrator, err := migratable.Migrator()
+	require.NoError(t, err)
+	all := migrator.Migrations()
+
+	// Setting up the backend already applied everything
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, len(all))
+	for _, status := range statuses {
+		assert.NotNil(t, status.AppliedAt, status.Version)
+	}
+
+	// Roll everything back; the tables are gone
+	reverted, err := migrator.Down(ctx, len(all))
+	require.NoError(t, err)
+	require.Len(t, reverted, len(all))
+	assert.Equal(t, all[len(all)-1].Version, reverted[0].Version)
+
+	_, err = db.CreateUser("testuser", "test@example.com", "hash")
+	assert.Error(t, err)
+
+	statuses, err = migrator.Status(ctx)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.Nil(t, status.AppliedAt, status.Version)
+	}
+
+	// Nothing left to roll back
+	reverted, err = migrator.Down(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, reverted)
+
+	// And forward again
+	applied, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(all))
+
+	_, err = db.CreateUser("testuser", "test@example.com", "hash")
+	assert.NoError(t, err)
+}
+
+// TestMigratorConcurrent tests that two processes migrating the same
+// database don't apply a migration twice
+func TestMigratorConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "converse.db")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, err := NewSQLiteDB(path)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer db.Close()
+
+			_, err = MigrateUp(context.Background(), db)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	db, err := NewSQLiteDB(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count))
+	migrator, err := db.Migrator()
+	require.NoError(t, err)
+	assert.Equal(t, len(migrator.Migrations()), count)
+}
+
+// TestMigrateUpUnsupported tests that the in-memory database has no migrations
+func TestMigrateUpUnsupported(t *testing.T) {
+	_, err := MigrateUp(context.Background(), NewMemoryDB())
+	assert.Equal(t, ErrMigrationsNotSupported, err)
+}
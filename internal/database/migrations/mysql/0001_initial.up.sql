@@ -0,0 +1,25 @@
+-- Initial schema. UUIDs are stored as CHAR(36) and timestamps in UTC.
+CREATE TABLE IF NOT EXISTS users (
+    id CHAR(36) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL UNIQUE,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    display_name VARCHAR(255),
+    avatar_url TEXT,
+    created_at DATETIME(6) NOT NULL,
+    last_seen DATETIME(6) NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS messages (
+    id CHAR(36) PRIMARY KEY,
+    sender_id CHAR(36) NOT NULL,
+    receiver_id CHAR(36) NOT NULL,
+    content TEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    is_read BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at DATETIME(6) NULL,
+    INDEX idx_messages_sender (sender_id, created_at),
+    INDEX idx_messages_receiver (receiver_id, created_at),
+    FOREIGN KEY (sender_id) REFERENCES users(id),
+    FOREIGN KEY (receiver_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
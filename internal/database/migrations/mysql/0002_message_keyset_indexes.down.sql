@@ -0,0 +1 @@
+DROP INDEX idx_messages_conversation ON messages;
@@ -0,0 +1,4 @@
+-- Composite index for paging through a conversation by (created_at, id).
+-- InnoDB secondary indexes already end in the primary key, so the existing
+-- sender and receiver indexes cover a user's message history.
+CREATE INDEX idx_messages_conversation ON messages (sender_id, receiver_id, created_at, id);
@@ -0,0 +1 @@
+DROP INDEX idx_messages_content_search ON messages;
@@ -0,0 +1,2 @@
+-- Full-text search over message content
+CREATE FULLTEXT INDEX idx_messages_content_search ON messages (content);
@@ -0,0 +1,9 @@
+DELETE FROM messages WHERE conversation_id IS NOT NULL;
+ALTER TABLE messages DROP CONSTRAINT messages_recipient_check;
+ALTER TABLE messages DROP FOREIGN KEY fk_messages_conversation;
+ALTER TABLE messages
+    DROP INDEX idx_messages_group,
+    DROP COLUMN conversation_id,
+    MODIFY receiver_id CHAR(36) NOT NULL;
+DROP TABLE IF EXISTS conversation_members;
+DROP TABLE IF EXISTS conversations;
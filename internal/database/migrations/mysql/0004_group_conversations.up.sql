@@ -0,0 +1,27 @@
+-- Group conversations. A group message has a conversation_id instead of a
+-- receiver_id; direct messages are unchanged.
+CREATE TABLE conversations (
+    id CHAR(36) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_by CHAR(36) NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    updated_at DATETIME(6) NOT NULL,
+    FOREIGN KEY (created_by) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE conversation_members (
+    conversation_id CHAR(36) NOT NULL,
+    user_id CHAR(36) NOT NULL,
+    joined_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (conversation_id, user_id),
+    INDEX idx_conversation_members_user (user_id),
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE messages
+    MODIFY receiver_id CHAR(36) NULL,
+    ADD COLUMN conversation_id CHAR(36) NULL AFTER receiver_id,
+    ADD INDEX idx_messages_group (conversation_id, created_at, id),
+    ADD CONSTRAINT fk_messages_conversation FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+    ADD CONSTRAINT messages_recipient_check CHECK ((receiver_id IS NULL) <> (conversation_id IS NULL));
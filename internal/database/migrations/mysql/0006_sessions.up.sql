@@ -0,0 +1,21 @@
+-- Sessions, one per login. A session's id is the family_id of the refresh
+-- tokens issued for it and the sid claim of its access tokens.
+CREATE TABLE sessions (
+    id CHAR(36) PRIMARY KEY,
+    user_id CHAR(36) NOT NULL,
+    device_label VARCHAR(100) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    last_used_at DATETIME(6) NOT NULL,
+    revoked_at DATETIME(6) NULL,
+    INDEX idx_sessions_user (user_id, last_used_at),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Every refresh token family is a login; give the live ones a session
+INSERT INTO sessions (id, user_id, device_label, ip_address, user_agent, created_at, last_used_at)
+SELECT family_id, user_id, '', '', '', MIN(created_at), MAX(created_at)
+FROM refresh_tokens
+WHERE revoked_at IS NULL
+GROUP BY family_id, user_id;
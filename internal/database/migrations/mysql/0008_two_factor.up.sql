@@ -0,0 +1,34 @@
+-- TOTP two-factor authentication. A secret is pending until the user
+-- confirms a code; last_step is the time step of the last accepted code so
+-- codes can't be replayed. Recovery codes and login challenge tokens are
+-- stored as SHA-256 hashes.
+CREATE TABLE user_totp (
+    user_id CHAR(36) PRIMARY KEY,
+    secret VARCHAR(64) NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    enabled_at DATETIME(6) NULL,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE recovery_codes (
+    id CHAR(36) PRIMARY KEY,
+    user_id CHAR(36) NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at DATETIME(6) NULL,
+    INDEX idx_recovery_codes_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE two_factor_challenges (
+    id CHAR(36) PRIMARY KEY,
+    user_id CHAR(36) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    device_label VARCHAR(100) NOT NULL DEFAULT '',
+    created_at DATETIME(6) NOT NULL,
+    expires_at DATETIME(6) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    used_at DATETIME(6) NULL,
+    INDEX idx_two_factor_challenges_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,9 @@
+-- Failed logins per throttling key (an account or an IP address). A key's
+-- count starts over once its last failure is older than the throttling
+-- window, and stale rows are pruned.
+CREATE TABLE login_attempts (
+    throttle_key VARCHAR(320) PRIMARY KEY,
+    failures INT NOT NULL,
+    last_failure_at DATETIME(6) NOT NULL,
+    INDEX idx_login_attempts_last_failure (last_failure_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,15 @@
+-- Events delivered to a user over WebSocket, numbered per user so a client
+-- that reconnects can ask for everything after the last one it saw. The
+-- counter lives on the user so numbers are never reused, even after old
+-- events are pruned.
+ALTER TABLE users ADD COLUMN event_seq BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE user_events (
+    user_id CHAR(36) NOT NULL,
+    seq BIGINT NOT NULL,
+    payload MEDIUMTEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (user_id, seq),
+    INDEX idx_user_events_created (created_at),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
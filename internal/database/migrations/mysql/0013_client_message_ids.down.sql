@@ -0,0 +1,2 @@
+DROP INDEX idx_messages_client_msg_id ON messages;
+ALTER TABLE messages DROP COLUMN client_msg_id;
@@ -1,10 +1,5 @@
--- Create the test database if it doesn't exist
-CREATE DATABASE converse_test;
-
--- Connect to the test database
-\c converse_test
-
--- Create users table
+-- Initial schema. IF NOT EXISTS lets databases created from the old
+-- schema.sql adopt the migration history without changes.
 CREATE TABLE IF NOT EXISTS users (
     id UUID PRIMARY KEY,
     username VARCHAR(255) NOT NULL UNIQUE,
@@ -14,9 +9,8 @@ CREATE TABLE IF NOT EXISTS users (
     avatar_url TEXT,
     created_at TIMESTAMP WITH TIME ZONE NOT NULL,
     last_seen TIMESTAMP WITH TIME ZONE NOT NULL
-); 
+);
 
--- Create messages table
 CREATE TABLE IF NOT EXISTS messages (
     id UUID PRIMARY KEY,
     sender_id UUID NOT NULL REFERENCES users(id),
@@ -25,4 +19,4 @@ CREATE TABLE IF NOT EXISTS messages (
     created_at TIMESTAMP WITH TIME ZONE NOT NULL,
     is_read BOOLEAN DEFAULT FALSE,
     updated_at TIMESTAMP WITH TIME ZONE
-); 
\ No newline at end of file
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_messages_receiver;
+DROP INDEX IF EXISTS idx_messages_sender;
+DROP INDEX IF EXISTS idx_messages_conversation;
@@ -0,0 +1,5 @@
+-- Composite indexes matching the (created_at, id) keyset used to page
+-- through conversations and a user's message history.
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages (sender_id, receiver_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_sender ON messages (sender_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_receiver ON messages (receiver_id, created_at, id);
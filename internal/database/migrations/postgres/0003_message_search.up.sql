@@ -0,0 +1,2 @@
+-- Full-text search over message content
+CREATE INDEX IF NOT EXISTS idx_messages_content_search ON messages USING GIN (to_tsvector('english', content));
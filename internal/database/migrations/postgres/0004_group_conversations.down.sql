@@ -0,0 +1,7 @@
+DELETE FROM messages WHERE conversation_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_messages_group;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_recipient_check;
+ALTER TABLE messages ALTER COLUMN receiver_id SET NOT NULL;
+ALTER TABLE messages DROP COLUMN IF EXISTS conversation_id;
+DROP TABLE IF EXISTS conversation_members;
+DROP TABLE IF EXISTS conversations;
@@ -0,0 +1,24 @@
+-- Group conversations. A group message has a conversation_id instead of a
+-- receiver_id; direct messages are unchanged.
+CREATE TABLE conversations (
+    id UUID PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_by UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE conversation_members (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id),
+    joined_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE INDEX idx_conversation_members_user ON conversation_members (user_id);
+
+ALTER TABLE messages ADD COLUMN conversation_id UUID REFERENCES conversations(id);
+ALTER TABLE messages ALTER COLUMN receiver_id DROP NOT NULL;
+ALTER TABLE messages ADD CONSTRAINT messages_recipient_check CHECK ((receiver_id IS NULL) <> (conversation_id IS NULL));
+
+CREATE INDEX idx_messages_group ON messages (conversation_id, created_at, id);
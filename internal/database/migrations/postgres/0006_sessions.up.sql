@@ -0,0 +1,21 @@
+-- Sessions, one per login. A session's id is the family_id of the refresh
+-- tokens issued for it and the sid claim of its access tokens.
+CREATE TABLE sessions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_label VARCHAR(100) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_sessions_user ON sessions (user_id, last_used_at);
+
+-- Every refresh token family is a login; give the live ones a session
+INSERT INTO sessions (id, user_id, device_label, ip_address, user_agent, created_at, last_used_at)
+SELECT family_id, user_id, '', '', '', MIN(created_at), MAX(created_at)
+FROM refresh_tokens
+WHERE revoked_at IS NULL
+GROUP BY family_id, user_id;
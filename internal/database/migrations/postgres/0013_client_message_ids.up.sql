@@ -0,0 +1,4 @@
+-- Clients may name the messages they send so a retried send is recognised
+-- and not stored twice. The IDs only need to be unique per sender.
+ALTER TABLE messages ADD COLUMN client_msg_id VARCHAR(64);
+CREATE UNIQUE INDEX idx_messages_client_msg_id ON messages (sender_id, client_msg_id);
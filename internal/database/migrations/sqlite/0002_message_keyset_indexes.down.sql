@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_messages_conversation;
+DROP INDEX IF EXISTS idx_messages_sender;
+DROP INDEX IF EXISTS idx_messages_receiver;
+CREATE INDEX idx_messages_sender ON messages (sender_id, created_at);
+CREATE INDEX idx_messages_receiver ON messages (receiver_id, created_at);
@@ -0,0 +1,7 @@
+-- Composite indexes matching the (created_at, id) keyset used to page
+-- through conversations and a user's message history.
+DROP INDEX IF EXISTS idx_messages_sender;
+DROP INDEX IF EXISTS idx_messages_receiver;
+CREATE INDEX idx_messages_conversation ON messages (sender_id, receiver_id, created_at, id);
+CREATE INDEX idx_messages_sender ON messages (sender_id, created_at, id);
+CREATE INDEX idx_messages_receiver ON messages (receiver_id, created_at, id);
@@ -0,0 +1,9 @@
+-- Full-text search over message content. messages_fts keeps its own copy of
+-- the content keyed by message id (rowids of messages aren't stable across
+-- VACUUM) and is kept in sync by triggers; trigger bodies must stay on one
+-- line for the migration runner.
+CREATE VIRTUAL TABLE messages_fts USING fts4(message_id, content, notindexed=message_id, tokenize=porter);
+CREATE TRIGGER messages_fts_ai AFTER INSERT ON messages BEGIN INSERT INTO messages_fts (message_id, content) VALUES (new.id, new.content); END;
+CREATE TRIGGER messages_fts_au AFTER UPDATE OF content ON messages BEGIN UPDATE messages_fts SET content = new.content WHERE message_id = old.id; END;
+CREATE TRIGGER messages_fts_ad AFTER DELETE ON messages BEGIN DELETE FROM messages_fts WHERE message_id = old.id; END;
+INSERT INTO messages_fts (message_id, content) SELECT id, content FROM messages;
@@ -0,0 +1,32 @@
+DELETE FROM messages WHERE conversation_id IS NOT NULL;
+
+DROP TRIGGER IF EXISTS messages_fts_ai;
+DROP TRIGGER IF EXISTS messages_fts_au;
+DROP TRIGGER IF EXISTS messages_fts_ad;
+
+CREATE TABLE messages_old (
+    id TEXT PRIMARY KEY,
+    sender_id TEXT NOT NULL REFERENCES users(id),
+    receiver_id TEXT NOT NULL REFERENCES users(id),
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    is_read BOOLEAN NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP
+);
+
+INSERT INTO messages_old (id, sender_id, receiver_id, content, created_at, is_read, updated_at)
+SELECT id, sender_id, receiver_id, content, created_at, is_read, updated_at FROM messages;
+
+DROP TABLE messages;
+ALTER TABLE messages_old RENAME TO messages;
+
+CREATE INDEX idx_messages_conversation ON messages (sender_id, receiver_id, created_at, id);
+CREATE INDEX idx_messages_sender ON messages (sender_id, created_at, id);
+CREATE INDEX idx_messages_receiver ON messages (receiver_id, created_at, id);
+
+CREATE TRIGGER messages_fts_ai AFTER INSERT ON messages BEGIN INSERT INTO messages_fts (message_id, content) VALUES (new.id, new.content); END;
+CREATE TRIGGER messages_fts_au AFTER UPDATE OF content ON messages BEGIN UPDATE messages_fts SET content = new.content WHERE message_id = old.id; END;
+CREATE TRIGGER messages_fts_ad AFTER DELETE ON messages BEGIN DELETE FROM messages_fts WHERE message_id = old.id; END;
+
+DROP TABLE IF EXISTS conversation_members;
+DROP TABLE IF EXISTS conversations;
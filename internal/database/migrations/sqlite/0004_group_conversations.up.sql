@@ -0,0 +1,52 @@
+-- Group conversations. A group message has a conversation_id instead of a
+-- receiver_id; direct messages are unchanged.
+CREATE TABLE conversations (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_by TEXT NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE conversation_members (
+    conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    joined_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE INDEX idx_conversation_members_user ON conversation_members (user_id);
+
+-- SQLite can't drop NOT NULL from receiver_id, so messages is rebuilt.
+-- Dropping the old table drops its indexes and search triggers, which are
+-- recreated below; messages_fts keeps its rows.
+DROP TRIGGER IF EXISTS messages_fts_ai;
+DROP TRIGGER IF EXISTS messages_fts_au;
+DROP TRIGGER IF EXISTS messages_fts_ad;
+
+CREATE TABLE messages_new (
+    id TEXT PRIMARY KEY,
+    sender_id TEXT NOT NULL REFERENCES users(id),
+    receiver_id TEXT REFERENCES users(id),
+    conversation_id TEXT REFERENCES conversations(id),
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    is_read BOOLEAN NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP,
+    CHECK ((receiver_id IS NULL) <> (conversation_id IS NULL))
+);
+
+INSERT INTO messages_new (id, sender_id, receiver_id, content, created_at, is_read, updated_at)
+SELECT id, sender_id, receiver_id, content, created_at, is_read, updated_at FROM messages;
+
+DROP TABLE messages;
+ALTER TABLE messages_new RENAME TO messages;
+
+CREATE INDEX idx_messages_conversation ON messages (sender_id, receiver_id, created_at, id);
+CREATE INDEX idx_messages_sender ON messages (sender_id, created_at, id);
+CREATE INDEX idx_messages_receiver ON messages (receiver_id, created_at, id);
+CREATE INDEX idx_messages_group ON messages (conversation_id, created_at, id);
+
+CREATE TRIGGER messages_fts_ai AFTER INSERT ON messages BEGIN INSERT INTO messages_fts (message_id, content) VALUES (new.id, new.content); END;
+CREATE TRIGGER messages_fts_au AFTER UPDATE OF content ON messages BEGIN UPDATE messages_fts SET content = new.content WHERE message_id = old.id; END;
+CREATE TRIGGER messages_fts_ad AFTER DELETE ON messages BEGIN DELETE FROM messages_fts WHERE message_id = old.id; END;
@@ -0,0 +1,21 @@
+-- Sessions, one per login. A session's id is the family_id of the refresh
+-- tokens issued for it and the sid claim of its access tokens.
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_label TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_sessions_user ON sessions (user_id, last_used_at);
+
+-- Every refresh token family is a login; give the live ones a session
+INSERT INTO sessions (id, user_id, device_label, ip_address, user_agent, created_at, last_used_at)
+SELECT family_id, user_id, '', '', '', MIN(created_at), MAX(created_at)
+FROM refresh_tokens
+WHERE revoked_at IS NULL
+GROUP BY family_id, user_id;
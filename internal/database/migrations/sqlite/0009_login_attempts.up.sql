@@ -0,0 +1,10 @@
+-- Failed logins per throttling key (an account or an IP address). A key's
+-- count starts over once its last failure is older than the throttling
+-- window, and stale rows are pruned.
+CREATE TABLE login_attempts (
+    throttle_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_login_attempts_last_failure ON login_attempts (last_failure_at);
@@ -0,0 +1,3 @@
+-- Deleted accounts are kept as anonymous tombstones so the messages they
+-- sent and received keep their sender and receiver. deleted_at marks them.
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
@@ -0,0 +1,5 @@
+-- Roles decide what a user may do; admins manage other accounts. A
+-- suspended account keeps its data but can't log in until it is
+-- unsuspended.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP;
@@ -0,0 +1,15 @@
+-- Events delivered to a user over WebSocket, numbered per user so a client
+-- that reconnects can ask for everything after the last one it saw. The
+-- counter lives on the user so numbers are never reused, even after old
+-- events are pruned.
+ALTER TABLE users ADD COLUMN event_seq INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE user_events (
+    user_id TEXT NOT NULL REFERENCES users(id),
+    seq INTEGER NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, seq)
+);
+
+CREATE INDEX idx_user_events_created ON user_events (created_at);
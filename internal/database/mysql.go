@@ -0,0 +1,344 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// MySQL error numbers mapped to our sentinel errors
+const (
+	mysqlErrDuplicateEntry   = 1062
+	mysqlErrNoReferencedRow  = 1452
+	mysqlErrNoReferencedRow2 = 1216
+)
+
+type MySQLDB struct {
+	*sql.DB
+	sqlStore
+}
+
+// NewMySQLDB connects to MySQL or MariaDB. The schema is managed by
+// migrations; see Migrator.
+// connStr is a go-sql-driver DSN such as user:pass@tcp(host:3306)/converse;
+// a leading "mysql://" is accepted for consistency with DATABASE_URL.
+func NewMySQLDB(connStr string) (*MySQLDB, error) {
+	cfg, err := mysql.ParseDSN(strings.TrimPrefix(connStr, "mysql://"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Scan DATETIME columns into time.Time and keep everything in UTC
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &MySQLDB{DB: db, sqlStore: sqlStore{db, questionPlaceholder}}, nil
+}
+
+// Migrator returns a migrator for the MySQL schema
+func (db *MySQLDB) Migrator() (*Migrator, error) {
+	return NewMigrator(db.DB, MySQL)
+}
+
+// mysqlErrorNumber returns the server error number of err, or 0
+func mysqlErrorNumber(err error) uint16 {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number
+	}
+	return 0
+}
+
+func (db *MySQLDB) CreateUser(username, email, passwordHash string) (*models.User, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ? OR email = ?",
+		username, email).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	if count > 0 {
+		return nil, ErrUserAlreadyExists
+	}
+
+	user := &models.User{
+		ID:           uuid.New(),
+		Username:     username,
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         models.RoleUser,
+		CreatedAt:    time.Now().UTC(),
+		LastSeen:     time.Now().UTC(),
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO users (id, username, email, password_hash, created_at, last_seen) VALUES (?, ?, ?, ?, ?, ?)",
+		user.ID, user.Username, user.Email, user.PasswordHash, user.CreatedAt, user.LastSeen,
+	)
+	// A concurrent registration can slip past the count check
+	if mysqlErrorNumber(err) == mysqlErrDuplicateEntry {
+		return nil, ErrUserAlreadyExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (db *MySQLDB) UpdateLastSeen(userID uuid.UUID) error {
+	// Check existence first: MySQL reports zero affected rows when the
+	// value doesn't change, which would look like a missing user
+	if _, err := db.GetUserByID(userID); err != nil {
+		return err
+	}
+
+	_, err := db.Exec("UPDATE users SET last_seen = ? WHERE id = ?",
+		time.Now().UTC(), userID)
+	return err
+}
+
+// RecordLoginFailure counts a failure with MySQL's upsert. failures is
+// assigned first: MySQL evaluates later assignments with the updated values,
+// and the CASE needs the old last_failure_at.
+func (db *MySQLDB) RecordLoginFailure(key string, at, since time.Time) (*models.LoginAttempts, error) {
+	return db.recordLoginFailure(`
+		INSERT INTO login_attempts (throttle_key, failures, last_failure_at) VALUES (?, 1, ?)
+		ON DUPLICATE KEY UPDATE
+			failures = CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END,
+			last_failure_at = VALUES(last_failure_at)`,
+		key, at, since)
+}
+
+func (db *MySQLDB) CreateMessage(senderID, receiverID uuid.UUID, content string) (*models.Message, error) {
+	message, _, err := db.CreateMessageOnce(senderID, receiverID, content, "")
+	return message, err
+}
+
+func (db *MySQLDB) CreateMessageOnce(senderID, receiverID uuid.UUID, content, clientMsgID string) (*models.Message, bool, error) {
+	if existing, err := db.clientMessage(senderID, clientMsgID); existing != nil || err != nil {
+		return existing, false, err
+	}
+
+	_, err := db.getActiveUser(senderID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	_, err = db.getActiveUser(receiverID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	message := &models.Message{
+		ID:         uuid.New(),
+		SenderID:   senderID,
+		ReceiverID: receiverID,
+		Content:    content,
+		CreatedAt:  time.Now().UTC().Truncate(time.Microsecond), // the precision DATETIME(6) stores
+		IsRead:     false,
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO messages (id, sender_id, receiver_id, content, created_at, is_read, client_msg_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		message.ID, message.SenderID, message.ReceiverID, message.Content, message.CreatedAt, message.IsRead, nullIfEmpty(clientMsgID),
+	)
+	// A participant deleted between the checks and the insert
+	if n := mysqlErrorNumber(err); n == mysqlErrNoReferencedRow || n == mysqlErrNoReferencedRow2 {
+		return nil, false, ErrUserNotFound
+	}
+	if err != nil {
+		return db.insertFailed(senderID, clientMsgID, err)
+	}
+
+	return message, true, nil
+}
+
+func (db *MySQLDB) GetMessagesByUser(userID uuid.UUID, page PageOptions) ([]*models.Message, error) {
+	query, args := keysetQuery(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at
+		FROM messages
+		WHERE (sender_id = ? OR receiver_id = ?) AND conversation_id IS NULL`,
+		[]interface{}{userID, userID}, page, questionPlaceholder,
+	)
+
+	messages, err := db.queryMessages(query, args...)
+	if err == nil && page.ascending() {
+		slices.Reverse(messages)
+	}
+	return messages, err
+}
+
+func (db *MySQLDB) GetMessageByID(messageID uuid.UUID) (*models.Message, error) {
+	messages, err := db.queryMessages(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at
+		FROM messages
+		WHERE id = ?`,
+		messageID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+
+	return messages[0], nil
+}
+
+func (db *MySQLDB) GetConversation(userID1, userID2 uuid.UUID, page PageOptions) ([]*models.Message, error) {
+	query, args := keysetQuery(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at
+		FROM messages
+		WHERE ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))`,
+		[]interface{}{userID1, userID2, userID2, userID1}, page, questionPlaceholder,
+	)
+
+	messages, err := db.queryMessages(query, args...)
+	if err == nil && !page.ascending() {
+		slices.Reverse(messages)
+	}
+	return messages, err
+}
+
+// queryMessages runs a query selecting the standard message columns
+func (db *MySQLDB) queryMessages(query string, args ...interface{}) ([]*models.Message, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+func (db *MySQLDB) MarkMessageAsRead(messageID uuid.UUID) error {
+	now := time.Now().UTC()
+	result, err := db.Exec(
+		"UPDATE messages SET is_read = TRUE, updated_at = ? WHERE id = ?",
+		now, messageID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrMessageNotFound
+	}
+
+	return nil
+}
+
+func (db *MySQLDB) SearchMessages(userID uuid.UUID, query string, page PageOptions) ([]*models.SearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	// Require every term: the ones the full-text index holds in boolean
+	// mode, the others with LIKE. MySQL has no highlighting, so snippets are
+	// built from the content.
+	where := `((sender_id = ? OR receiver_id = ?) AND conversation_id IS NULL
+		       OR conversation_id IN (SELECT conversation_id FROM conversation_members WHERE user_id = ?))`
+	args := []interface{}{userID, userID, userID}
+	var required []string
+	for _, term := range terms {
+		if mysqlIndexed(term) {
+			required = append(required, "+"+term)
+		} else {
+			// Terms are letters and digits only, so need no LIKE escaping
+			where += "\n\t\t  AND content LIKE ?"
+			args = append(args, "%"+term+"%")
+		}
+	}
+	if len(required) > 0 {
+		where += "\n\t\t  AND MATCH (content) AGAINST (? IN BOOLEAN MODE)"
+		args = append(args, strings.Join(required, " "))
+	}
+
+	sqlQuery, args := keysetQuery(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at, NULL
+		FROM messages
+		WHERE `+where, args, page, questionPlaceholder,
+	)
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := scanSearchResults(rows, page, terms, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, attachPartners(results, userID, db.GetUserByID, db.GetGroupByID)
+}
+
+// mysqlMinTokenSize is the default innodb_ft_min_token_size; shorter words
+// aren't in the full-text index
+const mysqlMinTokenSize = 3
+
+// mysqlStopwords is InnoDB's default full-text stopword list, whose words
+// aren't in the index either
+var mysqlStopwords = map[string]bool{
+	"a": true, "about": true, "an": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "com": true, "de": true, "en": true, "for": true,
+	"from": true, "how": true, "i": true, "in": true, "is": true, "it": true,
+	"la": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "what": true, "when": true,
+	"where": true, "who": true, "will": true, "with": true, "und": true,
+	"www": true,
+}
+
+// mysqlIndexed reports whether a search term can be found through the
+// full-text index. Requiring a term that isn't indexed in boolean mode
+// matches nothing.
+func mysqlIndexed(term string) bool {
+	return utf8.RuneCountInString(term) >= mysqlMinTokenSize && !mysqlStopwords[term]
+}
+
+func (db *MySQLDB) GetConversations(userID uuid.UUID, page PageOptions) ([]*models.ConversationSummary, error) {
+	query, args := conversationsQuery(userID, page, questionPlaceholder)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations, err := scanConversations(rows, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return conversations, attachGroups(conversations, db.GetGroupByID)
+}
+
+func (db *MySQLDB) Close() error {
+	return db.DB.Close()
+}
+
+func (db *MySQLDB) Exec(query string, args ...interface{}) (ExecResult, error) {
+	return db.DB.Exec(query, args...)
+}
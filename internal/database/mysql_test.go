@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mysqlTestDSN returns the DSN of the MySQL test database
+func mysqlTestDSN() string {
+	if dsn := os.Getenv("MYSQL_TEST_DSN"); dsn != "" {
+		return dsn
+	}
+	return "root@tcp(localhost:3306)/converse_test"
+}
+
+// setupMySQLTestDB creates a test database connection, skipping the test when
+// no MySQL server is available
+func setupMySQLTestDB(t *testing.T) *MySQLDB {
+	db, err := NewMySQLDB(mysqlTestDSN())
+	if err != nil {
+		t.Skipf("MySQL test database not available: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	clearTestTables(t, db)
+	return db
+}
+
+// TestNewMySQLDB tests database connection creation
+func TestNewMySQLDB(t *testing.T) {
+	setupMySQLTestDB(t).Close()
+
+	tests := []struct {
+		name      string
+		connStr   string
+		wantError bool
+	}{
+		{
+			name:      "valid connection string",
+			connStr:   mysqlTestDSN(),
+			wantError: false,
+		},
+		{
+			name:      "valid connection string with scheme",
+			connStr:   "mysql://" + mysqlTestDSN(),
+			wantError: false,
+		},
+		{
+			name:      "invalid connection string",
+			connStr:   "invalid connection string",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := NewMySQLDB(tt.connStr)
+
+			if tt.wantError {
+				assert.Error(t, err)
+				assert.Nil(t, db)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, db)
+				defer db.Close()
+			}
+		})
+	}
+}
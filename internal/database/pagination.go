@@ -0,0 +1,168 @@
+package database
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in a message listing. Messages are ordered by
+// (created_at, id) so the position is unique even when timestamps collide.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// CursorFor returns the cursor pointing at message
+func CursorFor(message *models.Message) *Cursor {
+	return &Cursor{CreatedAt: message.CreatedAt, ID: message.ID}
+}
+
+// CursorForUser returns the cursor pointing at user in a user listing, which
+// is ordered by (created_at, id) like messages
+func CursorForUser(user *models.User) *Cursor {
+	return &Cursor{CreatedAt: user.CreatedAt, ID: user.ID}
+}
+
+// String encodes the cursor as an opaque, URL-safe token
+func (c Cursor) String() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a token produced by Cursor.String
+func ParseCursor(token string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAtStr, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtStr)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{CreatedAt: createdAt.UTC(), ID: id}, nil
+}
+
+// before reports whether message sorts strictly before the cursor
+func (c *Cursor) before(message *models.Message) bool {
+	return CursorFor(message).precedes(c)
+}
+
+// precedes reports whether c sorts strictly before other
+func (c *Cursor) precedes(other *Cursor) bool {
+	if !c.CreatedAt.Equal(other.CreatedAt) {
+		return c.CreatedAt.Before(other.CreatedAt)
+	}
+	return bytes.Compare(c.ID[:], other.ID[:]) < 0
+}
+
+// PageOptions selects a window of a message listing. Before and After are
+// exclusive bounds. Without After the window is anchored at the newest end
+// (or just before Before); with After it starts right after After. A Limit
+// of zero means no limit.
+type PageOptions struct {
+	Before *Cursor
+	After  *Cursor
+	Limit  int
+}
+
+// ascending reports whether the window is filled oldest first
+func (p PageOptions) ascending() bool {
+	return p.After != nil
+}
+
+// keysetQuery appends the cursor bounds, ordering and limit of page to query,
+// whose WHERE clause must already be open. bind formats the n-th (1-based)
+// placeholder. Rows come back oldest first when page.ascending() and newest
+// first otherwise.
+func keysetQuery(query string, args []interface{}, page PageOptions, bind func(n int) string) (string, []interface{}) {
+	var sb strings.Builder
+	sb.WriteString(query)
+
+	// Expanded rather than a row comparison so every backend can use the
+	// (…, created_at, id) indexes
+	bound := func(op string, cursor *Cursor) {
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+		n := len(args)
+		fmt.Fprintf(&sb, " AND (created_at %s %s OR (created_at = %s AND id %s %s))",
+			op, bind(n-2), bind(n-1), op, bind(n))
+	}
+
+	if page.After != nil {
+		bound(">", page.After)
+	}
+	if page.Before != nil {
+		bound("<", page.Before)
+	}
+
+	if page.ascending() {
+		sb.WriteString(" ORDER BY created_at ASC, id ASC")
+	} else {
+		sb.WriteString(" ORDER BY created_at DESC, id DESC")
+	}
+
+	if page.Limit > 0 {
+		fmt.Fprintf(&sb, " LIMIT %d", page.Limit)
+	}
+
+	return sb.String(), args
+}
+
+// questionPlaceholder formats placeholders for MySQL and SQLite
+func questionPlaceholder(int) string {
+	return "?"
+}
+
+// pageMessages applies page to messages, which must be sorted oldest first.
+// The result is oldest first as well.
+func pageMessages(messages []*models.Message, page PageOptions) []*models.Message {
+	return pageItems(messages, CursorFor, page)
+}
+
+// pageItems applies page to items, which must be sorted oldest first by
+// their cursors. The result is oldest first as well.
+func pageItems[T any](items []T, cursor func(T) *Cursor, page PageOptions) []T {
+	var window []T
+	for _, item := range items {
+		position := cursor(item)
+		if page.After != nil && !page.After.precedes(position) {
+			continue
+		}
+		if page.Before != nil && !position.precedes(page.Before) {
+			continue
+		}
+		window = append(window, item)
+	}
+
+	if page.Limit > 0 && len(window) > page.Limit {
+		if page.ascending() {
+			window = window[:page.Limit]
+		} else {
+			window = window[len(window)-page.Limit:]
+		}
+	}
+
+	return window
+}
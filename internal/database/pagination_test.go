@@ -0,0 +1,102 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// TestCursorRoundTrip tests encoding and decoding cursors
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC), ID: uuid.New()}
+
+	parsed, err := ParseCursor(cursor.String())
+	require.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(parsed.CreatedAt))
+	assert.Equal(t, cursor.ID, parsed.ID)
+
+	for _, token := range []string{"", "!!!", "bm90LWEtY3Vyc29y", cursor.String()[:10]} {
+		_, err := ParseCursor(token)
+		assert.Equal(t, ErrInvalidCursor, err, token)
+	}
+}
+
+// TestPagination tests keyset pagination on every backend
+func TestPagination(t *testing.T) {
+	forEachBackend(t, testMessagePagination)
+}
+
+// testMessagePagination pages through a conversation and a user's history
+// in both directions and checks nothing is skipped or repeated
+func testMessagePagination(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	carol, err := db.CreateUser("carol", "carol@example.com", "hash")
+	require.NoError(t, err)
+
+	var sent []*models.Message
+	for i := 0; i < 7; i++ {
+		msg, err := db.CreateMessage(alice.ID, bob.ID, fmt.Sprintf("message %d", i))
+		require.NoError(t, err)
+		sent = append(sent, msg)
+	}
+	_, err = db.CreateMessage(carol.ID, bob.ID, "elsewhere")
+	require.NoError(t, err)
+
+	ids := func(messages []*models.Message) []uuid.UUID {
+		var result []uuid.UUID
+		for _, msg := range messages {
+			result = append(result, msg.ID)
+		}
+		return result
+	}
+
+	// The first page is the latest messages, oldest first
+	page, err := db.GetConversation(bob.ID, alice.ID, PageOptions{Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, ids(sent[4:]), ids(page))
+
+	// Walk backwards to the start
+	var older []*models.Message
+	for cursor := CursorFor(page[0]); ; {
+		page, err := db.GetConversation(alice.ID, bob.ID, PageOptions{Before: cursor, Limit: 3})
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		older = append(page, older...)
+		cursor = CursorFor(page[0])
+	}
+	assert.Equal(t, ids(sent[:4]), ids(older))
+
+	// Walk forwards from the start
+	page, err = db.GetConversation(alice.ID, bob.ID, PageOptions{After: CursorFor(sent[0]), Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, ids(sent[1:3]), ids(page))
+
+	// Both bounds
+	page, err = db.GetConversation(alice.ID, bob.ID, PageOptions{After: CursorFor(sent[1]), Before: CursorFor(sent[5])})
+	require.NoError(t, err)
+	assert.Equal(t, ids(sent[2:5]), ids(page))
+
+	// A user's history is newest first in either direction
+	history, err := db.GetMessagesByUser(alice.ID, PageOptions{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{sent[6].ID, sent[5].ID}, ids(history))
+
+	history, err = db.GetMessagesByUser(alice.ID, PageOptions{Before: CursorFor(sent[5]), Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{sent[4].ID, sent[3].ID}, ids(history))
+
+	history, err = db.GetMessagesByUser(alice.ID, PageOptions{After: CursorFor(sent[0]), Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{sent[2].ID, sent[1].ID}, ids(history))
+}
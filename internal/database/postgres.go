@@ -4,10 +4,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq"
 
 	"github.com/ammar1510/converse/internal/models"
 )
@@ -15,11 +17,28 @@ import (
 var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrUserAlreadyExists = errors.New("user already exists")
+	ErrEmailInUse        = errors.New("email already in use")
 	ErrMessageNotFound   = errors.New("message not found")
+	ErrGroupNotFound     = errors.New("group not found")
+	ErrNotGroupMember    = errors.New("not a member of the group")
+
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenUsed     = errors.New("refresh token already used or revoked")
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrEmailTokenInvalid    = errors.New("email token invalid, expired or already used")
+
+	ErrTOTPNotFound        = errors.New("no pending or enabled TOTP secret")
+	ErrTOTPAlreadyEnabled  = errors.New("TOTP already enabled")
+	ErrTOTPCodeUsed        = errors.New("TOTP code already used")
+	ErrRecoveryCodeInvalid = errors.New("recovery code invalid or already used")
+	ErrChallengeNotFound   = errors.New("two-factor challenge not found")
+	ErrChallengeUsed       = errors.New("two-factor challenge already used or out of attempts")
 )
 
 type PostgresDB struct {
 	*sql.DB
+	sqlStore
+	connStr string
 }
 
 func NewPostgresDB(connStr string) (*PostgresDB, error) {
@@ -32,7 +51,24 @@ func NewPostgresDB(connStr string) (*PostgresDB, error) {
 		return nil, err
 	}
 
-	return &PostgresDB{db}, nil
+	return &PostgresDB{DB: db, sqlStore: sqlStore{db, postgresPlaceholder}, connStr: connStr}, nil
+}
+
+// NewListener opens a connection of its own for LISTEN, which a pooled
+// connection can't hold on to. It reconnects by itself, telling
+// eventCallback, if set, about the connection's state.
+func (db *PostgresDB) NewListener(eventCallback pq.EventCallbackType) *pq.Listener {
+	return pq.NewListener(db.connStr, time.Second, time.Minute, eventCallback)
+}
+
+// Migrator returns a migrator for the Postgres schema
+func (db *PostgresDB) Migrator() (*Migrator, error) {
+	return NewMigrator(db.DB, PostgreSQL)
+}
+
+// postgresPlaceholder formats the n-th query placeholder
+func postgresPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
 }
 
 func (db *PostgresDB) CreateUser(username, email, passwordHash string) (*models.User, error) {
@@ -52,6 +88,7 @@ func (db *PostgresDB) CreateUser(username, email, passwordHash string) (*models.
 		Username:     username,
 		Email:        email,
 		PasswordHash: passwordHash,
+		Role:         models.RoleUser,
 		CreatedAt:    time.Now(),
 		LastSeen:     time.Now(),
 	}
@@ -67,28 +104,6 @@ func (db *PostgresDB) CreateUser(username, email, passwordHash string) (*models.
 	return user, nil
 }
 
-func (db *PostgresDB) GetUserByEmail(email string) (*models.User, error) {
-	user := &models.User{}
-
-	err := db.QueryRow(`
-		SELECT id, username, email, password_hash, 
-		       COALESCE(display_name, ''), COALESCE(avatar_url, ''), 
-		       created_at, last_seen 
-		FROM users WHERE email = $1`, email).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash,
-		&user.DisplayName, &user.AvatarURL, &user.CreatedAt, &user.LastSeen)
-
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
-	}
-
-	if err != nil {
-		return nil, err
-	}
-
-	return user, nil
-}
-
 func (db *PostgresDB) UpdateLastSeen(userID uuid.UUID) error {
 	result, err := db.Exec("UPDATE users SET last_seen = $1 WHERE id = $2",
 		time.Now(), userID)
@@ -108,43 +123,28 @@ func (db *PostgresDB) UpdateLastSeen(userID uuid.UUID) error {
 	return nil
 }
 
-func (db *PostgresDB) GetUserByID(id uuid.UUID) (*models.User, error) {
-	var user models.User
-	err := db.QueryRow(`
-		SELECT id, username, email, password_hash, 
-		       COALESCE(display_name, ''), COALESCE(avatar_url, ''), 
-		       created_at, last_seen 
-		FROM users WHERE id = $1`,
-		id).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.DisplayName,
-		&user.AvatarURL,
-		&user.CreatedAt,
-		&user.LastSeen,
-	)
-
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	return &user, nil
+func (db *PostgresDB) RecordLoginFailure(key string, at, since time.Time) (*models.LoginAttempts, error) {
+	return db.recordLoginFailure(upsertLoginFailureSQL, key, at, since)
 }
 
 func (db *PostgresDB) CreateMessage(senderID, receiverID uuid.UUID, content string) (*models.Message, error) {
-	_, err := db.GetUserByID(senderID)
+	message, _, err := db.CreateMessageOnce(senderID, receiverID, content, "")
+	return message, err
+}
+
+func (db *PostgresDB) CreateMessageOnce(senderID, receiverID uuid.UUID, content, clientMsgID string) (*models.Message, bool, error) {
+	if existing, err := db.clientMessage(senderID, clientMsgID); existing != nil || err != nil {
+		return existing, false, err
+	}
+
+	_, err := db.getActiveUser(senderID)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	_, err = db.GetUserByID(receiverID)
+	_, err = db.getActiveUser(receiverID)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	message := &models.Message{
@@ -152,116 +152,75 @@ func (db *PostgresDB) CreateMessage(senderID, receiverID uuid.UUID, content stri
 		SenderID:   senderID,
 		ReceiverID: receiverID,
 		Content:    content,
-		CreatedAt:  time.Now().UTC(),
+		CreatedAt:  time.Now().UTC().Truncate(time.Microsecond), // the precision Postgres stores
 		IsRead:     false,
 	}
 
 	_, err = db.Exec(
-		"INSERT INTO messages (id, sender_id, receiver_id, content, created_at, is_read) VALUES ($1, $2, $3, $4, $5, $6)",
-		message.ID, message.SenderID, message.ReceiverID, message.Content, message.CreatedAt, message.IsRead,
+		"INSERT INTO messages (id, sender_id, receiver_id, content, created_at, is_read, client_msg_id) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		message.ID, message.SenderID, message.ReceiverID, message.Content, message.CreatedAt, message.IsRead, nullIfEmpty(clientMsgID),
 	)
 	if err != nil {
-		return nil, err
+		return db.insertFailed(senderID, clientMsgID, err)
 	}
 
-	return message, nil
+	return message, true, nil
 }
 
-func (db *PostgresDB) GetMessagesByUser(userID uuid.UUID) ([]*models.Message, error) {
-	rows, err := db.Query(
-		"SELECT id, sender_id, receiver_id, content, created_at, is_read, updated_at FROM messages WHERE sender_id = $1 OR receiver_id = $1 ORDER BY created_at DESC",
-		userID,
+func (db *PostgresDB) GetMessagesByUser(userID uuid.UUID, page PageOptions) ([]*models.Message, error) {
+	query, args := keysetQuery(
+		"SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at FROM messages WHERE (sender_id = $1 OR receiver_id = $1) AND conversation_id IS NULL",
+		[]interface{}{userID}, page, postgresPlaceholder,
 	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var messages []*models.Message
-	for rows.Next() {
-		var msg models.Message
-		var updatedAt sql.NullTime
-
-		err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Content, &msg.CreatedAt, &msg.IsRead, &updatedAt)
-		if err != nil {
-			return nil, err
-		}
 
-		if updatedAt.Valid {
-			msg.UpdatedAt = &updatedAt.Time
-		}
-
-		messages = append(messages, &msg)
+	messages, err := db.queryMessages(query, args...)
+	if err == nil && page.ascending() {
+		slices.Reverse(messages)
 	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return messages, nil
+	return messages, err
 }
 
 func (db *PostgresDB) GetMessageByID(messageID uuid.UUID) (*models.Message, error) {
-	var msg models.Message
-	var updatedAt sql.NullTime
-
-	err := db.QueryRow(`
-		SELECT id, sender_id, receiver_id, content, created_at, is_read, updated_at 
-		FROM messages 
+	messages, err := db.queryMessages(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at
+		FROM messages
 		WHERE id = $1`,
-		messageID).Scan(
-		&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Content,
-		&msg.CreatedAt, &msg.IsRead, &updatedAt)
-
-	if err == sql.ErrNoRows {
-		return nil, ErrMessageNotFound
-	}
+		messageID,
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	if updatedAt.Valid {
-		msg.UpdatedAt = &updatedAt.Time
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
 	}
 
-	return &msg, nil
+	return messages[0], nil
 }
 
-func (db *PostgresDB) GetConversation(userID1, userID2 uuid.UUID) ([]*models.Message, error) {
-	rows, err := db.Query(
-		`SELECT id, sender_id, receiver_id, content, created_at, is_read, updated_at 
-		FROM messages 
-		WHERE (sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1) 
-		ORDER BY created_at ASC`,
-		userID1, userID2,
+func (db *PostgresDB) GetConversation(userID1, userID2 uuid.UUID, page PageOptions) ([]*models.Message, error) {
+	query, args := keysetQuery(
+		`SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at
+		FROM messages
+		WHERE ((sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1))`,
+		[]interface{}{userID1, userID2}, page, postgresPlaceholder,
 	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var messages []*models.Message
-	for rows.Next() {
-		var msg models.Message
-		var updatedAt sql.NullTime
 
-		err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Content, &msg.CreatedAt, &msg.IsRead, &updatedAt)
-		if err != nil {
-			return nil, err
-		}
-
-		if updatedAt.Valid {
-			msg.UpdatedAt = &updatedAt.Time
-		}
-
-		messages = append(messages, &msg)
+	messages, err := db.queryMessages(query, args...)
+	if err == nil && !page.ascending() {
+		slices.Reverse(messages)
 	}
+	return messages, err
+}
 
-	if err = rows.Err(); err != nil {
+// queryMessages runs a query selecting the standard message columns
+func (db *PostgresDB) queryMessages(query string, args ...interface{}) ([]*models.Message, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
 		return nil, err
 	}
 
-	return messages, nil
+	return scanMessages(rows)
 }
 
 func (db *PostgresDB) MarkMessageAsRead(messageID uuid.UUID) error {
@@ -286,60 +245,57 @@ func (db *PostgresDB) MarkMessageAsRead(messageID uuid.UUID) error {
 	return nil
 }
 
-func (db *PostgresDB) Close() error {
-	return db.DB.Close()
-}
+func (db *PostgresDB) SearchMessages(userID uuid.UUID, query string, page PageOptions) ([]*models.SearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	// plainto_tsquery ANDs the terms together; the expression matches the
+	// idx_messages_content_search index. The highlight delimiters are taken
+	// out of the content so only ts_headline's own can reach sanitizeSnippet.
+	sqlQuery, args := keysetQuery(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at,
+		       ts_headline('english', translate(content, chr(2) || chr(3), ''), plainto_tsquery('english', $2),
+		                   'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxWords=25, MinWords=10')
+		FROM messages
+		WHERE ((sender_id = $1 OR receiver_id = $1) AND conversation_id IS NULL
+		       OR conversation_id IN (SELECT conversation_id FROM conversation_members WHERE user_id = $1))
+		  AND to_tsvector('english', content) @@ plainto_tsquery('english', $2)`,
+		[]interface{}{userID, strings.Join(terms, " ")}, page, postgresPlaceholder,
+	)
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
 
-func (db *PostgresDB) Exec(query string, args ...interface{}) (ExecResult, error) {
-	return db.DB.Exec(query, args...)
-}
+	results, err := scanSearchResults(rows, page, terms, false)
+	if err != nil {
+		return nil, err
+	}
 
-func (db *PostgresDB) GetAllUsers(excludeUserID uuid.UUID) ([]*models.User, error) {
-	query := `
-		SELECT id, username, email, password_hash, display_name, avatar_url, created_at, last_seen
-		FROM users
-		WHERE id != $1
-		ORDER BY username
-	`
+	return results, attachPartners(results, userID, db.GetUserByID, db.GetGroupByID)
+}
 
-	rows, err := db.Query(query, excludeUserID)
+func (db *PostgresDB) GetConversations(userID uuid.UUID, page PageOptions) ([]*models.ConversationSummary, error) {
+	query, args := conversationsQuery(userID, page, postgresPlaceholder)
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query users: %w", err)
-	}
-	defer rows.Close()
-
-	var users []*models.User
-	for rows.Next() {
-		var user models.User
-		var displayName, avatarURL sql.NullString
-
-		err := rows.Scan(
-			&user.ID,
-			&user.Username,
-			&user.Email,
-			&user.PasswordHash,
-			&displayName,
-			&avatarURL,
-			&user.CreatedAt,
-			&user.LastSeen,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan user row: %w", err)
-		}
-
-		if displayName.Valid {
-			user.DisplayName = displayName.String
-		}
-		if avatarURL.Valid {
-			user.AvatarURL = avatarURL.String
-		}
-
-		users = append(users, &user)
+		return nil, err
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating user rows: %w", err)
+	conversations, err := scanConversations(rows, page)
+	if err != nil {
+		return nil, err
 	}
 
-	return users, nil
+	return conversations, attachGroups(conversations, db.GetGroupByID)
+}
+
+func (db *PostgresDB) Close() error {
+	return db.DB.Close()
+}
+
+func (db *PostgresDB) Exec(query string, args ...interface{}) (ExecResult, error) {
+	return db.DB.Exec(query, args...)
 }
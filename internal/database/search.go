@@ -0,0 +1,217 @@
+package database
+
+import (
+	"database/sql"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// Snippet sizes, in bytes of content around the first match
+const (
+	snippetBefore = 40
+	snippetAfter  = 100
+)
+
+// SearchTerms splits a search query into lowercase words, dropping
+// punctuation and search operators. A query without words has no terms.
+func SearchTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+
+	return terms
+}
+
+// Highlight delimiters the databases put around matches in their snippets.
+// They are control characters rather than tags so that markup typed into a
+// message can't pass for a highlight.
+const (
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+// sanitizeSnippet HTML-escapes a snippet produced by the database with
+// snippetStart and snippetStop around the matches, then turns those into
+// <mark></mark> highlights
+func sanitizeSnippet(marked string) string {
+	return strings.NewReplacer(
+		snippetStart, "<mark>",
+		snippetStop, "</mark>",
+	).Replace(html.EscapeString(marked))
+}
+
+// highlightSnippet builds a snippet for backends without native highlighting:
+// an HTML-escaped excerpt around the first occurrence of any term with every
+// occurrence wrapped in <mark></mark>
+func highlightSnippet(content string, terms []string) string {
+	if len(terms) == 0 {
+		return html.EscapeString(content)
+	}
+
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	pattern := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+
+	matches := pattern.FindAllStringIndex(content, -1)
+	if len(matches) == 0 {
+		return html.EscapeString(truncateAt(content, snippetBefore+snippetAfter))
+	}
+
+	// Window around the first match, moved to rune boundaries
+	start := matches[0][0] - snippetBefore
+	if start < 0 {
+		start = 0
+	}
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	end := matches[0][1] + snippetAfter
+	if end > len(content) {
+		end = len(content)
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+
+	pos := start
+	for _, match := range matches {
+		if match[0] < pos {
+			continue
+		}
+		if match[1] > end {
+			break
+		}
+		sb.WriteString(html.EscapeString(content[pos:match[0]]))
+		sb.WriteString("<mark>")
+		sb.WriteString(html.EscapeString(content[match[0]:match[1]]))
+		sb.WriteString("</mark>")
+		pos = match[1]
+	}
+	sb.WriteString(html.EscapeString(content[pos:end]))
+
+	if end < len(content) {
+		sb.WriteString("…")
+	}
+
+	return sb.String()
+}
+
+// truncateAt shortens s to at most n bytes on a rune boundary
+func truncateAt(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
+
+// scanSearchResults reads message rows followed by a snippet column, newest
+// first. When highlight is set the snippet column is ignored and built from
+// the content instead.
+func scanSearchResults(rows *sql.Rows, page PageOptions, terms []string, highlight bool) ([]*models.SearchResult, error) {
+	defer rows.Close()
+
+	var results []*models.SearchResult
+	for rows.Next() {
+		var msg models.Message
+		var receiverID, conversationID uuid.NullUUID
+		var updatedAt sql.NullTime
+		var snippet sql.NullString
+
+		err := rows.Scan(&msg.ID, &msg.SenderID, &receiverID, &conversationID, &msg.Content, &msg.CreatedAt, &msg.IsRead, &updatedAt, &snippet)
+		if err != nil {
+			return nil, err
+		}
+
+		msg.ReceiverID = receiverID.UUID
+		if conversationID.Valid {
+			msg.ConversationID = &conversationID.UUID
+		}
+		if updatedAt.Valid {
+			msg.UpdatedAt = &updatedAt.Time
+		}
+
+		result := &models.SearchResult{Message: &msg}
+		if highlight {
+			result.Snippet = highlightSnippet(msg.Content, terms)
+		} else {
+			result.Snippet = sanitizeSnippet(snippet.String)
+		}
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if page.ascending() {
+		slices.Reverse(results)
+	}
+
+	return results, nil
+}
+
+// attachPartners sets the conversation partner of each result, or its group,
+// loading each user once with getUser and each group once with getGroup
+func attachPartners(results []*models.SearchResult, userID uuid.UUID, getUser func(uuid.UUID) (*models.User, error), getGroup func(uuid.UUID) (*models.Group, error)) error {
+	partners := make(map[uuid.UUID]*models.User)
+	groups := make(map[uuid.UUID]*models.Group)
+
+	for _, result := range results {
+		if groupID := result.Message.ConversationID; groupID != nil {
+			group, ok := groups[*groupID]
+			if !ok {
+				var err error
+				group, err = getGroup(*groupID)
+				if err != nil {
+					return err
+				}
+				groups[*groupID] = group
+			}
+
+			result.Group = group
+			continue
+		}
+
+		partnerID := partnerOf(result.Message, userID)
+
+		partner, ok := partners[partnerID]
+		if !ok {
+			var err error
+			partner, err = getUser(partnerID)
+			if err != nil {
+				return err
+			}
+			partners[partnerID] = partner
+		}
+
+		result.Partner = partner
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// TestSearchTerms tests splitting queries into terms
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "Pizza tonight?", want: []string{"pizza", "tonight"}},
+		{query: `"pizza" -OR pizza*`, want: []string{"pizza", "or"}},
+		{query: "Café  crème", want: []string{"café", "crème"}},
+		{query: " ?! ", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.want, SearchTerms(tt.query))
+		})
+	}
+}
+
+// TestHighlightSnippet tests excerpts, highlighting and escaping
+func TestHighlightSnippet(t *testing.T) {
+	assert.Equal(t, "Let&#39;s get <mark>Pizza</mark> &lt;3",
+		highlightSnippet("Let's get Pizza <3", []string{"pizza"}))
+
+	long := strings.Repeat("a ", 50) + "pizza" + strings.Repeat(" b", 100)
+	snippet := highlightSnippet(long, []string{"pizza"})
+	assert.True(t, strings.HasPrefix(snippet, "…"))
+	assert.True(t, strings.HasSuffix(snippet, "…"))
+	assert.Contains(t, snippet, "<mark>pizza</mark>")
+	assert.Less(t, len(snippet), len(long))
+
+	// Windows never split a multi-byte rune
+	snippet = highlightSnippet(strings.Repeat("é", 60)+"pizza", []string{"pizza"})
+	assert.True(t, strings.HasPrefix(snippet, "…é"))
+
+	assert.Equal(t, "<mark>a</mark> &amp; <mark>b</mark>", sanitizeSnippet(snippetStart+"a"+snippetStop+" & "+snippetStart+"b"+snippetStop))
+	assert.Equal(t, "&lt;script&gt;", sanitizeSnippet("<script>"))
+	assert.Equal(t, "&lt;mark&gt;a&lt;/mark&gt;", sanitizeSnippet("<mark>a</mark>"))
+}
+
+// TestSearchMessages tests search on every backend
+func TestSearchMessages(t *testing.T) {
+	forEachBackend(t, testSearchMessages)
+}
+
+// testSearchMessages checks matching, scoping to the caller, partners,
+// snippets and paging
+func testSearchMessages(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	carol, err := db.CreateUser("carol", "carol@example.com", "hash")
+	require.NoError(t, err)
+
+	send := func(from, to *models.User, content string) *models.Message {
+		msg, err := db.CreateMessage(from.ID, to.ID, content)
+		require.NoError(t, err)
+		return msg
+	}
+
+	first := send(bob, alice, "Want pizza tonight?")
+	send(alice, bob, "Sure, see you at eight")
+	second := send(alice, carol, "Bob suggested pizza tonight <3")
+	send(carol, bob, "pizza tonight without alice")
+	third := send(carol, alice, "Pizza was great")
+
+	ids := func(results []*models.SearchResult) []uuid.UUID {
+		var result []uuid.UUID
+		for _, r := range results {
+			result = append(result, r.Message.ID)
+		}
+		return result
+	}
+
+	// Newest first and only Alice's conversations
+	results, err := db.SearchMessages(alice.ID, "pizza", PageOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{third.ID, second.ID, first.ID}, ids(results))
+
+	assert.Equal(t, carol.ID, results[0].Partner.ID)
+	assert.Equal(t, bob.ID, results[2].Partner.ID)
+	assert.Contains(t, strings.ToLower(results[0].Snippet), "<mark>pizza</mark>")
+	assert.NotContains(t, results[1].Snippet, "<3")
+
+	// Every term must match, case-insensitively
+	results, err = db.SearchMessages(alice.ID, "TONIGHT pizza", PageOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{second.ID, first.ID}, ids(results))
+
+	results, err = db.SearchMessages(alice.ID, "pizza lasagna", PageOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// Operators are treated as plain words
+	results, err = db.SearchMessages(alice.ID, `"pizza" -tonight*`, PageOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{second.ID, first.ID}, ids(results))
+
+	results, err = db.SearchMessages(alice.ID, "?!", PageOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// Paging
+	results, err = db.SearchMessages(alice.ID, "pizza", PageOptions{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{third.ID, second.ID}, ids(results))
+
+	results, err = db.SearchMessages(alice.ID, "pizza", PageOptions{Before: CursorFor(second), Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{first.ID}, ids(results))
+
+	results, err = db.SearchMessages(alice.ID, "pizza", PageOptions{After: CursorFor(first), Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{second.ID}, ids(results))
+
+	// Messages of the user's groups are searched too
+	group, err := db.CreateGroup(bob.ID, "dinner", []uuid.UUID{alice.ID})
+	require.NoError(t, err)
+	groupMessage, err := db.CreateGroupMessage(bob.ID, group.ID, "More pizza on Friday")
+	require.NoError(t, err)
+
+	results, err = db.SearchMessages(alice.ID, "pizza", PageOptions{Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, []uuid.UUID{groupMessage.ID, third.ID}, ids(results))
+	assert.Nil(t, results[0].Partner)
+	require.NotNil(t, results[0].Group)
+	assert.Equal(t, "dinner", results[0].Group.Name)
+	require.NotNil(t, results[0].Message.ConversationID)
+	assert.Equal(t, group.ID, *results[0].Message.ConversationID)
+	assert.Contains(t, strings.ToLower(results[0].Snippet), "<mark>pizza</mark>")
+
+	results, err = db.SearchMessages(carol.ID, "friday", PageOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, results, "only members search a group")
+
+	// Markup typed into a message is escaped, never turned into a highlight
+	marked := send(bob, alice, "I <mark>love</mark> burgers")
+	results, err = db.SearchMessages(alice.ID, "burgers", PageOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []uuid.UUID{marked.ID}, ids(results))
+	assert.Contains(t, results[0].Snippet, "&lt;mark&gt;love&lt;/mark&gt;")
+	assert.Equal(t, 1, strings.Count(results[0].Snippet, "<mark>"))
+
+	// Short words are required like any other
+	short := send(alice, bob, "An ox ate burgers")
+	results, err = db.SearchMessages(alice.ID, "ox burgers", PageOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{short.ID}, ids(results))
+
+	results, err = db.SearchMessages(alice.ID, "ox", PageOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{short.ID}, ids(results))
+}
+
+// TestMySQLIndexed tests which terms MySQL's full-text index can match
+func TestMySQLIndexed(t *testing.T) {
+	assert.True(t, mysqlIndexed("pizza"))
+	assert.True(t, mysqlIndexed("été"))
+	assert.False(t, mysqlIndexed("ox"))
+	assert.False(t, mysqlIndexed("the"))
+	assert.False(t, mysqlIndexed("with"))
+}
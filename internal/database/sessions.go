@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+func (s sqlStore) CreateSession(session *models.Session) error {
+	_, err := s.db.Exec(
+		s.rebind("INSERT INTO sessions (id, user_id, device_label, ip_address, user_agent, created_at, last_used_at) VALUES (?, ?, ?, ?, ?, ?, ?)"),
+		session.ID, session.UserID, session.DeviceLabel, session.IPAddress, session.UserAgent,
+		session.CreatedAt.UTC().Truncate(time.Microsecond), session.LastUsedAt.UTC().Truncate(time.Microsecond),
+	)
+	return err
+}
+
+func (s sqlStore) GetSession(sessionID uuid.UUID) (*models.Session, error) {
+	sessions, err := s.querySessions(`
+		SELECT id, user_id, device_label, ip_address, user_agent, created_at, last_used_at, revoked_at
+		FROM sessions
+		WHERE id = ?`,
+		sessionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sessions) == 0 {
+		return nil, ErrSessionNotFound
+	}
+
+	return sessions[0], nil
+}
+
+func (s sqlStore) GetSessionsByUser(userID uuid.UUID) ([]*models.Session, error) {
+	return s.querySessions(`
+		SELECT id, user_id, device_label, ip_address, user_agent, created_at, last_used_at, revoked_at
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY last_used_at DESC, id DESC`,
+		userID,
+	)
+}
+
+// querySessions runs a query selecting the session columns
+func (s sqlStore) querySessions(query string, args ...interface{}) ([]*models.Session, error) {
+	rows, err := s.db.Query(s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		var session models.Session
+		var revokedAt sql.NullTime
+
+		err := rows.Scan(&session.ID, &session.UserID, &session.DeviceLabel, &session.IPAddress, &session.UserAgent,
+			&session.CreatedAt, &session.LastUsedAt, &revokedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if revokedAt.Valid {
+			session.RevokedAt = &revokedAt.Time
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (s sqlStore) TouchSession(sessionID uuid.UUID, ipAddress string) error {
+	_, err := s.db.Exec(
+		s.rebind("UPDATE sessions SET last_used_at = ?, ip_address = ? WHERE id = ?"),
+		time.Now().UTC().Truncate(time.Microsecond), ipAddress, sessionID,
+	)
+	return err
+}
+
+func (s sqlStore) RevokeSession(sessionID uuid.UUID) error {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(s.rebind("UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL"), now, sessionID)
+	if err != nil {
+		return err
+	}
+
+	// The session's refresh tokens can't be exchanged any more
+	_, err = tx.Exec(s.rebind("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL"), now, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s sqlStore) RevokeUserSessions(userID uuid.UUID) error {
+	// No session has the nil ID, so this revokes them all
+	return s.RevokeOtherSessions(userID, uuid.Nil)
+}
+
+func (s sqlStore) RevokeOtherSessions(userID, keepSessionID uuid.UUID) error {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		s.rebind("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id != ? AND revoked_at IS NULL"),
+		now, userID, keepSessionID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		s.rebind("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND family_id != ? AND revoked_at IS NULL"),
+		now, userID, keepSessionID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// TestSessions tests session storage on every backend
+func TestSessions(t *testing.T) {
+	forEachBackend(t, testSessions)
+}
+
+// testSessions checks listing, touching and revoking sessions, and that
+// revoking a session revokes its refresh tokens
+func testSessions(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	newSession := func(userID uuid.UUID, device string, lastUsed time.Time) *models.Session {
+		session := &models.Session{
+			ID:          uuid.New(),
+			UserID:      userID,
+			DeviceLabel: device,
+			IPAddress:   "10.0.0.1",
+			UserAgent:   device + "-agent",
+			CreatedAt:   lastUsed,
+			LastUsedAt:  lastUsed,
+		}
+		require.NoError(t, db.CreateSession(session))
+		return session
+	}
+
+	laptop := newSession(alice.ID, "laptop", now.Add(-2*time.Hour))
+	phone := newSession(alice.ID, "phone", now.Add(-time.Hour))
+	newSession(bob.ID, "tablet", now)
+
+	stored, err := db.GetSession(laptop.ID)
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, stored.UserID)
+	assert.Equal(t, "laptop", stored.DeviceLabel)
+	assert.Equal(t, "laptop-agent", stored.UserAgent)
+	assert.Equal(t, "10.0.0.1", stored.IPAddress)
+	assert.True(t, laptop.CreatedAt.Equal(stored.CreatedAt))
+	assert.Nil(t, stored.RevokedAt)
+
+	_, err = db.GetSession(uuid.New())
+	assert.Equal(t, ErrSessionNotFound, err)
+
+	ids := func(sessions []*models.Session) []uuid.UUID {
+		var result []uuid.UUID
+		for _, session := range sessions {
+			result = append(result, session.ID)
+		}
+		return result
+	}
+
+	// Most recently used first
+	sessions, err := db.GetSessionsByUser(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{phone.ID, laptop.ID}, ids(sessions))
+
+	require.NoError(t, db.TouchSession(laptop.ID, "10.0.0.2"))
+	sessions, err = db.GetSessionsByUser(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{laptop.ID, phone.ID}, ids(sessions))
+	assert.Equal(t, "10.0.0.2", sessions[0].IPAddress)
+
+	// Revoking a session revokes its refresh tokens and hides it from listings
+	token := &models.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    alice.ID,
+		FamilyID:  phone.ID,
+		TokenHash: "phone-hash",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	require.NoError(t, db.CreateRefreshToken(token))
+
+	require.NoError(t, db.RevokeSession(phone.ID))
+
+	stored, err = db.GetSession(phone.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+
+	storedToken, err := db.GetRefreshToken("phone-hash")
+	require.NoError(t, err)
+	assert.NotNil(t, storedToken.RevokedAt)
+
+	sessions, err = db.GetSessionsByUser(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{laptop.ID}, ids(sessions))
+
+	// Revoking twice is harmless
+	require.NoError(t, db.RevokeSession(phone.ID))
+
+	// Revoking the other sessions keeps the given one and its tokens
+	desktop := newSession(alice.ID, "desktop", now)
+	for _, family := range []uuid.UUID{laptop.ID, desktop.ID} {
+		require.NoError(t, db.CreateRefreshToken(&models.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    alice.ID,
+			FamilyID:  family,
+			TokenHash: family.String(),
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Hour),
+		}))
+	}
+
+	require.NoError(t, db.RevokeOtherSessions(alice.ID, laptop.ID))
+
+	sessions, err = db.GetSessionsByUser(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{laptop.ID}, ids(sessions))
+
+	storedToken, err = db.GetRefreshToken(laptop.ID.String())
+	require.NoError(t, err)
+	assert.Nil(t, storedToken.RevokedAt)
+	storedToken, err = db.GetRefreshToken(desktop.ID.String())
+	require.NoError(t, err)
+	assert.NotNil(t, storedToken.RevokedAt)
+
+	// Revoking all of a user's sessions leaves other users alone
+	require.NoError(t, db.RevokeUserSessions(alice.ID))
+
+	sessions, err = db.GetSessionsByUser(alice.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	sessions, err = db.GetSessionsByUser(bob.ID)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
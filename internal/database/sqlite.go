@@ -0,0 +1,281 @@
+package database
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+type SQLiteDB struct {
+	*sql.DB
+	sqlStore
+}
+
+// NewSQLiteDB opens (or creates) the SQLite database file at path. The schema
+// is managed by migrations; see Migrator. Use ":memory:" for a throwaway
+// database.
+func NewSQLiteDB(path string) (*SQLiteDB, error) {
+	// Immediate transactions take the write lock up front, which is what
+	// serializes migrations between processes sharing the file
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer; one connection also keeps ":memory:"
+	// databases from being split across connections
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteDB{DB: db, sqlStore: sqlStore{db, questionPlaceholder}}, nil
+}
+
+// Migrator returns a migrator for the SQLite schema
+func (db *SQLiteDB) Migrator() (*Migrator, error) {
+	return NewMigrator(db.DB, SQLite)
+}
+
+func (db *SQLiteDB) CreateUser(username, email, passwordHash string) (*models.User, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ? OR email = ?",
+		username, email).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	if count > 0 {
+		return nil, ErrUserAlreadyExists
+	}
+
+	user := &models.User{
+		ID:           uuid.New(),
+		Username:     username,
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         models.RoleUser,
+		CreatedAt:    time.Now(),
+		LastSeen:     time.Now(),
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO users (id, username, email, password_hash, created_at, last_seen) VALUES (?, ?, ?, ?, ?, ?)",
+		user.ID, user.Username, user.Email, user.PasswordHash, user.CreatedAt, user.LastSeen,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (db *SQLiteDB) UpdateLastSeen(userID uuid.UUID) error {
+	result, err := db.Exec("UPDATE users SET last_seen = ? WHERE id = ?",
+		time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (db *SQLiteDB) RecordLoginFailure(key string, at, since time.Time) (*models.LoginAttempts, error) {
+	return db.recordLoginFailure(upsertLoginFailureSQL, key, at, since)
+}
+
+func (db *SQLiteDB) CreateMessage(senderID, receiverID uuid.UUID, content string) (*models.Message, error) {
+	message, _, err := db.CreateMessageOnce(senderID, receiverID, content, "")
+	return message, err
+}
+
+func (db *SQLiteDB) CreateMessageOnce(senderID, receiverID uuid.UUID, content, clientMsgID string) (*models.Message, bool, error) {
+	if existing, err := db.clientMessage(senderID, clientMsgID); existing != nil || err != nil {
+		return existing, false, err
+	}
+
+	_, err := db.getActiveUser(senderID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	_, err = db.getActiveUser(receiverID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	message := &models.Message{
+		ID:         uuid.New(),
+		SenderID:   senderID,
+		ReceiverID: receiverID,
+		Content:    content,
+		CreatedAt:  time.Now().UTC(),
+		IsRead:     false,
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO messages (id, sender_id, receiver_id, content, created_at, is_read, client_msg_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		message.ID, message.SenderID, message.ReceiverID, message.Content, message.CreatedAt, message.IsRead, nullIfEmpty(clientMsgID),
+	)
+	if err != nil {
+		return db.insertFailed(senderID, clientMsgID, err)
+	}
+
+	return message, true, nil
+}
+
+func (db *SQLiteDB) GetMessagesByUser(userID uuid.UUID, page PageOptions) ([]*models.Message, error) {
+	query, args := keysetQuery(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at
+		FROM messages
+		WHERE (sender_id = ? OR receiver_id = ?) AND conversation_id IS NULL`,
+		[]interface{}{userID, userID}, page, questionPlaceholder,
+	)
+
+	messages, err := db.queryMessages(query, args...)
+	if err == nil && page.ascending() {
+		slices.Reverse(messages)
+	}
+	return messages, err
+}
+
+func (db *SQLiteDB) GetMessageByID(messageID uuid.UUID) (*models.Message, error) {
+	messages, err := db.queryMessages(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at
+		FROM messages
+		WHERE id = ?`,
+		messageID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+
+	return messages[0], nil
+}
+
+func (db *SQLiteDB) GetConversation(userID1, userID2 uuid.UUID, page PageOptions) ([]*models.Message, error) {
+	query, args := keysetQuery(`
+		SELECT id, sender_id, receiver_id, conversation_id, content, created_at, is_read, updated_at
+		FROM messages
+		WHERE ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))`,
+		[]interface{}{userID1, userID2, userID2, userID1}, page, questionPlaceholder,
+	)
+
+	messages, err := db.queryMessages(query, args...)
+	if err == nil && !page.ascending() {
+		slices.Reverse(messages)
+	}
+	return messages, err
+}
+
+// queryMessages runs a query selecting the standard message columns
+func (db *SQLiteDB) queryMessages(query string, args ...interface{}) ([]*models.Message, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+func (db *SQLiteDB) MarkMessageAsRead(messageID uuid.UUID) error {
+	now := time.Now().UTC()
+	result, err := db.Exec(
+		"UPDATE messages SET is_read = 1, updated_at = ? WHERE id = ?",
+		now, messageID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrMessageNotFound
+	}
+
+	return nil
+}
+
+func (db *SQLiteDB) SearchMessages(userID uuid.UUID, query string, page PageOptions) ([]*models.SearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	// Quoting each term keeps FTS operators out of the MATCH expression;
+	// space-separated terms must all match
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"`
+	}
+
+	sqlQuery, args := keysetQuery(`
+		SELECT m.id, m.sender_id, m.receiver_id, m.conversation_id, m.content, m.created_at, m.is_read, m.updated_at,
+		       snippet(messages_fts, char(2), char(3), '…', -1, 20)
+		FROM messages_fts
+		JOIN messages m ON m.id = messages_fts.message_id
+		WHERE messages_fts MATCH ?
+		  AND ((m.sender_id = ? OR m.receiver_id = ?) AND m.conversation_id IS NULL
+		       OR m.conversation_id IN (SELECT conversation_id FROM conversation_members WHERE user_id = ?))`,
+		[]interface{}{strings.Join(quoted, " "), userID, userID, userID}, page, questionPlaceholder,
+	)
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := scanSearchResults(rows, page, terms, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, attachPartners(results, userID, db.GetUserByID, db.GetGroupByID)
+}
+
+func (db *SQLiteDB) GetConversations(userID uuid.UUID, page PageOptions) ([]*models.ConversationSummary, error) {
+	query, args := conversationsQuery(userID, page, questionPlaceholder)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations, err := scanConversations(rows, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return conversations, attachGroups(conversations, db.GetGroupByID)
+}
+
+func (db *SQLiteDB) Close() error {
+	return db.DB.Close()
+}
+
+func (db *SQLiteDB) Exec(query string, args ...interface{}) (ExecResult, error) {
+	return db.DB.Exec(query, args...)
+}
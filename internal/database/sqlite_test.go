@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupSQLiteDB creates a fresh file-backed SQLite database for a test
+func setupSQLiteDB(t *testing.T) *SQLiteDB {
+	db, err := NewSQLiteDB(filepath.Join(t.TempDir(), "converse.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = MigrateUp(context.Background(), db)
+	require.NoError(t, err)
+	return db
+}
+
+// TestNewSQLiteDB tests opening, migrating and reopening a database
+func TestNewSQLiteDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "converse.db")
+
+	db, err := NewDatabase(SQLite, path)
+	require.NoError(t, err)
+	_, err = MigrateUp(context.Background(), db)
+	require.NoError(t, err)
+	user, err := db.CreateUser("testuser", "test@example.com", "hash")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// Reopening keeps existing data
+	db, err = NewDatabase(SQLite, path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	found, err := db.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", found.Username)
+
+	_, err = NewSQLiteDB(filepath.Join(t.TempDir(), "missing", "converse.db"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// sqlStore implements the methods of DBInterface whose SQL is the same on
+// every SQL backend; the backends embed it. Queries are written with ?
+// placeholders and rebound with bind.
+type sqlStore struct {
+	db   *sql.DB
+	bind func(n int) string
+}
+
+// queryer and execer are the parts of *sql.DB and *sql.Tx used by
+// statements that run both inside and outside transactions
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// rebind replaces the ? placeholders of query with the backend's
+func (s sqlStore) rebind(query string) string {
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteString(s.bind(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+func (s sqlStore) CreateRefreshToken(token *models.RefreshToken) error {
+	return s.insertRefreshToken(s.db, token)
+}
+
+// insertRefreshToken stores token through db or a transaction
+func (s sqlStore) insertRefreshToken(db execer, token *models.RefreshToken) error {
+	_, err := db.Exec(
+		s.rebind("INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)"),
+		token.ID, token.UserID, token.FamilyID, token.TokenHash,
+		token.CreatedAt.UTC().Truncate(time.Microsecond), token.ExpiresAt.UTC().Truncate(time.Microsecond),
+	)
+	return err
+}
+
+func (s sqlStore) GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	var usedAt, revokedAt sql.NullTime
+
+	err := s.db.QueryRow(s.rebind(`
+		SELECT id, user_id, family_id, token_hash, created_at, expires_at, used_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = ?`),
+		tokenHash,
+	).Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash,
+		&token.CreatedAt, &token.ExpiresAt, &usedAt, &revokedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return &token, nil
+}
+
+func (s sqlStore) RotateRefreshToken(usedID uuid.UUID, next *models.RefreshToken) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The conditional update lets only one of two concurrent refreshes win
+	result, err := tx.Exec(
+		s.rebind("UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL"),
+		time.Now().UTC().Truncate(time.Microsecond), usedID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRefreshTokenUsed
+	}
+
+	if err := s.insertRefreshToken(tx, next); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s sqlStore) RevokeRefreshTokenFamily(familyID uuid.UUID) error {
+	_, err := s.db.Exec(
+		s.rebind("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL"),
+		time.Now().UTC().Truncate(time.Microsecond), familyID,
+	)
+	return err
+}
+
+func (s sqlStore) CreateEmailToken(token *models.EmailToken) error {
+	_, err := s.db.Exec(
+		s.rebind("INSERT INTO email_tokens (id, user_id, purpose, email, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)"),
+		token.ID, token.UserID, token.Purpose, token.Email, token.TokenHash,
+		token.CreatedAt.UTC().Truncate(time.Microsecond), token.ExpiresAt.UTC().Truncate(time.Microsecond),
+	)
+	return err
+}
+
+func (s sqlStore) UseEmailToken(tokenHash, purpose string) (*models.EmailToken, error) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var token models.EmailToken
+	err = tx.QueryRow(s.rebind(`
+		SELECT id, user_id, purpose, email, token_hash, created_at, expires_at
+		FROM email_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL`),
+		tokenHash, purpose,
+	).Scan(&token.ID, &token.UserID, &token.Purpose, &token.Email, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrEmailTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if now.After(token.ExpiresAt) {
+		return nil, ErrEmailTokenInvalid
+	}
+
+	// Using one token also uses the user's other outstanding tokens for the
+	// same purpose. The used_at check lets only one concurrent use win.
+	result, err := tx.Exec(
+		s.rebind("UPDATE email_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL"),
+		now, token.UserID, purpose,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrEmailTokenInvalid
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	token.UsedAt = &now
+	return &token, nil
+}
+
+func (s sqlStore) ExpireResetTokens(userID uuid.UUID) error {
+	_, err := s.db.Exec(
+		s.rebind("UPDATE email_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL"),
+		time.Now().UTC().Truncate(time.Microsecond), userID, models.TokenPurposeResetPassword,
+	)
+	return err
+}
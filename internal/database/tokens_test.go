@@ -0,0 +1,184 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// TestRefreshTokens tests refresh token storage on every backend
+func TestRefreshTokens(t *testing.T) {
+	forEachBackend(t, testRefreshTokens)
+}
+
+// testRefreshTokens checks lookup, single-use rotation and revocation
+func testRefreshTokens(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+
+	newToken := func(userID, familyID uuid.UUID, hash string) *models.RefreshToken {
+		now := time.Now().UTC().Truncate(time.Second)
+		return &models.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    userID,
+			FamilyID:  familyID,
+			TokenHash: hash,
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Hour),
+		}
+	}
+
+	family := uuid.New()
+	first := newToken(alice.ID, family, "hash-1")
+	require.NoError(t, db.CreateRefreshToken(first))
+
+	stored, err := db.GetRefreshToken("hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, stored.ID)
+	assert.Equal(t, alice.ID, stored.UserID)
+	assert.Equal(t, family, stored.FamilyID)
+	assert.True(t, first.ExpiresAt.Equal(stored.ExpiresAt))
+	assert.Nil(t, stored.UsedAt)
+	assert.Nil(t, stored.RevokedAt)
+
+	_, err = db.GetRefreshToken("missing")
+	assert.Equal(t, ErrRefreshTokenNotFound, err)
+
+	// Rotation marks the old token used and stores the new one
+	second := newToken(alice.ID, family, "hash-2")
+	require.NoError(t, db.RotateRefreshToken(first.ID, second))
+
+	stored, err = db.GetRefreshToken("hash-1")
+	require.NoError(t, err)
+	assert.NotNil(t, stored.UsedAt)
+
+	_, err = db.GetRefreshToken("hash-2")
+	require.NoError(t, err)
+
+	// A token can only be rotated once
+	assert.Equal(t, ErrRefreshTokenUsed, db.RotateRefreshToken(first.ID, newToken(alice.ID, family, "hash-3")))
+	_, err = db.GetRefreshToken("hash-3")
+	assert.Equal(t, ErrRefreshTokenNotFound, err)
+
+	// Revoking a family leaves other families alone
+	otherFamily := newToken(alice.ID, uuid.New(), "hash-4")
+	require.NoError(t, db.CreateRefreshToken(otherFamily))
+
+	require.NoError(t, db.RevokeRefreshTokenFamily(family))
+	stored, err = db.GetRefreshToken("hash-2")
+	require.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+	assert.Equal(t, ErrRefreshTokenUsed, db.RotateRefreshToken(second.ID, newToken(alice.ID, family, "hash-5")))
+
+	stored, err = db.GetRefreshToken("hash-4")
+	require.NoError(t, err)
+	assert.Nil(t, stored.RevokedAt)
+
+	// Revoking a user's sessions revokes their tokens and leaves other users alone
+	bobs := newToken(bob.ID, uuid.New(), "hash-6")
+	require.NoError(t, db.CreateRefreshToken(bobs))
+
+	require.NoError(t, db.RevokeUserSessions(alice.ID))
+	stored, err = db.GetRefreshToken("hash-4")
+	require.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+
+	stored, err = db.GetRefreshToken("hash-6")
+	require.NoError(t, err)
+	assert.Nil(t, stored.RevokedAt)
+}
+
+// TestEmailTokens tests email tokens on every backend
+func TestEmailTokens(t *testing.T) {
+	forEachBackend(t, testEmailTokens)
+}
+
+// testEmailTokens checks that email tokens are single use, expire and are
+// bound to their purpose, along with the user updates they authorize
+func testEmailTokens(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	assert.False(t, alice.EmailVerified)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	newToken := func(purpose, hash string, expiresAt time.Time) *models.EmailToken {
+		token := &models.EmailToken{
+			ID:        uuid.New(),
+			UserID:    alice.ID,
+			Purpose:   purpose,
+			Email:     alice.Email,
+			TokenHash: hash,
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+		}
+		require.NoError(t, db.CreateEmailToken(token))
+		return token
+	}
+
+	verify := newToken(models.TokenPurposeVerifyEmail, "verify-1", now.Add(time.Hour))
+	newToken(models.TokenPurposeVerifyEmail, "verify-2", now.Add(time.Hour))
+	newToken(models.TokenPurposeResetPassword, "reset-1", now.Add(time.Hour))
+	newToken(models.TokenPurposeResetPassword, "expired", now.Add(-time.Minute))
+
+	// Tokens only work for their purpose
+	_, err = db.UseEmailToken("verify-1", models.TokenPurposeResetPassword)
+	assert.Equal(t, ErrEmailTokenInvalid, err)
+
+	used, err := db.UseEmailToken("verify-1", models.TokenPurposeVerifyEmail)
+	require.NoError(t, err)
+	assert.Equal(t, verify.ID, used.ID)
+	assert.Equal(t, alice.ID, used.UserID)
+	assert.Equal(t, "alice@example.com", used.Email)
+	assert.NotNil(t, used.UsedAt)
+
+	// Using a token uses the user's other tokens for the same purpose only
+	_, err = db.UseEmailToken("verify-1", models.TokenPurposeVerifyEmail)
+	assert.Equal(t, ErrEmailTokenInvalid, err)
+	_, err = db.UseEmailToken("verify-2", models.TokenPurposeVerifyEmail)
+	assert.Equal(t, ErrEmailTokenInvalid, err)
+
+	_, err = db.UseEmailToken("expired", models.TokenPurposeResetPassword)
+	assert.Equal(t, ErrEmailTokenInvalid, err)
+	_, err = db.UseEmailToken("missing", models.TokenPurposeResetPassword)
+	assert.Equal(t, ErrEmailTokenInvalid, err)
+
+	_, err = db.UseEmailToken("reset-1", models.TokenPurposeResetPassword)
+	require.NoError(t, err)
+
+	// Verification only applies to the address the token was sent to
+	assert.Equal(t, ErrUserNotFound, db.MarkEmailVerified(alice.ID, "old@example.com"))
+	require.NoError(t, db.MarkEmailVerified(alice.ID, "alice@example.com"))
+	require.NoError(t, db.MarkEmailVerified(alice.ID, "alice@example.com"))
+	assert.Equal(t, ErrUserNotFound, db.MarkEmailVerified(uuid.New(), "alice@example.com"))
+
+	// Updating the hash leaves reset tokens alone; expiring them uses up
+	// reset tokens only
+	newToken(models.TokenPurposeResetPassword, "reset-2", now.Add(time.Hour))
+	newToken(models.TokenPurposeResetPassword, "reset-3", now.Add(time.Hour))
+	newToken(models.TokenPurposeVerifyEmail, "verify-3", now.Add(time.Hour))
+	require.NoError(t, db.UpdatePassword(alice.ID, "new-hash"))
+	_, err = db.UseEmailToken("reset-2", models.TokenPurposeResetPassword)
+	assert.NoError(t, err)
+
+	newToken(models.TokenPurposeResetPassword, "reset-4", now.Add(time.Hour))
+	require.NoError(t, db.ExpireResetTokens(alice.ID))
+	_, err = db.UseEmailToken("reset-4", models.TokenPurposeResetPassword)
+	assert.Equal(t, ErrEmailTokenInvalid, err)
+	_, err = db.UseEmailToken("verify-3", models.TokenPurposeVerifyEmail)
+	assert.NoError(t, err)
+
+	require.NoError(t, db.UpdatePassword(alice.ID, "new-hash"))
+	assert.Equal(t, ErrUserNotFound, db.UpdatePassword(uuid.New(), "new-hash"))
+
+	user, err := db.GetUserByID(alice.ID)
+	require.NoError(t, err)
+	assert.True(t, user.EmailVerified)
+	assert.Equal(t, "new-hash", user.PasswordHash)
+}
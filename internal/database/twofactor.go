@@ -0,0 +1,254 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+func (s sqlStore) SaveTOTPSecret(userID uuid.UUID, secret string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var enabledAt sql.NullTime
+	err = tx.QueryRow(s.rebind("SELECT enabled_at FROM user_totp WHERE user_id = ?"), userID).Scan(&enabledAt)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if enabledAt.Valid {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	// Starting over replaces a pending secret
+	if _, err := tx.Exec(s.rebind("DELETE FROM user_totp WHERE user_id = ?"), userID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		s.rebind("INSERT INTO user_totp (user_id, secret, created_at) VALUES (?, ?, ?)"),
+		userID, secret, time.Now().UTC().Truncate(time.Microsecond),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s sqlStore) GetTOTP(userID uuid.UUID) (*models.TOTP, error) {
+	var totp models.TOTP
+	var enabledAt sql.NullTime
+
+	err := s.db.QueryRow(
+		s.rebind("SELECT user_id, secret, created_at, enabled_at, last_step FROM user_totp WHERE user_id = ?"),
+		userID,
+	).Scan(&totp.UserID, &totp.Secret, &totp.CreatedAt, &enabledAt, &totp.LastStep)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrTOTPNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledAt.Valid {
+		totp.EnabledAt = &enabledAt.Time
+	}
+
+	return &totp, nil
+}
+
+func (s sqlStore) EnableTOTP(userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		s.rebind("UPDATE user_totp SET enabled_at = ?, last_step = ? WHERE user_id = ? AND enabled_at IS NULL"),
+		time.Now().UTC().Truncate(time.Microsecond), step, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrTOTPNotFound
+	}
+
+	if err := s.replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes swaps a user's recovery codes for new ones
+func (s sqlStore) replaceRecoveryCodes(db execer, userID uuid.UUID, codeHashes []string) error {
+	if _, err := db.Exec(s.rebind("DELETE FROM recovery_codes WHERE user_id = ?"), userID); err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		_, err := db.Exec(
+			s.rebind("INSERT INTO recovery_codes (id, user_id, code_hash) VALUES (?, ?, ?)"),
+			uuid.New(), userID, hash,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s sqlStore) UseTOTPStep(userID uuid.UUID, step int64) error {
+	// The comparison lets each step be used once, even by concurrent logins
+	result, err := s.db.Exec(
+		s.rebind("UPDATE user_totp SET last_step = ? WHERE user_id = ? AND enabled_at IS NOT NULL AND last_step < ?"),
+		step, userID, step,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrTOTPCodeUsed
+	}
+
+	return nil
+}
+
+func (s sqlStore) UseRecoveryCode(userID uuid.UUID, codeHash string) error {
+	result, err := s.db.Exec(
+		s.rebind("UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL"),
+		time.Now().UTC().Truncate(time.Microsecond), userID, codeHash,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+
+	return nil
+}
+
+func (s sqlStore) DisableTOTP(userID uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.replaceRecoveryCodes(tx, userID, nil); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(s.rebind("DELETE FROM user_totp WHERE user_id = ?"), userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s sqlStore) CreateTwoFactorChallenge(challenge *models.TwoFactorChallenge) error {
+	_, err := s.db.Exec(
+		s.rebind("INSERT INTO two_factor_challenges (id, user_id, token_hash, device_label, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)"),
+		challenge.ID, challenge.UserID, challenge.TokenHash, challenge.DeviceLabel,
+		challenge.CreatedAt.UTC().Truncate(time.Microsecond), challenge.ExpiresAt.UTC().Truncate(time.Microsecond),
+	)
+	return err
+}
+
+func (s sqlStore) GetTwoFactorChallenge(tokenHash string) (*models.TwoFactorChallenge, error) {
+	var challenge models.TwoFactorChallenge
+	var usedAt sql.NullTime
+
+	err := s.db.QueryRow(s.rebind(`
+		SELECT id, user_id, token_hash, device_label, created_at, expires_at, attempts, used_at
+		FROM two_factor_challenges
+		WHERE token_hash = ?`),
+		tokenHash,
+	).Scan(&challenge.ID, &challenge.UserID, &challenge.TokenHash, &challenge.DeviceLabel,
+		&challenge.CreatedAt, &challenge.ExpiresAt, &challenge.Attempts, &usedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		challenge.UsedAt = &usedAt.Time
+	}
+
+	return &challenge, nil
+}
+
+func (s sqlStore) AttemptTwoFactorChallenge(challengeID uuid.UUID, maxAttempts int) error {
+	// Counting in the WHERE clause keeps concurrent guesses within the limit
+	result, err := s.db.Exec(
+		s.rebind("UPDATE two_factor_challenges SET attempts = attempts + 1 WHERE id = ? AND used_at IS NULL AND attempts < ?"),
+		challengeID, maxAttempts,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrChallengeUsed
+	}
+
+	return nil
+}
+
+func (s sqlStore) UseTwoFactorChallenge(challengeID uuid.UUID) error {
+	result, err := s.db.Exec(
+		s.rebind("UPDATE two_factor_challenges SET used_at = ? WHERE id = ? AND used_at IS NULL"),
+		time.Now().UTC().Truncate(time.Microsecond), challengeID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrChallengeUsed
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// TestTwoFactor tests two-factor storage on every backend
+func TestTwoFactor(t *testing.T) {
+	forEachBackend(t, testTwoFactor)
+}
+
+// testTwoFactor checks enrollment, code replay protection, recovery codes and
+// login challenges
+func testTwoFactor(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+
+	_, err = db.GetTOTP(alice.ID)
+	assert.Equal(t, ErrTOTPNotFound, err)
+
+	// Enrolling again replaces a pending secret
+	require.NoError(t, db.SaveTOTPSecret(alice.ID, "FIRST"))
+	require.NoError(t, db.SaveTOTPSecret(alice.ID, "SECOND"))
+
+	totp, err := db.GetTOTP(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "SECOND", totp.Secret)
+	assert.False(t, totp.Enabled())
+
+	// Pending secrets don't accept codes
+	assert.Equal(t, ErrTOTPCodeUsed, db.UseTOTPStep(alice.ID, 100))
+
+	require.NoError(t, db.EnableTOTP(alice.ID, 100, []string{"code-a", "code-b"}))
+	assert.Equal(t, ErrTOTPNotFound, db.EnableTOTP(alice.ID, 101, nil))
+	assert.Equal(t, ErrTOTPAlreadyEnabled, db.SaveTOTPSecret(alice.ID, "THIRD"))
+
+	totp, err = db.GetTOTP(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "SECOND", totp.Secret)
+	assert.True(t, totp.Enabled())
+	assert.Equal(t, int64(100), totp.LastStep)
+
+	// Each step works once, and never after a later one
+	assert.Equal(t, ErrTOTPCodeUsed, db.UseTOTPStep(alice.ID, 100))
+	require.NoError(t, db.UseTOTPStep(alice.ID, 102))
+	assert.Equal(t, ErrTOTPCodeUsed, db.UseTOTPStep(alice.ID, 101))
+
+	// Recovery codes
+	require.NoError(t, db.UseRecoveryCode(alice.ID, "code-a"))
+	assert.Equal(t, ErrRecoveryCodeInvalid, db.UseRecoveryCode(alice.ID, "code-a"))
+	assert.Equal(t, ErrRecoveryCodeInvalid, db.UseRecoveryCode(alice.ID, "code-c"))
+	assert.Equal(t, ErrRecoveryCodeInvalid, db.UseRecoveryCode(uuid.New(), "code-b"))
+
+	// Challenges
+	now := time.Now().UTC().Truncate(time.Second)
+	challenge := &models.TwoFactorChallenge{
+		ID:          uuid.New(),
+		UserID:      alice.ID,
+		TokenHash:   "challenge-hash",
+		DeviceLabel: "Phone",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(5 * time.Minute),
+	}
+	require.NoError(t, db.CreateTwoFactorChallenge(challenge))
+
+	_, err = db.GetTwoFactorChallenge("missing")
+	assert.Equal(t, ErrChallengeNotFound, err)
+
+	require.NoError(t, db.AttemptTwoFactorChallenge(challenge.ID, 2))
+	require.NoError(t, db.AttemptTwoFactorChallenge(challenge.ID, 2))
+	assert.Equal(t, ErrChallengeUsed, db.AttemptTwoFactorChallenge(challenge.ID, 2))
+
+	stored, err := db.GetTwoFactorChallenge("challenge-hash")
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, stored.UserID)
+	assert.Equal(t, "Phone", stored.DeviceLabel)
+	assert.Equal(t, 2, stored.Attempts)
+	assert.True(t, now.Add(5*time.Minute).Equal(stored.ExpiresAt))
+	assert.Nil(t, stored.UsedAt)
+
+	require.NoError(t, db.UseTwoFactorChallenge(challenge.ID))
+	assert.Equal(t, ErrChallengeUsed, db.UseTwoFactorChallenge(challenge.ID))
+	assert.Equal(t, ErrChallengeUsed, db.AttemptTwoFactorChallenge(challenge.ID, 5))
+
+	stored, err = db.GetTwoFactorChallenge("challenge-hash")
+	require.NoError(t, err)
+	assert.NotNil(t, stored.UsedAt)
+
+	// Disabling removes the secret and the recovery codes
+	require.NoError(t, db.DisableTOTP(alice.ID))
+	_, err = db.GetTOTP(alice.ID)
+	assert.Equal(t, ErrTOTPNotFound, err)
+	assert.Equal(t, ErrRecoveryCodeInvalid, db.UseRecoveryCode(alice.ID, "code-b"))
+
+	// A new enrollment starts over
+	require.NoError(t, db.SaveTOTPSecret(alice.ID, "FOURTH"))
+	require.NoError(t, db.EnableTOTP(alice.ID, 5, []string{"code-d"}))
+	require.NoError(t, db.UseTOTPStep(alice.ID, 6))
+	require.NoError(t, db.UseRecoveryCode(alice.ID, "code-d"))
+}
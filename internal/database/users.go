@@ -0,0 +1,251 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// userColumns are the columns scanned by scanUser
+const userColumns = `id, username, email, password_hash,
+		       COALESCE(display_name, ''), COALESCE(avatar_url, ''),
+		       email_verified, role, created_at, last_seen, suspended_at, deleted_at`
+
+// rowScanner is the part of *sql.Row and *sql.Rows used by scanUser
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser reads a row selecting userColumns
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	var role string
+	var suspendedAt, deletedAt sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.Username, &user.Email, &user.PasswordHash,
+		&user.DisplayName, &user.AvatarURL, &user.EmailVerified, &role,
+		&user.CreatedAt, &user.LastSeen, &suspendedAt, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	user.Role = models.Role(role)
+	if suspendedAt.Valid {
+		user.SuspendedAt = &suspendedAt.Time
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	return &user, nil
+}
+
+func (s sqlStore) GetUserByEmail(email string) (*models.User, error) {
+	return s.getUser("email = ?", email)
+}
+
+func (s sqlStore) GetUserByID(id uuid.UUID) (*models.User, error) {
+	return s.getUser("id = ?", id)
+}
+
+// getActiveUser loads a user, treating deleted accounts as missing
+func (s sqlStore) getActiveUser(id uuid.UUID) (*models.User, error) {
+	user, err := s.GetUserByID(id)
+	if err == nil && user.Deleted() {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+// getUser loads a single user matching the given WHERE clause
+func (s sqlStore) getUser(where string, arg interface{}) (*models.User, error) {
+	user, err := scanUser(s.db.QueryRow(s.rebind(`
+		SELECT `+userColumns+`
+		FROM users WHERE `+where), arg))
+
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s sqlStore) GetAllUsers(excludeUserID uuid.UUID) ([]*models.User, error) {
+	rows, err := s.db.Query(s.rebind(`
+		SELECT `+userColumns+`
+		FROM users
+		WHERE id != ? AND deleted_at IS NULL
+		ORDER BY username`), excludeUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user rows: %w", err)
+	}
+
+	return users, nil
+}
+
+func (s sqlStore) UpdatePassword(userID uuid.UUID, passwordHash string) error {
+	changed, err := s.updateUser("UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, userID)
+	if err != nil || changed {
+		return err
+	}
+
+	_, err = s.GetUserByID(userID)
+	return err
+}
+
+func (s sqlStore) MarkEmailVerified(userID uuid.UUID, email string) error {
+	changed, err := s.updateUser("UPDATE users SET email_verified = ? WHERE id = ? AND email = ?", true, userID, email)
+	if err != nil || changed {
+		return err
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Email != email {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s sqlStore) UpdateProfile(userID uuid.UUID, displayName, avatarURL string) error {
+	changed, err := s.updateUser(
+		"UPDATE users SET display_name = ?, avatar_url = ? WHERE id = ?",
+		nullIfEmpty(displayName), nullIfEmpty(avatarURL), userID,
+	)
+	if err != nil || changed {
+		return err
+	}
+
+	_, err = s.GetUserByID(userID)
+	return err
+}
+
+func (s sqlStore) UpdateEmail(userID uuid.UUID, email string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRow(s.rebind("SELECT COUNT(*) FROM users WHERE email = ? AND id != ?"), email, userID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEmailInUse
+	}
+
+	result, err := tx.Exec(s.rebind("UPDATE users SET email = ?, email_verified = ? WHERE id = ?"), email, false, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		// MySQL reports no change when the values are already set
+		err = tx.QueryRow(s.rebind("SELECT COUNT(*) FROM users WHERE id = ?"), userID).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrUserNotFound
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s sqlStore) DeleteUser(userID uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	username, email := DeletedUserIdentity(userID)
+	result, err := tx.Exec(s.rebind(`
+		UPDATE users
+		SET username = ?, email = ?, password_hash = '', display_name = NULL, avatar_url = NULL,
+		    email_verified = ?, deleted_at = ?
+		WHERE id = ? AND deleted_at IS NULL`),
+		username, email, false, time.Now().UTC().Truncate(time.Microsecond), userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	// The tombstone keeps nothing that could sign in or identify the user
+	for _, table := range []string{
+		"sessions", "refresh_tokens", "email_tokens",
+		"user_totp", "recovery_codes", "two_factor_challenges",
+		"conversation_members", "user_events",
+	} {
+		if _, err := tx.Exec(s.rebind("DELETE FROM "+table+" WHERE user_id = ?"), userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeletedUserIdentity returns the username and email a deleted account is
+// renamed to, which frees its own and can't collide with real ones
+func DeletedUserIdentity(userID uuid.UUID) (username, email string) {
+	return "deleted-" + userID.String(), userID.String() + "@deleted.invalid"
+}
+
+// nullIfEmpty stores empty optional columns as NULL
+func nullIfEmpty(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// updateUser runs an UPDATE of users and reports whether it changed a row.
+// No change doesn't mean no match: MySQL reports zero affected rows when the
+// values are already set, so callers check existence themselves.
+func (s sqlStore) updateUser(query string, args ...interface{}) (bool, error) {
+	result, err := s.db.Exec(s.rebind(query), args...)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
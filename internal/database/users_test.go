@@ -0,0 +1,258 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// TestCreateUser tests user creation and uniqueness checks
+func TestCreateUser(t *testing.T) {
+	forEachBackend(t, testCreateUser)
+}
+
+// testCreateUser checks user creation and uniqueness
+func testCreateUser(t *testing.T, db DBInterface) {
+	tests := []struct {
+		name     string
+		username string
+		email    string
+		wantErr  error
+	}{
+		{
+			name:     "valid user",
+			username: "testuser",
+			email:    "test@example.com",
+		},
+		{
+			name:     "duplicate email",
+			username: "testuser2",
+			email:    "test@example.com",
+			wantErr:  ErrUserAlreadyExists,
+		},
+		{
+			name:     "duplicate username",
+			username: "testuser",
+			email:    "test2@example.com",
+			wantErr:  ErrUserAlreadyExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := db.CreateUser(tt.username, tt.email, "hashedpassword")
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				assert.Nil(t, user)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEqual(t, uuid.Nil, user.ID)
+				assert.Equal(t, tt.username, user.Username)
+				assert.Equal(t, tt.email, user.Email)
+				assert.Equal(t, "hashedpassword", user.PasswordHash)
+			}
+		})
+	}
+}
+
+// TestGetUsers tests user lookups, last seen updates and listing
+func TestGetUsers(t *testing.T) {
+	forEachBackend(t, testGetUsers)
+}
+
+// testGetUsers checks lookups by ID and email, last seen updates and listing
+func testGetUsers(t *testing.T, db DBInterface) {
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	carol, err := db.CreateUser("carol", "carol@example.com", "hash")
+	require.NoError(t, err)
+
+	byEmail, err := db.GetUserByEmail("alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, byEmail.ID)
+
+	_, err = db.GetUserByEmail("nobody@example.com")
+	assert.Equal(t, ErrUserNotFound, err)
+
+	_, err = db.GetUserByID(uuid.New())
+	assert.Equal(t, ErrUserNotFound, err)
+
+	// Returned users are copies
+	byEmail.Username = "mallory"
+	byID, err := db.GetUserByID(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", byID.Username)
+
+	time.Sleep(time.Millisecond)
+	require.NoError(t, db.UpdateLastSeen(bob.ID))
+	updated, err := db.GetUserByID(bob.ID)
+	require.NoError(t, err)
+	assert.True(t, updated.LastSeen.After(bob.LastSeen))
+	assert.Equal(t, ErrUserNotFound, db.UpdateLastSeen(uuid.New()))
+
+	// Listing excludes the caller and is ordered by username
+	users, err := db.GetAllUsers(bob.ID)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, alice.ID, users[0].ID)
+	assert.Equal(t, carol.ID, users[1].ID)
+}
+
+// TestProfile tests profile updates on every backend
+func TestProfile(t *testing.T) {
+	forEachBackend(t, testProfile)
+}
+
+// testProfile checks updating the display name, avatar and email
+func testProfile(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	_, err = db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+
+	require.NoError(t, db.UpdateProfile(alice.ID, "Alice", "https://example.com/alice.png"))
+	require.NoError(t, db.UpdateProfile(alice.ID, "Alice", "https://example.com/alice.png"))
+	assert.Equal(t, ErrUserNotFound, db.UpdateProfile(uuid.New(), "Nobody", ""))
+
+	user, err := db.GetUserByID(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", user.DisplayName)
+	assert.Equal(t, "https://example.com/alice.png", user.AvatarURL)
+
+	// Empty values clear the fields
+	require.NoError(t, db.UpdateProfile(alice.ID, "Alice", ""))
+	user, err = db.GetUserByID(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", user.DisplayName)
+	assert.Empty(t, user.AvatarURL)
+
+	// A new email needs verifying again
+	require.NoError(t, db.MarkEmailVerified(alice.ID, "alice@example.com"))
+	require.NoError(t, db.UpdateEmail(alice.ID, "alice@example.org"))
+
+	user, err = db.GetUserByEmail("alice@example.org")
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, user.ID)
+	assert.False(t, user.EmailVerified)
+
+	_, err = db.GetUserByEmail("alice@example.com")
+	assert.Equal(t, ErrUserNotFound, err)
+
+	// The old address is free again, the other user's isn't
+	assert.Equal(t, ErrEmailInUse, db.UpdateEmail(alice.ID, "bob@example.com"))
+	require.NoError(t, db.UpdateEmail(alice.ID, "alice@example.com"))
+	require.NoError(t, db.UpdateEmail(alice.ID, "alice@example.com"))
+	assert.Equal(t, ErrUserNotFound, db.UpdateEmail(uuid.New(), "nobody@example.com"))
+}
+
+// TestDeleteUser tests account deletion on every backend
+func TestDeleteUser(t *testing.T) {
+	forEachBackend(t, testDeleteUser)
+}
+
+// testDeleteUser checks exporting a user's messages and that deleting the
+// account keeps its messages but nothing that identifies or signs in as it
+func testDeleteUser(t *testing.T, db DBInterface) {
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	carol, err := db.CreateUser("carol", "carol@example.com", "hash")
+	require.NoError(t, err)
+
+	toBob, err := db.CreateMessage(alice.ID, bob.ID, "hi bob")
+	require.NoError(t, err)
+	toAlice, err := db.CreateMessage(bob.ID, alice.ID, "hi alice")
+	require.NoError(t, err)
+	_, err = db.CreateMessage(bob.ID, carol.ID, "not alice's business")
+	require.NoError(t, err)
+
+	group, err := db.CreateGroup(alice.ID, "friends", []uuid.UUID{bob.ID})
+	require.NoError(t, err)
+	inGroup, err := db.CreateGroupMessage(bob.ID, group.ID, "hi all")
+	require.NoError(t, err)
+
+	// Everything alice sent or received, oldest first
+	messages, err := db.GetUserMessages(alice.ID)
+	require.NoError(t, err)
+	var ids []uuid.UUID
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	assert.Equal(t, []uuid.UUID{toBob.ID, toAlice.ID, inGroup.ID}, ids)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	session := &models.Session{ID: uuid.New(), UserID: alice.ID, CreatedAt: now, LastUsedAt: now}
+	require.NoError(t, db.CreateSession(session))
+	require.NoError(t, db.CreateRefreshToken(&models.RefreshToken{
+		ID: uuid.New(), UserID: alice.ID, FamilyID: session.ID, TokenHash: "alice-refresh",
+		CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+	}))
+	require.NoError(t, db.SaveTOTPSecret(alice.ID, "SECRET"))
+
+	require.NoError(t, db.DeleteUser(alice.ID))
+	assert.Equal(t, ErrUserNotFound, db.DeleteUser(alice.ID))
+	assert.Equal(t, ErrUserNotFound, db.DeleteUser(uuid.New()))
+
+	tombstone, err := db.GetUserByID(alice.ID)
+	require.NoError(t, err)
+	assert.True(t, tombstone.Deleted())
+	username, email := DeletedUserIdentity(alice.ID)
+	assert.Equal(t, username, tombstone.Username)
+	assert.Equal(t, email, tombstone.Email)
+	assert.Empty(t, tombstone.PasswordHash)
+
+	// The name and address are free again
+	_, err = db.GetUserByEmail("alice@example.com")
+	assert.Equal(t, ErrUserNotFound, err)
+	_, err = db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+
+	users, err := db.GetAllUsers(bob.ID)
+	require.NoError(t, err)
+	for _, user := range users {
+		assert.NotEqual(t, alice.ID, user.ID)
+	}
+
+	sessions, err := db.GetSessionsByUser(alice.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+	_, err = db.GetRefreshToken("alice-refresh")
+	assert.Equal(t, ErrRefreshTokenNotFound, err)
+	_, err = db.GetTOTP(alice.ID)
+	assert.Equal(t, ErrTOTPNotFound, err)
+
+	// Others keep the conversation and the group
+	conversation, err := db.GetConversation(bob.ID, alice.ID, PageOptions{})
+	require.NoError(t, err)
+	assert.Len(t, conversation, 2)
+
+	conversations, err := db.GetConversations(bob.ID, PageOptions{})
+	require.NoError(t, err)
+	for _, summary := range conversations {
+		if summary.User != nil && summary.User.ID == alice.ID {
+			assert.True(t, summary.User.Deleted())
+		}
+	}
+
+	group, err = db.GetGroupByID(group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, group.CreatedBy)
+	assert.Equal(t, []uuid.UUID{bob.ID}, group.MemberIDs)
+
+	// Deleted accounts can't be messaged or added to groups
+	_, err = db.CreateMessage(bob.ID, alice.ID, "are you there?")
+	assert.Equal(t, ErrUserNotFound, err)
+	_, err = db.CreateMessage(alice.ID, bob.ID, "still here")
+	assert.Equal(t, ErrUserNotFound, err)
+	_, err = db.CreateGroup(bob.ID, "again", []uuid.UUID{alice.ID})
+	assert.Equal(t, ErrUserNotFound, err)
+}
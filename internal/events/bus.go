@@ -0,0 +1,61 @@
+// Package events carries what happens in the application, such as a message
+// being sent or a session being revoked, from the code that makes it happen
+// to whatever reacts to it: the WebSocket manager, webhooks, notifications.
+package events
+
+import (
+	"sync"
+)
+
+// Event is something that happened. Each event type is a struct with its
+// own name.
+type Event interface {
+	EventName() string
+}
+
+// Bus hands published events to the handlers subscribed to their type. It
+// is safe for concurrent use; a nil Bus drops every event.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]func(Event)
+}
+
+// NewBus creates a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]func(Event))}
+}
+
+// Subscribe registers handler for every event of type E published on bus
+// from now on. Subscribing to a nil Bus does nothing.
+func Subscribe[E Event](bus *Bus, handler func(E)) {
+	if bus == nil {
+		return
+	}
+
+	var event E
+	name := event.EventName()
+
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	bus.handlers[name] = append(bus.handlers[name], func(event Event) {
+		handler(event.(E))
+	})
+}
+
+// Publish runs the handlers subscribed to the event's type in the order
+// they subscribed, and returns once they all have. Handlers that take long
+// should hand the event off to their own goroutine.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers[event.EventName()]
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
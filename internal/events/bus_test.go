@@ -0,0 +1,65 @@
+package events
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+
+	var got []string
+	Subscribe(bus, func(e UserDeleted) { got = append(got, "first "+e.UserID.String()) })
+	Subscribe(bus, func(e UserDeleted) { got = append(got, "second "+e.UserID.String()) })
+	Subscribe(bus, func(e SessionRevoked) { got = append(got, "session "+e.SessionID.String()) })
+
+	userID := uuid.New()
+	bus.Publish(UserDeleted{UserID: userID})
+	assert.Equal(t, []string{"first " + userID.String(), "second " + userID.String()}, got)
+
+	// Events nobody subscribed to are dropped
+	got = nil
+	bus.Publish(MessageRead{})
+	assert.Empty(t, got)
+
+	sessionID := uuid.New()
+	bus.Publish(SessionRevoked{UserID: userID, SessionID: sessionID})
+	assert.Equal(t, []string{"session " + sessionID.String()}, got)
+}
+
+func TestNilBus(t *testing.T) {
+	var bus *Bus
+	assert.NotPanics(t, func() { Subscribe(bus, func(UserDeleted) {}) })
+	assert.NotPanics(t, func() { bus.Publish(UserDeleted{UserID: uuid.New()}) })
+}
+
+func TestBusConcurrent(t *testing.T) {
+	bus := NewBus()
+
+	var mu sync.Mutex
+	count := 0
+	Subscribe(bus, func(MessageCreated) {
+		mu.Lock()
+		count++
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			bus.Publish(MessageCreated{})
+		}()
+		go func() {
+			defer wg.Done()
+			Subscribe(bus, func(UserUpdated) {})
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, count)
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// MessageCreated is published once a message is stored, whether it was sent
+// over REST or WebSocket. A resent message isn't published again.
+type MessageCreated struct {
+	Message *models.Message
+	// ConnID is the WebSocket connection the message was sent from, if any;
+	// it has already been told about it
+	ConnID uuid.UUID
+}
+
+// MessageRead is published when the receiver of a message marks it as read
+type MessageRead struct {
+	Message  *models.Message
+	ReaderID uuid.UUID
+}
+
+// UserUpdated is published when a user changes their profile or email
+type UserUpdated struct {
+	User *models.User
+}
+
+// UserDeleted is published when an account is deleted
+type UserDeleted struct {
+	UserID uuid.UUID
+}
+
+// SessionRevoked is published when a single login session is ended
+type SessionRevoked struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+}
+
+// SessionsRevoked is published when all of a user's sessions are ended,
+// apart from ExceptSessionID if it is set
+type SessionsRevoked struct {
+	UserID          uuid.UUID
+	ExceptSessionID uuid.UUID
+}
+
+// EventName implements Event
+func (MessageCreated) EventName() string { return "message.created" }
+
+// EventName implements Event
+func (MessageRead) EventName() string { return "message.read" }
+
+// EventName implements Event
+func (UserUpdated) EventName() string { return "user.updated" }
+
+// EventName implements Event
+func (UserDeleted) EventName() string { return "user.deleted" }
+
+// EventName implements Event
+func (SessionRevoked) EventName() string { return "session.revoked" }
+
+// EventName implements Event
+func (SessionsRevoked) EventName() string { return "sessions.revoked" }
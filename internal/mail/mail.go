@@ -0,0 +1,66 @@
+// Package mail sends transactional email such as verification and password
+// reset links through a pluggable Sender.
+package mail
+
+import (
+	"fmt"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers email. Implementations must be safe for concurrent use.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// VerificationEmail builds the message asking a user to confirm their address
+func VerificationEmail(to, username, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(`Hi %s,
+
+Please confirm that %s is your email address by opening this link:
+
+%s
+
+The link expires in 24 hours. If you didn't create a Converse account, you can ignore this email.
+`, username, to, link),
+	}
+}
+
+// PasswordResetEmail builds the message carrying a password reset link
+func PasswordResetEmail(to, username, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(`Hi %s,
+
+Someone asked to reset the password of your Converse account. To choose a new password, open this link:
+
+%s
+
+The link expires in 1 hour and can be used once. If you didn't ask for a reset, you can ignore this email; your password hasn't changed.
+`, username, link),
+	}
+}
+
+// EmailChangedEmail builds the notice sent to a user's previous address when
+// their email is changed
+func EmailChangedEmail(to, username, newEmail string) Message {
+	return Message{
+		To:      to,
+		Subject: "Your email address was changed",
+		Body: fmt.Sprintf(`Hi %s,
+
+The email address of your Converse account was changed to %s. From now on, log in and receive emails at the new address.
+
+If you didn't make this change, contact the Converse administrators right away.
+`, username, newEmail),
+	}
+}
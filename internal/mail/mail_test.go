@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterSender(t *testing.T) {
+	var buf bytes.Buffer
+	sender := NewWriterSender(&buf)
+
+	msg := PasswordResetEmail("alice@example.com", "alice", "http://localhost:3000/reset-password?token=abc")
+	require.NoError(t, sender.Send(msg))
+
+	out := buf.String()
+	assert.Contains(t, out, "To: alice@example.com\n")
+	assert.Contains(t, out, "Subject: Reset your password\n")
+	assert.Contains(t, out, "Hi alice,")
+	assert.Contains(t, out, "http://localhost:3000/reset-password?token=abc")
+}
+
+func TestSMTPFormat(t *testing.T) {
+	sender := &SMTPSender{Host: "smtp.example.com", Port: "587", From: "Converse <no-reply@example.com>"}
+
+	msg := VerificationEmail("bob@example.com", "bob", "http://localhost:3000/verify-email?token=xyz")
+	date := time.Date(2024, 3, 21, 10, 0, 0, 0, time.UTC)
+	out := string(sender.format(msg, date))
+
+	headers, body, ok := strings.Cut(out, "\r\n\r\n")
+	require.True(t, ok)
+	assert.Contains(t, headers, "From: Converse <no-reply@example.com>\r\n")
+	assert.Contains(t, headers, "To: bob@example.com\r\n")
+	assert.Contains(t, headers, "Subject: Verify your email address\r\n")
+	assert.Contains(t, headers, "Date: Thu, 21 Mar 2024 10:00:00 +0000\r\n")
+	assert.Contains(t, headers, "Content-Type: text/plain; charset=utf-8")
+
+	// Bodies use CRLF line endings throughout
+	assert.Contains(t, body, "http://localhost:3000/verify-email?token=xyz\r\n")
+	assert.NotContains(t, strings.ReplaceAll(body, "\r\n", ""), "\n")
+}
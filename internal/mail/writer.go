@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ammar1510/converse/internal/logger"
+)
+
+var log = logger.New("mail")
+
+// WriterSender writes messages to an io.Writer instead of delivering them,
+// for development and tests without a mail server
+type WriterSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSender creates a sender that writes messages to w
+func NewWriterSender(w io.Writer) *WriterSender {
+	return &WriterSender{w: w}
+}
+
+// NewFileSender creates a sender that appends messages to the file at path
+func NewFileSender(path string) (*WriterSender, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterSender(f), nil
+}
+
+// Send writes msg
+func (s *WriterSender) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n---\n",
+		time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// LogSender logs messages instead of delivering them. It is the default
+// when no mail server is configured.
+type LogSender struct{}
+
+// Send logs msg
+func (LogSender) Send(msg Message) error {
+	log.Info("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+// AdminUserResponse is the view of an account admins get
+type AdminUserResponse struct {
+	UserResponse
+	LastSeen    time.Time  `json:"last_seen"`
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+}
+
+// UserPage is a page of the admin user listing, newest accounts first
+type UserPage struct {
+	Users   []*AdminUserResponse `json:"users"`
+	HasMore bool                 `json:"has_more"`
+	Before  string               `json:"before,omitempty"`
+	After   string               `json:"after,omitempty"`
+}
+
+// RoleRequest changes a user's role
+type RoleRequest struct {
+	Role Role `json:"role" binding:"required"`
+}
+
+// SystemStats are counts of what the server holds. Recent counts cover the
+// last 24 hours.
+type SystemStats struct {
+	Users          int `json:"users"` // accounts that aren't deleted
+	Admins         int `json:"admins"`
+	SuspendedUsers int `json:"suspended_users"`
+	DeletedUsers   int `json:"deleted_users"`
+	RecentUsers    int `json:"recent_users"` // accounts seen recently
+	NewUsers       int `json:"new_users"`    // accounts created recently
+	Messages       int `json:"messages"`     // direct and group messages
+	RecentMessages int `json:"recent_messages"`
+	Groups         int `json:"groups"`
+	ActiveSessions int `json:"active_sessions"`
+	// Connections are the open WebSocket connections and ConnectedUsers the
+	// users they belong to
+	ConnectedUsers int `json:"connected_users"`
+	Connections    int `json:"connections"`
+}
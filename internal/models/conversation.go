@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// ConversationSummary is one entry of a user's conversation list: the other
+// participant, or the group, the latest message exchanged and how many of
+// the other participant's messages are still unread. Group messages have no
+// read status, so groups have no unread messages.
+type ConversationSummary struct {
+	User        *User
+	Group       *Group
+	LastMessage *Message
+	UnreadCount int
+}
+
+// ConversationResponse is what we return to clients for a conversation list
+// entry. Either User or Group is set.
+type ConversationResponse struct {
+	User          UserResponse `json:"user,omitzero"`
+	Group         *Group       `json:"group,omitempty"`
+	LastMessage   *Message     `json:"last_message"`
+	LastMessageAt time.Time    `json:"last_message_at"`
+	UnreadCount   int          `json:"unread_count"`
+}
+
+// ConversationPage is one page of the conversation list, most recent first.
+// It pages like MessagePage, with cursors taken from the last messages.
+type ConversationPage struct {
+	Conversations []*ConversationResponse `json:"conversations"`
+	HasMore       bool                    `json:"has_more"`
+	Before        string                  `json:"before,omitempty"`
+	After         string                  `json:"after,omitempty"`
+}
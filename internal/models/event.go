@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event is a frame stored for delivery to a user over WebSocket. Seq numbers
+// a user's events in order, starting at 1, so a client that reconnects can
+// resume after the last one it saw.
+type Event struct {
+	UserID    uuid.UUID
+	Seq       int64
+	Payload   []byte // the JSON frame, without its seq
+	CreatedAt time.Time
+}
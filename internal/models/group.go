@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Group is a conversation with any number of members. Its ID is the
+// conversation ID group messages are addressed to.
+type Group struct {
+	ID        uuid.UUID   `json:"id"`
+	Name      string      `json:"name"`
+	CreatedBy uuid.UUID   `json:"created_by"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	MemberIDs []uuid.UUID `json:"member_ids"`
+}
+
+// GroupRequest contains data needed to create a group. The creator is always
+// a member and need not be listed.
+type GroupRequest struct {
+	Name      string      `json:"name" binding:"required,max=100"`
+	MemberIDs []uuid.UUID `json:"member_ids" binding:"required,min=1"`
+}
+
+// GroupRenameRequest contains data needed to rename a group
+type GroupRenameRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
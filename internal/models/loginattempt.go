@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginAttempts counts the recent failed logins for a throttling key, such
+// as an account or an IP address
+type LoginAttempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+}
@@ -8,21 +8,31 @@ import (
 
 // Message represents a chat message in the system
 type Message struct {
-	ID         uuid.UUID  `json:"id"`
-	SenderID   uuid.UUID  `json:"sender_id"`
-	ReceiverID uuid.UUID  `json:"receiver_id"`
-	Content    string     `json:"content"`
-	CreatedAt  time.Time  `json:"created_at"`
-	IsRead     bool       `json:"is_read"`
-	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	ID             uuid.UUID  `json:"id"`
+	SenderID       uuid.UUID  `json:"sender_id"`
+	ReceiverID     uuid.UUID  `json:"receiver_id,omitzero"`
+	ConversationID *uuid.UUID `json:"conversation_id,omitempty"` // set instead of ReceiverID for group messages
+	Content        string     `json:"content"`
+	CreatedAt      time.Time  `json:"created_at"`
+	IsRead         bool       `json:"is_read"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
 }
 
-// MessageRequest is the structure for message creation requests
+// MessageRequest is the structure for message creation requests. Exactly one
+// of ReceiverID (a direct message) and ConversationID (a group message) must
+// be set.
 type MessageRequest struct {
-	ReceiverID uuid.UUID `json:"receiver_id" binding:"required"`
-	Content    string    `json:"content" binding:"required,min=1"`
+	ReceiverID     uuid.UUID `json:"receiver_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Content        string    `json:"content" binding:"required,min=1"`
+	// ClientMsgID optionally names the message on the client, so a retried
+	// send returns the stored message instead of storing it again
+	ClientMsgID string `json:"client_msg_id" binding:"max=64"`
 }
 
+// MaxClientMsgIDLength is the longest client message ID accepted
+const MaxClientMsgIDLength = 64
+
 // MessageResponse is what we return to clients
 type MessageResponse struct {
 	ID         uuid.UUID     `json:"id"`
@@ -34,3 +44,15 @@ type MessageResponse struct {
 	UpdatedAt  *time.Time    `json:"updated_at,omitempty"`
 	Sender     *UserResponse `json:"sender,omitempty"`
 }
+
+// MessagePage is one page of a cursor-paginated message listing
+type MessagePage struct {
+	Messages []*Message `json:"messages"`
+	// HasMore reports whether more messages exist beyond this page in the
+	// direction being paged (older, or newer when paging with "after")
+	HasMore bool `json:"has_more"`
+	// Before and After are cursors for fetching the pages older and newer
+	// than this one; they are empty when the page is empty
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
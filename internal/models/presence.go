@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PresenceStatus says whether a user is connected and active
+type PresenceStatus string
+
+// Presence statuses
+const (
+	PresenceOnline  PresenceStatus = "online"  // connected and active recently
+	PresenceAway    PresenceStatus = "away"    // connected but idle
+	PresenceOffline PresenceStatus = "offline" // not connected
+)
+
+// Presence is a user's status and when they were last seen, which is when
+// they last logged in or disconnected
+type Presence struct {
+	UserID   uuid.UUID      `json:"user_id"`
+	Status   PresenceStatus `json:"status"`
+	LastSeen time.Time      `json:"last_seen"`
+}
@@ -0,0 +1,30 @@
+package models
+
+// SearchResult is a message matching a search, with the other participant
+// of its conversation, or its group, and a highlighted excerpt
+type SearchResult struct {
+	Message *Message
+	Partner *User
+	Group   *Group
+	// Snippet is an HTML-escaped excerpt of the content with the matching
+	// terms wrapped in <mark></mark>
+	Snippet string
+}
+
+// SearchResultResponse is what we return to clients for a search result.
+// Either Partner or Group is set.
+type SearchResultResponse struct {
+	Message *Message     `json:"message"`
+	Partner UserResponse `json:"partner,omitzero"`
+	Group   *Group       `json:"group,omitempty"`
+	Snippet string       `json:"snippet"`
+}
+
+// SearchPage is one page of search results, newest first. It pages like
+// MessagePage.
+type SearchPage struct {
+	Results []*SearchResultResponse `json:"results"`
+	HasMore bool                    `json:"has_more"`
+	Before  string                  `json:"before,omitempty"`
+	After   string                  `json:"after,omitempty"`
+}
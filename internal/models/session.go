@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a login on one device. Its ID is the family of the refresh
+// tokens issued for it and the sid claim of its access tokens.
+type Session struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"-"`
+	DeviceLabel string     `json:"device_label,omitempty"`
+	IPAddress   string     `json:"ip_address"`
+	UserAgent   string     `json:"user_agent"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  time.Time  `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"-"`
+	Current     bool       `json:"current"` // whether the request was made with this session
+}
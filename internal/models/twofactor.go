@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TOTP is a user's authenticator app secret. It only protects logins once
+// the user confirms a code and EnabledAt is set. LastStep is the time step of
+// the last accepted code, so each code works once.
+type TOTP struct {
+	UserID    uuid.UUID
+	Secret    string
+	CreatedAt time.Time
+	EnabledAt *time.Time
+	LastStep  int64
+}
+
+// Enabled reports whether logins require a second factor
+func (t *TOTP) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+// TwoFactorChallenge is issued when a password login needs a second factor.
+// Its token is exchanged together with a code for real tokens. Only a hash of
+// the token is kept.
+type TwoFactorChallenge struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	TokenHash   string
+	DeviceLabel string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	Attempts    int
+	UsedAt      *time.Time
+}
+
+// TOTPCodeRequest carries a code from the user's authenticator app
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorLoginRequest completes a login with the challenge token from the
+// password step. Code may be an authenticator or a recovery code.
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// TwoFactorDisableRequest turns 2FA off. Code may be an authenticator or a
+// recovery code.
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
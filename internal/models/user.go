@@ -6,16 +6,45 @@ import (
 	"github.com/google/uuid"
 )
 
+// Role decides what a user is allowed to do
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	return r == RoleUser || r == RoleAdmin
+}
+
 // User represents a user in the chat system
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"` // Never send to client
-	DisplayName  string    `json:"display_name,omitempty"`
-	AvatarURL    string    `json:"avatar_url,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	LastSeen     time.Time `json:"last_seen"`
+	ID            uuid.UUID  `json:"id"`
+	Username      string     `json:"username"`
+	Email         string     `json:"email"`
+	PasswordHash  string     `json:"-"` // Never send to client
+	DisplayName   string     `json:"display_name,omitempty"`
+	AvatarURL     string     `json:"avatar_url,omitempty"`
+	EmailVerified bool       `json:"email_verified"`
+	Role          Role       `json:"role"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastSeen      time.Time  `json:"last_seen"`
+	SuspendedAt   *time.Time `json:"suspended_at,omitempty"`
+	DeletedAt     *time.Time `json:"-"`
+}
+
+// Suspended reports whether an admin suspended the account. Suspended
+// accounts can't log in.
+func (u *User) Suspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// Deleted reports whether the account was deleted. Deleted accounts remain
+// as anonymous tombstones so their messages keep a sender and receiver.
+func (u *User) Deleted() bool {
+	return u.DeletedAt != nil
 }
 
 // UserRegistration contains data needed for user registration
@@ -27,16 +56,69 @@ type UserRegistration struct {
 
 // UserLogin contains data needed for user login
 type UserLogin struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Email       string `json:"email" binding:"required,email"`
+	Password    string `json:"password" binding:"required"`
+	DeviceLabel string `json:"device_label" binding:"max=100"` // optional name for the session, e.g. "Work laptop"
 }
 
 // UserResponse is what we return to the client
 type UserResponse struct {
-	ID          uuid.UUID `json:"id"`
-	Username    string    `json:"username"`
-	Email       string    `json:"email"`
-	DisplayName string    `json:"display_name,omitempty"`
-	AvatarURL   string    `json:"avatar_url,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID            uuid.UUID `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	DisplayName   string    `json:"display_name,omitempty"`
+	AvatarURL     string    `json:"avatar_url,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          Role      `json:"role,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	Deleted       bool      `json:"deleted,omitempty"`
+}
+
+// EmailRequest carries the address to send a password reset link to
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// PasswordResetRequest sets a new password with a token from a reset email
+type PasswordResetRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=5"`
+}
+
+// ProfileUpdate changes the display name or avatar. Omitted fields are left
+// as they are; empty strings clear them.
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,max=50"`
+	AvatarURL   *string `json:"avatar_url" binding:"omitempty,max=2048"`
+}
+
+// PasswordChangeRequest sets a new password, confirming the current one
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=5"`
+}
+
+// EmailChangeRequest moves the account to a new address, confirming the
+// password
+type EmailChangeRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// AccountDeletionRequest confirms deleting the account with the password
+type AccountDeletionRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// DataExport is everything stored about a user, as returned by the personal
+// data export
+type DataExport struct {
+	ExportedAt       time.Time  `json:"exported_at"`
+	User             *User      `json:"user"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	Sessions         []*Session `json:"sessions"`
+	Groups           []*Group   `json:"groups"`
+	// Messages are the direct messages the user sent or received and the
+	// messages of their groups, oldest first
+	Messages []*Message `json:"messages"`
 }
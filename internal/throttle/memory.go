@@ -0,0 +1,66 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// MemoryStore keeps login attempts in memory. Counts are lost on restart and
+// aren't shared between servers.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempts
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: make(map[string]models.LoginAttempts)}
+}
+
+func (s *MemoryStore) RecordLoginFailure(key string, at, since time.Time) (*models.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok || attempts.LastFailureAt.Before(since) {
+		attempts = models.LoginAttempts{Key: key}
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = at
+
+	s.attempts[key] = attempts
+	return &attempts, nil
+}
+
+func (s *MemoryStore) GetLoginAttempts(key string) (*models.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok {
+		attempts = models.LoginAttempts{Key: key}
+	}
+	return &attempts, nil
+}
+
+func (s *MemoryStore) ClearLoginAttempts(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *MemoryStore) PruneLoginAttempts(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, attempts := range s.attempts {
+		if attempts.LastFailureAt.Before(before) {
+			delete(s.attempts, key)
+		}
+	}
+	return nil
+}
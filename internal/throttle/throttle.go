@@ -0,0 +1,248 @@
+// Package throttle slows down password guessing by tracking failed logins
+// per account and per IP address
+package throttle
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ammar1510/converse/internal/logger"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// Store keeps failed login counts per throttling key. database.DBInterface
+// implements it, as does MemoryStore.
+type Store interface {
+	// RecordLoginFailure counts a failed login for key at the given time,
+	// starting the count over if the last failure was before since
+	RecordLoginFailure(key string, at, since time.Time) (*models.LoginAttempts, error)
+	// GetLoginAttempts returns a key's failures; a zero count if it has none
+	GetLoginAttempts(key string) (*models.LoginAttempts, error)
+	ClearLoginAttempts(key string) error
+	// PruneLoginAttempts forgets keys whose last failure was before the given time
+	PruneLoginAttempts(before time.Time) error
+}
+
+// Policy decides how long a key has to wait after failed logins. Past
+// FreeAttempts each failure doubles the wait, starting from BaseDelay, up to
+// MaxDelay; at LockoutAttempts the key is locked for LockoutDuration.
+type Policy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAttempts int
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+// DefaultAccountPolicy throttles guessing a single account's password
+var DefaultAccountPolicy = Policy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAttempts: 10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// DefaultIPPolicy throttles one address trying many accounts. It is looser
+// than the account policy since many users can share an address.
+var DefaultIPPolicy = Policy{
+	FreeAttempts:    20,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAttempts: 100,
+	LockoutDuration: time.Hour,
+	Window:          time.Hour,
+}
+
+// delay returns how long to wait after the given number of failures
+func (p Policy) delay(failures int) time.Duration {
+	if failures >= p.LockoutAttempts {
+		return p.LockoutDuration
+	}
+	if failures < p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// wait returns how much longer the key with these attempts has to wait
+func (p Policy) wait(attempts *models.LoginAttempts, now time.Time) time.Duration {
+	if attempts.Failures == 0 || now.Sub(attempts.LastFailureAt) > p.Window {
+		return 0
+	}
+
+	until := attempts.LastFailureAt.Add(p.delay(attempts.Failures))
+	return max(until.Sub(now), 0)
+}
+
+// pruneInterval is how often stale keys are removed from the store
+const pruneInterval = 10 * time.Minute
+
+// Limiter applies the account and IP policies to logins
+type Limiter struct {
+	Account Policy
+	IP      Policy
+
+	store Store
+	now   func() time.Time
+	log   *logger.Logger
+
+	mu         sync.Mutex
+	lastPruned time.Time
+	// locks serialize the attempts on each key, guarded by mu
+	locks map[string]*keyLock
+}
+
+// keyLock is held by the attempt in progress on a key. refs counts the
+// attempts holding or waiting for it, so it can be dropped once unused.
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// NewLimiter creates a limiter with the default policies
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{
+		Account: DefaultAccountPolicy,
+		IP:      DefaultIPPolicy,
+		store:   store,
+		now:     time.Now,
+		log:     logger.New("security"),
+		locks:   make(map[string]*keyLock),
+	}
+}
+
+// throttleKey is a store key and the policy that applies to it
+type throttleKey struct {
+	key    string
+	policy Policy
+}
+
+// keys returns the keys a login for account from ip is throttled by
+func (l *Limiter) keys(account, ip string) []throttleKey {
+	keys := []throttleKey{{"account:" + strings.ToLower(strings.TrimSpace(account)), l.Account}}
+	if ip != "" {
+		keys = append(keys, throttleKey{"ip:" + ip, l.IP})
+	}
+	return keys
+}
+
+// Begin starts a password attempt for account from ip. It waits for the
+// attempts already in progress on the same keys in this process, so that a
+// burst of parallel guesses is checked one at a time against the failures
+// recorded before it rather than all getting past Check at once. It returns
+// how long the attempt has to wait, like Check, and a release function the
+// caller must call once it has recorded the outcome with Fail or Succeed.
+func (l *Limiter) Begin(account, ip string) (time.Duration, func(), error) {
+	keys := l.keys(account, ip)
+	unlocks := make([]func(), 0, len(keys))
+	for _, k := range keys {
+		unlocks = append(unlocks, l.lockKey(k.key))
+	}
+	release := func() {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}
+
+	wait, err := l.Check(account, ip)
+	if err != nil {
+		release()
+		return 0, func() {}, err
+	}
+	return wait, release, nil
+}
+
+// lockKey takes the lock of key and returns the function releasing it.
+// Keys are always locked in the same order, account before IP.
+func (l *Limiter) lockKey(key string) func() {
+	l.mu.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Check returns how long a login for account from ip has to wait, or zero if
+// it can go ahead
+func (l *Limiter) Check(account, ip string) (time.Duration, error) {
+	now := l.now()
+
+	var wait time.Duration
+	for _, k := range l.keys(account, ip) {
+		attempts, err := l.store.GetLoginAttempts(k.key)
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, k.policy.wait(attempts, now))
+	}
+
+	return wait, nil
+}
+
+// Fail records a failed login for account from ip and logs a security event
+// for each key it locks out
+func (l *Limiter) Fail(account, ip string) error {
+	now := l.now()
+
+	for _, k := range l.keys(account, ip) {
+		attempts, err := l.store.RecordLoginFailure(k.key, now, now.Add(-k.policy.Window))
+		if err != nil {
+			return err
+		}
+
+		if attempts.Failures >= k.policy.LockoutAttempts {
+			l.log.Warn("Locked out %s for %s after %d failed logins", k.key, k.policy.LockoutDuration, attempts.Failures)
+		}
+	}
+
+	l.prune(now)
+	return nil
+}
+
+// Succeed forgets the account's failures after a successful login. The IP's
+// are kept so an attacker can't reset them by logging into their own account.
+func (l *Limiter) Succeed(account string) error {
+	return l.store.ClearLoginAttempts(l.keys(account, "")[0].key)
+}
+
+// prune removes keys whose failures are no longer remembered, at most once
+// per pruneInterval
+func (l *Limiter) prune(now time.Time) {
+	l.mu.Lock()
+	if now.Sub(l.lastPruned) < pruneInterval {
+		l.mu.Unlock()
+		return
+	}
+	l.lastPruned = now
+	l.mu.Unlock()
+
+	window := max(l.Account.Window, l.IP.Window)
+	if err := l.store.PruneLoginAttempts(now.Add(-window)); err != nil {
+		l.log.Warn("Failed to prune login attempts: %v", err)
+	}
+}
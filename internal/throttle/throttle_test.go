@@ -0,0 +1,200 @@
+package throttle
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/database"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	p := DefaultAccountPolicy
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{6, 8 * time.Second},
+		{9, time.Minute},
+		{10, 15 * time.Minute},
+		{25, 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, p.delay(tt.failures), "%d failures", tt.failures)
+	}
+}
+
+// newTestLimiter returns a limiter on store with a clock the test moves
+func newTestLimiter(store Store) (*Limiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(store)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiter(t *testing.T) {
+	stores := map[string]func() Store{
+		"memory":   func() Store { return NewMemoryStore() },
+		"database": func() Store { return database.NewMemoryDB() },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Run("account backoff and lockout", func(t *testing.T) {
+				l, now := newTestLimiter(newStore())
+
+				for range 2 {
+					require.NoError(t, l.Fail("alice@example.com", "192.0.2.1"))
+				}
+				wait, err := l.Check("alice@example.com", "192.0.2.1")
+				require.NoError(t, err)
+				assert.Zero(t, wait)
+
+				require.NoError(t, l.Fail("alice@example.com", "192.0.2.1"))
+				wait, err = l.Check("alice@example.com", "192.0.2.1")
+				require.NoError(t, err)
+				assert.Equal(t, time.Second, wait)
+
+				// The account is throttled from any address, and its email is
+				// matched case-insensitively
+				wait, err = l.Check(" Alice@Example.com", "198.51.100.7")
+				require.NoError(t, err)
+				assert.Equal(t, time.Second, wait)
+
+				*now = now.Add(time.Second)
+				wait, err = l.Check("alice@example.com", "192.0.2.1")
+				require.NoError(t, err)
+				assert.Zero(t, wait)
+
+				for range 7 {
+					require.NoError(t, l.Fail("alice@example.com", "192.0.2.1"))
+				}
+				wait, err = l.Check("alice@example.com", "192.0.2.1")
+				require.NoError(t, err)
+				assert.Equal(t, 15*time.Minute, wait)
+
+				// Other accounts aren't affected
+				wait, err = l.Check("bob@example.com", "192.0.2.1")
+				require.NoError(t, err)
+				assert.Zero(t, wait)
+
+				*now = now.Add(15 * time.Minute)
+				wait, err = l.Check("alice@example.com", "192.0.2.1")
+				require.NoError(t, err)
+				assert.Zero(t, wait)
+			})
+
+			t.Run("success resets the account", func(t *testing.T) {
+				l, _ := newTestLimiter(newStore())
+
+				for range 5 {
+					require.NoError(t, l.Fail("alice@example.com", "192.0.2.1"))
+				}
+				require.NoError(t, l.Succeed("alice@example.com"))
+
+				wait, err := l.Check("alice@example.com", "192.0.2.1")
+				require.NoError(t, err)
+				assert.Zero(t, wait)
+
+				// One more failure doesn't bring the backoff back
+				require.NoError(t, l.Fail("alice@example.com", "192.0.2.1"))
+				wait, err = l.Check("alice@example.com", "192.0.2.1")
+				require.NoError(t, err)
+				assert.Zero(t, wait)
+			})
+
+			t.Run("failures are forgotten", func(t *testing.T) {
+				l, now := newTestLimiter(newStore())
+
+				for range 5 {
+					require.NoError(t, l.Fail("alice@example.com", ""))
+				}
+				*now = now.Add(2 * time.Hour)
+
+				require.NoError(t, l.Fail("alice@example.com", ""))
+				wait, err := l.Check("alice@example.com", "")
+				require.NoError(t, err)
+				assert.Zero(t, wait)
+			})
+
+			t.Run("ip spraying", func(t *testing.T) {
+				l, _ := newTestLimiter(newStore())
+
+				// One attempt at each of many accounts
+				for i := range DefaultIPPolicy.FreeAttempts {
+					require.NoError(t, l.Fail(string(rune('a'+i))+"@example.com", "192.0.2.1"))
+				}
+
+				wait, err := l.Check("new@example.com", "192.0.2.1")
+				require.NoError(t, err)
+				assert.Equal(t, time.Second, wait)
+
+				wait, err = l.Check("new@example.com", "198.51.100.7")
+				require.NoError(t, err)
+				assert.Zero(t, wait)
+
+				// Logging into an account doesn't clear the address
+				require.NoError(t, l.Succeed("a@example.com"))
+				wait, err = l.Check("new@example.com", "192.0.2.1")
+				require.NoError(t, err)
+				assert.Equal(t, time.Second, wait)
+			})
+		})
+	}
+}
+
+func TestLimiterPrunes(t *testing.T) {
+	store := NewMemoryStore()
+	l, now := newTestLimiter(store)
+
+	require.NoError(t, l.Fail("alice@example.com", "192.0.2.1"))
+	*now = now.Add(2 * time.Hour)
+	require.NoError(t, l.Fail("bob@example.com", "192.0.2.2"))
+
+	assert.Len(t, store.attempts, 2)
+	assert.Contains(t, store.attempts, "account:bob@example.com")
+	assert.Contains(t, store.attempts, "ip:192.0.2.2")
+}
+
+// TestLimiterBegin tests that parallel attempts on an account are checked one
+// at a time, so a burst can't get more guesses past the backoff
+func TestLimiterBegin(t *testing.T) {
+	l, _ := newTestLimiter(NewMemoryStore())
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, release, err := l.Begin("alice@example.com", fmt.Sprintf("192.0.2.%d", i))
+			require.NoError(t, err)
+			defer release()
+			if wait > 0 {
+				return
+			}
+
+			mu.Lock()
+			allowed++
+			mu.Unlock()
+			require.NoError(t, l.Fail("alice@example.com", fmt.Sprintf("192.0.2.%d", i)))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, DefaultAccountPolicy.FreeAttempts, allowed)
+	assert.Empty(t, l.locks)
+}
@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// DisconnectScope says which connections an envelope closes
+type DisconnectScope string
+
+// Disconnect scopes
+const (
+	ScopeUser          DisconnectScope = "user"           // every connection of the user
+	ScopeSession       DisconnectScope = "session"        // connections opened with the session
+	ScopeOtherSessions DisconnectScope = "other_sessions" // the user's connections outside the session
+)
+
+// Envelope is what managers pass each other over a backplane: a frame for
+// every connection of a user, or a request to close some connections
+type Envelope struct {
+	UserID       uuid.UUID `json:"user_id,omitzero"`
+	ExceptConnID uuid.UUID `json:"except_conn_id,omitzero"`
+	// Seq is the number of the user's event Frame carries, if it is one
+	Seq   int64  `json:"seq,omitempty"`
+	Frame []byte `json:"frame,omitempty"`
+
+	// Disconnect closes connections instead of sending a frame. SessionID
+	// names the session for ScopeSession and ScopeOtherSessions.
+	Disconnect DisconnectScope `json:"disconnect,omitempty"`
+	SessionID  uuid.UUID       `json:"session_id,omitzero"`
+
+	// Presence reports the status of users connected to an instance instead
+	Presence *PresenceReport `json:"presence,omitempty"`
+}
+
+// excludes reports whether the envelope's frame skips the connection
+func (e Envelope) excludes(connID uuid.UUID) bool {
+	return e.ExceptConnID != uuid.Nil && connID == e.ExceptConnID
+}
+
+// Backplane carries envelopes between the managers of every instance of the
+// server, so a frame reaches a user whichever instance they are connected
+// to. Envelopes may be lost or arrive out of order; events are numbered so
+// managers can fill in what they missed from the database.
+type Backplane interface {
+	// Publish hands envelope to every subscribed manager, including the
+	// publishing one
+	Publish(envelope Envelope) error
+	// Subscribe registers a manager's receive function. Envelopes for one
+	// subscriber are received one at a time, unless they are published
+	// concurrently on a LocalBackplane.
+	Subscribe(receive func(Envelope))
+	// Close stops delivering envelopes
+	Close() error
+}
+
+// LocalBackplane passes envelopes between the managers of one process. It is
+// what a single instance uses, and lets tests run several managers side by
+// side. Publish returns once every subscriber has received the envelope.
+type LocalBackplane struct {
+	mu          sync.RWMutex
+	subscribers []func(Envelope)
+}
+
+// NewLocalBackplane creates an in-process backplane
+func NewLocalBackplane() *LocalBackplane {
+	return &LocalBackplane{}
+}
+
+// Publish hands envelope to every subscriber in turn
+func (b *LocalBackplane) Publish(envelope Envelope) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, receive := range b.subscribers {
+		receive(envelope)
+	}
+	return nil
+}
+
+// Subscribe registers receive for every envelope published from now on
+func (b *LocalBackplane) Subscribe(receive func(Envelope)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, receive)
+}
+
+// Close drops the subscribers
+func (b *LocalBackplane) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = nil
+	return nil
+}
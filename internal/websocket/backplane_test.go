@@ -0,0 +1,283 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// heldBackplane keeps published envelopes until the test hands them on
+type heldBackplane struct {
+	mu        sync.Mutex
+	envelopes []Envelope
+	receive   func(Envelope)
+}
+
+func (b *heldBackplane) Publish(envelope Envelope) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.envelopes = append(b.envelopes, envelope)
+	return nil
+}
+
+func (b *heldBackplane) Subscribe(receive func(Envelope)) {
+	b.receive = receive
+}
+
+func (b *heldBackplane) Close() error {
+	return nil
+}
+
+// held returns the envelopes published so far, leaving out presence reports
+func (b *heldBackplane) held() []Envelope {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var held []Envelope
+	for _, envelope := range b.envelopes {
+		if envelope.Presence == nil {
+			held = append(held, envelope)
+		}
+	}
+	return held
+}
+
+// TestBackplaneInstances tests two managers sharing a backplane and a
+// database, as two instances of the server would
+func TestBackplaneInstances(t *testing.T) {
+	db := database.NewMemoryDB()
+	backplane := NewLocalBackplane()
+
+	first := NewManagerWithBackplane(db, backplane, events.NewBus())
+	go first.Run()
+	firstServer := httptest.NewServer(setupTestRouterWithManager(first))
+	defer firstServer.Close()
+
+	second := NewManagerWithBackplane(db, backplane, events.NewBus())
+	go second.Run()
+	secondServer := httptest.NewServer(setupTestRouterWithManager(second))
+	defer secondServer.Close()
+
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+
+	wsURL := func(server *httptest.Server, userID uuid.UUID) string {
+		return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-user?user_id=" + userID.String()
+	}
+
+	aliceWS, _ := createTestClient(t, wsURL(firstServer, alice.ID))
+	defer aliceWS.Close()
+	bobWS, _ := createTestClient(t, wsURL(secondServer, bob.ID))
+	defer bobWS.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	// Messages cross over to the instance the receiver is on
+	messageJSON, err := json.Marshal(WebSocketMessage{Type: MessageTypeMessage, ReceiverID: alice.ID, Content: "hello"})
+	require.NoError(t, err)
+	require.NoError(t, bobWS.WriteMessage(websocket.TextMessage, messageJSON))
+	assert.Equal(t, MessageTypeAck, readTestMessage(t, bobWS).Type)
+
+	received := readTestMessage(t, aliceWS)
+	assert.Equal(t, "hello", received.Content)
+	assert.Equal(t, bob.ID, received.SenderID)
+	assert.Equal(t, int64(1), received.Seq)
+
+	// So do typing indicators and events delivered outside a connection
+	typingJSON, err := json.Marshal(WebSocketMessage{Type: MessageTypeTyping, ReceiverID: alice.ID, IsTyping: true})
+	require.NoError(t, err)
+	require.NoError(t, bobWS.WriteMessage(websocket.TextMessage, typingJSON))
+	assert.Equal(t, MessageTypeTyping, readTestMessage(t, aliceWS).Type)
+
+	second.Deliver(alice.ID, WebSocketMessage{Type: MessageTypeMessage, Content: "from the second instance"})
+	received = readTestMessage(t, aliceWS)
+	assert.Equal(t, "from the second instance", received.Content)
+	assert.Equal(t, int64(2), received.Seq)
+
+	// A client resuming on the other instance picks up from there
+	aliceWS2, _ := createTestClient(t, wsURL(secondServer, alice.ID)+"&last_seq=1")
+	defer aliceWS2.Close()
+	frames := readTestFrames(t, aliceWS2, 2)
+	assert.Equal(t, int64(2), frames[0].Seq)
+	assert.Equal(t, MessageTypeSync, frames[1].Type)
+	assert.Equal(t, int64(2), frames[1].Seq)
+
+	// Disconnecting a user reaches every instance
+	first.DisconnectUser(bob.ID)
+	bobWS.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := bobWS.ReadMessage(); err != nil {
+			break
+		}
+	}
+	users, _ := second.ConnectionCounts()
+	assert.Equal(t, 1, users)
+}
+
+// TestBackplanePresence tests that a user connected to two instances only
+// goes offline once they leave both, and that partners hear it once
+func TestBackplanePresence(t *testing.T) {
+	db := database.NewMemoryDB()
+	backplane := NewLocalBackplane()
+
+	first := NewManagerWithBackplane(db, backplane, events.NewBus())
+	go first.Run()
+	firstServer := httptest.NewServer(setupTestRouterWithManager(first))
+	defer firstServer.Close()
+
+	second := NewManagerWithBackplane(db, backplane, events.NewBus())
+	go second.Run()
+	secondServer := httptest.NewServer(setupTestRouterWithManager(second))
+	defer secondServer.Close()
+
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	_, err = db.CreateMessage(alice.ID, bob.ID, "hi")
+	require.NoError(t, err)
+
+	wsURL := func(server *httptest.Server, userID uuid.UUID) string {
+		return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-user?user_id=" + userID.String()
+	}
+
+	bobWS, _ := createTestClient(t, wsURL(firstServer, bob.ID))
+	defer bobWS.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	aliceFirst, _ := createTestClient(t, wsURL(firstServer, alice.ID))
+	presence := readTestPresence(t, bobWS)
+	assert.Equal(t, alice.ID, presence.UserID)
+	assert.Equal(t, models.PresenceOnline, presence.Status)
+
+	aliceSecond, _ := createTestClient(t, wsURL(secondServer, alice.ID))
+	defer aliceSecond.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	// Leaving the first instance keeps her online on both
+	before := time.Now()
+	aliceFirst.Close()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, models.PresenceOnline, first.Presence(alice.ID))
+	assert.Equal(t, models.PresenceOnline, second.Presence(alice.ID))
+	user, err := db.GetUserByID(alice.ID)
+	require.NoError(t, err)
+	assert.True(t, user.LastSeen.Before(before), "last seen should not be recorded while she is connected elsewhere")
+
+	// Leaving the second makes her offline, announced once
+	aliceSecond.Close()
+	presence = readTestPresence(t, bobWS)
+	assert.Equal(t, alice.ID, presence.UserID)
+	assert.Equal(t, models.PresenceOffline, presence.Status)
+	assert.NotNil(t, presence.LastSeen)
+	assert.Equal(t, models.PresenceOffline, first.Presence(alice.ID))
+	assert.Equal(t, models.PresenceOffline, second.Presence(alice.ID))
+
+	bobWS.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, _, err = bobWS.ReadMessage()
+	assert.Error(t, err, "going offline should be announced once")
+}
+
+// TestPresenceInstanceGone tests that the users of an instance that stops
+// reporting go offline
+func TestPresenceInstanceGone(t *testing.T) {
+	db := database.NewMemoryDB()
+	manager := NewManager(db, events.NewBus())
+	manager.AwayAfter = 200 * time.Millisecond
+	go manager.Run()
+	server := httptest.NewServer(setupTestRouterWithManager(manager))
+	defer server.Close()
+
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	_, err = db.CreateMessage(alice.ID, bob.ID, "hi")
+	require.NoError(t, err)
+
+	bobWS, _ := createTestClient(t, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws-user?user_id="+bob.ID.String())
+	defer bobWS.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	// Alice is connected to another instance, which announces her itself
+	manager.receivePresence(PresenceReport{
+		InstanceID: uuid.Max,
+		Statuses:   map[uuid.UUID]models.PresenceStatus{alice.ID: models.PresenceOnline},
+	})
+	assert.Equal(t, models.PresenceOnline, manager.Presence(alice.ID))
+
+	// It goes quiet and its users go offline
+	for {
+		presence := readTestPresence(t, bobWS)
+		if presence.UserID == alice.ID {
+			assert.Equal(t, models.PresenceOffline, presence.Status)
+			break
+		}
+	}
+	assert.Equal(t, models.PresenceOffline, manager.Presence(alice.ID))
+}
+
+// TestEventsOutOfOrder tests that events arriving out of order, or not at
+// all, reach clients once each and in order
+func TestEventsOutOfOrder(t *testing.T) {
+	db := database.NewMemoryDB()
+	backplane := &heldBackplane{}
+	manager := NewManagerWithBackplane(db, backplane, events.NewBus())
+	go manager.Run()
+	server := httptest.NewServer(setupTestRouterWithManager(manager))
+	defer server.Close()
+
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+
+	aliceWS, _ := createTestClient(t, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws-user?user_id="+alice.ID.String()+"&last_seq=0")
+	defer aliceWS.Close()
+	sync := readTestMessage(t, aliceWS)
+	assert.Equal(t, MessageTypeSync, sync.Type)
+	assert.Zero(t, sync.Seq)
+
+	for _, content := range []string{"one", "two", "three", "four"} {
+		manager.Deliver(alice.ID, WebSocketMessage{Type: MessageTypeMessage, Content: content})
+	}
+	envelopes := backplane.held()
+	require.Len(t, envelopes, 4)
+
+	// The third arrives first and brings the two before it; the fourth is
+	// lost and only turns up on the next catch-up
+	backplane.receive(envelopes[2])
+	backplane.receive(envelopes[0])
+	backplane.receive(envelopes[1])
+
+	frames := readTestFrames(t, aliceWS, 3)
+	for i, content := range []string{"one", "two", "three"} {
+		assert.Equal(t, content, frames[i].Content)
+		assert.Equal(t, int64(i+1), frames[i].Seq)
+	}
+
+	manager.Deliver(alice.ID, WebSocketMessage{Type: MessageTypeMessage, Content: "five"})
+	envelopes = backplane.held()
+	require.Len(t, envelopes, 5)
+	backplane.receive(envelopes[4])
+
+	frames = readTestFrames(t, aliceWS, 2)
+	assert.Equal(t, "four", frames[0].Content)
+	assert.Equal(t, "five", frames[1].Content)
+	assert.Equal(t, int64(5), frames[1].Seq)
+
+	aliceWS.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, _, err = aliceWS.ReadMessage()
+	assert.Error(t, err, "no event should be sent twice")
+}
@@ -3,85 +3,240 @@ package websocket
 import (
 	"encoding/json"
 	"net/http"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
 	"github.com/ammar1510/converse/internal/logger"
+	"github.com/ammar1510/converse/internal/models"
 )
 
 // Message types
 const (
-	MessageTypeMessage = "message"
-	MessageTypeTyping  = "typing"
+	MessageTypeMessage  = "message"
+	MessageTypeTyping   = "typing"
+	MessageTypeAck      = "ack"
+	MessageTypeNack     = "nack"
+	MessageTypeError    = "error"
+	MessageTypeSync     = "sync"
+	MessageTypePresence = "presence"
+	// MessageTypeReadReceipt tells a sender that a message was read
+	MessageTypeReadReceipt = "read_receipt"
+)
+
+// Nack codes say why a message wasn't stored
+const (
+	NackInvalidContent      = "invalid_content"
+	NackInvalidClientMsgID  = "invalid_client_msg_id"
+	NackInvalidReceiver     = "invalid_receiver"
+	NackInvalidConversation = "invalid_conversation"
+	NackInternalError       = "internal_error"
+)
+
+// DefaultEventRetention is how long events are kept for clients that
+// reconnect
+const DefaultEventRetention = 7 * 24 * time.Hour
+
+const (
+	// eventPruneInterval is how often events past the retention are deleted
+	eventPruneInterval = time.Hour
+	// replayBatchSize is how many missed events are read at a time when a
+	// client resumes
+	replayBatchSize = 100
 )
 
 var log = logger.New("websocket")
 
-// Client represents a connected websocket client
+// Client represents a connected websocket client. ID identifies the user and
+// ConnID the individual connection, so one user can be connected from
+// several devices at once.
 type Client struct {
-	ID     uuid.UUID
-	Socket *websocket.Conn
-	Send   chan []byte
+	ID        uuid.UUID
+	ConnID    uuid.UUID
+	SessionID uuid.UUID // login session the connection was opened with, if any
+	Socket    *websocket.Conn
+	Send      chan []byte
+
+	// lastActive is when the client last sent a frame and away whether it
+	// said its user stepped away. Both are guarded by the manager's mutex.
+	lastActive time.Time
+	away       bool
+	// lastSeq is the seq of the last event sent to the connection, or -1
+	// until the first one if the client didn't resume. It is guarded by the
+	// manager's mutex.
+	lastSeq int64
+	// closed is set once Send is closed, after which nothing may be sent on
+	// it. It is guarded by the manager's mutex.
+	closed bool
 }
 
-// Manager maintains the set of active clients
+// Manager maintains the set of active clients, keyed by user ID and then by
+// connection ID. Frames for users go through a backplane, so with several
+// instances of the server they reach users connected to any of them.
 type Manager struct {
-	clients    map[uuid.UUID]*Client
+	clients    map[uuid.UUID]map[uuid.UUID]*Client
 	broadcast  chan []byte
 	register   chan *Client
 	unregister chan *Client
 	mutex      sync.Mutex
+	db         database.DBInterface
+	backplane  Backplane
+	// bus is where messages sent over WebSocket are published
+	bus *events.Bus
+
+	// EventRetention is how long delivered events are kept for replay
+	EventRetention time.Duration
+
+	// deliveryLocks keep each user's events published in the order they are
+	// numbered, as far as this instance goes. Users share them by the first
+	// byte of their ID.
+	deliveryLocks [64]sync.Mutex
+	pruneMu       sync.Mutex
+	lastPruned    time.Time
+
+	// AwayAfter is how long a user's connections can be idle before the user
+	// shows as away
+	AwayAfter time.Duration
+
+	// presence holds the status last broadcast for each user that isn't
+	// offline, and presenceChanged the users whose status may have changed
+	// since. Both are guarded by mutex.
+	presence        map[uuid.UUID]models.PresenceStatus
+	presenceChanged map[uuid.UUID]bool
+	presenceWake    chan struct{}
+
+	// instanceID names this instance in presence reports. reported holds the
+	// status last reported for each user connected here and instances what
+	// every instance, this one included, reported last. Both are guarded by
+	// mutex.
+	instanceID uuid.UUID
+	reported   map[uuid.UUID]models.PresenceStatus
+	instances  map[uuid.UUID]*instancePresence
 }
 
 // WebSocketMessage represents a message sent over WebSocket
 type WebSocketMessage struct {
-	Type       string    `json:"type"`
-	SenderID   uuid.UUID `json:"sender_id,omitempty"`
-	ReceiverID uuid.UUID `json:"receiver_id,omitempty"`
-	Content    string    `json:"content,omitempty"`
-	IsTyping   bool      `json:"is_typing,omitempty"`
-	Timestamp  time.Time `json:"timestamp"`
-}
-
-// NewManager creates a new websocket manager
-func NewManager() *Manager {
-	return &Manager{
-		clients:    make(map[uuid.UUID]*Client),
+	Type           string          `json:"type"`
+	MessageID      uuid.UUID       `json:"message_id,omitempty"`
+	SenderID       uuid.UUID       `json:"sender_id,omitempty"`
+	ReceiverID     uuid.UUID       `json:"receiver_id,omitempty"`
+	ConversationID uuid.UUID       `json:"conversation_id,omitzero"` // addresses a group instead of ReceiverID
+	Content        string          `json:"content,omitempty"`
+	IsTyping       bool            `json:"is_typing,omitempty"`
+	Message        *models.Message `json:"message,omitempty"`
+	Timestamp      time.Time       `json:"timestamp"`
+	// ClientMsgID is the client's name for a message it sends, echoed in the
+	// ack or nack. Resending with the same one doesn't store it twice.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	// Code says why a nack rejected a message
+	Code string `json:"code,omitempty"`
+	// Seq numbers the events stored for the receiving user; a sync frame
+	// carries the latest one
+	Seq int64 `json:"seq,omitempty"`
+	// Truncated marks a sync frame whose replay is missing events that were
+	// pruned before the client came back
+	Truncated bool `json:"truncated,omitempty"`
+	// UserID, Status and LastSeen describe the user a presence frame is
+	// about. LastSeen is only set when they go offline.
+	UserID   uuid.UUID             `json:"user_id,omitzero"`
+	Status   models.PresenceStatus `json:"status,omitempty"`
+	LastSeen *time.Time            `json:"last_seen,omitempty"`
+}
+
+// NewChatMessage builds the frame delivered to the participants of a stored message
+func NewChatMessage(message *models.Message) WebSocketMessage {
+	wsMessage := WebSocketMessage{
+		Type:       MessageTypeMessage,
+		MessageID:  message.ID,
+		SenderID:   message.SenderID,
+		ReceiverID: message.ReceiverID,
+		Content:    message.Content,
+		Timestamp:  message.CreatedAt,
+	}
+	if message.ConversationID != nil {
+		wsMessage.ConversationID = *message.ConversationID
+	}
+	return wsMessage
+}
+
+// NewReadReceipt builds the frame telling the sender of a message that
+// readerID read it
+func NewReadReceipt(message *models.Message, readerID uuid.UUID) WebSocketMessage {
+	return WebSocketMessage{
+		Type:       MessageTypeReadReceipt,
+		MessageID:  message.ID,
+		SenderID:   readerID,
+		ReceiverID: message.SenderID,
+		Timestamp:  message.CreatedAt,
+	}
+}
+
+// NewManager creates a new websocket manager that persists messages through db,
+// acts on the events published on bus and only delivers to its own clients
+func NewManager(db database.DBInterface, bus *events.Bus) *Manager {
+	return NewManagerWithBackplane(db, NewLocalBackplane(), bus)
+}
+
+// NewManagerWithBackplane creates a websocket manager that persists messages
+// through db, acts on the events published on bus and delivers them through
+// backplane
+func NewManagerWithBackplane(db database.DBInterface, backplane Backplane, bus *events.Bus) *Manager {
+	m := &Manager{
+		clients:    make(map[uuid.UUID]map[uuid.UUID]*Client),
 		broadcast:  make(chan []byte),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		db:         db,
+		backplane:  backplane,
+		bus:        bus,
+
+		EventRetention: DefaultEventRetention,
+		AwayAfter:      DefaultAwayAfter,
+
+		presence:        make(map[uuid.UUID]models.PresenceStatus),
+		presenceChanged: make(map[uuid.UUID]bool),
+		presenceWake:    make(chan struct{}, 1),
+
+		instanceID: uuid.New(),
+		reported:   make(map[uuid.UUID]models.PresenceStatus),
+		instances:  make(map[uuid.UUID]*instancePresence),
 	}
+	backplane.Subscribe(m.receive)
+	m.subscribe(bus)
+	return m
 }
 
 // Run starts the websocket manager
 func (m *Manager) Run() {
+	go m.runPresence()
+
 	for {
 		select {
 		case client := <-m.register:
-			m.mutex.Lock()
-			m.clients[client.ID] = client
-			log.Info("Client connected: %s", client.ID)
-			m.mutex.Unlock()
+			m.addClient(client)
 		case client := <-m.unregister:
 			m.mutex.Lock()
-			if _, ok := m.clients[client.ID]; ok {
-				delete(m.clients, client.ID)
-				close(client.Send)
-				log.Info("Client disconnected: %s", client.ID)
+			if m.removeClient(client) {
+				log.Info("Client disconnected: %s (connection %s)", client.ID, client.ConnID)
 			}
 			m.mutex.Unlock()
 		case message := <-m.broadcast:
 			m.mutex.Lock()
-			for _, client := range m.clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(m.clients, client.ID)
+			for _, conns := range m.clients {
+				for _, client := range conns {
+					select {
+					case client.Send <- message:
+					default:
+						m.removeClient(client)
+					}
 				}
 			}
 			m.mutex.Unlock()
@@ -89,25 +244,302 @@ func (m *Manager) Run() {
 	}
 }
 
-// SendToUser sends a message to a specific user
+// addClient adds a connection to the set of active clients
+func (m *Manager) addClient(client *Client) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	conns, ok := m.clients[client.ID]
+	if !ok {
+		conns = make(map[uuid.UUID]*Client)
+		m.clients[client.ID] = conns
+	}
+	conns[client.ConnID] = client
+	client.lastActive = time.Now()
+	m.presenceChangedLocked(client.ID)
+	log.Info("Client connected: %s (connection %s, %d active)", client.ID, client.ConnID, len(conns))
+}
+
+// removeClient drops a connection and closes its send channel. It reports
+// whether the connection was still registered. The caller must hold m.mutex.
+func (m *Manager) removeClient(client *Client) bool {
+	conns, ok := m.clients[client.ID]
+	if !ok {
+		return false
+	}
+	if registered, ok := conns[client.ConnID]; !ok || registered != client {
+		return false
+	}
+
+	delete(conns, client.ConnID)
+	if len(conns) == 0 {
+		delete(m.clients, client.ID)
+	}
+	client.closed = true
+	close(client.Send)
+	m.presenceChangedLocked(client.ID)
+	return true
+}
+
+// SendToUser sends a message to every connection of a specific user
 func (m *Manager) SendToUser(userID uuid.UUID, message []byte) {
+	m.SendToUserExcept(userID, uuid.Nil, message)
+}
+
+// SendToUserExcept sends a message to every connection of a user apart from
+// the one identified by exceptConnID, typically the connection it came from
+func (m *Manager) SendToUserExcept(userID, exceptConnID uuid.UUID, message []byte) {
+	m.publish(Envelope{UserID: userID, ExceptConnID: exceptConnID, Frame: message})
+}
+
+// SendToUsers sends a message to every connection of each user apart from the
+// one identified by exceptConnID, typically the connection it came from. It
+// is how group messages fan out to the online members.
+func (m *Manager) SendToUsers(userIDs []uuid.UUID, exceptConnID uuid.UUID, message []byte) {
+	for _, userID := range userIDs {
+		m.SendToUserExcept(userID, exceptConnID, message)
+	}
+}
+
+// Deliver stores message as the user's next event and sends it to every
+// connection of the user, stamped with the event's sequence number. Clients
+// that were offline get it replayed when they resume.
+func (m *Manager) Deliver(userID uuid.UUID, message WebSocketMessage) {
+	m.DeliverExcept(userID, uuid.Nil, message)
+}
+
+// DeliverExcept is Deliver without sending to the connection identified by
+// exceptConnID, typically the one the message came from. That connection
+// only sees the event if it later resumes from before it.
+func (m *Manager) DeliverExcept(userID, exceptConnID uuid.UUID, message WebSocketMessage) {
+	m.pruneEvents(time.Now())
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		log.Error("Failed to marshal event for user %s: %v", userID, err)
+		return
+	}
+
+	lock := m.deliveryLock(userID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	event, err := m.db.AppendEvent(userID, payload)
+	if err != nil {
+		// Online clients still get it; only a resuming client would miss it
+		if err != database.ErrUserNotFound {
+			log.Error("Failed to store event for user %s: %v", userID, err)
+		}
+		m.SendToUserExcept(userID, exceptConnID, payload)
+		return
+	}
+
+	message.Seq = event.Seq
+	frame, _ := json.Marshal(message)
+	m.publish(Envelope{UserID: userID, ExceptConnID: exceptConnID, Seq: event.Seq, Frame: frame})
+}
+
+// DeliverToUsers delivers message to each of the users, apart from the
+// connection identified by exceptConnID. It is how group messages fan out.
+func (m *Manager) DeliverToUsers(userIDs []uuid.UUID, exceptConnID uuid.UUID, message WebSocketMessage) {
+	for _, userID := range userIDs {
+		m.DeliverExcept(userID, exceptConnID, message)
+	}
+}
+
+// deliveryLock returns the lock that orders the events of a user
+func (m *Manager) deliveryLock(userID uuid.UUID) *sync.Mutex {
+	return &m.deliveryLocks[int(userID[0])%len(m.deliveryLocks)]
+}
+
+// pruneEvents deletes events older than the retention, at most once per
+// eventPruneInterval
+func (m *Manager) pruneEvents(now time.Time) {
+	m.pruneMu.Lock()
+	if now.Sub(m.lastPruned) < eventPruneInterval {
+		m.pruneMu.Unlock()
+		return
+	}
+	m.lastPruned = now
+	m.pruneMu.Unlock()
+
+	if err := m.db.PruneEvents(now.Add(-m.EventRetention)); err != nil {
+		log.Warn("Failed to prune events: %v", err)
+	}
+}
+
+// DisconnectSession closes every connection opened with the given session,
+// typically because the session was revoked
+func (m *Manager) DisconnectSession(sessionID uuid.UUID) {
+	m.publish(Envelope{Disconnect: ScopeSession, SessionID: sessionID})
+}
+
+// DisconnectUser closes every connection of a user, typically because all
+// of their sessions were revoked
+func (m *Manager) DisconnectUser(userID uuid.UUID) {
+	m.publish(Envelope{UserID: userID, Disconnect: ScopeUser})
+}
+
+// DisconnectOtherSessions closes every connection of a user that wasn't
+// opened with keepSessionID, typically because their other sessions were
+// revoked
+func (m *Manager) DisconnectOtherSessions(userID, keepSessionID uuid.UUID) {
+	m.publish(Envelope{UserID: userID, Disconnect: ScopeOtherSessions, SessionID: keepSessionID})
+}
+
+// publish hands an envelope to the backplane
+func (m *Manager) publish(envelope Envelope) {
+	if err := m.backplane.Publish(envelope); err != nil {
+		log.Error("Failed to publish to user %s: %v", envelope.UserID, err)
+	}
+}
+
+// receive acts on an envelope from the backplane for this instance's clients
+func (m *Manager) receive(envelope Envelope) {
+	switch {
+	case envelope.Presence != nil:
+		m.receivePresence(*envelope.Presence)
+	case envelope.Disconnect != "":
+		m.disconnect(envelope)
+	case envelope.Seq > 0:
+		m.sendEvent(envelope)
+	default:
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		for connID, client := range m.clients[envelope.UserID] {
+			if !envelope.excludes(connID) {
+				m.sendLocked(client, envelope.Frame)
+			}
+		}
+	}
+}
+
+// sendEvent sends an event to each connection of its user that is up to the
+// event before it. Connections further behind, because envelopes arrived out
+// of order or were lost, first get the events they missed from the database.
+func (m *Manager) sendEvent(envelope Envelope) {
+	m.mutex.Lock()
+	behind := int64(-1)
+	for connID, client := range m.clients[envelope.UserID] {
+		switch {
+		case client.lastSeq >= envelope.Seq:
+			// Already sent while catching up
+		case client.lastSeq < 0 || client.lastSeq == envelope.Seq-1:
+			if !envelope.excludes(connID) {
+				m.sendLocked(client, envelope.Frame)
+			}
+			client.lastSeq = envelope.Seq
+		case behind < 0 || client.lastSeq < behind:
+			behind = client.lastSeq
+		}
+	}
+	m.mutex.Unlock()
+
+	if behind >= 0 {
+		m.catchUp(envelope.UserID, behind, &envelope)
+	}
+}
+
+// catchUp sends the user's connections the events after afterSeq they
+// haven't been sent, up to and including envelope's if it is given, or up to
+// the latest otherwise. Events missing from the database are skipped.
+func (m *Manager) catchUp(userID uuid.UUID, afterSeq int64, envelope *Envelope) {
+	limit := replayBatchSize
+	if envelope != nil {
+		limit = int(envelope.Seq - afterSeq)
+	}
+	events, err := m.db.GetEventsSince(userID, afterSeq, limit)
+	if err != nil {
+		log.Error("Failed to load missed events of user %s: %v", userID, err)
+		return
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	if client, ok := m.clients[userID]; ok {
-		select {
-		case client.Send <- message:
-			log.Debug("Message sent to user %s", userID)
-		default:
-			close(client.Send)
-			delete(m.clients, client.ID)
-			log.Warn("Failed to send message to user %s, removing client", userID)
+	for connID, client := range m.clients[userID] {
+		for _, event := range events {
+			if client.lastSeq < 0 || event.Seq <= client.lastSeq {
+				continue
+			}
+			client.lastSeq = event.Seq
+			if envelope != nil && event.Seq == envelope.Seq && envelope.excludes(connID) {
+				continue
+			}
+			frame, err := eventFrame(event)
+			if err != nil {
+				log.Error("Invalid event %d of user %s: %v", event.Seq, userID, err)
+				continue
+			}
+			m.sendLocked(client, frame)
+		}
+
+		if envelope != nil && client.lastSeq >= 0 && client.lastSeq < envelope.Seq {
+			client.lastSeq = envelope.Seq
+			if !envelope.excludes(connID) {
+				m.sendLocked(client, envelope.Frame)
+			}
 		}
-	} else {
-		log.Debug("User %s not connected", userID)
 	}
 }
 
+// sendLocked queues a frame for a client, dropping the client if its queue
+// is full. The caller must hold m.mutex.
+func (m *Manager) sendLocked(client *Client, frame []byte) {
+	select {
+	case client.Send <- frame:
+		log.Debug("Message sent to user %s (connection %s)", client.ID, client.ConnID)
+	default:
+		m.removeClient(client)
+		log.Warn("Failed to send message to user %s (connection %s), removing client", client.ID, client.ConnID)
+	}
+}
+
+// disconnect closes the connections an envelope names
+func (m *Manager) disconnect(envelope Envelope) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch envelope.Disconnect {
+	case ScopeSession:
+		for _, conns := range m.clients {
+			for _, client := range conns {
+				if client.SessionID == envelope.SessionID {
+					m.removeClient(client)
+					log.Info("Disconnected client %s (connection %s) of revoked session %s", client.ID, client.ConnID, envelope.SessionID)
+				}
+			}
+		}
+	case ScopeUser:
+		for _, client := range m.clients[envelope.UserID] {
+			m.removeClient(client)
+		}
+		log.Info("Disconnected all connections of user %s", envelope.UserID)
+	case ScopeOtherSessions:
+		for _, client := range m.clients[envelope.UserID] {
+			if client.SessionID != envelope.SessionID {
+				m.removeClient(client)
+			}
+		}
+		log.Info("Disconnected connections of user %s outside session %s", envelope.UserID, envelope.SessionID)
+	default:
+		log.Warn("Unknown disconnect scope %q", envelope.Disconnect)
+	}
+}
+
+// ConnectionCounts returns the number of connected users and of their open
+// connections
+func (m *Manager) ConnectionCounts() (users, connections int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, conns := range m.clients {
+		connections += len(conns)
+	}
+	return len(m.clients), connections
+}
+
 // HandleWebSocket handles websocket requests from clients
 func (m *Manager) HandleWebSocket(c *gin.Context) {
 	// Get user ID from context (set by auth middleware or route handler)
@@ -126,6 +558,37 @@ func (m *Manager) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
+	// Tokens tied to a session stop working for new connections as soon as
+	// the session is revoked, even before they expire
+	var sessionID uuid.UUID
+	if value, ok := c.Get("sessionID"); ok {
+		sessionID = value.(uuid.UUID)
+
+		session, err := m.db.GetSession(sessionID)
+		if err != nil && err != database.ErrSessionNotFound {
+			log.Error("Failed to load session %s: %v", sessionID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session"})
+			return
+		}
+		if err != nil || session.RevokedAt != nil {
+			log.Warn("Rejecting connection for revoked session %s from %s", sessionID, c.Request.RemoteAddr)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
+			return
+		}
+	}
+
+	// A reconnecting client passes the seq of the last event it saw to have
+	// the ones it missed replayed
+	lastSeq := int64(-1)
+	if raw := c.Query("last_seq"); raw != "" {
+		seq, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || seq < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "last_seq must be a non-negative integer"})
+			return
+		}
+		lastSeq = seq
+	}
+
 	log.Debug("User authenticated: %s (IP: %s)", userUUID, c.Request.RemoteAddr)
 
 	// Upgrade HTTP connection to WebSocket
@@ -148,13 +611,25 @@ func (m *Manager) HandleWebSocket(c *gin.Context) {
 	}
 
 	client := &Client{
-		ID:     userUUID,
-		Socket: conn,
-		Send:   make(chan []byte, 256),
+		ID:        userUUID,
+		ConnID:    uuid.New(),
+		SessionID: sessionID,
+		Socket:    conn,
+		Send:      make(chan []byte, 256),
+		lastSeq:   -1,
 	}
 
-	m.register <- client
-	log.Debug("Registered client %s with manager", client.ID)
+	if lastSeq >= 0 {
+		if err := m.resume(client, lastSeq); err != nil {
+			log.Error("Failed to replay events for client %s: %v", client.ID, err)
+			client.write(errorFrame("Failed to replay missed events"))
+			conn.Close()
+			return
+		}
+	} else {
+		m.register <- client
+	}
+	log.Debug("Registered client %s (connection %s) with manager", client.ID, client.ConnID)
 
 	// Start goroutines for reading and writing
 	go client.readPump(m)
@@ -162,6 +637,82 @@ func (m *Manager) HandleWebSocket(c *gin.Context) {
 	log.Info("Client %s connected and ready", client.ID)
 }
 
+// resume replays the events a reconnecting client missed after lastSeq,
+// straight to the socket, and ends the replay with a sync frame carrying the
+// seq it got to. The client is then registered to be sent the events that
+// follow, and whatever was stored between the replay and the registration is
+// caught up on, so no event is lost or sent twice whichever instance
+// delivers it.
+func (m *Manager) resume(client *Client, lastSeq int64) error {
+	latest, err := m.db.GetLastEventSeq(client.ID)
+	if err == database.ErrUserNotFound {
+		latest = lastSeq
+	} else if err != nil {
+		return err
+	}
+
+	// A client ahead of the latest event lost its events; it starts over
+	// from the latest
+	seq := min(lastSeq, latest)
+	truncated := seq != lastSeq
+	replayed := false
+	for {
+		batch, err := m.db.GetEventsSince(client.ID, seq, replayBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) > 0 && !replayed {
+			truncated = truncated || batch[0].Seq != seq+1
+			replayed = true
+		}
+		for _, event := range batch {
+			frame, err := eventFrame(event)
+			if err != nil {
+				return err
+			}
+			if err := client.write(frame); err != nil {
+				return err
+			}
+			seq = event.Seq
+		}
+		if len(batch) < replayBatchSize {
+			break
+		}
+	}
+	// With nothing to replay the client should have been up to date; if it
+	// was behind, its events were pruned
+	if !replayed && latest > seq {
+		truncated = true
+		seq = latest
+	}
+
+	syncJSON, _ := json.Marshal(WebSocketMessage{
+		Type:      MessageTypeSync,
+		Seq:       seq,
+		Truncated: truncated,
+		Timestamp: time.Now(),
+	})
+	if err := client.write(syncJSON); err != nil {
+		return err
+	}
+
+	client.lastSeq = seq
+	m.addClient(client)
+	m.catchUp(client.ID, seq, nil)
+	log.Info("Client %s resumed after event %d (replayed up to %d, truncated: %v)", client.ID, lastSeq, seq, truncated)
+	return nil
+}
+
+// eventFrame returns the frame of a stored event stamped with its seq
+func eventFrame(event *models.Event) ([]byte, error) {
+	var message WebSocketMessage
+	if err := json.Unmarshal(event.Payload, &message); err != nil {
+		return nil, err
+	}
+	message.Seq = event.Seq
+	return json.Marshal(message)
+}
+
 // readPump pumps messages from the websocket connection to the manager
 func (c *Client) readPump(m *Manager) {
 	defer func() {
@@ -216,17 +767,15 @@ func (c *Client) readPump(m *Manager) {
 			log.Error("Error unmarshaling message: %v", err)
 
 			// Send error message to client
-			errMsg := WebSocketMessage{
-				Type:      "error",
-				Content:   "Invalid message format",
-				Timestamp: time.Now(),
-			}
-			errJSON, _ := json.Marshal(errMsg)
-			c.Send <- errJSON
+			m.sendError(c, "Invalid message format")
 
 			continue
 		}
 
+		// Any frame shows the user is active, apart from one saying they
+		// stepped away
+		m.markActive(c, wsMessage.Type == MessageTypePresence && wsMessage.Status == models.PresenceAway)
+
 		// Set sender ID and timestamp
 		wsMessage.SenderID = c.ID
 		wsMessage.Timestamp = time.Now()
@@ -239,29 +788,33 @@ func (c *Client) readPump(m *Manager) {
 			// Validate message
 			if wsMessage.Content == "" {
 				log.Debug("Empty message content from client %s", c.ID)
+				m.sendNack(c, wsMessage.ClientMsgID, NackInvalidContent, "Message content is required")
 				continue
 			}
 
-			// Send message to recipient
-			if wsMessage.ReceiverID != uuid.Nil {
-				log.Debug("Forwarding message from client %s to recipient %s", c.ID, wsMessage.ReceiverID)
-				messageJSON, _ := json.Marshal(wsMessage)
-				m.SendToUser(wsMessage.ReceiverID, messageJSON)
-			} else {
-				log.Warn("Invalid receiver ID from client %s", c.ID)
+			if utf8.RuneCountInString(wsMessage.ClientMsgID) > models.MaxClientMsgIDLength {
+				log.Debug("Client message ID too long from client %s", c.ID)
+				m.sendNack(c, "", NackInvalidClientMsgID, "Client message ID is too long")
+				continue
+			}
 
-				// Send error message to client
-				errMsg := WebSocketMessage{
-					Type:      "error",
-					Content:   "Invalid receiver ID",
-					Timestamp: time.Now(),
-				}
-				errJSON, _ := json.Marshal(errMsg)
-				c.Send <- errJSON
+			if wsMessage.ConversationID != uuid.Nil {
+				m.handleGroupMessage(c, wsMessage)
+				continue
+			}
+
+			if wsMessage.ReceiverID == uuid.Nil {
+				log.Warn("Invalid receiver ID from client %s", c.ID)
+				m.sendNack(c, wsMessage.ClientMsgID, NackInvalidReceiver, "Invalid receiver ID")
+				continue
 			}
+
+			m.handleChatMessage(c, wsMessage)
 		case MessageTypeTyping:
 			// Send typing indicator to recipient
-			if wsMessage.ReceiverID != uuid.Nil {
+			if wsMessage.ConversationID != uuid.Nil {
+				m.handleGroupTyping(c, wsMessage)
+			} else if wsMessage.ReceiverID != uuid.Nil {
 				log.Debug("Forwarding typing indicator from client %s to recipient %s (typing: %v)",
 					c.ID, wsMessage.ReceiverID, wsMessage.IsTyping)
 				messageJSON, _ := json.Marshal(wsMessage)
@@ -269,21 +822,147 @@ func (c *Client) readPump(m *Manager) {
 			} else {
 				log.Debug("Invalid receiver ID in typing indicator from client %s", c.ID)
 			}
+		case MessageTypePresence:
+			if wsMessage.Status != models.PresenceOnline && wsMessage.Status != models.PresenceAway {
+				m.sendError(c, "Presence status must be online or away")
+			}
 		default:
 			log.Warn("Unknown message type '%s' from client %s", wsMessage.Type, c.ID)
 
 			// Send error message to client
-			errMsg := WebSocketMessage{
-				Type:      "error",
-				Content:   "Unknown message type",
-				Timestamp: time.Now(),
-			}
-			errJSON, _ := json.Marshal(errMsg)
-			c.Send <- errJSON
+			m.sendError(c, "Unknown message type")
 		}
 	}
 }
 
+// handleChatMessage stores a chat message, acknowledges it to the sender and
+// only then forwards it to the recipient, mirroring the REST send path. A
+// resent message is acknowledged again but not forwarded twice.
+func (m *Manager) handleChatMessage(c *Client, wsMessage WebSocketMessage) {
+	message, created, err := m.db.CreateMessageOnce(c.ID, wsMessage.ReceiverID, wsMessage.Content, wsMessage.ClientMsgID)
+	if err == database.ErrUserNotFound {
+		log.Warn("Unknown receiver %s in message from client %s", wsMessage.ReceiverID, c.ID)
+		m.sendNack(c, wsMessage.ClientMsgID, NackInvalidReceiver, "Invalid receiver ID")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to store message from client %s: %v", c.ID, err)
+		m.sendNack(c, wsMessage.ClientMsgID, NackInternalError, "Failed to send message")
+		return
+	}
+
+	m.sendAck(c, message, wsMessage.ClientMsgID)
+	if !created {
+		log.Debug("Client %s resent message %s", c.ID, message.ID)
+		return
+	}
+
+	log.Debug("Forwarding message %s from client %s to recipient %s", message.ID, c.ID, message.ReceiverID)
+	m.bus.Publish(events.MessageCreated{Message: message, ConnID: c.ConnID})
+}
+
+// handleGroupMessage stores a group message, acknowledges it to the sender and
+// fans it out to the group's online members and the sender's other devices
+func (m *Manager) handleGroupMessage(c *Client, wsMessage WebSocketMessage) {
+	message, created, err := m.db.CreateGroupMessageOnce(c.ID, wsMessage.ConversationID, wsMessage.Content, wsMessage.ClientMsgID)
+	if err == database.ErrGroupNotFound || err == database.ErrNotGroupMember {
+		log.Warn("Client %s can't send to conversation %s: %v", c.ID, wsMessage.ConversationID, err)
+		m.sendNack(c, wsMessage.ClientMsgID, NackInvalidConversation, "Invalid conversation ID")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to store group message from client %s: %v", c.ID, err)
+		m.sendNack(c, wsMessage.ClientMsgID, NackInternalError, "Failed to send message")
+		return
+	}
+
+	m.sendAck(c, message, wsMessage.ClientMsgID)
+	if !created {
+		log.Debug("Client %s resent message %s", c.ID, message.ID)
+		return
+	}
+
+	log.Debug("Forwarding message %s from client %s to conversation %s", message.ID, c.ID, wsMessage.ConversationID)
+	m.bus.Publish(events.MessageCreated{Message: message, ConnID: c.ConnID})
+}
+
+// handleGroupTyping forwards a typing indicator to the other members of a
+// group the sender belongs to
+func (m *Manager) handleGroupTyping(c *Client, wsMessage WebSocketMessage) {
+	group, err := m.db.GetGroupByID(wsMessage.ConversationID)
+	if err != nil || !slices.Contains(group.MemberIDs, c.ID) {
+		log.Debug("Invalid conversation ID in typing indicator from client %s", c.ID)
+		return
+	}
+
+	others := slices.DeleteFunc(group.MemberIDs, func(id uuid.UUID) bool { return id == c.ID })
+	messageJSON, _ := json.Marshal(wsMessage)
+	m.SendToUsers(others, uuid.Nil, messageJSON)
+}
+
+// sendAck acknowledges a stored message to the client so the sender learns
+// its server ID and timestamp
+func (m *Manager) sendAck(c *Client, message *models.Message, clientMsgID string) {
+	ack := WebSocketMessage{
+		Type:        MessageTypeAck,
+		MessageID:   message.ID,
+		ClientMsgID: clientMsgID,
+		Message:     message,
+		Timestamp:   message.CreatedAt,
+	}
+	ackJSON, _ := json.Marshal(ack)
+	m.reply(c, ackJSON)
+}
+
+// sendNack tells the client a message wasn't stored and why
+func (m *Manager) sendNack(c *Client, clientMsgID, code, content string) {
+	nack := WebSocketMessage{
+		Type:        MessageTypeNack,
+		ClientMsgID: clientMsgID,
+		Code:        code,
+		Content:     content,
+		Timestamp:   time.Now(),
+	}
+	nackJSON, _ := json.Marshal(nack)
+	m.reply(c, nackJSON)
+}
+
+// sendError queues an error frame for the client
+func (m *Manager) sendError(c *Client, content string) {
+	m.reply(c, errorFrame(content))
+}
+
+// reply queues a frame for the client from its read pump. The connection
+// may have been closed meanwhile, such as when its session was revoked, and
+// then the frame is dropped.
+func (m *Manager) reply(c *Client, frame []byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if c.closed {
+		return
+	}
+	m.sendLocked(c, frame)
+}
+
+// errorFrame builds an error frame
+func errorFrame(content string) []byte {
+	errMsg := WebSocketMessage{
+		Type:      MessageTypeError,
+		Content:   content,
+		Timestamp: time.Now(),
+	}
+	errJSON, _ := json.Marshal(errMsg)
+	return errJSON
+}
+
+// write sends a frame straight to the socket. It is only safe before
+// writePump starts.
+func (c *Client) write(message []byte) error {
+	c.Socket.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.Socket.WriteMessage(websocket.TextMessage, message)
+}
+
 // writePump pumps messages from the manager to the websocket connection
 func (c *Client) writePump() {
 	ticker := time.NewTicker(54 * time.Second)
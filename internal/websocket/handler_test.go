@@ -1,14 +1,19 @@
 package websocket
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ammar1510/converse/internal/auth"
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
 	"github.com/ammar1510/converse/internal/models"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -17,15 +22,76 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// stubDB records created messages without requiring their users to exist;
+// methods not overridden here go to an empty in-memory database
+type stubDB struct {
+	database.DBInterface
+	mu           sync.Mutex
+	messages     []*models.Message
+	clientMsgIDs []string // the client message ID of each message
+	err          error
+}
+
+func newStubDB() *stubDB {
+	return &stubDB{DBInterface: database.NewMemoryDB()}
+}
+
+// CreateMessageOnce stores the message in memory unless the sender already
+// sent one with the same client message ID
+func (s *stubDB) CreateMessageOnce(senderID, receiverID uuid.UUID, content, clientMsgID string) (*models.Message, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return nil, false, s.err
+	}
+
+	if clientMsgID != "" {
+		for i, message := range s.messages {
+			if message.SenderID == senderID && s.clientMsgIDs[i] == clientMsgID {
+				return message, false, nil
+			}
+		}
+	}
+
+	message := &models.Message{
+		ID:         uuid.New(),
+		SenderID:   senderID,
+		ReceiverID: receiverID,
+		Content:    content,
+		CreatedAt:  time.Now().UTC(),
+	}
+	s.messages = append(s.messages, message)
+	s.clientMsgIDs = append(s.clientMsgIDs, clientMsgID)
+	return message, true, nil
+}
+
+// storedMessages returns a snapshot of the stored messages
+func (s *stubDB) storedMessages() []*models.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*models.Message(nil), s.messages...)
+}
+
 // setupTestRouter creates a test Gin router with the WebSocket handler
 func setupTestRouter() (*gin.Engine, *Manager) {
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
+	return setupTestRouterWithDB(newStubDB())
+}
 
+// setupTestRouterWithDB creates a test Gin router whose manager persists to db
+func setupTestRouterWithDB(db database.DBInterface) (*gin.Engine, *Manager) {
 	// Create WebSocket manager
-	manager := NewManager()
+	manager := NewManager(db, events.NewBus())
 	go manager.Run()
 
+	return setupTestRouterWithManager(manager), manager
+}
+
+// setupTestRouterWithManager creates a test Gin router for a running manager
+func setupTestRouterWithManager(manager *Manager) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
 	// Add test middleware to set user ID in context
 	router.GET("/ws", func(c *gin.Context) {
 		// Set a test user ID in the context
@@ -34,6 +100,37 @@ func setupTestRouter() (*gin.Engine, *Manager) {
 		c.Next()
 	}, manager.HandleWebSocket)
 
+	// Add a route that lets tests choose the connecting user's ID
+	router.GET("/ws-user", func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+		c.Set("userID", userID)
+		c.Next()
+	}, manager.HandleWebSocket)
+
+	// Add a route that lets tests choose the connecting user and session
+	router.GET("/ws-session", func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+		sessionID, err := uuid.Parse(c.Query("session_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+			c.Abort()
+			return
+		}
+		c.Set("userID", userID)
+		c.Set("sessionID", sessionID)
+		c.Next()
+	}, manager.HandleWebSocket)
+
 	// Add a route with JWT auth middleware for testing
 	router.GET("/ws-auth", func(c *gin.Context) {
 		// Extract Authorization header
@@ -56,7 +153,7 @@ func setupTestRouter() (*gin.Engine, *Manager) {
 		c.Next()
 	}, manager.HandleWebSocket)
 
-	return router, manager
+	return router
 }
 
 // createTestClient creates a test WebSocket client
@@ -69,9 +166,57 @@ func createTestClient(t *testing.T, url string) (*websocket.Conn, *http.Response
 	return ws, resp
 }
 
+// pendingFrames holds frames that arrived in the same message as one a test
+// read but haven't been read themselves yet
+var (
+	pendingMu     sync.Mutex
+	pendingFrames = make(map[*websocket.Conn][]WebSocketMessage)
+)
+
+// nextTestFrame returns the next frame from ws, splitting messages that carry
+// several queued frames. The caller sets the read deadline.
+func nextTestFrame(t *testing.T, ws *websocket.Conn) WebSocketMessage {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	if len(pendingFrames[ws]) == 0 {
+		_, data, err := ws.ReadMessage()
+		require.NoError(t, err)
+
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			var message WebSocketMessage
+			require.NoError(t, json.Unmarshal(line, &message))
+			pendingFrames[ws] = append(pendingFrames[ws], message)
+		}
+	}
+
+	message := pendingFrames[ws][0]
+	pendingFrames[ws] = pendingFrames[ws][1:]
+	return message
+}
+
+// readTestMessage reads and decodes the next frame from ws, failing after a
+// timeout. Presence updates are skipped; readTestPresence reads those.
+func readTestMessage(t *testing.T, ws *websocket.Conn) WebSocketMessage {
+	return readTestFrames(t, ws, 1)[0]
+}
+
+// readTestPresence reads frames from ws until a presence update arrives
+func readTestPresence(t *testing.T, ws *websocket.Conn) WebSocketMessage {
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+
+	for {
+		message := nextTestFrame(t, ws)
+		if message.Type == MessageTypePresence {
+			return message
+		}
+	}
+}
+
 // TestNewManager tests the creation of a new WebSocket manager
 func TestNewManager(t *testing.T) {
-	manager := NewManager()
+	manager := NewManager(newStubDB(), events.NewBus())
 
 	assert.NotNil(t, manager)
 	assert.NotNil(t, manager.clients)
@@ -82,7 +227,7 @@ func TestNewManager(t *testing.T) {
 
 // TestManagerRun tests the manager's Run method
 func TestManagerRun(t *testing.T) {
-	manager := NewManager()
+	manager := NewManager(newStubDB(), events.NewBus())
 
 	// Start the manager in a goroutine
 	go manager.Run()
@@ -119,7 +264,7 @@ func TestManagerRun(t *testing.T) {
 
 // TestSendToUser tests sending a message to a specific user
 func TestSendToUser(t *testing.T) {
-	manager := NewManager()
+	manager := NewManager(newStubDB(), events.NewBus())
 
 	// Start the manager in a goroutine
 	go manager.Run()
@@ -187,28 +332,21 @@ func TestWebSocketMessageExchange(t *testing.T) {
 	defer server.Close()
 
 	// Convert http:// to ws://
-	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-user?user_id="
 
-	// Connect two clients to the WebSocket server
-	ws1, _ := createTestClient(t, wsURL)
+	// Connect two clients with known IDs to the WebSocket server
+	client1ID, client2ID := uuid.New(), uuid.New()
+	ws1, _ := createTestClient(t, wsURL+client1ID.String())
 	defer ws1.Close()
 
-	ws2, _ := createTestClient(t, wsURL)
+	ws2, _ := createTestClient(t, wsURL+client2ID.String())
 	defer ws2.Close()
 
 	// Wait for the clients to be registered
 	time.Sleep(100 * time.Millisecond)
 
-	// Get the client IDs
 	manager.mutex.Lock()
-	var client1ID, client2ID uuid.UUID
-	for id := range manager.clients {
-		if client1ID == uuid.Nil {
-			client1ID = id
-		} else {
-			client2ID = id
-		}
-	}
+	assert.Equal(t, 2, len(manager.clients))
 	manager.mutex.Unlock()
 
 	// Create a test message
@@ -261,6 +399,7 @@ func TestWebSocketMessageExchange(t *testing.T) {
 			assert.Equal(t, client1ID, receivedMessage.SenderID)
 			assert.Equal(t, client2ID, receivedMessage.ReceiverID)
 			assert.Equal(t, "Hello, client2!", receivedMessage.Content)
+			assert.NotEqual(t, uuid.Nil, receivedMessage.MessageID)
 		} else {
 			t.Fatal("Failed to receive or parse message")
 		}
@@ -276,6 +415,610 @@ func TestWebSocketMessageExchange(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 }
 
+// TestMessagePersistedBeforeForwarding tests that WebSocket messages are stored,
+// acknowledged to the sender and forwarded with the stored ID
+func TestMessagePersistedBeforeForwarding(t *testing.T) {
+	db := newStubDB()
+	router, _ := setupTestRouterWithDB(db)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-user?user_id="
+
+	senderID, receiverID := uuid.New(), uuid.New()
+	sender, _ := createTestClient(t, wsURL+senderID.String())
+	defer sender.Close()
+
+	receiver, _ := createTestClient(t, wsURL+receiverID.String())
+	defer receiver.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	messageJSON, err := json.Marshal(WebSocketMessage{
+		Type:       MessageTypeMessage,
+		ReceiverID: receiverID,
+		Content:    "stored first",
+	})
+	require.NoError(t, err)
+	require.NoError(t, sender.WriteMessage(websocket.TextMessage, messageJSON))
+
+	// The sender is acknowledged with the stored message
+	ack := readTestMessage(t, sender)
+	assert.Equal(t, MessageTypeAck, ack.Type)
+	require.NotNil(t, ack.Message)
+
+	stored := db.storedMessages()
+	require.Len(t, stored, 1)
+	assert.Equal(t, stored[0].ID, ack.Message.ID)
+	assert.Equal(t, senderID, ack.Message.SenderID)
+	assert.Equal(t, receiverID, ack.Message.ReceiverID)
+	assert.Equal(t, "stored first", ack.Message.Content)
+
+	// The receiver gets the message carrying the server ID
+	forwarded := readTestMessage(t, receiver)
+	assert.Equal(t, MessageTypeMessage, forwarded.Type)
+	assert.Equal(t, stored[0].ID, forwarded.MessageID)
+	assert.Equal(t, senderID, forwarded.SenderID)
+	assert.Equal(t, "stored first", forwarded.Content)
+
+	// A failed store is reported to the sender and nothing is forwarded
+	db.mu.Lock()
+	db.err = database.ErrUserNotFound
+	db.mu.Unlock()
+
+	require.NoError(t, sender.WriteMessage(websocket.TextMessage, messageJSON))
+
+	nack := readTestMessage(t, sender)
+	assert.Equal(t, MessageTypeNack, nack.Type)
+	assert.Equal(t, NackInvalidReceiver, nack.Code)
+	assert.Equal(t, "Invalid receiver ID", nack.Content)
+
+	receiver.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, _, err = receiver.ReadMessage()
+	assert.Error(t, err, "receiver should not get a message that was not stored")
+}
+
+// TestClientMessageIDs tests that a resent message is acknowledged with the
+// stored message but not stored or forwarded again, and that rejected
+// messages get a nack
+func TestClientMessageIDs(t *testing.T) {
+	db := newStubDB()
+	router, _ := setupTestRouterWithDB(db)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-user?user_id="
+
+	senderID, receiverID := uuid.New(), uuid.New()
+	sender, _ := createTestClient(t, wsURL+senderID.String())
+	defer sender.Close()
+
+	receiver, _ := createTestClient(t, wsURL+receiverID.String())
+	defer receiver.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	send := func(message WebSocketMessage) WebSocketMessage {
+		message.Type = MessageTypeMessage
+		messageJSON, err := json.Marshal(message)
+		require.NoError(t, err)
+		require.NoError(t, sender.WriteMessage(websocket.TextMessage, messageJSON))
+		return readTestMessage(t, sender)
+	}
+
+	message := WebSocketMessage{ReceiverID: receiverID, Content: "only once", ClientMsgID: "c-1"}
+	ack := send(message)
+	assert.Equal(t, MessageTypeAck, ack.Type)
+	assert.Equal(t, "c-1", ack.ClientMsgID)
+	require.NotNil(t, ack.Message)
+	assert.Equal(t, ack.Message.ID, ack.MessageID)
+	assert.True(t, ack.Message.CreatedAt.Equal(ack.Timestamp))
+	assert.Equal(t, ack.MessageID, readTestMessage(t, receiver).MessageID)
+
+	retry := send(message)
+	assert.Equal(t, MessageTypeAck, retry.Type)
+	assert.Equal(t, ack.MessageID, retry.MessageID)
+	assert.True(t, ack.Timestamp.Equal(retry.Timestamp))
+	assert.Len(t, db.storedMessages(), 1)
+
+	receiver.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, _, err := receiver.ReadMessage()
+	assert.Error(t, err, "a resent message should not be forwarded again")
+
+	// Rejected messages
+	nack := send(WebSocketMessage{ReceiverID: receiverID, ClientMsgID: "c-2"})
+	assert.Equal(t, MessageTypeNack, nack.Type)
+	assert.Equal(t, NackInvalidContent, nack.Code)
+	assert.Equal(t, "c-2", nack.ClientMsgID)
+
+	nack = send(WebSocketMessage{Content: "to nobody", ClientMsgID: "c-3"})
+	assert.Equal(t, NackInvalidReceiver, nack.Code)
+	assert.Equal(t, "c-3", nack.ClientMsgID)
+
+	nack = send(WebSocketMessage{ReceiverID: receiverID, Content: "hi", ClientMsgID: strings.Repeat("x", 65)})
+	assert.Equal(t, NackInvalidClientMsgID, nack.Code)
+
+	db.mu.Lock()
+	db.err = errors.New("database down")
+	db.mu.Unlock()
+	nack = send(WebSocketMessage{ReceiverID: receiverID, Content: "hi", ClientMsgID: "c-4"})
+	assert.Equal(t, NackInternalError, nack.Code)
+	assert.Equal(t, "c-4", nack.ClientMsgID)
+}
+
+// TestMultipleConnectionsPerUser tests that a user can be connected from
+// several devices and that every device stays in sync
+func TestMultipleConnectionsPerUser(t *testing.T) {
+	router, manager := setupTestRouter()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-user?user_id="
+
+	userID, peerID := uuid.New(), uuid.New()
+	laptop, _ := createTestClient(t, wsURL+userID.String())
+	defer laptop.Close()
+
+	phone, _ := createTestClient(t, wsURL+userID.String())
+	defer phone.Close()
+
+	peer, _ := createTestClient(t, wsURL+peerID.String())
+	defer peer.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Both devices are tracked under the same user
+	manager.mutex.Lock()
+	assert.Equal(t, 2, len(manager.clients))
+	assert.Equal(t, 2, len(manager.clients[userID]))
+	manager.mutex.Unlock()
+
+	// Messages for the user reach every device
+	messageJSON, err := json.Marshal(WebSocketMessage{
+		Type:       MessageTypeMessage,
+		ReceiverID: userID,
+		Content:    "hi from peer",
+	})
+	require.NoError(t, err)
+	require.NoError(t, peer.WriteMessage(websocket.TextMessage, messageJSON))
+
+	assert.Equal(t, MessageTypeAck, readTestMessage(t, peer).Type)
+	assert.Equal(t, "hi from peer", readTestMessage(t, laptop).Content)
+	assert.Equal(t, "hi from peer", readTestMessage(t, phone).Content)
+
+	// A message sent from one device is echoed to the user's other devices
+	messageJSON, err = json.Marshal(WebSocketMessage{
+		Type:       MessageTypeMessage,
+		ReceiverID: peerID,
+		Content:    "hi from laptop",
+	})
+	require.NoError(t, err)
+	require.NoError(t, laptop.WriteMessage(websocket.TextMessage, messageJSON))
+
+	ack := readTestMessage(t, laptop)
+	assert.Equal(t, MessageTypeAck, ack.Type)
+	require.NotNil(t, ack.Message)
+
+	echo := readTestMessage(t, phone)
+	assert.Equal(t, MessageTypeMessage, echo.Type)
+	assert.Equal(t, ack.Message.ID, echo.MessageID)
+	assert.Equal(t, userID, echo.SenderID)
+	assert.Equal(t, "hi from laptop", readTestMessage(t, peer).Content)
+
+	// Closing one device keeps the other connected
+	laptop.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	manager.mutex.Lock()
+	assert.Equal(t, 1, len(manager.clients[userID]))
+	manager.mutex.Unlock()
+
+	manager.SendToUser(userID, []byte(`{"type":"message","content":"still here"}`))
+	assert.Equal(t, "still here", readTestMessage(t, phone).Content)
+}
+
+// TestDisconnectSession tests that revoking a session closes its connections
+// and keeps it from reconnecting
+func TestDisconnectSession(t *testing.T) {
+	db := database.NewMemoryDB()
+	router, manager := setupTestRouterWithDB(db)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	user, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+
+	now := time.Now()
+	laptopSession := &models.Session{ID: uuid.New(), UserID: user.ID, CreatedAt: now, LastUsedAt: now}
+	phoneSession := &models.Session{ID: uuid.New(), UserID: user.ID, CreatedAt: now, LastUsedAt: now}
+	require.NoError(t, db.CreateSession(laptopSession))
+	require.NoError(t, db.CreateSession(phoneSession))
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-session?user_id=" + user.ID.String() + "&session_id="
+
+	laptop, _ := createTestClient(t, wsURL+laptopSession.ID.String())
+	defer laptop.Close()
+
+	phone, _ := createTestClient(t, wsURL+phoneSession.ID.String())
+	defer phone.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	require.NoError(t, db.RevokeSession(laptopSession.ID))
+	manager.DisconnectSession(laptopSession.ID)
+
+	// The revoked session's connection is closed
+	laptop.SetReadDeadline(time.Now().Add(1 * time.Second))
+	_, _, err = laptop.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNoStatusReceived), "unexpected error: %v", err)
+
+	// The other session stays connected
+	manager.SendToUser(user.ID, []byte(`{"type":"message","content":"still here"}`))
+	assert.Equal(t, "still here", readTestMessage(t, phone).Content)
+
+	manager.mutex.Lock()
+	assert.Equal(t, 1, len(manager.clients[user.ID]))
+	manager.mutex.Unlock()
+
+	// Tokens of the revoked session can't open new connections
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL+laptopSession.ID.String(), nil)
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// TestGroupMessageFanOut tests that group messages and typing indicators
+// reach every online member and nobody else
+func TestGroupMessageFanOut(t *testing.T) {
+	db := database.NewMemoryDB()
+	router, _ := setupTestRouterWithDB(db)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	carol, err := db.CreateUser("carol", "carol@example.com", "hash")
+	require.NoError(t, err)
+	dave, err := db.CreateUser("dave", "dave@example.com", "hash")
+	require.NoError(t, err)
+
+	group, err := db.CreateGroup(alice.ID, "Weekend", []uuid.UUID{bob.ID, carol.ID})
+	require.NoError(t, err)
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-user?user_id="
+
+	aliceLaptop, _ := createTestClient(t, wsURL+alice.ID.String())
+	defer aliceLaptop.Close()
+	alicePhone, _ := createTestClient(t, wsURL+alice.ID.String())
+	defer alicePhone.Close()
+	bobWS, _ := createTestClient(t, wsURL+bob.ID.String())
+	defer bobWS.Close()
+	carolWS, _ := createTestClient(t, wsURL+carol.ID.String())
+	defer carolWS.Close()
+	daveWS, _ := createTestClient(t, wsURL+dave.ID.String())
+	defer daveWS.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	messageJSON, err := json.Marshal(WebSocketMessage{
+		Type:           MessageTypeMessage,
+		ConversationID: group.ID,
+		Content:        "hi all",
+	})
+	require.NoError(t, err)
+	require.NoError(t, aliceLaptop.WriteMessage(websocket.TextMessage, messageJSON))
+
+	ack := readTestMessage(t, aliceLaptop)
+	assert.Equal(t, MessageTypeAck, ack.Type)
+	require.NotNil(t, ack.Message)
+	require.NotNil(t, ack.Message.ConversationID)
+	assert.Equal(t, group.ID, *ack.Message.ConversationID)
+
+	for _, ws := range []*websocket.Conn{alicePhone, bobWS, carolWS} {
+		forwarded := readTestMessage(t, ws)
+		assert.Equal(t, MessageTypeMessage, forwarded.Type)
+		assert.Equal(t, ack.Message.ID, forwarded.MessageID)
+		assert.Equal(t, group.ID, forwarded.ConversationID)
+		assert.Equal(t, "hi all", forwarded.Content)
+	}
+
+	// Typing indicators go to the other members
+	typingJSON, err := json.Marshal(WebSocketMessage{
+		Type:           MessageTypeTyping,
+		ConversationID: group.ID,
+		IsTyping:       true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, bobWS.WriteMessage(websocket.TextMessage, typingJSON))
+
+	typing := readTestMessage(t, carolWS)
+	assert.Equal(t, MessageTypeTyping, typing.Type)
+	assert.Equal(t, bob.ID, typing.SenderID)
+	assert.Equal(t, group.ID, typing.ConversationID)
+
+	// Non-members can't post to the group
+	require.NoError(t, daveWS.WriteMessage(websocket.TextMessage, messageJSON))
+	nack := readTestMessage(t, daveWS)
+	assert.Equal(t, MessageTypeNack, nack.Type)
+	assert.Equal(t, NackInvalidConversation, nack.Code)
+	assert.Equal(t, "Invalid conversation ID", nack.Content)
+
+	// Dave never hears from the group
+	daveWS.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, _, err = daveWS.ReadMessage()
+	assert.Error(t, err, "non-members should not get group traffic")
+}
+
+// readTestFrames reads the next n frames from ws other than presence updates
+func readTestFrames(t *testing.T, ws *websocket.Conn, n int) []WebSocketMessage {
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+
+	var frames []WebSocketMessage
+	for len(frames) < n {
+		message := nextTestFrame(t, ws)
+		if message.Type != MessageTypePresence {
+			frames = append(frames, message)
+		}
+	}
+	return frames
+}
+
+// TestResume tests that events are numbered per user and that a client
+// reconnecting with last_seq gets the ones it missed before live ones
+func TestResume(t *testing.T) {
+	db := database.NewMemoryDB()
+	router, manager := setupTestRouterWithDB(db)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-user?user_id="
+
+	// Alice is offline; her messages are kept
+	for _, content := range []string{"one", "two", "three"} {
+		message, err := db.CreateMessage(bob.ID, alice.ID, content)
+		require.NoError(t, err)
+		manager.Deliver(alice.ID, NewChatMessage(message))
+	}
+
+	aliceWS, _ := createTestClient(t, wsURL+alice.ID.String()+"&last_seq=1")
+	defer aliceWS.Close()
+
+	frames := readTestFrames(t, aliceWS, 3)
+	assert.Equal(t, "two", frames[0].Content)
+	assert.Equal(t, int64(2), frames[0].Seq)
+	assert.Equal(t, "three", frames[1].Content)
+	assert.Equal(t, int64(3), frames[1].Seq)
+	assert.Equal(t, MessageTypeSync, frames[2].Type)
+	assert.Equal(t, int64(3), frames[2].Seq)
+	assert.False(t, frames[2].Truncated)
+
+	// Then live events, numbered on
+	bobWS, _ := createTestClient(t, wsURL+bob.ID.String())
+	defer bobWS.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	messageJSON, err := json.Marshal(WebSocketMessage{
+		Type:       MessageTypeMessage,
+		ReceiverID: alice.ID,
+		Content:    "four",
+	})
+	require.NoError(t, err)
+	require.NoError(t, bobWS.WriteMessage(websocket.TextMessage, messageJSON))
+	assert.Equal(t, MessageTypeAck, readTestMessage(t, bobWS).Type)
+
+	live := readTestMessage(t, aliceWS)
+	assert.Equal(t, "four", live.Content)
+	assert.Equal(t, int64(4), live.Seq)
+
+	// Typing indicators aren't stored
+	typingJSON, err := json.Marshal(WebSocketMessage{Type: MessageTypeTyping, ReceiverID: alice.ID, IsTyping: true})
+	require.NoError(t, err)
+	require.NoError(t, bobWS.WriteMessage(websocket.TextMessage, typingJSON))
+	typing := readTestMessage(t, aliceWS)
+	assert.Equal(t, MessageTypeTyping, typing.Type)
+	assert.Zero(t, typing.Seq)
+
+	// An up to date client just gets the sync frame
+	aliceWS2, _ := createTestClient(t, wsURL+alice.ID.String()+"&last_seq=4")
+	defer aliceWS2.Close()
+	sync := readTestMessage(t, aliceWS2)
+	assert.Equal(t, MessageTypeSync, sync.Type)
+	assert.Equal(t, int64(4), sync.Seq)
+	assert.False(t, sync.Truncated)
+
+	// Clients that stayed away past the retention are told what they missed
+	// is gone
+	require.NoError(t, db.PruneEvents(time.Now().Add(time.Hour)))
+	aliceWS3, _ := createTestClient(t, wsURL+alice.ID.String()+"&last_seq=2")
+	defer aliceWS3.Close()
+	sync = readTestMessage(t, aliceWS3)
+	assert.Equal(t, MessageTypeSync, sync.Type)
+	assert.Equal(t, int64(4), sync.Seq)
+	assert.True(t, sync.Truncated)
+
+	for _, bad := range []string{"-1", "abc"} {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL+alice.ID.String()+"&last_seq="+bad, nil)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, bad)
+	}
+}
+
+// TestResumeWhileDelivering tests that events delivered while a client
+// catches up on a long backlog arrive once each and in order
+func TestResumeWhileDelivering(t *testing.T) {
+	db := database.NewMemoryDB()
+	router, manager := setupTestRouterWithDB(db)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+
+	const backlog, live = 3 * replayBatchSize, 200
+	for i := 0; i < backlog; i++ {
+		manager.Deliver(alice.ID, WebSocketMessage{Type: MessageTypeMessage, Content: "offline"})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < live; i++ {
+			manager.Deliver(alice.ID, WebSocketMessage{Type: MessageTypeMessage, Content: "live"})
+		}
+	}()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-user?user_id=" + alice.ID.String() + "&last_seq=0"
+	aliceWS, _ := createTestClient(t, wsURL)
+	defer aliceWS.Close()
+	<-done
+
+	// Every event once, in order, with the sync frame somewhere among them
+	frames := readTestFrames(t, aliceWS, backlog+live+1)
+	seq := int64(0)
+	for _, frame := range frames {
+		if frame.Type == MessageTypeSync {
+			assert.Equal(t, seq, frame.Seq)
+			assert.False(t, frame.Truncated)
+			continue
+		}
+		seq++
+		assert.Equal(t, seq, frame.Seq)
+	}
+	assert.Equal(t, int64(backlog+live), seq)
+}
+
+// TestPresence tests that conversation partners hear when a user comes
+// online, steps away and goes offline, and that going offline records when
+// the user was last seen
+func TestPresence(t *testing.T) {
+	db := database.NewMemoryDB()
+	router, manager := setupTestRouterWithDB(db)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	carol, err := db.CreateUser("carol", "carol@example.com", "hash")
+	require.NoError(t, err)
+	_, err = db.CreateMessage(alice.ID, bob.ID, "hi")
+	require.NoError(t, err)
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-user?user_id="
+
+	bobWS, _ := createTestClient(t, wsURL+bob.ID.String())
+	defer bobWS.Close()
+	carolWS, _ := createTestClient(t, wsURL+carol.ID.String())
+	defer carolWS.Close()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, models.PresenceOffline, manager.Presence(alice.ID))
+
+	aliceLaptop, _ := createTestClient(t, wsURL+alice.ID.String())
+	presence := readTestPresence(t, bobWS)
+	assert.Equal(t, alice.ID, presence.UserID)
+	assert.Equal(t, models.PresenceOnline, presence.Status)
+	assert.Nil(t, presence.LastSeen)
+	assert.Equal(t, models.PresenceOnline, manager.Presence(alice.ID))
+
+	alicePhone, _ := createTestClient(t, wsURL+alice.ID.String())
+	time.Sleep(100 * time.Millisecond)
+
+	// Alice is away once every device says so
+	awayJSON, err := json.Marshal(WebSocketMessage{Type: MessageTypePresence, Status: models.PresenceAway})
+	require.NoError(t, err)
+	require.NoError(t, aliceLaptop.WriteMessage(websocket.TextMessage, awayJSON))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, models.PresenceOnline, manager.Presence(alice.ID))
+	require.NoError(t, alicePhone.WriteMessage(websocket.TextMessage, awayJSON))
+
+	presence = readTestPresence(t, bobWS)
+	assert.Equal(t, models.PresenceAway, presence.Status)
+	assert.Equal(t, models.PresenceAway, manager.Presence(alice.ID))
+
+	// Any other frame brings her back
+	typingJSON, err := json.Marshal(WebSocketMessage{Type: MessageTypeTyping, ReceiverID: bob.ID, IsTyping: true})
+	require.NoError(t, err)
+	require.NoError(t, alicePhone.WriteMessage(websocket.TextMessage, typingJSON))
+	presence = readTestPresence(t, bobWS)
+	assert.Equal(t, models.PresenceOnline, presence.Status)
+
+	badJSON, err := json.Marshal(WebSocketMessage{Type: MessageTypePresence, Status: models.PresenceOffline})
+	require.NoError(t, err)
+	require.NoError(t, alicePhone.WriteMessage(websocket.TextMessage, badJSON))
+	assert.Equal(t, MessageTypeError, readTestMessage(t, alicePhone).Type)
+
+	// She is offline when her last connection closes
+	before := time.Now()
+	aliceLaptop.Close()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, models.PresenceOnline, manager.Presence(alice.ID))
+	alicePhone.Close()
+	presence = readTestPresence(t, bobWS)
+	assert.Equal(t, alice.ID, presence.UserID)
+	assert.Equal(t, models.PresenceOffline, presence.Status)
+	require.NotNil(t, presence.LastSeen)
+	assert.False(t, presence.LastSeen.Before(before))
+
+	user, err := db.GetUserByID(alice.ID)
+	require.NoError(t, err)
+	assert.False(t, user.LastSeen.Before(before))
+
+	// Carol doesn't talk to alice and hears nothing
+	carolWS.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, _, err = carolWS.ReadMessage()
+	assert.Error(t, err, "users who aren't partners should not get presence updates")
+}
+
+// TestPresenceIdle tests that users whose connections go quiet show as away
+func TestPresenceIdle(t *testing.T) {
+	db := database.NewMemoryDB()
+	manager := NewManager(db, events.NewBus())
+	manager.AwayAfter = 200 * time.Millisecond
+	go manager.Run()
+	server := httptest.NewServer(setupTestRouterWithManager(manager))
+	defer server.Close()
+
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+	_, err = db.CreateMessage(alice.ID, bob.ID, "hi")
+	require.NoError(t, err)
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-user?user_id="
+
+	bobWS, _ := createTestClient(t, wsURL+bob.ID.String())
+	defer bobWS.Close()
+	time.Sleep(50 * time.Millisecond)
+	aliceWS, _ := createTestClient(t, wsURL+alice.ID.String())
+	defer aliceWS.Close()
+
+	nextStatus := func() models.PresenceStatus {
+		for {
+			presence := readTestPresence(t, bobWS)
+			if presence.UserID == alice.ID {
+				return presence.Status
+			}
+		}
+	}
+	assert.Equal(t, models.PresenceOnline, nextStatus())
+	assert.Equal(t, models.PresenceAway, nextStatus())
+
+	heartbeatJSON, err := json.Marshal(WebSocketMessage{Type: MessageTypePresence, Status: models.PresenceOnline})
+	require.NoError(t, err)
+	require.NoError(t, aliceWS.WriteMessage(websocket.TextMessage, heartbeatJSON))
+	assert.Equal(t, models.PresenceOnline, nextStatus())
+}
+
 // TestTypingIndicator tests the typing indicator functionality
 func TestTypingIndicator(t *testing.T) {
 	// Setup test server
@@ -284,28 +1027,21 @@ func TestTypingIndicator(t *testing.T) {
 	defer server.Close()
 
 	// Convert http:// to ws://
-	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws-user?user_id="
 
-	// Connect two clients to the WebSocket server
-	ws1, _ := createTestClient(t, wsURL)
+	// Connect two clients with known IDs to the WebSocket server
+	client1ID, client2ID := uuid.New(), uuid.New()
+	ws1, _ := createTestClient(t, wsURL+client1ID.String())
 	defer ws1.Close()
 
-	ws2, _ := createTestClient(t, wsURL)
+	ws2, _ := createTestClient(t, wsURL+client2ID.String())
 	defer ws2.Close()
 
 	// Wait for the clients to be registered
 	time.Sleep(100 * time.Millisecond)
 
-	// Get the client IDs
 	manager.mutex.Lock()
-	var client1ID, client2ID uuid.UUID
-	for id := range manager.clients {
-		if client1ID == uuid.Nil {
-			client1ID = id
-		} else {
-			client2ID = id
-		}
-	}
+	assert.Equal(t, 2, len(manager.clients))
 	manager.mutex.Unlock()
 
 	// Create a typing indicator message
@@ -406,6 +1142,25 @@ func TestClientDisconnect(t *testing.T) {
 	manager.mutex.Unlock()
 }
 
+// TestReplyAfterDisconnect tests that a frame the read pump queues after its
+// connection was closed, such as an ack racing a session revocation, is
+// dropped instead of sent on the closed channel
+func TestReplyAfterDisconnect(t *testing.T) {
+	manager := NewManager(newStubDB(), events.NewBus())
+	client := &Client{ID: uuid.New(), ConnID: uuid.New(), SessionID: uuid.New(), Send: make(chan []byte, 1), lastSeq: -1}
+	manager.addClient(client)
+
+	manager.DisconnectSession(client.SessionID)
+	_, ok := <-client.Send
+	require.False(t, ok)
+
+	assert.NotPanics(t, func() {
+		manager.sendError(client, "too late")
+		manager.sendNack(client, "id", NackInternalError, "too late")
+		manager.sendAck(client, &models.Message{ID: uuid.New()}, "id")
+	})
+}
+
 // TestAuthenticationHandling tests the authentication handling in the WebSocket connection
 func TestAuthenticationHandling(t *testing.T) {
 	// Setup test server
@@ -435,7 +1190,7 @@ func TestUnauthorizedAccess(t *testing.T) {
 	router := gin.New()
 
 	// Create WebSocket manager
-	manager := NewManager()
+	manager := NewManager(newStubDB(), events.NewBus())
 	go manager.Run()
 
 	// Add handler without setting userID in context
@@ -658,7 +1413,7 @@ func TestJWTProtocolAuthentication(t *testing.T) {
 	router := gin.New()
 
 	// Create WebSocket manager
-	manager := NewManager()
+	manager := NewManager(newStubDB(), events.NewBus())
 	go manager.Run()
 
 	// Add handler without the auth middleware to test protocol authentication
@@ -864,7 +1619,7 @@ func TestWebSocketTokenURLAuth(t *testing.T) {
 	router := gin.New()
 
 	// Create WebSocket manager
-	manager := NewManager()
+	manager := NewManager(newStubDB(), events.NewBus())
 	go manager.Run()
 
 	// Add handler with token URL authentication
@@ -0,0 +1,201 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/ammar1510/converse/internal/database"
+)
+
+const (
+	// backplaneChannel is the notification channel envelopes travel on
+	backplaneChannel = "converse_backplane"
+	// maxNotifyPart is how much of an envelope one notification carries.
+	// Postgres refuses payloads from 8000 bytes on, so larger envelopes are
+	// split into parts sent in one transaction.
+	maxNotifyPart = 7000
+	// listenerPingInterval is how often the listening connection is checked,
+	// as a dead one isn't noticed otherwise while nothing is sent
+	listenerPingInterval = 90 * time.Second
+)
+
+// PostgresBackplane passes envelopes between instances with LISTEN/NOTIFY on
+// the database they share. Envelopes sent while an instance's listening
+// connection is down are lost to it. It serves a single manager.
+type PostgresBackplane struct {
+	db       *database.PostgresDB
+	listener *pq.Listener
+}
+
+// NewPostgresBackplane starts listening for envelopes on db
+func NewPostgresBackplane(db *database.PostgresDB) (*PostgresBackplane, error) {
+	listener := db.NewListener(func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Warn("Backplane connection problem: %v", err)
+		}
+	})
+	if err := listener.Listen(backplaneChannel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return &PostgresBackplane{db: db, listener: listener}, nil
+}
+
+// Publish notifies every listening instance of envelope
+func (b *PostgresBackplane) Publish(envelope Envelope) error {
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	notifications := splitNotification(string(payload), maxNotifyPart)
+	if len(notifications) == 1 {
+		_, err := b.db.Exec("SELECT pg_notify($1, $2)", backplaneChannel, notifications[0])
+		return err
+	}
+
+	// The notifications of a transaction are delivered together and in order
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, notification := range notifications {
+		if _, err := tx.Exec("SELECT pg_notify($1, $2)", backplaneChannel, notification); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Subscribe hands every envelope received from now on to receive, one at a
+// time
+func (b *PostgresBackplane) Subscribe(receive func(Envelope)) {
+	go b.listen(receive)
+}
+
+// Close stops listening
+func (b *PostgresBackplane) Close() error {
+	return b.listener.Close()
+}
+
+// listen receives notifications until the listener is closed
+func (b *PostgresBackplane) listen(receive func(Envelope)) {
+	parts := newNotificationParts()
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case notification, ok := <-b.listener.Notify:
+			if !ok {
+				return
+			}
+			if notification == nil {
+				// The connection was reestablished; whatever was sent while
+				// it was down is gone
+				log.Warn("Backplane reconnected, envelopes may have been lost")
+				parts.reset()
+				continue
+			}
+
+			payload, ok := parts.add(notification.Extra)
+			if !ok {
+				continue
+			}
+
+			var envelope Envelope
+			if err := json.Unmarshal([]byte(payload), &envelope); err != nil {
+				log.Error("Invalid backplane envelope: %v", err)
+				continue
+			}
+			receive(envelope)
+		case <-ticker.C:
+			go b.listener.Ping()
+		}
+	}
+}
+
+// splitNotification splits payload into notifications carrying at most size
+// bytes of it. A payload that fits is sent as is; parts are prefixed with
+// "<id> <index> <count> ". payload must be ASCII, as JSON envelopes are.
+func splitNotification(payload string, size int) []string {
+	if len(payload) <= size {
+		return []string{payload}
+	}
+
+	id := uuid.NewString()
+	count := (len(payload) + size - 1) / size
+	notifications := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		end := min((i+1)*size, len(payload))
+		notifications = append(notifications, fmt.Sprintf("%s %d %d %s", id, i, count, payload[i*size:end]))
+	}
+	return notifications
+}
+
+// notificationParts puts split envelopes back together
+type notificationParts struct {
+	pending map[string][]string
+}
+
+func newNotificationParts() *notificationParts {
+	return &notificationParts{pending: make(map[string][]string)}
+}
+
+// add takes a notification and returns the payload it completes, if any
+func (p *notificationParts) add(notification string) (string, bool) {
+	if strings.HasPrefix(notification, "{") {
+		return notification, true
+	}
+
+	fields := strings.SplitN(notification, " ", 4)
+	if len(fields) != 4 {
+		log.Error("Invalid backplane notification")
+		return "", false
+	}
+	index, err := strconv.Atoi(fields[1])
+	if err != nil {
+		log.Error("Invalid backplane notification part: %v", err)
+		return "", false
+	}
+	count, err := strconv.Atoi(fields[2])
+	if err != nil || index < 0 || index >= count {
+		log.Error("Invalid backplane notification part %d of %s", index, fields[2])
+		return "", false
+	}
+
+	id := fields[0]
+	parts, ok := p.pending[id]
+	if !ok {
+		parts = make([]string, count)
+		p.pending[id] = parts
+	}
+	if len(parts) != count {
+		log.Error("Backplane notification %s has parts of different counts", id)
+		delete(p.pending, id)
+		return "", false
+	}
+	parts[index] = fields[3]
+
+	for _, part := range parts {
+		if part == "" {
+			return "", false
+		}
+	}
+	delete(p.pending, id)
+	return strings.Join(parts, ""), true
+}
+
+// reset drops the envelopes still missing parts
+func (p *notificationParts) reset() {
+	clear(p.pending)
+}
@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/database"
+)
+
+// TestSplitNotification tests that envelopes too large for one notification
+// are split and put back together
+func TestSplitNotification(t *testing.T) {
+	small := `{"user_id":"x"}`
+	assert.Equal(t, []string{small}, splitNotification(small, 100))
+
+	payload := `{"frame":"` + strings.Repeat("abcdefghij", 25) + `"}`
+	notifications := splitNotification(payload, 100)
+	require.Len(t, notifications, 3)
+
+	// Parts of two envelopes may interleave and arrive in any order
+	other := splitNotification(`{"frame":"`+strings.Repeat("z", 150)+`"}`, 100)
+	require.Len(t, other, 2)
+
+	parts := newNotificationParts()
+	for _, notification := range []string{notifications[2], other[1], notifications[0]} {
+		_, ok := parts.add(notification)
+		assert.False(t, ok)
+	}
+	assembled, ok := parts.add(notifications[1])
+	require.True(t, ok)
+	assert.Equal(t, payload, assembled)
+
+	assembled, ok = parts.add(other[0])
+	require.True(t, ok)
+	assert.True(t, strings.HasSuffix(assembled, `z"}`))
+	assert.Empty(t, parts.pending)
+
+	for _, bad := range []string{"nope", "id x 2 data", "id 2 2 data", "id 0 x data"} {
+		_, ok := parts.add(bad)
+		assert.False(t, ok, bad)
+	}
+
+	// Parts left over from before a reconnection are dropped
+	parts.add(notifications[0])
+	parts.reset()
+	assert.Empty(t, parts.pending)
+}
+
+// TestPostgresBackplane tests passing envelopes, small and large, between two
+// backplanes on the same database
+func TestPostgresBackplane(t *testing.T) {
+	connStr := os.Getenv("POSTGRES_TEST_DSN")
+	if connStr == "" {
+		connStr = "postgres://localhost:5432/converse_test?sslmode=disable"
+	}
+	db, err := database.NewPostgresDB(connStr)
+	if err != nil {
+		t.Skipf("Postgres test database not available: %v", err)
+	}
+	defer db.Close()
+
+	publisher, err := NewPostgresBackplane(db)
+	require.NoError(t, err)
+	defer publisher.Close()
+	subscriber, err := NewPostgresBackplane(db)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	received := make(chan Envelope, 10)
+	subscriber.Subscribe(func(envelope Envelope) {
+		received <- envelope
+	})
+
+	userID := uuid.New()
+	large := []byte(`{"content":"` + strings.Repeat("x", 3*maxNotifyPart) + `"}`)
+	for _, envelope := range []Envelope{
+		{UserID: userID, Seq: 7, Frame: []byte(`{"type":"message"}`)},
+		{UserID: userID, Frame: large},
+		{UserID: userID, Disconnect: ScopeUser},
+	} {
+		require.NoError(t, publisher.Publish(envelope))
+
+		select {
+		case got := <-received:
+			assert.Equal(t, envelope, got)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for envelope")
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// DefaultAwayAfter is how long a user's connections can go without a frame
+// from the client before the user shows as away
+const DefaultAwayAfter = 5 * time.Minute
+
+// PresenceReport is what an instance tells the others about the status of
+// the users connected to it
+type PresenceReport struct {
+	InstanceID uuid.UUID `json:"instance_id"`
+	// Statuses holds the users whose status on the instance changed. A full
+	// report lists every user connected to the instance instead, and the
+	// users it leaves out are offline there.
+	Statuses map[uuid.UUID]models.PresenceStatus `json:"statuses,omitempty"`
+	Full     bool                                `json:"full,omitempty"`
+}
+
+// instancePresence is what an instance reported last
+type instancePresence struct {
+	statuses map[uuid.UUID]models.PresenceStatus
+	heardAt  time.Time
+}
+
+// Presence returns the current status of a user, across every instance
+func (m *Manager) Presence(userID uuid.UUID) models.PresenceStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// This instance's own report may lag behind its connections
+	status := m.statusLocked(userID, time.Now())
+	for instanceID, instance := range m.instances {
+		if instanceID != m.instanceID {
+			status = morePresent(status, instance.statuses[userID])
+		}
+	}
+	return status
+}
+
+// statusLocked works out a user's status from their connections to this
+// instance: online if any of them is active, away if all are idle and
+// offline if there are none. The caller must hold m.mutex.
+func (m *Manager) statusLocked(userID uuid.UUID, now time.Time) models.PresenceStatus {
+	conns, ok := m.clients[userID]
+	if !ok || len(conns) == 0 {
+		return models.PresenceOffline
+	}
+
+	for _, client := range conns {
+		if !client.away && now.Sub(client.lastActive) < m.AwayAfter {
+			return models.PresenceOnline
+		}
+	}
+	return models.PresenceAway
+}
+
+// sharedStatusLocked works out a user's status from what every instance
+// reported: the most present of them. The caller must hold m.mutex.
+func (m *Manager) sharedStatusLocked(userID uuid.UUID) models.PresenceStatus {
+	status := models.PresenceOffline
+	for _, instance := range m.instances {
+		status = morePresent(status, instance.statuses[userID])
+	}
+	return status
+}
+
+// morePresent returns whichever of two statuses shows the user as more
+// present: online, then away, then offline
+func morePresent(a, b models.PresenceStatus) models.PresenceStatus {
+	if a == models.PresenceOnline || b == models.PresenceOnline {
+		return models.PresenceOnline
+	}
+	if a == models.PresenceAway || b == models.PresenceAway {
+		return models.PresenceAway
+	}
+	return models.PresenceOffline
+}
+
+// markActive records a frame from the client. away is set when the client
+// says its user stepped away, such as when its window loses focus.
+func (m *Manager) markActive(c *Client, away bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	c.lastActive = time.Now()
+	c.away = away
+	if m.statusLocked(c.ID, c.lastActive) != m.reportedLocked(c.ID) {
+		m.presenceChangedLocked(c.ID)
+	}
+}
+
+// reportedLocked returns the status this instance last reported for a user.
+// The caller must hold m.mutex.
+func (m *Manager) reportedLocked(userID uuid.UUID) models.PresenceStatus {
+	if status, ok := m.reported[userID]; ok {
+		return status
+	}
+	return models.PresenceOffline
+}
+
+// announcedLocked returns the status last broadcast for a user. The caller
+// must hold m.mutex.
+func (m *Manager) announcedLocked(userID uuid.UUID) models.PresenceStatus {
+	if status, ok := m.presence[userID]; ok {
+		return status
+	}
+	return models.PresenceOffline
+}
+
+// presenceChangedLocked asks the presence worker to check a user's status.
+// The caller must hold m.mutex.
+func (m *Manager) presenceChangedLocked(userID uuid.UUID) {
+	m.presenceChanged[userID] = true
+	select {
+	case m.presenceWake <- struct{}{}:
+	default:
+	}
+}
+
+// runPresence reports status changes as connections come and go, and now
+// and then reports every connected user, which notices the ones gone idle
+// and tells the other instances this one is still up
+func (m *Manager) runPresence() {
+	ticker := time.NewTicker(m.AwayAfter / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.presenceWake:
+			m.updatePresence(false)
+		case <-ticker.C:
+			m.updatePresence(true)
+		}
+	}
+}
+
+// updatePresence reports the users whose status on this instance changed to
+// every instance. Only users marked as changed are checked unless all is
+// set, in which case every connected user is reported and the reports of
+// instances that stopped sending them are dropped.
+func (m *Manager) updatePresence(all bool) {
+	now := time.Now()
+	report := PresenceReport{InstanceID: m.instanceID, Statuses: make(map[uuid.UUID]models.PresenceStatus), Full: all}
+
+	m.mutex.Lock()
+	if all {
+		for userID := range m.clients {
+			m.presenceChanged[userID] = true
+		}
+		for userID := range m.reported {
+			m.presenceChanged[userID] = true
+		}
+	}
+	for userID := range m.presenceChanged {
+		status := m.statusLocked(userID, now)
+		if status == m.reportedLocked(userID) && !all {
+			continue
+		}
+		if status == models.PresenceOffline {
+			delete(m.reported, userID)
+			if all {
+				continue
+			}
+		} else {
+			m.reported[userID] = status
+		}
+		report.Statuses[userID] = status
+	}
+	clear(m.presenceChanged)
+
+	var changes []models.Presence
+	if all {
+		changes = m.expireInstancesLocked(now)
+	}
+	m.mutex.Unlock()
+
+	for _, change := range changes {
+		m.broadcastPresence(change, now)
+	}
+	if len(report.Statuses) > 0 || all {
+		m.publishPresence(report)
+	}
+}
+
+// publishPresence hands a report to every instance. If the backplane fails
+// this instance still takes the report in; the others catch up with the
+// next full report.
+func (m *Manager) publishPresence(report PresenceReport) {
+	if err := m.backplane.Publish(Envelope{Presence: &report}); err != nil {
+		log.Error("Failed to publish presence: %v", err)
+		m.receivePresence(report)
+	}
+}
+
+// receivePresence records an instance's report and works out which users it
+// changes the status of. The instance that sent the report is the one that
+// tells their partners, so they hear it once.
+func (m *Manager) receivePresence(report PresenceReport) {
+	now := time.Now()
+
+	m.mutex.Lock()
+	instance, ok := m.instances[report.InstanceID]
+	if !ok {
+		instance = &instancePresence{statuses: make(map[uuid.UUID]models.PresenceStatus)}
+		m.instances[report.InstanceID] = instance
+	}
+	instance.heardAt = now
+
+	affected := make(map[uuid.UUID]bool, len(report.Statuses))
+	if report.Full {
+		for userID := range instance.statuses {
+			affected[userID] = true
+		}
+		clear(instance.statuses)
+	}
+	for userID, status := range report.Statuses {
+		affected[userID] = true
+		if status == models.PresenceOffline {
+			delete(instance.statuses, userID)
+		} else {
+			instance.statuses[userID] = status
+		}
+	}
+
+	var changes []models.Presence
+	for userID := range affected {
+		if change, ok := m.announceLocked(userID); ok && report.InstanceID == m.instanceID {
+			changes = append(changes, change)
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, change := range changes {
+		m.broadcastPresence(change, now)
+	}
+}
+
+// expireInstancesLocked drops the reports of instances that haven't sent a
+// full one for three rounds, as they are gone, and returns the changes in
+// status that follow. Every instance notices, but only the one with the
+// lowest ID returns the changes for broadcasting. The caller must hold
+// m.mutex.
+func (m *Manager) expireInstancesLocked(now time.Time) []models.Presence {
+	ttl := 3 * m.AwayAfter / 4
+	affected := make(map[uuid.UUID]bool)
+	for instanceID, instance := range m.instances {
+		if instanceID == m.instanceID || now.Sub(instance.heardAt) < ttl {
+			continue
+		}
+		log.Warn("Instance %s stopped reporting presence, its users are offline", instanceID)
+		for userID := range instance.statuses {
+			affected[userID] = true
+		}
+		delete(m.instances, instanceID)
+	}
+
+	leads := true
+	for instanceID := range m.instances {
+		if bytes.Compare(instanceID[:], m.instanceID[:]) < 0 {
+			leads = false
+		}
+	}
+
+	var changes []models.Presence
+	for userID := range affected {
+		if change, ok := m.announceLocked(userID); ok && leads {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// announceLocked records a user's status across instances as announced and
+// reports whether it changed. The caller must hold m.mutex.
+func (m *Manager) announceLocked(userID uuid.UUID) (models.Presence, bool) {
+	status := m.sharedStatusLocked(userID)
+	if status == m.announcedLocked(userID) {
+		return models.Presence{}, false
+	}
+	if status == models.PresenceOffline {
+		delete(m.presence, userID)
+	} else {
+		m.presence[userID] = status
+	}
+	return models.Presence{UserID: userID, Status: status}, true
+}
+
+// broadcastPresence tells a user's conversation partners about their new
+// status. Going offline also records when the user was last seen.
+func (m *Manager) broadcastPresence(change models.Presence, now time.Time) {
+	message := WebSocketMessage{
+		Type:      MessageTypePresence,
+		UserID:    change.UserID,
+		Status:    change.Status,
+		Timestamp: now,
+	}
+
+	if change.Status == models.PresenceOffline {
+		if err := m.db.UpdateLastSeen(change.UserID); err != nil && err != database.ErrUserNotFound {
+			log.Error("Failed to update last seen of user %s: %v", change.UserID, err)
+		}
+		message.LastSeen = &now
+	}
+
+	partners, err := m.db.GetConversationPartners(change.UserID)
+	if err != nil {
+		log.Error("Failed to load conversation partners of user %s: %v", change.UserID, err)
+		return
+	}
+
+	log.Debug("User %s is %s, telling %d partners", change.UserID, change.Status, len(partners))
+	messageJSON, _ := json.Marshal(message)
+	m.SendToUsers(partners, uuid.Nil, messageJSON)
+}
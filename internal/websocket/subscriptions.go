@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/ammar1510/converse/internal/events"
+)
+
+// subscribe makes the manager deliver the messages and read receipts
+// published on bus and close the connections of revoked sessions and deleted
+// accounts
+func (m *Manager) subscribe(bus *events.Bus) {
+	events.Subscribe(bus, m.messageCreated)
+	events.Subscribe(bus, m.messageRead)
+	events.Subscribe(bus, func(e events.SessionRevoked) {
+		m.DisconnectSession(e.SessionID)
+	})
+	events.Subscribe(bus, func(e events.SessionsRevoked) {
+		if e.ExceptSessionID == uuid.Nil {
+			m.DisconnectUser(e.UserID)
+		} else {
+			m.DisconnectOtherSessions(e.UserID, e.ExceptSessionID)
+		}
+	})
+	events.Subscribe(bus, func(e events.UserDeleted) {
+		m.DisconnectUser(e.UserID)
+	})
+}
+
+// messageCreated delivers a new message to its receiver, or to every member
+// of its group, and to the sender's other devices
+func (m *Manager) messageCreated(e events.MessageCreated) {
+	message := e.Message
+	frame := NewChatMessage(message)
+
+	if message.ConversationID != nil {
+		group, err := m.db.GetGroupByID(*message.ConversationID)
+		if err != nil {
+			log.Error("Failed to load members of conversation %s: %v", *message.ConversationID, err)
+			return
+		}
+		m.DeliverToUsers(group.MemberIDs, e.ConnID, frame)
+		return
+	}
+
+	m.Deliver(message.ReceiverID, frame)
+	if message.SenderID != message.ReceiverID {
+		m.DeliverExcept(message.SenderID, e.ConnID, frame)
+	}
+}
+
+// messageRead tells the sender of a message that it was read
+func (m *Manager) messageRead(e events.MessageRead) {
+	m.Deliver(e.Message.SenderID, NewReadReceipt(e.Message, e.ReaderID))
+}
@@ -0,0 +1,89 @@
+package websocket
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ammar1510/converse/internal/database"
+	"github.com/ammar1510/converse/internal/events"
+	"github.com/ammar1510/converse/internal/models"
+)
+
+// TestSubscribe tests that the manager acts on the events published on its bus
+func TestSubscribe(t *testing.T) {
+	db := database.NewMemoryDB()
+	bus := events.NewBus()
+	manager := NewManager(db, bus)
+	go manager.Run()
+
+	server := httptest.NewServer(setupTestRouterWithManager(manager))
+	defer server.Close()
+
+	alice, err := db.CreateUser("alice", "alice@example.com", "hash")
+	require.NoError(t, err)
+	bob, err := db.CreateUser("bob", "bob@example.com", "hash")
+	require.NoError(t, err)
+
+	baseURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	now := time.Now()
+	laptopSession, phoneSession := uuid.New(), uuid.New()
+	for _, sessionID := range []uuid.UUID{laptopSession, phoneSession} {
+		require.NoError(t, db.CreateSession(&models.Session{ID: sessionID, UserID: alice.ID, CreatedAt: now, LastUsedAt: now}))
+	}
+	laptop, _ := createTestClient(t, baseURL+"/ws-session?user_id="+alice.ID.String()+"&session_id="+laptopSession.String())
+	defer laptop.Close()
+	phone, _ := createTestClient(t, baseURL+"/ws-session?user_id="+alice.ID.String()+"&session_id="+phoneSession.String())
+	defer phone.Close()
+	bobWS, _ := createTestClient(t, baseURL+"/ws-user?user_id="+bob.ID.String())
+	defer bobWS.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	// A message sent over REST reaches the receiver and all the sender's devices
+	message := &models.Message{ID: uuid.New(), SenderID: alice.ID, ReceiverID: bob.ID, Content: "hi bob", CreatedAt: time.Now().UTC()}
+	bus.Publish(events.MessageCreated{Message: message})
+	for _, ws := range []*websocket.Conn{bobWS, laptop, phone} {
+		received := readTestMessage(t, ws)
+		assert.Equal(t, MessageTypeMessage, received.Type)
+		assert.Equal(t, message.ID, received.MessageID)
+		assert.Equal(t, "hi bob", received.Content)
+	}
+
+	// The sender learns the message was read
+	bus.Publish(events.MessageRead{Message: message, ReaderID: bob.ID})
+	receipt := readTestMessage(t, laptop)
+	assert.Equal(t, MessageTypeReadReceipt, receipt.Type)
+	assert.Equal(t, message.ID, receipt.MessageID)
+	assert.Equal(t, bob.ID, receipt.SenderID)
+	assert.Equal(t, alice.ID, receipt.ReceiverID)
+	assert.Equal(t, MessageTypeReadReceipt, readTestMessage(t, phone).Type)
+
+	// Revoking the other sessions closes the laptop and keeps the phone
+	bus.Publish(events.SessionsRevoked{UserID: alice.ID, ExceptSessionID: phoneSession})
+	laptop.SetReadDeadline(time.Now().Add(1 * time.Second))
+	_, _, err = laptop.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNoStatusReceived), "unexpected error: %v", err)
+
+	// Deleting an account closes all its connections
+	bus.Publish(events.UserDeleted{UserID: bob.ID})
+	bobWS.SetReadDeadline(time.Now().Add(1 * time.Second))
+	_, _, err = bobWS.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNoStatusReceived), "unexpected error: %v", err)
+
+	manager.mutex.Lock()
+	assert.Len(t, manager.clients[alice.ID], 1)
+	assert.Empty(t, manager.clients[bob.ID])
+	manager.mutex.Unlock()
+
+	// Ending the last session closes the phone too
+	bus.Publish(events.SessionRevoked{UserID: alice.ID, SessionID: phoneSession})
+	phone.SetReadDeadline(time.Now().Add(1 * time.Second))
+	_, _, err = phone.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNoStatusReceived), "unexpected error: %v", err)
+}